@@ -0,0 +1,264 @@
+// Package admission contains the concurrency limiter with the bounded fair waiting queue.
+package admission
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned, when the waiting queue is full.
+	ErrQueueFull = errors.New("admission queue is full")
+
+	// ErrQueueTimeout is returned, when the waiting in the queue takes too long.
+	ErrQueueTimeout = errors.New("admission queue timeout exceeded")
+)
+
+// Limiter limits the count of concurrently processed (in-flight) requests. Requests over the limit wait in the
+// bounded queue. Each client has its own FIFO queue, and the freed slots are granted to the clients in the round-robin
+// order, so one client cannot take every slot. When the queue is full, the newest request of the client with the
+// longest queue is rejected in favor of the client with the shorter one.
+type Limiter struct {
+	limit     int
+	queueSize int
+	timeout   time.Duration // zero means "wait while the context is alive"
+
+	onEnqueue, onDequeue func() // queue hooks (e.g. for the metrics), called with the locked mutex
+
+	mu       sync.Mutex
+	inFlight int
+	queued   int
+	clients  map[string]*clientQueue
+	order    *list.List // round-robin order of the clients with the waiting requests (*clientQueue)
+}
+
+type clientQueue struct {
+	key     string
+	waiters *list.List    // FIFO (*waiter)
+	elem    *list.Element // position in the round-robin order
+}
+
+type waiterState int
+
+const (
+	waiting waiterState = iota
+	granted
+	dropped
+)
+
+type waiter struct {
+	ready  chan struct{} // closed, when the state is changed from "waiting"
+	state  waiterState
+	client *clientQueue
+	elem   *list.Element // position in the client queue
+}
+
+// Option allows to configure the Limiter.
+type Option func(*Limiter)
+
+// WithQueueHooks sets the functions, that are called, when the request starts waiting in the queue, and when it
+// leaves the queue (the slot is granted, or the waiting is failed). Requests, that take the free slot immediately,
+// are not queued. Hooks must be fast and must not call the limiter methods.
+func WithQueueHooks(onEnqueue, onDequeue func()) Option {
+	return func(l *Limiter) { l.onEnqueue, l.onDequeue = onEnqueue, onDequeue }
+}
+
+// New creates a new Limiter. Zero queue size means "reject the requests over the limit immediately", zero timeout -
+// "wait while the request context is alive".
+func New(limit, queueSize int, timeout time.Duration, opts ...Option) (*Limiter, error) {
+	if limit <= 0 {
+		return nil, errors.New("in-flight requests limit must be positive")
+	}
+
+	if queueSize < 0 || timeout < 0 {
+		return nil, errors.New("queue size and timeout must not be negative")
+	}
+
+	l := &Limiter{
+		limit:     limit,
+		queueSize: queueSize,
+		timeout:   timeout,
+		onEnqueue: func() {},
+		onDequeue: func() {},
+		clients:   make(map[string]*clientQueue),
+		order:     list.New(),
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l, nil
+}
+
+// Acquire takes a slot for the client request (waiting in the queue, if needed). The returned function must be
+// called to release the slot, when the request processing is finished.
+func (l *Limiter) Acquire(ctx context.Context, client string) (func(), error) {
+	l.mu.Lock()
+
+	if l.inFlight < l.limit && l.queued == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+
+		return l.releaseFunc(), nil
+	}
+
+	w, err := l.enqueue(client)
+
+	l.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var timeout <-chan time.Time
+
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+
+		timeout = timer.C
+	}
+
+	select {
+	case <-w.ready:
+	case <-timeout:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch w.state {
+	case granted:
+		if err != nil { // the slot was granted right after the timeout (or the context canceling)
+			l.release()
+
+			return nil, err
+		}
+
+		return l.releaseFunc(), nil
+
+	case dropped:
+		return nil, ErrQueueFull
+	}
+
+	l.remove(w)
+
+	return nil, err
+}
+
+// InFlight returns the count of in-flight requests.
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.inFlight
+}
+
+// Queued returns the count of waiting requests.
+func (l *Limiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.queued
+}
+
+// enqueue adds the client request into the queue. The mutex must be locked.
+func (l *Limiter) enqueue(key string) (*waiter, error) {
+	c, exists := l.clients[key]
+
+	if l.queued >= l.queueSize {
+		var (
+			longest *clientQueue
+			ownLen  int
+		)
+
+		if exists {
+			ownLen = c.waiters.Len()
+		}
+
+		for _, other := range l.clients {
+			if longest == nil || other.waiters.Len() > longest.waiters.Len() {
+				longest = other
+			}
+		}
+
+		if longest == nil || longest.waiters.Len() <= ownLen+1 {
+			return nil, ErrQueueFull
+		}
+
+		// the newest request of the greediest client is rejected
+		victim := longest.waiters.Back().Value.(*waiter) //nolint:forcetypeassert
+		l.remove(victim)
+		victim.state = dropped
+		close(victim.ready)
+
+		c, exists = l.clients[key] // the client queue could be removed
+	}
+
+	if !exists {
+		c = &clientQueue{key: key, waiters: list.New()}
+		c.elem = l.order.PushBack(c)
+		l.clients[key] = c
+	}
+
+	w := &waiter{ready: make(chan struct{}), client: c}
+	w.elem = c.waiters.PushBack(w)
+	l.queued++
+	l.onEnqueue()
+
+	return w, nil
+}
+
+// remove removes the waiting request from the queue. The mutex must be locked.
+func (l *Limiter) remove(w *waiter) {
+	c := w.client
+
+	c.waiters.Remove(w.elem)
+	l.queued--
+	l.onDequeue()
+
+	if c.waiters.Len() == 0 {
+		l.order.Remove(c.elem)
+		delete(l.clients, c.key)
+	}
+}
+
+func (l *Limiter) releaseFunc() func() {
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.release()
+			l.mu.Unlock()
+		})
+	}
+}
+
+// release frees the slot and grants the free slots to the waiting requests in the round-robin order. The mutex must
+// be locked.
+func (l *Limiter) release() {
+	l.inFlight--
+
+	for l.inFlight < l.limit && l.order.Len() > 0 {
+		c := l.order.Front().Value.(*clientQueue) //nolint:forcetypeassert
+		w := c.waiters.Front().Value.(*waiter)    //nolint:forcetypeassert
+
+		l.remove(w)
+
+		if c.waiters.Len() > 0 { // the client goes to the end of the line
+			l.order.MoveToBack(c.elem)
+		}
+
+		l.inFlight++
+		w.state = granted
+		close(w.ready)
+	}
+}
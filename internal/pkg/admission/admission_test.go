@@ -0,0 +1,246 @@
+package admission_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/admission"
+)
+
+func newLimiter(t *testing.T, limit, queueSize int, timeout time.Duration) *admission.Limiter {
+	t.Helper()
+
+	l, err := admission.New(limit, queueSize, timeout)
+	assert.NoError(t, err)
+
+	return l
+}
+
+// waitQueued waits until the limiter has the expected count of waiting requests.
+func waitQueued(t *testing.T, l *admission.Limiter, n int) {
+	t.Helper()
+
+	assert.Eventually(t, func() bool { return l.Queued() == n }, time.Second, time.Millisecond)
+}
+
+func TestLimiter_Acquire(t *testing.T) {
+	l := newLimiter(t, 2, 1, 0)
+
+	release1, err := l.Acquire(context.Background(), "foo")
+	assert.NoError(t, err)
+
+	_, err = l.Acquire(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, l.InFlight())
+
+	acquired := make(chan error, 1)
+
+	go func() {
+		_, acquireErr := l.Acquire(context.Background(), "foo")
+		acquired <- acquireErr
+	}()
+
+	waitQueued(t, l, 1)
+
+	_, err = l.Acquire(context.Background(), "foo")
+	assert.ErrorIs(t, err, admission.ErrQueueFull)
+
+	release1()
+	release1() // must be idempotent
+
+	assert.NoError(t, <-acquired)
+	assert.Equal(t, 2, l.InFlight())
+	assert.Equal(t, 0, l.Queued())
+}
+
+func TestLimiter_AcquireWithoutQueue(t *testing.T) {
+	l := newLimiter(t, 1, 0, 0)
+
+	_, err := l.Acquire(context.Background(), "foo")
+	assert.NoError(t, err)
+
+	_, err = l.Acquire(context.Background(), "foo")
+	assert.ErrorIs(t, err, admission.ErrQueueFull)
+}
+
+func TestLimiter_AcquireTimeout(t *testing.T) {
+	l := newLimiter(t, 1, 1, time.Millisecond*10)
+
+	_, err := l.Acquire(context.Background(), "foo")
+	assert.NoError(t, err)
+
+	_, err = l.Acquire(context.Background(), "foo")
+	assert.ErrorIs(t, err, admission.ErrQueueTimeout)
+	assert.Equal(t, 0, l.Queued())
+	assert.Equal(t, 1, l.InFlight())
+}
+
+func TestLimiter_AcquireCanceled(t *testing.T) {
+	l := newLimiter(t, 1, 1, 0)
+
+	_, err := l.Acquire(context.Background(), "foo")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	_, err = l.Acquire(ctx, "foo")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, l.Queued())
+}
+
+func TestLimiter_Fairness(t *testing.T) {
+	l := newLimiter(t, 1, 10, 0)
+
+	release, err := l.Acquire(context.Background(), "greedy")
+	assert.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+
+	enqueue := func(client string, queued int) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			r, acquireErr := l.Acquire(context.Background(), client)
+			assert.NoError(t, acquireErr)
+
+			mu.Lock()
+			order = append(order, client)
+			mu.Unlock()
+
+			r()
+		}()
+
+		waitQueued(t, l, queued)
+	}
+
+	enqueue("greedy", 1)
+	enqueue("greedy", 2)
+	enqueue("greedy", 3)
+	enqueue("polite", 4)
+
+	release()
+	wg.Wait()
+
+	assert.Equal(t, []string{"greedy", "polite", "greedy", "greedy"}, order)
+}
+
+func TestLimiter_QueueFullFairness(t *testing.T) {
+	l := newLimiter(t, 1, 3, 0)
+
+	release, err := l.Acquire(context.Background(), "greedy")
+	assert.NoError(t, err)
+
+	results := make(chan error, 3)
+
+	for i := 1; i <= 3; i++ {
+		go func() {
+			r, acquireErr := l.Acquire(context.Background(), "greedy")
+			if r != nil {
+				defer r()
+			}
+
+			results <- acquireErr
+		}()
+
+		waitQueued(t, l, i)
+	}
+
+	_, err = l.Acquire(context.Background(), "greedy")
+	assert.ErrorIs(t, err, admission.ErrQueueFull, "greedy client must not extend the full queue")
+
+	politeAcquired := make(chan error, 1)
+
+	go func() {
+		r, acquireErr := l.Acquire(context.Background(), "polite")
+		if r != nil {
+			defer r()
+		}
+
+		politeAcquired <- acquireErr
+	}()
+
+	assert.ErrorIs(t, <-results, admission.ErrQueueFull, "the newest greedy request must be rejected")
+
+	release()
+
+	assert.NoError(t, <-politeAcquired)
+	assert.NoError(t, <-results)
+	assert.NoError(t, <-results)
+}
+
+func TestLimiter_QueueHooks(t *testing.T) {
+	var enqueued, dequeued int32
+
+	l, err := admission.New(1, 1, 0, admission.WithQueueHooks(
+		func() { atomic.AddInt32(&enqueued, 1) },
+		func() { atomic.AddInt32(&dequeued, 1) },
+	))
+	assert.NoError(t, err)
+
+	release, err := l.Acquire(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&enqueued), "the free slot must be taken without the queueing")
+
+	acquired := make(chan error, 1)
+
+	go func() {
+		_, acquireErr := l.Acquire(context.Background(), "bar")
+		acquired <- acquireErr
+	}()
+
+	waitQueued(t, l, 1)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&enqueued))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&dequeued))
+
+	_, err = l.Acquire(context.Background(), "bar") // rejected (the queue is full)
+	assert.ErrorIs(t, err, admission.ErrQueueFull)
+
+	release()
+
+	assert.NoError(t, <-acquired)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&enqueued))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&dequeued))
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := admission.New(0, 1, time.Second)
+	assert.Error(t, err)
+
+	_, err = admission.New(1, -1, time.Second)
+	assert.Error(t, err)
+
+	_, err = admission.NewGroup(1, 1, -time.Second)
+	assert.Error(t, err)
+}
+
+func TestGroup_Acquire(t *testing.T) {
+	g, err := admission.NewGroup(1, 0, 0)
+	assert.NoError(t, err)
+
+	releaseFoo, err := g.Acquire(context.Background(), "foo.com", "client")
+	assert.NoError(t, err)
+
+	_, err = g.Acquire(context.Background(), "foo.com", "client")
+	assert.ErrorIs(t, err, admission.ErrQueueFull)
+
+	releaseBar, err := g.Acquire(context.Background(), "bar.com", "client")
+	assert.NoError(t, err, "keys must have separate limiters")
+	assert.Equal(t, 2, g.Len())
+
+	releaseFoo()
+	releaseBar()
+
+	assert.Equal(t, 0, g.Len(), "unused limiters must be removed")
+}
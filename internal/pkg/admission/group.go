@@ -0,0 +1,89 @@
+package admission
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Group is a set of the limiters with the same settings, one per key (e.g. upstream host). Limiters are created on
+// demand and removed, when they are not used, so the memory usage is bounded by the count of active keys.
+type Group struct {
+	limit     int
+	queueSize int
+	timeout   time.Duration
+	opts      []Option
+
+	mu       sync.Mutex
+	limiters map[string]*groupEntry
+}
+
+type groupEntry struct {
+	limiter *Limiter
+	refs    int // the count of in-flight and waiting requests
+}
+
+// NewGroup creates a new Group. Arguments have the same meaning as for the New function (options are applied to
+// each limiter of the group).
+func NewGroup(limit, queueSize int, timeout time.Duration, opts ...Option) (*Group, error) {
+	if _, err := New(limit, queueSize, timeout); err != nil { // arguments validation
+		return nil, err
+	}
+
+	return &Group{
+		limit:     limit,
+		queueSize: queueSize,
+		timeout:   timeout,
+		opts:      opts,
+		limiters:  make(map[string]*groupEntry),
+	}, nil
+}
+
+// Acquire takes a slot of the key limiter for the client request (see Limiter.Acquire).
+func (g *Group) Acquire(ctx context.Context, key, client string) (func(), error) {
+	g.mu.Lock()
+
+	e, exists := g.limiters[key]
+	if !exists {
+		l, _ := New(g.limit, g.queueSize, g.timeout, g.opts...) // arguments are already validated
+
+		e = &groupEntry{limiter: l}
+		g.limiters[key] = e
+	}
+
+	e.refs++
+	g.mu.Unlock()
+
+	release, err := e.limiter.Acquire(ctx, client)
+	if err != nil {
+		g.unref(key, e)
+
+		return nil, err
+	}
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			release()
+			g.unref(key, e)
+		})
+	}, nil
+}
+
+// Len returns the count of the active limiters.
+func (g *Group) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return len(g.limiters)
+}
+
+func (g *Group) unref(key string, e *groupEntry) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if e.refs--; e.refs == 0 {
+		delete(g.limiters, key)
+	}
+}
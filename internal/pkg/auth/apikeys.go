@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// APIKeys authenticates the requests using static API keys, passed in the header or the query parameter.
+type APIKeys struct {
+	keys       [][sha256.Size]byte // hashes, so the comparison time does not depend on the key length
+	header     string              // empty means "do not check the header"
+	queryParam string              // empty means "do not check the query parameter"
+}
+
+// NewAPIKeys creates APIKeys authenticator. Empty keys are ignored.
+func NewAPIKeys(keys []string, header, queryParam string) *APIKeys {
+	a := &APIKeys{header: header, queryParam: queryParam, keys: make([][sha256.Size]byte, 0, len(keys))}
+
+	for _, key := range keys {
+		if key != "" {
+			a.keys = append(a.keys, sha256.Sum256([]byte(key)))
+		}
+	}
+
+	return a
+}
+
+// Authenticate implements Authenticator interface. The user name is the API key index (like "api-key-1").
+func (a *APIKeys) Authenticate(r *http.Request) (Identity, bool) {
+	if a.header != "" {
+		if idx, ok := a.match(r.Header.Get(a.header)); ok {
+			return Identity{User: "api-key-" + strconv.Itoa(idx+1)}, true
+		}
+	}
+
+	if a.queryParam != "" {
+		if idx, ok := a.match(r.URL.Query().Get(a.queryParam)); ok {
+			return Identity{User: "api-key-" + strconv.Itoa(idx+1)}, true
+		}
+	}
+
+	return Identity{}, false
+}
+
+func (a *APIKeys) match(key string) (int, bool) {
+	if key == "" {
+		return 0, false
+	}
+
+	var (
+		hash  = sha256.Sum256([]byte(key))
+		found = -1
+	)
+
+	for i := range a.keys { // all the keys are compared to avoid timing attacks
+		if subtle.ConstantTimeCompare(hash[:], a.keys[i][:]) == 1 {
+			found = i
+		}
+	}
+
+	return found, found >= 0
+}
+
+// Strip implements Authenticator interface.
+func (a *APIKeys) Strip(r *http.Request) {
+	if a.header != "" {
+		r.Header.Del(a.header)
+	}
+
+	if a.queryParam != "" && r.URL.RawQuery != "" {
+		r.URL.RawQuery = removeQueryParam(r.URL.RawQuery, a.queryParam)
+	}
+}
+
+// removeQueryParam removes the parameter from the raw query, keeping the order of other parameters as is.
+func removeQueryParam(rawQuery, name string) string {
+	var parts = strings.Split(rawQuery, "&")
+
+	result := parts[:0]
+
+	for _, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+
+		if k, err := url.QueryUnescape(key); err == nil && k == name {
+			continue
+		}
+
+		result = append(result, part)
+	}
+
+	return strings.Join(result, "&")
+}
@@ -0,0 +1,53 @@
+package auth_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+)
+
+func TestAPIKeys_Authenticate(t *testing.T) {
+	a := auth.NewAPIKeys([]string{"foo", "", "bar"}, "X-Api-Key", "api_key")
+
+	for _, tt := range []struct {
+		name     string
+		giveURL  string
+		giveKey  string
+		wantUser string
+		wantOK   bool
+	}{
+		{name: "header", giveURL: "http://testing/", giveKey: "bar", wantUser: "api-key-2", wantOK: true},
+		{name: "query parameter", giveURL: "http://testing/?api_key=foo", wantUser: "api-key-1", wantOK: true},
+		{name: "wrong key", giveURL: "http://testing/?api_key=baz", giveKey: "baz"},
+		{name: "no key", giveURL: "http://testing/"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, tt.giveURL, http.NoBody)
+
+			if tt.giveKey != "" {
+				req.Header.Set("X-Api-Key", tt.giveKey)
+			}
+
+			identity, ok := a.Authenticate(req)
+
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantUser, identity.User)
+		})
+	}
+}
+
+func TestAPIKeys_Strip(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://testing/?b=1&api_key=foo&a=2&api%5Fkey=bar", http.NoBody)
+	req.Header.Set("X-Api-Key", "foo")
+	req.Header.Set("X-Foo", "bar")
+
+	auth.NewAPIKeys([]string{"foo"}, "X-Api-Key", "api_key").Strip(req)
+
+	assert.Equal(t, "b=1&a=2", req.URL.RawQuery) // the order must be kept
+	assert.Empty(t, req.Header.Get("X-Api-Key"))
+	assert.Equal(t, "bar", req.Header.Get("X-Foo"))
+}
@@ -0,0 +1,20 @@
+// Package auth contains the proxy clients authenticators (API keys, htpasswd file backed Basic auth, JWT bearer
+// tokens) and the permissions of the authenticated clients.
+package auth
+
+import "net/http"
+
+// Authenticator checks the request credentials.
+type Authenticator interface {
+	// Authenticate returns the authenticated client identity, if the request contains valid credentials.
+	Authenticate(r *http.Request) (Identity, bool)
+
+	// Strip removes the credentials from the request (they must not be forwarded to the upstream).
+	Strip(r *http.Request)
+}
+
+// Identity is the authenticated client.
+type Identity struct {
+	User        string       // user name, credentials identifier or the token subject
+	Permissions *Permissions // nil means "everything is allowed"
+}
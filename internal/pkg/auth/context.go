@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/realip"
+)
+
+type (
+	permissionsKey struct{}
+	userHolderKey  struct{}
+)
+
+// userHolder allows to pass the authenticated user name to the outer handlers (like the requests logger).
+type userHolder struct {
+	mu   sync.Mutex
+	user string
+}
+
+// WithPermissions returns a copy of the context with the client permissions.
+func WithPermissions(ctx context.Context, p *Permissions) context.Context {
+	return context.WithValue(ctx, permissionsKey{}, p)
+}
+
+// PermissionsFromContext returns the client permissions. Nil is returned (which means "everything is allowed"), if
+// the context has no permissions.
+func PermissionsFromContext(ctx context.Context) *Permissions {
+	p, _ := ctx.Value(permissionsKey{}).(*Permissions)
+
+	return p
+}
+
+// WithUserHolder returns a copy of the context, where the authenticated user name can be stored by the inner
+// handlers (using the SetUser function) and read later by the caller (using the UserFromContext function). The user,
+// authenticated already by the outer request (like the CONNECT tunnel one), is inherited.
+func WithUserHolder(ctx context.Context) context.Context {
+	return context.WithValue(ctx, userHolderKey{}, &userHolder{user: UserFromContext(ctx)})
+}
+
+// SetUser stores the authenticated user name into the context, created by the WithUserHolder function. Otherwise, it
+// does nothing.
+func SetUser(ctx context.Context, user string) {
+	if h, ok := ctx.Value(userHolderKey{}).(*userHolder); ok {
+		h.mu.Lock()
+		h.user = user
+		h.mu.Unlock()
+	}
+}
+
+// UserFromContext returns the authenticated user name (empty string, if the request was not authenticated).
+func UserFromContext(ctx context.Context) string {
+	if h, ok := ctx.Value(userHolderKey{}).(*userHolder); ok {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		return h.user
+	}
+
+	return ""
+}
+
+// ipv6ClientMask is the IPv6 client network prefix (a single subscriber usually gets the whole /64 network, so the
+// addresses inside it must not be treated as the different clients).
+var ipv6ClientMask = net.CIDRMask(64, 128) //nolint:gomnd
+
+// ClientID returns the client identifier: the authenticated user name (if the request was authenticated and the
+// context was created by the WithUserHolder function) or the client IP address (the client IP headers are trusted for
+// the requests from the trusted proxies networks only). IPv6 addresses are aggregated to the /64 networks.
+func ClientID(r *http.Request, trustedProxies []*net.IPNet) string {
+	if user := UserFromContext(r.Context()); user != "" {
+		return "user:" + user
+	}
+
+	var addr = realip.FromTrustedHTTPRequest(r, trustedProxies)
+
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		return "ip:" + (&net.IPNet{IP: ip.Mask(ipv6ClientMask), Mask: ipv6ClientMask}).String()
+	}
+
+	return "ip:" + addr
+}
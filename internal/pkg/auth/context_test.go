@@ -0,0 +1,44 @@
+package auth_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+)
+
+func TestClientID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req.RemoteAddr = "1.2.3.4:567"
+	req.Header.Set("X-Forwarded-For", "5.5.5.5")
+
+	assert.Equal(t, "ip:1.2.3.4", auth.ClientID(req, nil), "the client IP headers must not be trusted")
+
+	_, trusted, _ := net.ParseCIDR("1.2.3.0/24")
+	assert.Equal(t, "ip:5.5.5.5", auth.ClientID(req, []*net.IPNet{trusted}))
+
+	req.RemoteAddr = "[2001:db8:1:2:3:4:5:6]:567" // IPv6 clients are aggregated to the /64 networks
+	assert.Equal(t, "ip:2001:db8:1:2::/64", auth.ClientID(req, nil))
+
+	req.RemoteAddr = "[2001:db8:1:2:aaaa::1]:567"
+	assert.Equal(t, "ip:2001:db8:1:2::/64", auth.ClientID(req, nil))
+
+	req.RemoteAddr = "1.2.3.4:567"
+
+	auth.SetUser(req.Context(), "alice") // no user holder - nothing happens
+	assert.Equal(t, "ip:1.2.3.4", auth.ClientID(req, nil))
+
+	req = req.WithContext(auth.WithUserHolder(req.Context()))
+	auth.SetUser(req.Context(), "alice")
+
+	assert.Equal(t, "user:alice", auth.ClientID(req, nil))
+	assert.Equal(t, "alice", auth.UserFromContext(req.Context()))
+
+	// the user of the outer request (like the CONNECT tunnel) is inherited by the inner holder
+	req = req.WithContext(auth.WithUserHolder(req.Context()))
+	assert.Equal(t, "user:alice", auth.ClientID(req, nil))
+}
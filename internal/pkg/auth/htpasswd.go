@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" //nolint:gosec // SHA1 is used by the htpasswd format
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/filereload"
+)
+
+// Htpasswd authenticates the requests using the Basic auth credentials, checked against the htpasswd file (bcrypt and
+// SHA1 hashes are supported). The file is re-read, when it changes.
+type Htpasswd struct {
+	path     string
+	log      *zap.Logger
+	reloader *filereload.Reloader
+
+	mu    sync.RWMutex
+	users map[string]string // user name => password hash
+}
+
+const (
+	htpasswdCheckInterval = time.Second * 2 // limits the file changes checking frequency
+	realm                 = "http-proxy-daemon"
+)
+
+// NewHtpasswd creates Htpasswd authenticator and loads the file.
+func NewHtpasswd(path string, log *zap.Logger) (*Htpasswd, error) {
+	h := &Htpasswd{path: path, log: log}
+
+	reloader, err := filereload.New(htpasswdCheckInterval, h.load, path)
+	if err != nil {
+		return nil, err
+	}
+
+	h.reloader = reloader
+
+	return h, nil
+}
+
+// Authenticate implements Authenticator interface. Credentials are taken from the "Proxy-Authorization" header (for
+// the forward-proxy requests) or the "Authorization" header.
+func (h *Htpasswd) Authenticate(r *http.Request) (Identity, bool) {
+	_, user, password, ok := basicAuth(r)
+	if !ok {
+		return Identity{}, false
+	}
+
+	h.reloadIfChanged()
+
+	h.mu.RLock()
+	hash, exists := h.users[user]
+	h.mu.RUnlock()
+
+	if !exists || !checkPassword(hash, password) {
+		return Identity{}, false
+	}
+
+	return Identity{User: user}, true
+}
+
+// Challenge returns the "WWW-Authenticate" (or "Proxy-Authenticate") header value.
+func (h *Htpasswd) Challenge() string { return `Basic realm="` + realm + `", charset="UTF-8"` }
+
+// Strip implements Authenticator interface. Only the header with the Basic auth credentials is removed (so the
+// upstream "Authorization" header of the forward-proxy requests is kept).
+func (h *Htpasswd) Strip(r *http.Request) {
+	if name, _, _, ok := basicAuth(r); ok {
+		r.Header.Del(name)
+	}
+}
+
+// basicAuth extracts the Basic auth credentials from the "Proxy-Authorization" or "Authorization" header. The header
+// name, the credentials are taken from, is returned too.
+func basicAuth(r *http.Request) (string, string, string, bool) {
+	if v := r.Header.Get("Proxy-Authorization"); v != "" {
+		user, password, ok := (&http.Request{Header: http.Header{"Authorization": {v}}}).BasicAuth()
+
+		return "Proxy-Authorization", user, password, ok
+	}
+
+	user, password, ok := r.BasicAuth()
+
+	return "Authorization", user, password, ok
+}
+
+func checkPassword(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2"): // bcrypt ($2a$, $2b$, $2y$)
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password)) //nolint:gosec
+
+		return subtle.ConstantTimeCompare([]byte(hash[5:]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	}
+
+	return false
+}
+
+// reloadIfChanged re-reads the file, if it was changed (since the last reading).
+func (h *Htpasswd) reloadIfChanged() {
+	reloaded, err := h.reloader.ReloadIfChanged()
+	if err != nil {
+		h.log.Error("Cannot reload the htpasswd file (previous version is used)", zap.String("path", h.path), zap.Error(err))
+
+		return
+	}
+
+	if reloaded {
+		h.log.Info("Htpasswd file reloaded", zap.String("path", h.path))
+	}
+}
+
+// load reads and parses the file.
+func (h *Htpasswd) load() error {
+	content, err := os.ReadFile(h.path)
+	if err != nil {
+		return err
+	}
+
+	users, err := parseHtpasswd(content)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.users = users
+	h.mu.Unlock()
+
+	return nil
+}
+
+// parseHtpasswd parses the htpasswd file content (`user:hash` lines, empty lines and comments are ignored).
+func parseHtpasswd(content []byte) (map[string]string, error) {
+	var (
+		users   = make(map[string]string)
+		scanner = bufio.NewScanner(bytes.NewReader(content))
+		lineNum int
+	)
+
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, found := strings.Cut(line, ":")
+		if !found || user == "" || hash == "" {
+			return nil, fmt.Errorf("wrong htpasswd line %d format", lineNum)
+		}
+
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("unsupported password hash for the user %s (only bcrypt and SHA1 are supported)", user)
+		}
+
+		users[user] = hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return nil, errors.New("htpasswd file has no users")
+	}
+
+	return users, nil
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// JWKS is a JSON Web Key Set (RFC 7517), loaded from the local file or fetched by the URL. The keys are refreshed
+// periodically and when the token is signed by an unknown key (keys rotation).
+type JWKS struct {
+	source          string // file path or URL
+	refreshInterval time.Duration
+	httpClient      *http.Client
+	log             *zap.Logger
+
+	refreshMu sync.Mutex // only one refreshing at a time
+	triedAt   time.Time  // the last refreshing attempt time (guarded by the refreshMu)
+
+	mu       sync.RWMutex
+	keys     map[string]interface{} // key ID => public key
+	loadedAt time.Time
+}
+
+const (
+	jwksMinRefreshInterval = time.Second * 10 // limits the refreshing frequency (e.g. on the unknown key IDs)
+	jwksFetchTimeout       = time.Second * 10
+	jwksMaxSize            = 1 << 20 // 1 MiB
+)
+
+// NewJWKS creates JWKS and loads the keys. Source is a file path or an HTTP(S) URL. Zero refresh interval means
+// "refresh on the unknown key IDs only".
+func NewJWKS(source string, refreshInterval time.Duration, log *zap.Logger) (*JWKS, error) {
+	s := &JWKS{
+		source:          source,
+		refreshInterval: refreshInterval,
+		httpClient:      &http.Client{Timeout: jwksFetchTimeout},
+		log:             log,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Key returns the public key by its ID.
+func (s *JWKS) Key(kid string) (interface{}, error) {
+	s.mu.RLock()
+	key, found := s.keys[kid]
+	stale := s.refreshInterval > 0 && time.Since(s.loadedAt) >= s.refreshInterval
+	s.mu.RUnlock()
+
+	switch {
+	case found && !stale:
+		return key, nil
+
+	case found: // stale key is still used, while the keys are refreshing by another request
+		if s.refreshMu.TryLock() {
+			s.refresh()
+			s.refreshMu.Unlock()
+		}
+
+	default: // probably, the keys were rotated
+		s.refreshMu.Lock()
+		s.refresh()
+		s.refreshMu.Unlock()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if key, found = s.keys[kid]; !found {
+		return nil, fmt.Errorf("unknown key ID [%s]", kid)
+	}
+
+	return key, nil
+}
+
+// refresh reloads the keys, if the previous attempt was not too recently. The refreshMu must be locked.
+func (s *JWKS) refresh() {
+	if time.Since(s.triedAt) < jwksMinRefreshInterval {
+		return
+	}
+
+	s.triedAt = time.Now()
+
+	if err := s.load(); err != nil {
+		s.log.Error("Cannot refresh the JWKS (previous keys are used)", zap.String("source", s.source), zap.Error(err))
+
+		return
+	}
+
+	s.log.Debug("JWKS refreshed", zap.String("source", s.source))
+}
+
+// load reads (or fetches) and parses the keys.
+func (s *JWKS) load() error {
+	var (
+		data []byte
+		err  error
+	)
+
+	if strings.HasPrefix(s.source, "http://") || strings.HasPrefix(s.source, "https://") {
+		data, err = s.fetch()
+	} else {
+		data, err = os.ReadFile(s.source)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys, s.loadedAt = keys, time.Now()
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *JWKS) fetch() ([]byte, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, s.source, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected JWKS response status code: %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, jwksMaxSize))
+}
+
+// jsonWebKey is a JSON Web Key (only the fields, required for the signature verification).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS parses the key set. Encryption keys and keys of unsupported types are ignored.
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("wrong JWKS format: %w", err)
+	}
+
+	var keys = make(map[string]interface{}, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("wrong key [%s]: %w", jwk.Kid, err)
+		}
+
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signature verification keys in the JWKS")
+	}
+
+	return keys, nil
+}
+
+// publicKey returns nil, if the key type is not supported.
+func (k jsonWebKey) publicKey() (interface{}, error) { //nolint:gocyclo
+	switch k.Kty {
+	case "RSA":
+		n, e := decodeBigInt(k.N), decodeBigInt(k.E)
+		if n == nil || e == nil || !e.IsInt64() {
+			return nil, errors.New("wrong RSA key parameters")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve [%s]", k.Crv)
+		}
+
+		x, y := decodeBigInt(k.X), decodeBigInt(k.Y)
+		if x == nil || y == nil || !curve.IsOnCurve(x, y) {
+			return nil, errors.New("wrong EC key parameters")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("wrong OKP key parameters")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, nil //nolint:nilnil
+}
+
+// decodeBigInt decodes base64url encoded unsigned big-endian integer. Nil is returned on the decoding error.
+func decodeBigInt(s string) *big.Int {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+
+	return new(big.Int).SetBytes(b)
+}
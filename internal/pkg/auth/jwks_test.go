@@ -0,0 +1,93 @@
+package auth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+)
+
+func TestJWKS_KeyRotation(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	var (
+		rotated  atomic.Bool
+		requests atomic.Int32
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+
+		var keys = []map[string]string{ecJWK("old", oldKey)}
+		if rotated.Load() {
+			keys = []map[string]string{ecJWK("new", newKey)}
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer srv.Close()
+
+	jwks, err := auth.NewJWKS(srv.URL, time.Hour, zap.NewNop())
+	assert.NoError(t, err)
+
+	key, err := jwks.Key("old")
+	assert.NoError(t, err)
+	assert.Equal(t, &oldKey.PublicKey, key)
+	assert.EqualValues(t, 1, requests.Load(), "keys must be cached")
+
+	rotated.Store(true)
+
+	key, err = jwks.Key("new")
+	assert.NoError(t, err)
+	assert.Equal(t, &newKey.PublicKey, key)
+
+	_, err = jwks.Key("unknown")
+	assert.Error(t, err)
+	assert.EqualValues(t, 2, requests.Load(), "refreshing frequency must be limited")
+}
+
+func TestNewJWKSErrors(t *testing.T) {
+	var dir = t.TempDir()
+
+	_, err := auth.NewJWKS(filepath.Join(dir, "not-exists"), 0, zap.NewNop())
+	assert.Error(t, err)
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err = auth.NewJWKS(srv.URL, 0, zap.NewNop())
+	assert.Error(t, err)
+
+	for name, content := range map[string]string{
+		"not a json":         "foo",
+		"no keys":            `{"keys": []}`,
+		"encryption keys":    `{"keys": [{"kty": "RSA", "use": "enc", "n": "AQAB", "e": "AQAB"}]}`,
+		"unsupported key":    `{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`,
+		"wrong RSA key":      `{"keys": [{"kty": "RSA", "n": "!", "e": "AQAB"}]}`,
+		"unsupported curve":  `{"keys": [{"kty": "EC", "crv": "P-224", "x": "AQAB", "y": "AQAB"}]}`,
+		"point is not on EC": `{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQAB", "y": "AQAB"}]}`,
+		"wrong Ed25519 key":  `{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "AQAB"}]}`,
+	} {
+		path := filepath.Join(dir, "jwks.json")
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		_, err = auth.NewJWKS(path, 0, zap.NewNop())
+		assert.Error(t, err, name)
+	}
+}
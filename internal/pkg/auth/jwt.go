@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+// JWT authenticates the requests using the bearer tokens (JSON Web Tokens), signed by the keys from the JWKS. The
+// token subject ("sub" claim) is used as the user name, and the permissions claim (scopes) - for the client
+// permissions (see PermissionsFromScopes).
+type JWT struct {
+	keys             *JWKS
+	issuer           string
+	audience         string
+	permissionsClaim string
+	parser           *jwt.Parser
+	log              *zap.Logger
+}
+
+const jwtLeeway = time.Second * 30 // allowed clock skew for the "exp" and "nbf" claims checking
+
+// NewJWT creates JWT authenticator. The token must contain the expected issuer ("iss" claim), audience ("aud" claim)
+// and the expiration time ("exp" claim).
+func NewJWT(keys *JWKS, issuer, audience, permissionsClaim string, log *zap.Logger) *JWT {
+	return &JWT{
+		keys:             keys,
+		issuer:           issuer,
+		audience:         audience,
+		permissionsClaim: permissionsClaim,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{ // asymmetric algorithms only
+				"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA",
+			}),
+			jwt.WithoutClaimsValidation(), // claims are validated with the leeway
+		),
+		log: log,
+	}
+}
+
+// Authenticate implements Authenticator interface. The token is taken from the "Proxy-Authorization" header (for the
+// forward-proxy requests) or the "Authorization" header.
+func (j *JWT) Authenticate(r *http.Request) (Identity, bool) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return Identity{}, false
+	}
+
+	var claims = jwt.MapClaims{}
+
+	if _, err := j.parser.ParseWithClaims(token, claims, j.key); err != nil {
+		j.log.Debug("Wrong JWT", zap.Error(err))
+
+		return Identity{}, false
+	}
+
+	var now = time.Now()
+
+	if !claims.VerifyExpiresAt(now.Add(-jwtLeeway).Unix(), true) ||
+		!claims.VerifyNotBefore(now.Add(jwtLeeway).Unix(), false) ||
+		!claims.VerifyIssuer(j.issuer, true) ||
+		!claims.VerifyAudience(j.audience, true) {
+		j.log.Debug("JWT claims validation failed", zap.Any("claims", claims))
+
+		return Identity{}, false
+	}
+
+	sub, _ := claims["sub"].(string)
+
+	return Identity{User: sub, Permissions: PermissionsFromScopes(j.scopes(claims)...)}, true
+}
+
+func (j *JWT) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	return j.keys.Key(kid)
+}
+
+// scopes extracts the scopes from the permissions claim, which can be a space-delimited string (RFC 8693) or an array
+// of strings.
+func (j *JWT) scopes(claims jwt.MapClaims) []string {
+	switch v := claims[j.permissionsClaim].(type) {
+	case string:
+		return strings.Fields(v)
+
+	case []interface{}:
+		var scopes = make([]string, 0, len(v))
+
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+
+		return scopes
+	}
+
+	return nil
+}
+
+// Challenge returns the "WWW-Authenticate" (or "Proxy-Authenticate") header value.
+func (j *JWT) Challenge() string { return `Bearer realm="` + realm + `"` }
+
+// Strip implements Authenticator interface. Only the headers with the bearer tokens are removed.
+func (j *JWT) Strip(r *http.Request) {
+	for _, name := range []string{"Proxy-Authorization", "Authorization"} {
+		if _, ok := parseBearer(r.Header.Get(name)); ok {
+			r.Header.Del(name)
+		}
+	}
+}
+
+// bearerToken extracts the bearer token from the "Proxy-Authorization" or "Authorization" header.
+func bearerToken(r *http.Request) (string, bool) {
+	if token, ok := parseBearer(r.Header.Get("Proxy-Authorization")); ok {
+		return token, true
+	}
+
+	return parseBearer(r.Header.Get("Authorization"))
+}
+
+func parseBearer(value string) (string, bool) {
+	const prefix = "Bearer "
+
+	if len(value) <= len(prefix) || !strings.EqualFold(value[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(value[len(prefix):]), true
+}
@@ -0,0 +1,208 @@
+package auth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// rsaJWK and ecJWK return the public JSON Web Keys.
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig",
+		"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(key.X.Bytes()), "y": b64(key.Y.Bytes()),
+	}
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+
+	return signed
+}
+
+func TestJWT_Authenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("rsa", rsaKey), ecJWK("ec", ecKey))
+
+	jwks, err := auth.NewJWKS(path, 0, zap.NewNop())
+	assert.NoError(t, err)
+
+	var (
+		a     = auth.NewJWT(jwks, "https://issuer", "proxy", "scope", zap.NewNop())
+		now   = time.Now()
+		valid = func() jwt.MapClaims {
+			return jwt.MapClaims{
+				"iss":   "https://issuer",
+				"aud":   []string{"foo", "proxy"},
+				"sub":   "service-a",
+				"exp":   now.Add(time.Minute).Unix(),
+				"scope": "read proxy:host:*.example.com proxy:method:GET",
+			}
+		}
+		with = func(key string, value interface{}) jwt.MapClaims {
+			c := valid()
+
+			if value == nil {
+				delete(c, key)
+			} else {
+				c[key] = value
+			}
+
+			return c
+		}
+	)
+
+	for _, tt := range []struct {
+		name       string
+		giveHeader string
+		giveToken  string
+		wantUser   string
+		wantOK     bool
+	}{
+		{
+			name:       "RSA",
+			giveHeader: "Authorization",
+			giveToken:  signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, valid()),
+			wantUser:   "service-a",
+			wantOK:     true,
+		},
+		{
+			name:       "ECDSA in the proxy authorization header",
+			giveHeader: "Proxy-Authorization",
+			giveToken:  signToken(t, jwt.SigningMethodES256, "ec", ecKey, valid()),
+			wantUser:   "service-a",
+			wantOK:     true,
+		},
+		{
+			name:       "scopes array",
+			giveHeader: "Authorization",
+			giveToken: signToken(t, jwt.SigningMethodES256, "ec", ecKey,
+				with("scope", []string{"proxy:host:*.example.com", "proxy:method:GET"}),
+			),
+			wantUser: "service-a",
+			wantOK:   true,
+		},
+		{
+			name:       "expired within the leeway",
+			giveHeader: "Authorization",
+			giveToken:  signToken(t, jwt.SigningMethodES256, "ec", ecKey, with("exp", now.Add(-time.Second).Unix())),
+			wantUser:   "service-a",
+			wantOK:     true,
+		},
+		{
+			name:       "expired",
+			giveHeader: "Authorization",
+			giveToken:  signToken(t, jwt.SigningMethodES256, "ec", ecKey, with("exp", now.Add(-time.Hour).Unix())),
+		},
+		{
+			name:       "without expiration time",
+			giveHeader: "Authorization",
+			giveToken:  signToken(t, jwt.SigningMethodES256, "ec", ecKey, with("exp", nil)),
+		},
+		{
+			name:       "not valid yet",
+			giveHeader: "Authorization",
+			giveToken:  signToken(t, jwt.SigningMethodES256, "ec", ecKey, with("nbf", now.Add(time.Hour).Unix())),
+		},
+		{
+			name:       "wrong issuer",
+			giveHeader: "Authorization",
+			giveToken:  signToken(t, jwt.SigningMethodES256, "ec", ecKey, with("iss", "https://evil")),
+		},
+		{
+			name:       "wrong audience",
+			giveHeader: "Authorization",
+			giveToken:  signToken(t, jwt.SigningMethodES256, "ec", ecKey, with("aud", "foo")),
+		},
+		{
+			name:       "unknown key",
+			giveHeader: "Authorization",
+			giveToken:  signToken(t, jwt.SigningMethodES256, "ec", otherKey, valid()),
+		},
+		{
+			name:       "symmetric algorithm",
+			giveHeader: "Authorization",
+			giveToken:  signToken(t, jwt.SigningMethodHS256, "ec", []byte("secret"), valid()),
+		},
+		{name: "malformed token", giveHeader: "Authorization", giveToken: "foo.bar.baz"},
+		{name: "no token"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "http://testing/", http.NoBody)
+
+			if tt.giveHeader != "" {
+				req.Header.Set(tt.giveHeader, "Bearer "+tt.giveToken)
+			}
+
+			identity, ok := a.Authenticate(req)
+
+			assert.Equal(t, tt.wantOK, ok)
+
+			if tt.wantOK {
+				assert.Equal(t, tt.wantUser, identity.User)
+				assert.True(t, identity.Permissions.Allows(http.MethodGet, "api.example.com"))
+				assert.False(t, identity.Permissions.Allows(http.MethodPost, "api.example.com"))
+				assert.False(t, identity.Permissions.Allows(http.MethodGet, "example.org"))
+			}
+		})
+	}
+}
+
+func TestJWT_Strip(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://testing/", http.NoBody)
+	req.Header.Set("Proxy-Authorization", "Bearer foo")
+	req.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+
+	(&auth.JWT{}).Strip(req)
+
+	assert.Empty(t, req.Header.Get("Proxy-Authorization"))
+	assert.Equal(t, "Basic Zm9vOmJhcg==", req.Header.Get("Authorization"), "non-bearer credentials must be kept")
+}
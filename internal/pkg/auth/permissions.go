@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+)
+
+// Permissions limits the upstream hosts and the request methods, allowed for the client.
+type Permissions struct {
+	hosts   hostmatch.Matcher   // empty means "any host is allowed"
+	methods map[string]struct{} // empty map means "any method is allowed"
+}
+
+const (
+	hostScopePrefix   = "proxy:host:"
+	methodScopePrefix = "proxy:method:"
+)
+
+// PermissionsFromScopes creates Permissions using the scopes like "proxy:host:*.example.com" (allowed upstream host
+// glob pattern) and "proxy:method:GET" (allowed request method, "CONNECT" is used for the tunnels). Other scopes are
+// ignored. Without host (or method) scopes any host (or method) is allowed.
+func PermissionsFromScopes(scopes ...string) *Permissions {
+	var (
+		p     = &Permissions{methods: make(map[string]struct{})}
+		hosts []string
+	)
+
+	for _, scope := range scopes {
+		switch {
+		case strings.HasPrefix(scope, hostScopePrefix):
+			hosts = append(hosts, strings.TrimPrefix(scope, hostScopePrefix))
+
+		case strings.HasPrefix(scope, methodScopePrefix):
+			if method := strings.TrimPrefix(scope, methodScopePrefix); method != "" {
+				p.methods[strings.ToUpper(method)] = struct{}{}
+			}
+		}
+	}
+
+	p.hosts = hostmatch.New(hosts...)
+
+	return p
+}
+
+// Allows reports whether the request with the method to the upstream host (the port will be ignored, if any) is
+// allowed. Nil Permissions allow everything.
+func (p *Permissions) Allows(method, host string) bool {
+	if p == nil {
+		return true
+	}
+
+	if len(p.methods) > 0 {
+		if _, ok := p.methods[strings.ToUpper(method)]; !ok {
+			return false
+		}
+	}
+
+	return p.hosts.Empty() || p.hosts.Match(host)
+}
@@ -0,0 +1,68 @@
+package auth_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+)
+
+func TestPermissions_Allows(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		giveScopes  []string
+		giveMethod  string
+		giveHost    string
+		wantAllowed bool
+	}{
+		{name: "no scopes", giveMethod: http.MethodPost, giveHost: "example.com", wantAllowed: true},
+		{
+			name:        "other scopes are ignored",
+			giveScopes:  []string{"openid", "profile"},
+			giveMethod:  http.MethodGet,
+			giveHost:    "example.com",
+			wantAllowed: true,
+		},
+		{
+			name:        "allowed host with port",
+			giveScopes:  []string{"proxy:host:example.com", "proxy:host:*.example.org"},
+			giveMethod:  http.MethodGet,
+			giveHost:    "api.example.org:443",
+			wantAllowed: true,
+		},
+		{
+			name:       "host is not allowed",
+			giveScopes: []string{"proxy:host:example.com"},
+			giveMethod: http.MethodGet,
+			giveHost:   "example.org",
+		},
+		{
+			name:        "allowed method (case-insensitive)",
+			giveScopes:  []string{"proxy:method:get", "proxy:method:CONNECT"},
+			giveMethod:  http.MethodConnect,
+			giveHost:    "example.com:443",
+			wantAllowed: true,
+		},
+		{
+			name:       "method is not allowed",
+			giveScopes: []string{"proxy:method:GET", "proxy:host:example.com"},
+			giveMethod: http.MethodDelete,
+			giveHost:   "example.com",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p := auth.PermissionsFromScopes(tt.giveScopes...)
+
+			assert.Equal(t, tt.wantAllowed, p.Allows(tt.giveMethod, tt.giveHost))
+		})
+	}
+}
+
+func TestPermissions_AllowsNil(t *testing.T) {
+	var p *auth.Permissions
+
+	assert.True(t, p.Allows(http.MethodGet, "example.com"))
+}
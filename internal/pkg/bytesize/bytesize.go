@@ -0,0 +1,43 @@
+// Package bytesize contains human-readable data sizes (like "64MiB") parsing.
+package bytesize
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// units maps the size units into the multipliers.
+var units = map[string]uint64{ //nolint:gochecknoglobals
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+}
+
+// Parse parses the size in bytes with an optional unit (B, KB, KiB, MB, MiB, GB or GiB; case-insensitive), like
+// "1024", "512KiB" or "64MB".
+func Parse(s string) (uint64, error) {
+	var trimmed = strings.TrimSpace(s)
+
+	i := strings.IndexFunc(trimmed, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i == -1 {
+		i = len(trimmed)
+	}
+
+	multiplier, known := units[strings.ToLower(strings.TrimSpace(trimmed[i:]))]
+	if !known {
+		return 0, fmt.Errorf("wrong size [%s] unit", s)
+	}
+
+	value, err := strconv.ParseFloat(trimmed[:i], 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("wrong size [%s] value", s)
+	}
+
+	return uint64(value * float64(multiplier)), nil
+}
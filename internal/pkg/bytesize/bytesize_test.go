@@ -0,0 +1,44 @@
+package bytesize_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/bytesize"
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		give    string
+		want    uint64
+		wantErr bool
+	}{
+		{give: "0", want: 0},
+		{give: "1024", want: 1024},
+		{give: "10B", want: 10},
+		{give: "2KB", want: 2000},
+		{give: "2KiB", want: 2048},
+		{give: " 64 mib ", want: 64 << 20},
+		{give: "1.5MB", want: 1500000},
+		{give: "1GiB", want: 1 << 30},
+		{give: "", wantErr: true},
+		{give: "MB", wantErr: true},
+		{give: "10TB", wantErr: true},
+		{give: "1.2.3KB", wantErr: true},
+	} {
+		tt := tt
+		t.Run(tt.give, func(t *testing.T) {
+			got, err := bytesize.Parse(tt.give)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Package circuit contains the per upstream host circuit breakers with the passive outlier detection: the breaker
+// is opened by the consecutive failures or the high error rate, and the requests to the host are rejected without
+// waiting for the upstream, until the trial requests succeed.
+package circuit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// State is the circuit breaker state.
+type State int
+
+const (
+	StateClosed   State = iota // requests are passed, failures are counted
+	StateHalfOpen              // limited count of the trial requests is passed
+	StateOpen                  // requests are rejected
+)
+
+// String returns the state name.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+
+	return "unknown"
+}
+
+// MarshalText implements encoding.TextMarshaler (states are encoded in JSON using their names).
+func (s State) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// Result is the upstream request outcome.
+type Result int
+
+const (
+	Success Result = iota
+	Failure
+	Ignored // the outcome is unknown (e.g. the client has gone), so it does not affect the breaker
+)
+
+// Settings are the circuit breakers settings.
+type Settings struct {
+	ConsecutiveFailures int           // consecutive failures count to open the breaker (zero disables)
+	ErrorRate           float64       // failures ratio within the window to open the breaker (zero disables)
+	MinRequests         int           // minimal requests count within the window to check the error rate
+	Window              time.Duration // error rate measuring window
+	OpenTimeout         time.Duration // the time in the open state, before the trial requests are passed
+	HalfOpenRequests    int           // successful trial requests count to close the breaker
+}
+
+// Validate checks the settings.
+func (s Settings) Validate() error {
+	switch {
+	case s.ConsecutiveFailures < 0:
+		return errors.New("wrong consecutive failures count")
+	case s.ErrorRate < 0 || s.ErrorRate > 1:
+		return fmt.Errorf("wrong error rate [%v] (0..1 expected)", s.ErrorRate)
+	case s.ConsecutiveFailures == 0 && s.ErrorRate == 0:
+		return errors.New("consecutive failures count or error rate is required")
+	case s.ErrorRate > 0 && s.Window <= 0:
+		return errors.New("error rate requires the window")
+	case s.MinRequests < 0:
+		return errors.New("wrong minimal requests count")
+	case s.OpenTimeout <= 0:
+		return errors.New("wrong open timeout")
+	case s.HalfOpenRequests <= 0:
+		return errors.New("wrong half-open requests count")
+	}
+
+	return nil
+}
+
+// OpenError is returned, when the request is rejected by the open circuit breaker.
+type OpenError struct {
+	Host       string
+	RetryAfter time.Duration // time until the trial requests are passed (zero, when the trial is in progress)
+}
+
+func (e *OpenError) Error() string {
+	return "circuit breaker for [" + e.Host + "] is open (the upstream is failing)"
+}
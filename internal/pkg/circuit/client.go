@@ -0,0 +1,67 @@
+package circuit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/netpolicy"
+)
+
+type httpClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Client is an HTTP client, that passes the requests through the upstream host circuit breakers. Connection errors,
+// timeouts and 5xx responses are counted as failures. *OpenError is returned for the rejected requests.
+type Client struct {
+	next  httpClient
+	group *Group
+}
+
+// NewClient creates a new Client.
+func NewClient(next httpClient, group *Group) *Client {
+	return &Client{next: next, group: group}
+}
+
+// Do sends the request, if the host circuit breaker allows it.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	done, err := c.group.Allow(strings.ToLower(req.URL.Host))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.next.Do(req)
+
+	done(result(req.Context(), resp, err))
+
+	return resp, err
+}
+
+// result classifies the request outcome. Canceled requests (the client has gone) are ignored, but the exceeded
+// request timeout is the failure.
+func result(ctx context.Context, resp *http.Response, err error) Result {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			return Failure
+		}
+
+		return Ignored
+	}
+
+	if err != nil {
+		var blocked *netpolicy.BlockedError
+		if errors.As(err, &blocked) { // the upstream was not even contacted
+			return Ignored
+		}
+
+		return Failure
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return Failure
+	}
+
+	return Success
+}
@@ -0,0 +1,120 @@
+package circuit_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/circuit"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/netpolicy"
+)
+
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestClient_Do(t *testing.T) {
+	var status = http.StatusOK
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer upstream.Close()
+
+	var (
+		m      = newFakeMetrics()
+		g      = newGroup(t, circuit.Settings{ConsecutiveFailures: 2, OpenTimeout: time.Minute, HalfOpenRequests: 1}, m)
+		client = circuit.NewClient(&http.Client{}, g)
+	)
+
+	do := func() (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodGet, upstream.URL, http.NoBody)
+
+		resp, err := client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+
+		return resp, err
+	}
+
+	resp, err := do()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	status = http.StatusNotFound // client errors are not counted
+
+	for i := 0; i < 3; i++ {
+		_, err = do()
+		assert.NoError(t, err)
+	}
+
+	status = http.StatusBadGateway
+
+	for i := 0; i < 2; i++ {
+		resp, err = do()
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	}
+
+	_, err = do()
+
+	var openErr *circuit.OpenError
+
+	assert.True(t, errors.As(err, &openErr))
+	assert.Equal(t, upstream.URL[7:], openErr.Host)
+	assert.Equal(t, 1, m.rejected)
+}
+
+func TestClient_DoErrors(t *testing.T) {
+	blocked := &net.OpError{Op: "dial", Err: &netpolicy.BlockedError{Address: "127.0.0.1:80", Reason: "denied"}}
+
+	for name, tt := range map[string]struct {
+		giveErr     error
+		giveTimeout bool
+		giveCancel  bool
+		wantState   circuit.State
+	}{
+		"connection error": {giveErr: errors.New("connection refused"), wantState: circuit.StateOpen},
+		"blocked upstream": {giveErr: blocked, wantState: circuit.StateClosed},
+		"request timeout":  {giveErr: context.DeadlineExceeded, giveTimeout: true, wantState: circuit.StateOpen},
+		"client has gone":  {giveErr: context.Canceled, giveCancel: true, wantState: circuit.StateClosed},
+	} {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			var (
+				m      = newFakeMetrics()
+				g      = newGroup(t, circuit.Settings{ConsecutiveFailures: 1, OpenTimeout: time.Minute, HalfOpenRequests: 1}, m)
+				client = circuit.NewClient(doerFunc(func(*http.Request) (*http.Response, error) {
+					return nil, tt.giveErr
+				}), g)
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if tt.giveTimeout {
+				ctx, cancel = context.WithTimeout(ctx, 0)
+				defer cancel()
+			}
+
+			if tt.giveCancel {
+				cancel()
+			}
+
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://Example.com/", http.NoBody)
+
+			_, err := client.Do(req)
+			assert.ErrorIs(t, err, tt.giveErr)
+
+			assert.Equal(t, int(tt.wantState), m.states["example.com"])
+		})
+	}
+}
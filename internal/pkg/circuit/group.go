@@ -0,0 +1,268 @@
+package circuit
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type metrics interface {
+	SetState(host string, state int)
+	DeleteHost(host string)
+	IncrementRejected()
+}
+
+// Group is a set of the circuit breakers with the same settings, one per upstream host. Breakers are created on
+// demand, and the idle closed breakers are removed, so the memory usage is bounded by the count of active hosts.
+type Group struct {
+	settings Settings
+	m        metrics
+
+	mu        sync.Mutex
+	breakers  map[string]*breaker
+	lastSweep time.Time
+}
+
+type breaker struct {
+	state      State
+	generation uint64 // incremented on each state change, outdated results are ignored
+
+	consecutive int       // consecutive failures (closed state)
+	windowStart time.Time // error rate window start (closed state)
+	requests    int       // requests count within the window (closed state)
+	failures    int       // failures count within the window (closed state)
+
+	openedAt  time.Time
+	trials    int // in-flight trial requests (half-open state)
+	successes int // successful trial requests (half-open state)
+
+	lastUsed time.Time
+}
+
+// Status is the circuit breaker status.
+type Status struct {
+	Host                string     `json:"host"`
+	State               State      `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Requests            int        `json:"requests"` // within the error rate window
+	Failures            int        `json:"failures"` // within the error rate window
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+const idleTimeout = time.Minute * 5 // idle closed breakers are removed after this time
+
+// NewGroup creates a new Group.
+func NewGroup(s Settings, m metrics) (*Group, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Group{settings: s, m: m, breakers: make(map[string]*breaker), lastSweep: time.Now()}, nil
+}
+
+// Allow checks whether the request to the host can be made. The returned function must be called with the request
+// result. *OpenError is returned, when the request is rejected.
+func (g *Group) Allow(host string) (func(Result), error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var now = time.Now()
+
+	g.sweep(now)
+
+	b, exists := g.breakers[host]
+	if !exists {
+		b = &breaker{windowStart: now}
+		g.breakers[host] = b
+		g.m.SetState(host, int(StateClosed))
+	}
+
+	b.lastUsed = now
+
+	switch b.state {
+	case StateClosed:
+	case StateOpen:
+		if retryAfter := b.openedAt.Add(g.settings.OpenTimeout).Sub(now); retryAfter > 0 {
+			g.m.IncrementRejected()
+
+			return nil, &OpenError{Host: host, RetryAfter: retryAfter}
+		}
+
+		g.setState(host, b, StateHalfOpen, now)
+
+		fallthrough
+
+	case StateHalfOpen:
+		if b.trials+b.successes >= g.settings.HalfOpenRequests {
+			g.m.IncrementRejected()
+
+			return nil, &OpenError{Host: host}
+		}
+
+		b.trials++
+	}
+
+	var generation = b.generation
+
+	return func(r Result) { g.report(host, b, generation, r) }, nil
+}
+
+// report updates the breaker using the request result.
+func (g *Group) report(host string, b *breaker, generation uint64, r Result) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if b.generation != generation { // the state has been changed since the request was started
+		return
+	}
+
+	var now = time.Now()
+
+	switch b.state {
+	case StateClosed:
+		if r == Ignored {
+			return
+		}
+
+		if g.settings.Window > 0 && now.Sub(b.windowStart) > g.settings.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+
+		b.requests++
+
+		if r == Success {
+			b.consecutive = 0
+
+			return
+		}
+
+		b.failures++
+		b.consecutive++
+
+		if g.shouldOpen(b) {
+			g.setState(host, b, StateOpen, now)
+		}
+
+	case StateHalfOpen:
+		b.trials--
+
+		switch r {
+		case Failure:
+			g.setState(host, b, StateOpen, now)
+
+		case Success:
+			if b.successes++; b.successes >= g.settings.HalfOpenRequests {
+				g.setState(host, b, StateClosed, now)
+			}
+
+		case Ignored:
+		}
+
+	case StateOpen:
+	}
+}
+
+// shouldOpen checks the closed breaker failures.
+func (g *Group) shouldOpen(b *breaker) bool {
+	if n := g.settings.ConsecutiveFailures; n > 0 && b.consecutive >= n {
+		return true
+	}
+
+	if rate := g.settings.ErrorRate; rate > 0 && b.requests >= g.settings.MinRequests {
+		return float64(b.failures)/float64(b.requests) >= rate
+	}
+
+	return false
+}
+
+// setState changes the breaker state and resets its counters.
+func (g *Group) setState(host string, b *breaker, state State, now time.Time) {
+	var openedAt = b.openedAt
+
+	*b = breaker{state: state, generation: b.generation + 1, windowStart: now, lastUsed: b.lastUsed}
+
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateHalfOpen:
+		b.openedAt = openedAt
+	case StateClosed:
+	}
+
+	g.m.SetState(host, int(state))
+}
+
+// sweep removes the idle closed breakers (not more often than once per idle timeout).
+func (g *Group) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < idleTimeout {
+		return
+	}
+
+	g.lastSweep = now
+
+	for host, b := range g.breakers {
+		if b.state == StateClosed && now.Sub(b.lastUsed) > idleTimeout {
+			delete(g.breakers, host)
+			g.m.DeleteHost(host)
+		}
+	}
+}
+
+// List returns the breakers statuses, sorted by the host.
+func (g *Group) List() []Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var list = make([]Status, 0, len(g.breakers))
+
+	for host, b := range g.breakers {
+		status := Status{
+			Host:                host,
+			State:               b.state,
+			ConsecutiveFailures: b.consecutive,
+			Requests:            b.requests,
+			Failures:            b.failures,
+		}
+
+		if b.state != StateClosed {
+			openedAt := b.openedAt
+			status.OpenedAt = &openedAt
+		}
+
+		list = append(list, status)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Host < list[j].Host })
+
+	return list
+}
+
+// Reset removes the host breaker (so it becomes closed). It returns false, if the breaker does not exist.
+func (g *Group) Reset(host string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, exists := g.breakers[host]; !exists {
+		return false
+	}
+
+	delete(g.breakers, host)
+	g.m.DeleteHost(host)
+
+	return true
+}
+
+// ResetAll removes all the breakers. It returns the count of removed breakers.
+func (g *Group) ResetAll() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var count = len(g.breakers)
+
+	for host := range g.breakers {
+		delete(g.breakers, host)
+		g.m.DeleteHost(host)
+	}
+
+	return count
+}
@@ -0,0 +1,261 @@
+package circuit_test
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/circuit"
+)
+
+type fakeMetrics struct {
+	mu       sync.Mutex
+	states   map[string]int
+	rejected int
+}
+
+func newFakeMetrics() *fakeMetrics { return &fakeMetrics{states: make(map[string]int)} }
+
+func (m *fakeMetrics) SetState(host string, state int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.states[host] = state
+}
+
+func (m *fakeMetrics) DeleteHost(host string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.states, host)
+}
+
+func (m *fakeMetrics) IncrementRejected() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rejected++
+}
+
+func newGroup(t *testing.T, s circuit.Settings, m *fakeMetrics) *circuit.Group {
+	t.Helper()
+
+	g, err := circuit.NewGroup(s, m)
+	assert.NoError(t, err)
+
+	return g
+}
+
+// request makes the request through the breaker and reports its result. It returns the Allow error.
+func request(g *circuit.Group, host string, r circuit.Result) error {
+	done, err := g.Allow(host)
+	if err != nil {
+		return err
+	}
+
+	done(r)
+
+	return nil
+}
+
+func TestSettings_Validate(t *testing.T) {
+	valid := circuit.Settings{ConsecutiveFailures: 5, OpenTimeout: time.Second, HalfOpenRequests: 1}
+
+	assert.NoError(t, valid.Validate())
+
+	for name, modify := range map[string]func(*circuit.Settings){
+		"negative failures":   func(s *circuit.Settings) { s.ConsecutiveFailures = -1 },
+		"wrong error rate":    func(s *circuit.Settings) { s.ErrorRate = 1.5 },
+		"nothing to check":    func(s *circuit.Settings) { s.ConsecutiveFailures = 0 },
+		"rate without window": func(s *circuit.Settings) { s.ErrorRate = 0.5 },
+		"wrong min requests":  func(s *circuit.Settings) { s.MinRequests = -1 },
+		"zero open timeout":   func(s *circuit.Settings) { s.OpenTimeout = 0 },
+		"zero half-open":      func(s *circuit.Settings) { s.HalfOpenRequests = 0 },
+	} {
+		s := valid
+		modify(&s)
+
+		assert.Error(t, s.Validate(), name)
+
+		_, err := circuit.NewGroup(s, newFakeMetrics())
+		assert.Error(t, err, name)
+	}
+}
+
+func TestGroup_ConsecutiveFailures(t *testing.T) {
+	var (
+		m = newFakeMetrics()
+		g = newGroup(t, circuit.Settings{
+			ConsecutiveFailures: 3,
+			OpenTimeout:         time.Millisecond * 50,
+			HalfOpenRequests:    2,
+		}, m)
+	)
+
+	// success resets the consecutive failures counter
+	for _, r := range []circuit.Result{circuit.Failure, circuit.Failure, circuit.Success, circuit.Failure} {
+		assert.NoError(t, request(g, "foo", r))
+	}
+
+	assert.NoError(t, request(g, "foo", circuit.Ignored)) // ignored results are not counted
+	assert.NoError(t, request(g, "foo", circuit.Failure))
+	assert.Equal(t, int(circuit.StateClosed), m.states["foo"])
+
+	assert.NoError(t, request(g, "foo", circuit.Failure)) // the 3rd consecutive failure
+	assert.Equal(t, int(circuit.StateOpen), m.states["foo"])
+
+	err := request(g, "foo", circuit.Success)
+
+	var openErr *circuit.OpenError
+
+	assert.True(t, errors.As(err, &openErr))
+	assert.Equal(t, "foo", openErr.Host)
+	assert.Positive(t, openErr.RetryAfter)
+	assert.Contains(t, err.Error(), "circuit breaker for [foo] is open")
+	assert.Equal(t, 1, m.rejected)
+
+	assert.NoError(t, request(g, "bar", circuit.Success), "other hosts are not affected")
+
+	time.Sleep(time.Millisecond * 60)
+
+	// half-open: only the limited count of trial requests is passed
+	done1, err := g.Allow("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, int(circuit.StateHalfOpen), m.states["foo"])
+
+	done2, err := g.Allow("foo")
+	assert.NoError(t, err)
+
+	_, err = g.Allow("foo")
+	assert.True(t, errors.As(err, &openErr))
+	assert.Zero(t, openErr.RetryAfter)
+
+	done1(circuit.Success)
+	assert.Equal(t, int(circuit.StateHalfOpen), m.states["foo"])
+
+	done2(circuit.Success)
+	assert.Equal(t, int(circuit.StateClosed), m.states["foo"])
+
+	assert.NoError(t, request(g, "foo", circuit.Success))
+}
+
+func TestGroup_HalfOpenFailure(t *testing.T) {
+	var (
+		m = newFakeMetrics()
+		g = newGroup(t, circuit.Settings{
+			ConsecutiveFailures: 1,
+			OpenTimeout:         time.Millisecond * 30,
+			HalfOpenRequests:    1,
+		}, m)
+	)
+
+	assert.NoError(t, request(g, "foo", circuit.Failure))
+	assert.Equal(t, int(circuit.StateOpen), m.states["foo"])
+
+	time.Sleep(time.Millisecond * 40)
+
+	done, err := g.Allow("foo")
+	assert.NoError(t, err)
+
+	done(circuit.Ignored) // the trial slot is released
+	assert.Equal(t, int(circuit.StateHalfOpen), m.states["foo"])
+
+	assert.NoError(t, request(g, "foo", circuit.Failure)) // the trial request fails, so the breaker is opened again
+	assert.Equal(t, int(circuit.StateOpen), m.states["foo"])
+	assert.Error(t, request(g, "foo", circuit.Success))
+}
+
+func TestGroup_ErrorRate(t *testing.T) {
+	var (
+		m = newFakeMetrics()
+		g = newGroup(t, circuit.Settings{
+			ErrorRate:        0.5,
+			MinRequests:      4,
+			Window:           time.Minute,
+			OpenTimeout:      time.Minute,
+			HalfOpenRequests: 1,
+		}, m)
+	)
+
+	for _, r := range []circuit.Result{circuit.Failure, circuit.Failure, circuit.Success} {
+		assert.NoError(t, request(g, "foo", r))
+	}
+
+	assert.Equal(t, int(circuit.StateClosed), m.states["foo"], "not enough requests")
+
+	assert.NoError(t, request(g, "foo", circuit.Success)) // 2 of 4 failed
+	assert.Equal(t, int(circuit.StateClosed), m.states["foo"])
+
+	assert.NoError(t, request(g, "foo", circuit.Failure)) // 3 of 5 failed
+	assert.Equal(t, int(circuit.StateOpen), m.states["foo"])
+}
+
+func TestGroup_OutdatedResults(t *testing.T) {
+	var (
+		m = newFakeMetrics()
+		g = newGroup(t, circuit.Settings{ConsecutiveFailures: 1, OpenTimeout: time.Minute, HalfOpenRequests: 1}, m)
+	)
+
+	slow, err := g.Allow("foo") // started before the breaker opening
+	assert.NoError(t, err)
+
+	assert.NoError(t, request(g, "foo", circuit.Failure))
+	assert.Equal(t, int(circuit.StateOpen), m.states["foo"])
+
+	slow(circuit.Success)
+	assert.Equal(t, int(circuit.StateOpen), m.states["foo"])
+}
+
+func TestGroup_ListAndReset(t *testing.T) {
+	var (
+		m = newFakeMetrics()
+		g = newGroup(t, circuit.Settings{ConsecutiveFailures: 2, OpenTimeout: time.Minute, HalfOpenRequests: 1}, m)
+	)
+
+	assert.Empty(t, g.List())
+
+	assert.NoError(t, request(g, "foo", circuit.Failure))
+	assert.NoError(t, request(g, "foo", circuit.Failure))
+	assert.NoError(t, request(g, "bar", circuit.Failure))
+	assert.NoError(t, request(g, "baz", circuit.Success))
+
+	list := g.List()
+	assert.Len(t, list, 3)
+
+	assert.Equal(t, "bar", list[0].Host)
+	assert.Equal(t, circuit.StateClosed, list[0].State)
+	assert.Equal(t, 1, list[0].ConsecutiveFailures)
+	assert.Equal(t, 1, list[0].Requests)
+	assert.Equal(t, 1, list[0].Failures)
+	assert.Nil(t, list[0].OpenedAt)
+
+	assert.Equal(t, "foo", list[2].Host)
+	assert.Equal(t, circuit.StateOpen, list[2].State)
+	assert.NotNil(t, list[2].OpenedAt)
+
+	encoded, err := json.Marshal(list[2])
+	assert.NoError(t, err)
+	assert.Contains(t, string(encoded), `"state":"open"`)
+
+	assert.True(t, g.Reset("foo"))
+	assert.False(t, g.Reset("foo"))
+	assert.NoError(t, request(g, "foo", circuit.Success))
+
+	_, exists := m.states["bar"]
+	assert.True(t, exists)
+
+	assert.Equal(t, 3, g.ResetAll())
+	assert.Empty(t, g.List())
+	assert.Empty(t, m.states)
+}
+
+func TestState_String(t *testing.T) {
+	assert.Equal(t, "closed", circuit.StateClosed.String())
+	assert.Equal(t, "half-open", circuit.StateHalfOpen.String())
+	assert.Equal(t, "open", circuit.StateOpen.String())
+	assert.Equal(t, "unknown", circuit.State(100).String())
+}
@@ -0,0 +1,77 @@
+// Package ca contains CLI `ca` command implementation.
+package ca
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/mitm"
+)
+
+// NewCommand creates `ca` command.
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ca",
+		Short: "Local certificate authority (used for the TLS interception) management",
+	}
+
+	cmd.AddCommand(newInitCommand())
+
+	return cmd
+}
+
+func newInitCommand() *cobra.Command {
+	var (
+		certFile, keyFile, commonName string
+		validFor                      time.Duration
+		force                         bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Generate a new CA certificate and private key",
+		RunE: func(*cobra.Command, []string) error {
+			if !force {
+				for _, file := range []string{certFile, keyFile} {
+					if _, err := os.Stat(file); err == nil {
+						return fmt.Errorf("file [%s] already exists (use --force to overwrite)", file)
+					}
+				}
+			}
+
+			certPEM, keyPEM, err := mitm.GenerateCA(commonName, validFor)
+			if err != nil {
+				return err
+			}
+
+			if err = os.WriteFile(certFile, certPEM, 0o644); err != nil { //nolint:gosec,gomnd // public certificate
+				return err
+			}
+
+			if err = os.WriteFile(keyFile, keyPEM, 0o600); err != nil { //nolint:gomnd
+				return err
+			}
+
+			_, err = fmt.Fprintf(os.Stdout, "CA certificate:\t%s\nCA private key:\t%s\n", certFile, keyFile)
+
+			return err
+		},
+	}
+
+	cmd.Flags().StringVarP(&certFile, "cert", "c", "ca.crt", "CA certificate output file")
+	cmd.Flags().StringVarP(&keyFile, "key", "k", "ca.key", "CA private key output file")
+	cmd.Flags().StringVarP(&commonName, "common-name", "", "HTTP Proxy Daemon CA", "CA certificate common name")
+	cmd.Flags().DurationVarP(
+		&validFor,
+		"valid-for",
+		"",
+		time.Hour*24*365*10, //nolint:gomnd // 10 years
+		"CA certificate validity duration",
+	)
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite existing files")
+
+	return cmd
+}
@@ -0,0 +1,64 @@
+package ca_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kami-zh/go-capturer"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/cli/ca"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/mitm"
+)
+
+func TestProperties(t *testing.T) {
+	cmd := ca.NewCommand()
+
+	assert.Equal(t, "ca", cmd.Use)
+
+	sub, _, err := cmd.Find([]string{"init"})
+	assert.NoError(t, err)
+	assert.Equal(t, "init", sub.Use)
+	assert.NotNil(t, sub.RunE)
+}
+
+func TestInitCommandRun(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		certFile = filepath.Join(dir, "ca.crt")
+		keyFile  = filepath.Join(dir, "ca.key")
+	)
+
+	cmd := ca.NewCommand()
+	cmd.SetArgs([]string{"init", "--cert", certFile, "--key", keyFile, "--common-name", "Unit Test CA"})
+
+	output := capturer.CaptureStdout(func() {
+		assert.NoError(t, cmd.Execute())
+	})
+
+	assert.Contains(t, output, certFile)
+	assert.Contains(t, output, keyFile)
+
+	loaded, err := mitm.LoadCA(certFile, keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "Unit Test CA", loaded.Cert.Subject.CommonName)
+
+	stat, err := os.Stat(keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+
+	// existing files must not be overwritten without the "--force" flag
+	cmd = ca.NewCommand()
+	cmd.SilenceUsage, cmd.SilenceErrors = true, true
+	cmd.SetArgs([]string{"init", "--cert", certFile, "--key", keyFile})
+
+	assert.ErrorContains(t, cmd.Execute(), "already exists")
+
+	cmd = ca.NewCommand()
+	cmd.SetArgs([]string{"init", "--cert", certFile, "--key", keyFile, "--force"})
+
+	capturer.CaptureStdout(func() {
+		assert.NoError(t, cmd.Execute())
+	})
+}
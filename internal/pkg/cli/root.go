@@ -5,6 +5,7 @@ import (
 	"context"
 
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/checkers"
+	caCmd "github.com/tarampampam/http-proxy-daemon/internal/pkg/cli/ca"
 	healthcheckCmd "github.com/tarampampam/http-proxy-daemon/internal/pkg/cli/healthcheck"
 	serveCmd "github.com/tarampampam/http-proxy-daemon/internal/pkg/cli/serve"
 	versionCmd "github.com/tarampampam/http-proxy-daemon/internal/pkg/cli/version"
@@ -62,6 +63,7 @@ func NewCommand(appName string) *cobra.Command {
 		versionCmd.NewCommand(version.Version()),
 		serveCmd.NewCommand(ctx, log),
 		healthcheckCmd.NewCommand(checkers.NewHealthChecker(ctx)),
+		caCmd.NewCommand(),
 	)
 
 	return cmd
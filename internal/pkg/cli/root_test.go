@@ -15,6 +15,7 @@ func TestSubcommands(t *testing.T) {
 	cases := []struct {
 		giveName string
 	}{
+		{giveName: "ca"},
 		{giveName: "healthcheck"},
 		{giveName: "serve"},
 		{giveName: "version"},
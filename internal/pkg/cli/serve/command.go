@@ -82,6 +82,13 @@ func run(parentCtx context.Context, log *zap.Logger, cfg config.Config, ip strin
 			zap.Uint16("port", port),
 			zap.String("proxy route prefix", cfg.Proxy.Prefix),
 			zap.Duration("proxy request timeout", cfg.Proxy.RequestTimeout),
+			zap.Duration("proxy stream idle timeout", cfg.Proxy.StreamIdleTimeout),
+			zap.String("forwarded headers", cfg.Proxy.ForwardedHeaders.Mode),
+			zap.Bool("auth", len(cfg.Auth.APIKeys) > 0 || cfg.Auth.HtpasswdFile != "" || cfg.Auth.JWT.JWKS != ""),
+			zap.Bool("deny private upstreams", cfg.Upstream.DenyPrivateNetworks),
+			zap.Bool("forward proxy", cfg.ForwardProxy.Enabled),
+			zap.Uint16s("connect allowed ports", cfg.ForwardProxy.ConnectAllowedPorts),
+			zap.Bool("tls interception", cfg.ForwardProxy.MITM.Enabled),
 		)
 
 		if err := server.Start(ip, port); err != nil && !errors.Is(err, http.ErrServerClosed) {
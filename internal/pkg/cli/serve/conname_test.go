@@ -37,6 +37,94 @@ func TestFlags(t *testing.T) {
 		{giveName: "port", wantShorthand: "p", wantDefault: "8080"},
 		{giveName: "prefix", wantShorthand: "x", wantDefault: "proxy"},
 		{giveName: "proxy-request-timeout", wantShorthand: "", wantDefault: "30s"},
+		{giveName: "proxy-stream-idle-timeout", wantShorthand: "", wantDefault: "1m0s"},
+		{giveName: "proxy-websocket-ping-interval", wantShorthand: "", wantDefault: "30s"},
+		{giveName: "rewrite-content", wantShorthand: "", wantDefault: "false"},
+		{giveName: "trusted-proxies", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "auth-api-keys", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "auth-api-key-header", wantShorthand: "", wantDefault: "X-Api-Key"},
+		{giveName: "auth-api-key-param", wantShorthand: "", wantDefault: "api_key"},
+		{giveName: "auth-htpasswd-file", wantShorthand: "", wantDefault: ""},
+		{giveName: "auth-jwt-jwks", wantShorthand: "", wantDefault: ""},
+		{giveName: "auth-jwt-jwks-refresh", wantShorthand: "", wantDefault: "1h0m0s"},
+		{giveName: "auth-jwt-issuer", wantShorthand: "", wantDefault: ""},
+		{giveName: "auth-jwt-audience", wantShorthand: "", wantDefault: ""},
+		{giveName: "auth-jwt-permissions-claim", wantShorthand: "", wantDefault: "scope"},
+		{giveName: "rate-limit", wantShorthand: "", wantDefault: ""},
+		{giveName: "rate-limit-hosts", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "max-in-flight", wantShorthand: "", wantDefault: "0"},
+		{giveName: "max-in-flight-per-host", wantShorthand: "", wantDefault: "0"},
+		{giveName: "admission-queue-size", wantShorthand: "", wantDefault: "100"},
+		{giveName: "admission-queue-timeout", wantShorthand: "", wantDefault: "10s"},
+		{giveName: "max-request-body-size", wantShorthand: "", wantDefault: "0"},
+		{giveName: "max-response-body-size", wantShorthand: "", wantDefault: "0"},
+		{giveName: "max-url-length", wantShorthand: "", wantDefault: "0"},
+		{giveName: "max-header-size", wantShorthand: "", wantDefault: "1MiB"},
+		{giveName: "cache", wantShorthand: "", wantDefault: "false"},
+		{giveName: "cache-max-size", wantShorthand: "", wantDefault: "64MiB"},
+		{giveName: "cache-max-entry-size", wantShorthand: "", wantDefault: "1MiB"},
+		{giveName: "cache-storage", wantShorthand: "", wantDefault: "memory"},
+		{giveName: "cache-dir", wantShorthand: "", wantDefault: ""},
+		{giveName: "cache-redis-url", wantShorthand: "", wantDefault: ""},
+		{giveName: "cache-redis-ttl", wantShorthand: "", wantDefault: "24h0m0s"},
+		{giveName: "retries", wantShorthand: "", wantDefault: "0"},
+		{giveName: "retry-backoff", wantShorthand: "", wantDefault: "100ms"},
+		{giveName: "retry-max-backoff", wantShorthand: "", wantDefault: "2s"},
+		{giveName: "retry-status-codes", wantShorthand: "", wantDefault: "[502,503,504]"},
+		{giveName: "retry-max-body-size", wantShorthand: "", wantDefault: "64KiB"},
+		{giveName: "circuit-breaker", wantShorthand: "", wantDefault: "false"},
+		{giveName: "circuit-breaker-failures", wantShorthand: "", wantDefault: "5"},
+		{giveName: "circuit-breaker-error-rate", wantShorthand: "", wantDefault: "0.5"},
+		{giveName: "circuit-breaker-min-requests", wantShorthand: "", wantDefault: "20"},
+		{giveName: "circuit-breaker-window", wantShorthand: "", wantDefault: "1m0s"},
+		{giveName: "circuit-breaker-open-timeout", wantShorthand: "", wantDefault: "30s"},
+		{giveName: "circuit-breaker-trials", wantShorthand: "", wantDefault: "1"},
+		{giveName: "admin-api-keys", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "upstream-deny-private", wantShorthand: "", wantDefault: "true"},
+		{giveName: "upstream-allow-networks", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "upstream-deny-networks", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "upstream-allow-hosts", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "upstream-deny-hosts", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "upstream-allowed-ports", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "upstream-tls-insecure", wantShorthand: "", wantDefault: "false"},
+		{giveName: "upstream-tls-ca", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "upstream-tls-insecure-hosts", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "upstream-tls-pins", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "upstream-tls-min-version", wantShorthand: "", wantDefault: "1.2"},
+		{giveName: "upstream-tls-cipher-suites", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "upstream-tls-client-certs", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "parent-proxy", wantShorthand: "", wantDefault: ""},
+		{giveName: "parent-proxy-rules", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "parent-proxy-from-env", wantShorthand: "", wantDefault: "false"},
+		{giveName: "forward-proxy", wantShorthand: "", wantDefault: "false"},
+		{giveName: "connect-allowed-ports", wantShorthand: "", wantDefault: "[443]"},
+		{giveName: "connect-idle-timeout", wantShorthand: "", wantDefault: "5m0s"},
+		{giveName: "forwarded-headers", wantShorthand: "", wantDefault: "append"},
+		{giveName: "forwarded-anonymize-hosts", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "redirects", wantShorthand: "", wantDefault: "follow"},
+		{giveName: "redirects-max", wantShorthand: "", wantDefault: "3"},
+		{giveName: "redirects-same-host", wantShorthand: "", wantDefault: "false"},
+		{giveName: "cors-allowed-origins", wantShorthand: "", wantDefault: "[*]"},
+		{giveName: "cors-allowed-methods", wantShorthand: "", wantDefault: "[GET,HEAD,POST,PUT,PATCH,DELETE]"},
+		{giveName: "cors-allowed-headers", wantShorthand: "", wantDefault: "[*]"},
+		{giveName: "cors-exposed-headers", wantShorthand: "", wantDefault: "[]"},
+		{giveName: "cors-allow-credentials", wantShorthand: "", wantDefault: "false"},
+		{giveName: "cors-max-age", wantShorthand: "", wantDefault: "0s"},
+		{giveName: "cors-upstream-headers", wantShorthand: "", wantDefault: "replace"},
+		{giveName: "compress", wantShorthand: "", wantDefault: "false"},
+		{giveName: "compress-encodings", wantShorthand: "", wantDefault: "[br,zstd,gzip]"},
+		{
+			giveName:      "compress-types",
+			wantShorthand: "",
+			wantDefault: "[text/*,application/json,application/*+json,application/x-ndjson,application/javascript," +
+				"application/xml,application/*+xml,image/svg+xml]",
+		},
+		{giveName: "compress-min-size", wantShorthand: "", wantDefault: "1KiB"},
+		{giveName: "compress-transcode-gzip", wantShorthand: "", wantDefault: "false"},
+		{giveName: "mitm", wantShorthand: "", wantDefault: "false"},
+		{giveName: "mitm-ca-cert", wantShorthand: "", wantDefault: ""},
+		{giveName: "mitm-ca-key", wantShorthand: "", wantDefault: ""},
+		{giveName: "mitm-hosts", wantShorthand: "", wantDefault: "[*]"},
 	}
 
 	for _, tt := range cases {
@@ -143,6 +231,362 @@ func TestFlagsWorkingWithoutCommandExecution(t *testing.T) {
 			},
 			wantErrorStrings: []string{"wrong proxy request timeout", "1d"},
 		},
+		{
+			name:    "Proxy Stream Idle Timeout Flag Wrong Env Value",
+			giveEnv: map[string]string{"PROXY_STREAM_IDLE_TIMEOUT": "1d"}, // invalid value
+			giveArgs: []string{
+				"--proxy-stream-idle-timeout", "1h", // valid value, but must be ignored
+			},
+			wantErrorStrings: []string{"wrong proxy stream idle timeout", "1d"},
+		},
+		{
+			name:    "Proxy WebSocket Ping Interval Flag Wrong Env Value",
+			giveEnv: map[string]string{"PROXY_WEBSOCKET_PING_INTERVAL": "1d"}, // invalid value
+			giveArgs: []string{
+				"--proxy-websocket-ping-interval", "1h", // valid value, but must be ignored
+			},
+			wantErrorStrings: []string{"wrong WebSocket ping interval", "1d"},
+		},
+		{
+			name:             "Forwarded Headers Flag Wrong Argument",
+			giveArgs:         []string{"--forwarded-headers", "foo"},
+			wantErrorStrings: []string{"unsupported forwarded headers mode", "foo"},
+		},
+		{
+			name:             "Forwarded Headers Flag Wrong Env Value",
+			giveEnv:          map[string]string{"FORWARDED_HEADERS": "bar"}, // invalid value
+			giveArgs:         []string{"--forwarded-headers", "strip"},      // valid value, but must be ignored
+			wantErrorStrings: []string{"unsupported forwarded headers mode", "bar"},
+		},
+		{
+			name:             "Redirects Flag Wrong Argument",
+			giveArgs:         []string{"--redirects", "foo"},
+			wantErrorStrings: []string{"unsupported redirects mode", "foo"},
+		},
+		{
+			name:             "Redirects Max Flag Wrong Env Value",
+			giveEnv:          map[string]string{"REDIRECTS_MAX": "-1"}, // invalid value
+			wantErrorStrings: []string{"wrong redirects max", "-1"},
+		},
+		{
+			name:             "Redirects Same Host Flag Wrong Env Value",
+			giveEnv:          map[string]string{"REDIRECTS_SAME_HOST": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong redirects same host", "foo"},
+		},
+		{
+			name:             "CORS Upstream Headers Flag Wrong Argument",
+			giveArgs:         []string{"--cors-upstream-headers", "foo"},
+			wantErrorStrings: []string{"unsupported CORS upstream headers mode", "foo"},
+		},
+		{
+			name:             "CORS Credentials For Any Origin",
+			giveArgs:         []string{"--cors-allow-credentials"},
+			wantErrorStrings: []string{"wrong CORS settings", "credentials cannot be allowed for any origin"},
+		},
+		{
+			name:             "CORS Allowed Origins Wrong Env Value",
+			giveEnv:          map[string]string{"CORS_ALLOWED_ORIGINS": "~(foo"}, // invalid value
+			wantErrorStrings: []string{"wrong CORS origin regular expression", "(foo"},
+		},
+		{
+			name:             "CORS Max Age Wrong Env Value",
+			giveEnv:          map[string]string{"CORS_MAX_AGE": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong CORS max age", "foo"},
+		},
+		{
+			name:             "Compress Flag Wrong Env Value",
+			giveEnv:          map[string]string{"COMPRESS": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong compress", "foo"},
+		},
+		{
+			name:             "Compress Encodings Flag Wrong Argument",
+			giveArgs:         []string{"--compress", "--compress-encodings", "br,deflate"},
+			wantErrorStrings: []string{"unsupported compression encoding", "deflate"},
+		},
+		{
+			name:             "Compress Types Flag Wrong Env Value",
+			giveArgs:         []string{"--compress"},
+			giveEnv:          map[string]string{"COMPRESS_TYPES": "text/*,json"}, // invalid value
+			wantErrorStrings: []string{"wrong compressible content type", "json"},
+		},
+		{
+			name:             "Compress Min Size Flag Wrong Argument",
+			giveArgs:         []string{"--compress", "--compress-min-size", "1XB"},
+			wantErrorStrings: []string{"wrong compression min size", "1XB"},
+		},
+		{
+			name:             "Compress Transcode Gzip Flag Wrong Env Value",
+			giveEnv:          map[string]string{"COMPRESS_TRANSCODE_GZIP": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong compress transcode gzip", "foo"},
+		},
+		{
+			name:             "API Keys Without Header And Param",
+			giveArgs:         []string{"--auth-api-keys", "foo", "--auth-api-key-header", "", "--auth-api-key-param", ""},
+			wantErrorStrings: []string{"API keys require the header or query parameter name"},
+		},
+		{
+			name:             "Htpasswd File Not Found",
+			giveEnv:          map[string]string{"AUTH_HTPASSWD_FILE": "/tmp/not-existing-htpasswd"},
+			wantErrorStrings: []string{"htpasswd file", "not found"},
+		},
+		{
+			name:             "JWT Without Issuer",
+			giveArgs:         []string{"--auth-jwt-jwks", "https://example.com/jwks.json", "--auth-jwt-audience", "proxy"},
+			wantErrorStrings: []string{"JWT validation requires the issuer and audience"},
+		},
+		{
+			name:             "JWKS Refresh Interval Flag Wrong Env Value",
+			giveEnv:          map[string]string{"AUTH_JWT_JWKS_REFRESH": "1d"}, // invalid value
+			wantErrorStrings: []string{"wrong JWKS refresh interval", "1d"},
+		},
+		{
+			name:             "Trusted Proxies Flag Wrong Env Value",
+			giveEnv:          map[string]string{"TRUSTED_PROXIES": "10.0.0.0/8,foo"},
+			wantErrorStrings: []string{"wrong trusted proxies", "foo"},
+		},
+		{
+			name:             "Rate Limit Flag Wrong Argument",
+			giveArgs:         []string{"--rate-limit", "100"},
+			wantErrorStrings: []string{"wrong rate limit", "100"},
+		},
+		{
+			name:             "Rate Limit Hosts Flag Wrong Env Value",
+			giveEnv:          map[string]string{"RATE_LIMIT_HOSTS": "example.com=1/s,foo.com"},
+			wantErrorStrings: []string{"wrong host rate limit", "foo.com"},
+		},
+		{
+			name:             "Max In-Flight Flag Wrong Env Value",
+			giveEnv:          map[string]string{"MAX_IN_FLIGHT": "-1"}, // invalid value
+			wantErrorStrings: []string{"wrong max in-flight requests", "-1"},
+		},
+		{
+			name:             "Admission Queue Timeout Flag Wrong Argument",
+			giveArgs:         []string{"--admission-queue-timeout", "-1s"},
+			wantErrorStrings: []string{"wrong admission queue timeout"},
+		},
+		{
+			name:             "Max Request Body Size Flag Wrong Argument",
+			giveArgs:         []string{"--max-request-body-size", "10XB"},
+			wantErrorStrings: []string{"wrong max request body size", "10XB"},
+		},
+		{
+			name:             "Max Response Body Size Flag Wrong Env Value",
+			giveEnv:          map[string]string{"MAX_RESPONSE_BODY_SIZE": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong max response body size", "foo"},
+		},
+		{
+			name:             "Max URL Length Flag Wrong Env Value",
+			giveEnv:          map[string]string{"MAX_URL_LENGTH": "-1"}, // invalid value
+			wantErrorStrings: []string{"wrong max URL length", "-1"},
+		},
+		{
+			name:             "Max Header Size Flag Wrong Argument",
+			giveArgs:         []string{"--max-header-size", "4GiB"}, // too large
+			wantErrorStrings: []string{"wrong max header size", "4GiB"},
+		},
+		{
+			name:             "Cache Flag Wrong Env Value",
+			giveEnv:          map[string]string{"CACHE": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong cache", "foo"},
+		},
+		{
+			name:             "Cache Max Size Flag Wrong Argument",
+			giveArgs:         []string{"--cache", "--cache-max-size", "64XB"},
+			wantErrorStrings: []string{"wrong cache max size", "64XB"},
+		},
+		{
+			name:             "Cache Max Entry Size Flag Wrong Env Value",
+			giveEnv:          map[string]string{"CACHE": "true", "CACHE_MAX_ENTRY_SIZE": "0"},
+			wantErrorStrings: []string{"wrong cache max entry size", "0"},
+		},
+		{
+			name:             "Cache Storage Flag Wrong Argument",
+			giveArgs:         []string{"--cache", "--cache-storage", "foo"},
+			wantErrorStrings: []string{"unsupported cache storage", "foo"},
+		},
+		{
+			name:             "Cache Disk Storage Without Directory",
+			giveArgs:         []string{"--cache", "--cache-storage", "disk"},
+			wantErrorStrings: []string{"disk cache storage requires the directory"},
+		},
+		{
+			name:             "Cache Redis URL Flag Wrong Env Value",
+			giveEnv:          map[string]string{"CACHE": "true", "CACHE_STORAGE": "redis", "CACHE_REDIS_URL": "http://foo"},
+			wantErrorStrings: []string{"wrong cache redis URL", "http"},
+		},
+		{
+			name:             "Cache Redis TTL Flag Wrong Env Value",
+			giveEnv:          map[string]string{"CACHE_REDIS_TTL": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong cache redis TTL", "foo"},
+		},
+		{
+			name:             "Retries Flag Wrong Env Value",
+			giveEnv:          map[string]string{"RETRIES": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong retries", "foo"},
+		},
+		{
+			name:             "Retry Backoff Flag Wrong Argument",
+			giveArgs:         []string{"--retries", "2", "--retry-backoff", "3s", "--retry-max-backoff", "1s"},
+			wantErrorStrings: []string{"wrong retry backoff", "3s", "1s"},
+		},
+		{
+			name:             "Retry Status Codes Flag Wrong Argument",
+			giveArgs:         []string{"--retries", "2", "--retry-status-codes", "503,1000"},
+			wantErrorStrings: []string{"wrong retry status code", "1000"},
+		},
+		{
+			name:             "Retry Status Codes Flag Wrong Env Value",
+			giveEnv:          map[string]string{"RETRY_STATUS_CODES": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong retry status codes", "foo"},
+		},
+		{
+			name:             "Retry Max Body Size Flag Wrong Env Value",
+			giveEnv:          map[string]string{"RETRIES": "1", "RETRY_MAX_BODY_SIZE": "foo"},
+			wantErrorStrings: []string{"wrong retry max body size", "foo"},
+		},
+		{
+			name:             "Circuit Breaker Flag Wrong Env Value",
+			giveEnv:          map[string]string{"CIRCUIT_BREAKER": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong circuit breaker", "foo"},
+		},
+		{
+			name:             "Circuit Breaker Error Rate Flag Wrong Env Value",
+			giveEnv:          map[string]string{"CIRCUIT_BREAKER_ERROR_RATE": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong circuit breaker error rate", "foo"},
+		},
+		{
+			name:             "Circuit Breaker Error Rate Flag Wrong Argument",
+			giveArgs:         []string{"--circuit-breaker", "--circuit-breaker-error-rate", "2"},
+			wantErrorStrings: []string{"wrong circuit breaker settings", "wrong error rate"},
+		},
+		{
+			name:             "Circuit Breaker Without Failures Checking",
+			giveEnv:          map[string]string{"CIRCUIT_BREAKER_FAILURES": "0", "CIRCUIT_BREAKER_ERROR_RATE": "0"},
+			giveArgs:         []string{"--circuit-breaker"},
+			wantErrorStrings: []string{"consecutive failures count or error rate is required"},
+		},
+		{
+			name:             "Circuit Breaker Open Timeout Flag Wrong Env Value",
+			giveEnv:          map[string]string{"CIRCUIT_BREAKER_OPEN_TIMEOUT": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong circuit breaker open timeout", "foo"},
+		},
+		{
+			name:             "Circuit Breaker Trials Flag Wrong Argument",
+			giveArgs:         []string{"--circuit-breaker", "--circuit-breaker-trials", "0"},
+			wantErrorStrings: []string{"wrong half-open requests count"},
+		},
+		{
+			name:             "Upstream Deny Private Flag Wrong Env Value",
+			giveEnv:          map[string]string{"UPSTREAM_DENY_PRIVATE": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong upstream deny private", "foo"},
+		},
+		{
+			name:             "Upstream Allow Networks Flag Wrong Argument",
+			giveArgs:         []string{"--upstream-allow-networks", "10.0.0.0/8,foo"},
+			wantErrorStrings: []string{"wrong upstream allowed networks", "foo"},
+		},
+		{
+			name:             "Upstream Deny Networks Flag Wrong Env Value",
+			giveEnv:          map[string]string{"UPSTREAM_DENY_NETWORKS": "10.0.0.0/33"}, // invalid value
+			wantErrorStrings: []string{"wrong upstream denied networks", "10.0.0.0/33"},
+		},
+		{
+			name:             "Upstream Allowed Ports Flag Wrong Argument",
+			giveArgs:         []string{"--upstream-allowed-ports", "0"},
+			wantErrorStrings: []string{"wrong upstream allowed port", "0"},
+		},
+		{
+			name:             "Upstream Allowed Ports Flag Wrong Env Value",
+			giveEnv:          map[string]string{"UPSTREAM_ALLOWED_PORTS": "80,foo"}, // invalid value
+			wantErrorStrings: []string{"wrong upstream allowed ports", "80,foo"},
+		},
+		{
+			name:             "Upstream TLS Insecure Flag Wrong Env Value",
+			giveEnv:          map[string]string{"UPSTREAM_TLS_INSECURE": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong upstream TLS insecure", "foo"},
+		},
+		{
+			name:             "Upstream TLS CA Flag Wrong Argument",
+			giveArgs:         []string{"--upstream-tls-ca", "/foo/bar.pem"},
+			wantErrorStrings: []string{"upstream TLS CA", "/foo/bar.pem", "not found"},
+		},
+		{
+			name:             "Upstream TLS Pins Flag Wrong Env Value",
+			giveEnv:          map[string]string{"UPSTREAM_TLS_PINS": "example.com=md5/foo"}, // invalid value
+			wantErrorStrings: []string{"wrong pin", "example.com=md5/foo"},
+		},
+		{
+			name:             "Upstream TLS Min Version Flag Wrong Argument",
+			giveArgs:         []string{"--upstream-tls-min-version", "2.0"},
+			wantErrorStrings: []string{"unsupported TLS version", "2.0"},
+		},
+		{
+			name:             "Upstream TLS Cipher Suites Flag Wrong Env Value",
+			giveEnv:          map[string]string{"UPSTREAM_TLS_CIPHER_SUITES": "foo"}, // invalid value
+			wantErrorStrings: []string{"unsupported cipher suite", "foo"},
+		},
+		{
+			name:             "Upstream TLS Client Certs Flag Wrong Argument",
+			giveArgs:         []string{"--upstream-tls-client-certs", "example.com=client.crt"},
+			wantErrorStrings: []string{"wrong client certificate", "example.com=client.crt"},
+		},
+		{
+			name:             "Upstream TLS Client Certs Flag Wrong Env Value",
+			giveEnv:          map[string]string{"UPSTREAM_TLS_CLIENT_CERTS": "example.com=/foo/a.crt:/foo/a.key"},
+			wantErrorStrings: []string{"upstream TLS client certificate file", "/foo/a.crt", "not found"},
+		},
+		{
+			name:             "Parent Proxy Flag Wrong Argument",
+			giveArgs:         []string{"--parent-proxy", "ftp://proxy"},
+			wantErrorStrings: []string{"unsupported parent proxy scheme", "ftp"},
+		},
+		{
+			name:             "Parent Proxy Rules Flag Wrong Env Value",
+			giveEnv:          map[string]string{"PARENT_PROXY_RULES": "example.com"}, // invalid value
+			wantErrorStrings: []string{"wrong parent proxy rule", "example.com"},
+		},
+		{
+			name:             "Parent Proxy From Env Flag Wrong Env Value",
+			giveEnv:          map[string]string{"PARENT_PROXY_FROM_ENV": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong parent proxy from env", "foo"},
+		},
+		{
+			name:             "Forward Proxy Flag Wrong Env Value",
+			giveEnv:          map[string]string{"FORWARD_PROXY": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong forward proxy", "foo"},
+		},
+		{
+			name: "CONNECT Allowed Ports Flag Wrong Argument",
+			giveArgs: []string{
+				"--connect-allowed-ports", "443,65536", // 65535 is max
+			},
+			wantErrorStrings: []string{"wrong CONNECT allowed port", "65536"},
+		},
+		{
+			name:             "CONNECT Allowed Ports Flag Wrong Env Value",
+			giveEnv:          map[string]string{"CONNECT_ALLOWED_PORTS": "443,foo"}, // invalid value
+			wantErrorStrings: []string{"wrong CONNECT allowed ports", "443,foo"},
+		},
+		{
+			name:             "CONNECT Idle Timeout Flag Wrong Env Value",
+			giveEnv:          map[string]string{"CONNECT_IDLE_TIMEOUT": "1d"}, // invalid value
+			wantErrorStrings: []string{"wrong CONNECT idle timeout", "1d"},
+		},
+		{
+			name:             "MITM Flag Without Forward Proxy",
+			giveArgs:         []string{"--mitm", "--mitm-ca-cert", "ca.crt", "--mitm-ca-key", "ca.key"},
+			wantErrorStrings: []string{"requires the forward-proxy mode"},
+		},
+		{
+			name:             "MITM Flag Without CA Files",
+			giveArgs:         []string{"--forward-proxy", "--mitm"},
+			wantErrorStrings: []string{"requires CA certificate and private key"},
+		},
+		{
+			name:             "MITM Flag Wrong Env Value",
+			giveEnv:          map[string]string{"MITM": "foo"}, // invalid value
+			wantErrorStrings: []string{"wrong MITM", "foo"},
+		},
 	} {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
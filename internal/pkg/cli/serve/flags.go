@@ -3,13 +3,29 @@ package serve
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net"
+	"net/http"
+	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/bytesize"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/circuit"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/compression"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/config"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/cors"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/env"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/forwarded"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/httpcache"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/netpolicy"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/parentproxy"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/ratelimit"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redirect"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redis"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/upstreamtls"
 
 	"github.com/spf13/pflag"
 )
@@ -21,64 +37,1409 @@ type flags struct {
 	}
 
 	proxy struct {
-		routePrefix    string
-		requestTimeout time.Duration
+		routePrefix       string
+		requestTimeout    time.Duration
+		streamIdleTimeout time.Duration
+		wsPingInterval    time.Duration
+		rewriteContent    bool
+		trustedProxies    []string
 	}
+
+	forwardedHeaders struct {
+		mode           string
+		anonymizeHosts []string
+	}
+
+	redirects struct {
+		mode     string
+		max      uint
+		sameHost bool
+	}
+
+	cors struct {
+		allowedOrigins   []string
+		allowedMethods   []string
+		allowedHeaders   []string
+		exposedHeaders   []string
+		allowCredentials bool
+		maxAge           time.Duration
+		upstreamHeaders  string
+	}
+
+	compression struct {
+		enabled       bool
+		encodings     []string
+		contentTypes  []string
+		minSize       string
+		transcodeGzip bool
+	}
+
+	auth struct {
+		apiKeys      []string
+		apiKeyHeader string
+		apiKeyParam  string
+		htpasswdFile string
+
+		jwt struct {
+			jwks             string
+			jwksRefresh      time.Duration
+			issuer           string
+			audience         string
+			permissionsClaim string
+		}
+	}
+
+	rateLimit struct {
+		limit      string
+		hostLimits []string
+	}
+
+	admission struct {
+		maxInFlight        uint
+		maxInFlightPerHost uint
+		queueSize          uint
+		queueTimeout       time.Duration
+	}
+
+	limits struct {
+		maxRequestBodySize  string
+		maxResponseBodySize string
+		maxURLLength        uint
+		maxHeaderSize       string
+	}
+
+	cache struct {
+		enabled      bool
+		storage      string
+		maxSize      string
+		maxEntrySize string
+		dir          string
+		redisURL     string
+		redisTTL     time.Duration
+	}
+
+	retry struct {
+		maxRetries  uint
+		backoff     time.Duration
+		maxBackoff  time.Duration
+		statusCodes []uint
+		maxBodySize string
+	}
+
+	circuitBreaker struct {
+		enabled     bool
+		failures    uint
+		errorRate   float64
+		minRequests uint
+		window      time.Duration
+		openTimeout time.Duration
+		trials      uint
+	}
+
+	admin struct {
+		apiKeys []string
+	}
+
+	upstream struct {
+		denyPrivate   bool
+		allowNetworks []string
+		denyNetworks  []string
+		allowHosts    []string
+		denyHosts     []string
+		allowedPorts  []uint
+	}
+
+	upstreamTLS struct {
+		insecure      bool
+		caFiles       []string
+		insecureHosts []string
+		pins          []string
+		minVersion    string
+		cipherSuites  []string
+		clientCerts   []string
+	}
+
+	parentProxy struct {
+		url     string
+		rules   []string
+		fromEnv bool
+	}
+
+	forwardProxy struct {
+		enabled             bool
+		connectAllowedPorts []uint
+		connectIdleTimeout  time.Duration
+	}
+
+	mitm struct {
+		enabled bool
+		caCert  string
+		caKey   string
+		hosts   []string
+	}
+}
+
+func (f *flags) init(flagSet *pflag.FlagSet) {
+	flagSet.StringVarP(
+		&f.listen.ip,
+		"listen",
+		"l",
+		"0.0.0.0",
+		fmt.Sprintf("IP address to listen on [$%s]", env.ListenAddr),
+	)
+	flagSet.Uint16VarP(
+		&f.listen.port,
+		"port",
+		"p",
+		8080, //nolint:gomnd
+		fmt.Sprintf("TCP port number [$%s]", env.ListenPort),
+	)
+	flagSet.StringVarP(
+		&f.proxy.routePrefix,
+		"prefix",
+		"x",
+		"proxy",
+		fmt.Sprintf("Proxy route prefix [$%s]", env.ProxyRoutePrefix),
+	)
+	flagSet.DurationVarP(
+		&f.proxy.requestTimeout,
+		"proxy-request-timeout",
+		"",
+		time.Second*30, //nolint:gomnd
+		fmt.Sprintf("Proxy request timeout (examples: 5s, 15s30ms) [$%s]", env.ProxyRequestTimeout),
+	)
+	flagSet.DurationVarP(
+		&f.proxy.streamIdleTimeout,
+		"proxy-stream-idle-timeout",
+		"",
+		time.Second*60, //nolint:gomnd
+		fmt.Sprintf("Maximal idle time between streaming response (SSE, chunked) chunks [$%s]", env.ProxyStreamIdleTimeout),
+	)
+	flagSet.DurationVarP(
+		&f.proxy.wsPingInterval,
+		"proxy-websocket-ping-interval",
+		"",
+		time.Second*30, //nolint:gomnd
+		fmt.Sprintf("WebSocket keepalive pings interval (0 to disable) [$%s]", env.ProxyWebsocketPingInterval),
+	)
+	flagSet.BoolVarP(
+		&f.proxy.rewriteContent,
+		"rewrite-content",
+		"",
+		false,
+		fmt.Sprintf("Rewrite URLs in the HTML and CSS responses, so the pages work through the proxy [$%s]",
+			env.RewriteContent,
+		),
+	)
+	flagSet.StringSliceVarP(
+		&f.proxy.trustedProxies,
+		"trusted-proxies",
+		"",
+		[]string{},
+		fmt.Sprintf("Networks (CIDR) of the proxies, trusted to set the client IP headers [$%s]", env.TrustedProxies),
+	)
+	flagSet.StringVarP(
+		&f.forwardedHeaders.mode,
+		"forwarded-headers",
+		"",
+		string(forwarded.ModeAppend),
+		fmt.Sprintf("X-Forwarded-*, Forwarded and Via headers mode (%s) [$%s]", forwardedModes(), env.ForwardedHeaders),
+	)
+	flagSet.StringSliceVarP(
+		&f.forwardedHeaders.anonymizeHosts,
+		"forwarded-anonymize-hosts",
+		"",
+		[]string{},
+		fmt.Sprintf("Always anonymize requests to the hosts (glob patterns) [$%s]", env.ForwardedAnonymizeHosts),
+	)
+	flagSet.StringVarP(
+		&f.redirects.mode,
+		"redirects",
+		"",
+		string(redirect.ModeFollow),
+		fmt.Sprintf("Upstream redirects mode (%s) [$%s]", redirectModes(), env.Redirects),
+	)
+	flagSet.UintVarP(
+		&f.redirects.max,
+		"redirects-max",
+		"",
+		3, //nolint:gomnd
+		fmt.Sprintf("Maximal number of the followed upstream redirects [$%s]", env.RedirectsMax),
+	)
+	flagSet.BoolVarP(
+		&f.redirects.sameHost,
+		"redirects-same-host",
+		"",
+		false,
+		fmt.Sprintf("Follow the same host redirects only, pass the others through [$%s]", env.RedirectsSameHost),
+	)
+	flagSet.StringSliceVarP(
+		&f.cors.allowedOrigins,
+		"cors-allowed-origins",
+		"",
+		[]string{"*"},
+		fmt.Sprintf("CORS allowed origins (exact, \"https://*.example.com\", \"~regex\" or \"*\") [$%s]",
+			env.CORSAllowedOrigins,
+		),
+	)
+	flagSet.StringSliceVarP(
+		&f.cors.allowedMethods,
+		"cors-allowed-methods",
+		"",
+		[]string{
+			http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		},
+		fmt.Sprintf("CORS allowed methods [$%s]", env.CORSAllowedMethods),
+	)
+	flagSet.StringSliceVarP(
+		&f.cors.allowedHeaders,
+		"cors-allowed-headers",
+		"",
+		[]string{"*"},
+		fmt.Sprintf("CORS allowed request headers (\"*\" allows any) [$%s]", env.CORSAllowedHeaders),
+	)
+	flagSet.StringSliceVarP(
+		&f.cors.exposedHeaders,
+		"cors-exposed-headers",
+		"",
+		[]string{},
+		fmt.Sprintf("CORS exposed response headers [$%s]", env.CORSExposedHeaders),
+	)
+	flagSet.BoolVarP(
+		&f.cors.allowCredentials,
+		"cors-allow-credentials",
+		"",
+		false,
+		fmt.Sprintf("Allow CORS requests with credentials (cookies, authorization headers) [$%s]",
+			env.CORSAllowCredentials,
+		),
+	)
+	flagSet.DurationVarP(
+		&f.cors.maxAge,
+		"cors-max-age",
+		"",
+		0,
+		fmt.Sprintf("CORS preflight responses caching time (0 means \"not set\") [$%s]", env.CORSMaxAge),
+	)
+	flagSet.StringVarP(
+		&f.cors.upstreamHeaders,
+		"cors-upstream-headers",
+		"",
+		string(cors.UpstreamReplace),
+		fmt.Sprintf("Upstream CORS headers handling mode (%s) [$%s]", corsUpstreamModes(), env.CORSUpstreamHeaders),
+	)
+	flagSet.BoolVarP(
+		&f.compression.enabled,
+		"compress",
+		"",
+		false,
+		fmt.Sprintf("Compress the proxy route responses, when the clients accept it [$%s]", env.Compress),
+	)
+	flagSet.StringSliceVarP(
+		&f.compression.encodings,
+		"compress-encodings",
+		"",
+		compressionEncodings(),
+		fmt.Sprintf("Compression encodings in the preference order [$%s]", env.CompressEncodings),
+	)
+	flagSet.StringSliceVarP(
+		&f.compression.contentTypes,
+		"compress-types",
+		"",
+		[]string{
+			"text/*", "application/json", "application/*+json", "application/x-ndjson", "application/javascript",
+			"application/xml", "application/*+xml", "image/svg+xml",
+		},
+		fmt.Sprintf("Compressible content types (like \"text/*\" or \"application/*+json\") [$%s]", env.CompressTypes),
+	)
+	flagSet.StringVarP(
+		&f.compression.minSize,
+		"compress-min-size",
+		"",
+		"1KiB",
+		fmt.Sprintf("Responses with the known smaller length are not compressed [$%s]", env.CompressMinSize),
+	)
+	flagSet.BoolVarP(
+		&f.compression.transcodeGzip,
+		"compress-transcode-gzip",
+		"",
+		false,
+		fmt.Sprintf("Re-encode gzip responses using brotli, when the clients accept it [$%s]", env.CompressTranscodeGzip),
+	)
+	flagSet.StringSliceVarP(
+		&f.auth.apiKeys,
+		"auth-api-keys",
+		"",
+		[]string{},
+		fmt.Sprintf("API keys for the proxy clients authentication [$%s]", env.AuthAPIKeys),
+	)
+	flagSet.StringVarP(
+		&f.auth.apiKeyHeader,
+		"auth-api-key-header",
+		"",
+		"X-Api-Key",
+		fmt.Sprintf("API key header name (empty to disable) [$%s]", env.AuthAPIKeyHeader),
+	)
+	flagSet.StringVarP(
+		&f.auth.apiKeyParam,
+		"auth-api-key-param",
+		"",
+		"api_key",
+		fmt.Sprintf("API key query parameter name (empty to disable) [$%s]", env.AuthAPIKeyParam),
+	)
+	flagSet.StringVarP(
+		&f.auth.htpasswdFile,
+		"auth-htpasswd-file",
+		"",
+		"",
+		fmt.Sprintf("htpasswd file (bcrypt or SHA1) for the Basic auth [$%s]", env.AuthHtpasswdFile),
+	)
+	flagSet.StringVarP(
+		&f.auth.jwt.jwks,
+		"auth-jwt-jwks",
+		"",
+		"",
+		fmt.Sprintf("JWKS file path or URL for the bearer tokens (JWT) validation [$%s]", env.AuthJWTJWKS),
+	)
+	flagSet.DurationVarP(
+		&f.auth.jwt.jwksRefresh,
+		"auth-jwt-jwks-refresh",
+		"",
+		time.Hour,
+		fmt.Sprintf("JWKS refreshing interval (zero to refresh on the unknown keys only) [$%s]", env.AuthJWTJWKSRefresh),
+	)
+	flagSet.StringVarP(
+		&f.auth.jwt.issuer,
+		"auth-jwt-issuer",
+		"",
+		"",
+		fmt.Sprintf("Expected JWT issuer (\"iss\" claim) [$%s]", env.AuthJWTIssuer),
+	)
+	flagSet.StringVarP(
+		&f.auth.jwt.audience,
+		"auth-jwt-audience",
+		"",
+		"",
+		fmt.Sprintf("Expected JWT audience (\"aud\" claim) [$%s]", env.AuthJWTAudience),
+	)
+	flagSet.StringVarP(
+		&f.auth.jwt.permissionsClaim,
+		"auth-jwt-permissions-claim",
+		"",
+		"scope",
+		fmt.Sprintf("JWT claim with the client permissions (scopes) [$%s]", env.AuthJWTPermissionsClaim),
+	)
+	flagSet.StringVarP(
+		&f.rateLimit.limit,
+		"rate-limit",
+		"",
+		"",
+		fmt.Sprintf("Per-client requests rate limit, like \"100/m\" (empty to disable) [$%s]", env.RateLimit),
+	)
+	flagSet.StringSliceVarP(
+		&f.rateLimit.hostLimits,
+		"rate-limit-hosts",
+		"",
+		[]string{},
+		fmt.Sprintf("Per-client upstream hosts rate limits, like \"*.example.com=10/s\" [$%s]", env.RateLimitHosts),
+	)
+	flagSet.UintVarP(
+		&f.admission.maxInFlight,
+		"max-in-flight",
+		"",
+		0,
+		fmt.Sprintf("Maximal in-flight requests count (zero for no limit) [$%s]", env.MaxInFlight),
+	)
+	flagSet.UintVarP(
+		&f.admission.maxInFlightPerHost,
+		"max-in-flight-per-host",
+		"",
+		0,
+		fmt.Sprintf("Maximal in-flight requests count per upstream host (zero for no limit) [$%s]", env.MaxInFlightPerHost),
+	)
+	flagSet.UintVarP(
+		&f.admission.queueSize,
+		"admission-queue-size",
+		"",
+		100, //nolint:gomnd
+		fmt.Sprintf("Waiting queue size for the in-flight requests limits [$%s]", env.AdmissionQueueSize),
+	)
+	flagSet.DurationVarP(
+		&f.admission.queueTimeout,
+		"admission-queue-timeout",
+		"",
+		time.Second*10, //nolint:gomnd
+		fmt.Sprintf("Maximal waiting time in the queue (zero for no timeout) [$%s]", env.AdmissionQueueTimeout),
+	)
+	flagSet.StringVarP(
+		&f.limits.maxRequestBodySize,
+		"max-request-body-size",
+		"",
+		"0",
+		fmt.Sprintf("Maximal request body size (examples: 512KB, 10MiB; zero for no limit) [$%s]", env.MaxRequestBodySize),
+	)
+	flagSet.StringVarP(
+		&f.limits.maxResponseBodySize,
+		"max-response-body-size",
+		"",
+		"0",
+		fmt.Sprintf("Maximal upstream response body size (zero for no limit) [$%s]", env.MaxResponseBodySize),
+	)
+	flagSet.UintVarP(
+		&f.limits.maxURLLength,
+		"max-url-length",
+		"",
+		0,
+		fmt.Sprintf("Maximal request URL length (zero for no limit) [$%s]", env.MaxURLLength),
+	)
+	flagSet.StringVarP(
+		&f.limits.maxHeaderSize,
+		"max-header-size",
+		"",
+		"1MiB",
+		fmt.Sprintf("Maximal request line and headers size [$%s]", env.MaxHeaderSize),
+	)
+	flagSet.BoolVarP(
+		&f.cache.enabled,
+		"cache",
+		"",
+		false,
+		fmt.Sprintf("Enable upstream responses caching (RFC 9111) [$%s]", env.Cache),
+	)
+	flagSet.StringVarP(
+		&f.cache.storage,
+		"cache-storage",
+		"",
+		httpcache.StorageMemory,
+		fmt.Sprintf("Cache storage (%s) [$%s]", strings.Join(httpcache.StorageTypes(), ", "), env.CacheStorage),
+	)
+	flagSet.StringVarP(
+		&f.cache.maxSize,
+		"cache-max-size",
+		"",
+		"64MiB",
+		fmt.Sprintf("Maximal total size of the cached responses (examples: 512KB, 64MiB) [$%s]", env.CacheMaxSize),
+	)
+	flagSet.StringVarP(
+		&f.cache.maxEntrySize,
+		"cache-max-entry-size",
+		"",
+		"1MiB",
+		fmt.Sprintf("Maximal size of the cached response body [$%s]", env.CacheMaxEntrySize),
+	)
+	flagSet.StringVarP(
+		&f.cache.dir,
+		"cache-dir",
+		"",
+		"",
+		fmt.Sprintf("Disk cache storage directory [$%s]", env.CacheDir),
+	)
+	flagSet.StringVarP(
+		&f.cache.redisURL,
+		"cache-redis-url",
+		"",
+		"",
+		fmt.Sprintf("Redis cache storage URL, like \"redis://:password@localhost:6379/0\" [$%s]", env.CacheRedisURL),
+	)
+	flagSet.DurationVarP(
+		&f.cache.redisTTL,
+		"cache-redis-ttl",
+		"",
+		time.Hour*24, //nolint:gomnd
+		fmt.Sprintf("Cached responses expiration time in Redis (zero for no expiration) [$%s]", env.CacheRedisTTL),
+	)
+	flagSet.UintVarP(
+		&f.retry.maxRetries,
+		"retries",
+		"",
+		0,
+		fmt.Sprintf("Maximal retries count for the failed idempotent upstream requests (zero disables) [$%s]", env.Retries),
+	)
+	flagSet.DurationVarP(
+		&f.retry.backoff,
+		"retry-backoff",
+		"",
+		time.Millisecond*100, //nolint:gomnd
+		fmt.Sprintf("Delay before the first retry, doubled for each next retry [$%s]", env.RetryBackoff),
+	)
+	flagSet.DurationVarP(
+		&f.retry.maxBackoff,
+		"retry-max-backoff",
+		"",
+		time.Second*2, //nolint:gomnd
+		fmt.Sprintf("Maximal delay between the retries [$%s]", env.RetryMaxBackoff),
+	)
+	flagSet.UintSliceVarP(
+		&f.retry.statusCodes,
+		"retry-status-codes",
+		"",
+		[]uint{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		fmt.Sprintf("Retried upstream response status codes [$%s]", env.RetryStatusCodes),
+	)
+	flagSet.StringVarP(
+		&f.retry.maxBodySize,
+		"retry-max-body-size",
+		"",
+		"64KiB",
+		fmt.Sprintf("Maximal request body size, buffered to be replayed on retries [$%s]", env.RetryMaxBodySize),
+	)
+	flagSet.BoolVarP(
+		&f.circuitBreaker.enabled,
+		"circuit-breaker",
+		"",
+		false,
+		fmt.Sprintf("Enable per upstream host circuit breakers [$%s]", env.CircuitBreaker),
+	)
+	flagSet.UintVarP(
+		&f.circuitBreaker.failures,
+		"circuit-breaker-failures",
+		"",
+		5, //nolint:gomnd
+		fmt.Sprintf("Consecutive failures count to open the breaker (zero disables) [$%s]", env.CircuitBreakerFailures),
+	)
+	flagSet.Float64VarP(
+		&f.circuitBreaker.errorRate,
+		"circuit-breaker-error-rate",
+		"",
+		0.5, //nolint:gomnd
+		fmt.Sprintf("Failures ratio (0..1) to open the breaker (zero disables) [$%s]", env.CircuitBreakerErrorRate),
+	)
+	flagSet.UintVarP(
+		&f.circuitBreaker.minRequests,
+		"circuit-breaker-min-requests",
+		"",
+		20, //nolint:gomnd
+		fmt.Sprintf("Minimal requests count within the window to check the error rate [$%s]", env.CircuitBreakerMinRequests),
+	)
+	flagSet.DurationVarP(
+		&f.circuitBreaker.window,
+		"circuit-breaker-window",
+		"",
+		time.Minute,
+		fmt.Sprintf("Error rate measuring window [$%s]", env.CircuitBreakerWindow),
+	)
+	flagSet.DurationVarP(
+		&f.circuitBreaker.openTimeout,
+		"circuit-breaker-open-timeout",
+		"",
+		time.Second*30, //nolint:gomnd
+		fmt.Sprintf("Open breaker duration, before the trial requests are passed [$%s]", env.CircuitBreakerOpenTimeout),
+	)
+	flagSet.UintVarP(
+		&f.circuitBreaker.trials,
+		"circuit-breaker-trials",
+		"",
+		1,
+		fmt.Sprintf("Successful trial requests count to close the breaker [$%s]", env.CircuitBreakerTrials),
+	)
+	flagSet.StringSliceVarP(
+		&f.admin.apiKeys,
+		"admin-api-keys",
+		"",
+		[]string{},
+		fmt.Sprintf("API keys for the administrative API (X-Admin-Key header) [$%s]", env.AdminAPIKeys),
+	)
+	flagSet.BoolVarP(
+		&f.upstream.denyPrivate,
+		"upstream-deny-private",
+		"",
+		true,
+		fmt.Sprintf("Deny loopback, private, link-local (cloud metadata) upstream networks [$%s]", env.UpstreamDenyPrivate),
+	)
+	flagSet.StringSliceVarP(
+		&f.upstream.allowNetworks,
+		"upstream-allow-networks",
+		"",
+		[]string{},
+		fmt.Sprintf("Allowed upstream networks (CIDR, exceptions for the denied) [$%s]", env.UpstreamAllowNetworks),
+	)
+	flagSet.StringSliceVarP(
+		&f.upstream.denyNetworks,
+		"upstream-deny-networks",
+		"",
+		[]string{},
+		fmt.Sprintf("Denied upstream networks (CIDR notation) [$%s]", env.UpstreamDenyNetworks),
+	)
+	flagSet.StringSliceVarP(
+		&f.upstream.allowHosts,
+		"upstream-allow-hosts",
+		"",
+		[]string{},
+		fmt.Sprintf("Allowed upstream hosts (glob patterns, exceptions for the denied) [$%s]", env.UpstreamAllowHosts),
+	)
+	flagSet.StringSliceVarP(
+		&f.upstream.denyHosts,
+		"upstream-deny-hosts",
+		"",
+		[]string{},
+		fmt.Sprintf("Denied upstream hosts (glob patterns, like *.internal) [$%s]", env.UpstreamDenyHosts),
+	)
+	flagSet.UintSliceVarP(
+		&f.upstream.allowedPorts,
+		"upstream-allowed-ports",
+		"",
+		[]uint{},
+		fmt.Sprintf("Allowed upstream ports (empty means any) [$%s]", env.UpstreamAllowedPorts),
+	)
+	flagSet.BoolVarP(
+		&f.upstreamTLS.insecure,
+		"upstream-tls-insecure",
+		"",
+		false,
+		fmt.Sprintf("Skip upstream TLS certificates verification (insecure) [$%s]", env.UpstreamTLSInsecure),
+	)
+	flagSet.StringSliceVarP(
+		&f.upstreamTLS.caFiles,
+		"upstream-tls-ca",
+		"",
+		[]string{},
+		fmt.Sprintf("Additional trusted CA certificates (PEM files or directories) [$%s]", env.UpstreamTLSCA),
+	)
+	flagSet.StringSliceVarP(
+		&f.upstreamTLS.insecureHosts,
+		"upstream-tls-insecure-hosts",
+		"",
+		[]string{},
+		fmt.Sprintf("Skip certificates verification for the hosts (glob patterns) [$%s]", env.UpstreamTLSInsecureHosts),
+	)
+	flagSet.StringSliceVarP(
+		&f.upstreamTLS.pins,
+		"upstream-tls-pins",
+		"",
+		[]string{},
+		fmt.Sprintf("Upstream public key pins, like \"example.com=sha256/<base64>\" [$%s]", env.UpstreamTLSPins),
+	)
+	flagSet.StringVarP(
+		&f.upstreamTLS.minVersion,
+		"upstream-tls-min-version",
+		"",
+		"1.2",
+		fmt.Sprintf("Minimal upstream TLS version (1.0, 1.1, 1.2 or 1.3) [$%s]", env.UpstreamTLSMinVersion),
+	)
+	flagSet.StringSliceVarP(
+		&f.upstreamTLS.cipherSuites,
+		"upstream-tls-cipher-suites",
+		"",
+		[]string{},
+		fmt.Sprintf("Upstream TLS 1.0-1.2 cipher suites (empty means defaults) [$%s]", env.UpstreamTLSCipherSuites),
+	)
+	flagSet.StringSliceVarP(
+		&f.upstreamTLS.clientCerts,
+		"upstream-tls-client-certs",
+		"",
+		[]string{},
+		fmt.Sprintf("Upstream mTLS certificates, like \"*.example.com=crt.pem:key.pem\" [$%s]", env.UpstreamTLSClientCerts),
+	)
+	flagSet.StringVarP(
+		&f.parentProxy.url,
+		"parent-proxy",
+		"",
+		"",
+		fmt.Sprintf("Parent proxy URL (http://, socks5:// or socks5h://), empty means direct [$%s]", env.ParentProxy),
+	)
+	flagSet.StringSliceVarP(
+		&f.parentProxy.rules,
+		"parent-proxy-rules",
+		"",
+		[]string{},
+		fmt.Sprintf("Parent proxy routing rules, like \"*.example.com=direct\" [$%s]", env.ParentProxyRules),
+	)
+	flagSet.BoolVarP(
+		&f.parentProxy.fromEnv,
+		"parent-proxy-from-env",
+		"",
+		false,
+		fmt.Sprintf("Use the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables [$%s]", env.ParentProxyFromEnv),
+	)
+	flagSet.BoolVarP(
+		&f.forwardProxy.enabled,
+		"forward-proxy",
+		"",
+		false,
+		fmt.Sprintf("Enable classic forward-proxy mode (HTTP_PROXY compatible) [$%s]", env.ForwardProxy),
+	)
+	flagSet.UintSliceVarP(
+		&f.forwardProxy.connectAllowedPorts,
+		"connect-allowed-ports",
+		"",
+		[]uint{443}, //nolint:gomnd
+		fmt.Sprintf("Allowed CONNECT tunnel destination ports (empty means any) [$%s]", env.ConnectAllowedPorts),
+	)
+	flagSet.DurationVarP(
+		&f.forwardProxy.connectIdleTimeout,
+		"connect-idle-timeout",
+		"",
+		time.Minute*5, //nolint:gomnd
+		fmt.Sprintf("Maximal CONNECT tunnel idle time (0 to disable) [$%s]", env.ConnectIdleTimeout),
+	)
+	flagSet.BoolVarP(
+		&f.mitm.enabled,
+		"mitm",
+		"",
+		false,
+		fmt.Sprintf("Enable TLS interception for the CONNECT tunnels (forward-proxy mode only) [$%s]", env.MITM),
+	)
+	flagSet.StringVarP(
+		&f.mitm.caCert,
+		"mitm-ca-cert",
+		"",
+		"",
+		fmt.Sprintf("TLS interception CA certificate file (PEM encoded) [$%s]", env.MITMCACert),
+	)
+	flagSet.StringVarP(
+		&f.mitm.caKey,
+		"mitm-ca-key",
+		"",
+		"",
+		fmt.Sprintf("TLS interception CA private key file (PEM encoded) [$%s]", env.MITMCAKey),
+	)
+	flagSet.StringSliceVarP(
+		&f.mitm.hosts,
+		"mitm-hosts",
+		"",
+		[]string{"*"},
+		fmt.Sprintf("Intercepted hosts (glob patterns, like *.example.com) [$%s]", env.MITMHosts),
+	)
+}
+
+// forwardedModes returns the list of supported forwarded headers modes (e.g. "append, replace").
+func forwardedModes() string {
+	var modes = make([]string, 0, len(forwarded.Modes()))
+
+	for _, m := range forwarded.Modes() {
+		modes = append(modes, string(m))
+	}
+
+	return strings.Join(modes, ", ")
+}
+
+// compressionEncodings returns the list of supported compression encodings.
+func compressionEncodings() []string {
+	var encodings = make([]string, 0, len(compression.Encodings()))
+
+	for _, e := range compression.Encodings() {
+		encodings = append(encodings, string(e))
+	}
+
+	return encodings
+}
+
+// corsUpstreamModes returns the list of supported upstream CORS headers modes (e.g. "replace, merge").
+func corsUpstreamModes() string {
+	var modes = make([]string, 0, len(cors.UpstreamModes()))
+
+	for _, m := range cors.UpstreamModes() {
+		modes = append(modes, string(m))
+	}
+
+	return strings.Join(modes, ", ")
+}
+
+// redirectModes returns the list of supported redirects modes (e.g. "follow, pass").
+func redirectModes() string {
+	var modes = make([]string, 0, len(redirect.Modes()))
+
+	for _, m := range redirect.Modes() {
+		modes = append(modes, string(m))
+	}
+
+	return strings.Join(modes, ", ")
+}
+
+// trimmedValues returns the list values with the leading and trailing spaces removed, empty values are skipped.
+func trimmedValues(values []string) []string {
+	var list = make([]string, 0, len(values))
+
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// parseUints parses comma-separated list of 16-bit unsigned integers (ports, status codes).
+func parseUints(s string) ([]uint, error) {
+	var list = make([]uint, 0)
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		p, err := strconv.ParseUint(item, 10, 16) //nolint:gomnd
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, uint(p))
+	}
+
+	return list, nil
+}
+
+func (f *flags) overrideUsingEnv() error {
+	if envVar, exists := env.ListenAddr.Lookup(); exists {
+		f.listen.ip = envVar
+	}
+
+	if envVar, exists := env.ListenPort.Lookup(); exists {
+		if p, err := strconv.ParseUint(envVar, 10, 16); err == nil { //nolint:gomnd
+			f.listen.port = uint16(p)
+		} else {
+			return fmt.Errorf("wrong TCP port environment variable [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.ProxyRoutePrefix.Lookup(); exists {
+		f.proxy.routePrefix = envVar
+	}
+
+	if envVar, exists := env.ProxyRequestTimeout.Lookup(); exists {
+		if d, err := time.ParseDuration(envVar); err == nil {
+			f.proxy.requestTimeout = d
+		} else {
+			return fmt.Errorf("wrong proxy request timeout [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.ProxyStreamIdleTimeout.Lookup(); exists {
+		if d, err := time.ParseDuration(envVar); err == nil {
+			f.proxy.streamIdleTimeout = d
+		} else {
+			return fmt.Errorf("wrong proxy stream idle timeout [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.ProxyWebsocketPingInterval.Lookup(); exists {
+		if d, err := time.ParseDuration(envVar); err == nil {
+			f.proxy.wsPingInterval = d
+		} else {
+			return fmt.Errorf("wrong WebSocket ping interval [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.RewriteContent.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.proxy.rewriteContent = b
+		} else {
+			return fmt.Errorf("wrong rewrite content [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.TrustedProxies.Lookup(); exists {
+		f.proxy.trustedProxies = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.ForwardedHeaders.Lookup(); exists {
+		f.forwardedHeaders.mode = envVar
+	}
+
+	if envVar, exists := env.ForwardedAnonymizeHosts.Lookup(); exists {
+		f.forwardedHeaders.anonymizeHosts = strings.Split(envVar, ",")
+	}
+
+	if err := f.overrideRedirectsUsingEnv(); err != nil {
+		return err
+	}
+
+	if err := f.overrideCORSUsingEnv(); err != nil {
+		return err
+	}
+
+	if err := f.overrideCompressionUsingEnv(); err != nil {
+		return err
+	}
+
+	if envVar, exists := env.AuthAPIKeys.Lookup(); exists {
+		f.auth.apiKeys = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.AuthAPIKeyHeader.Lookup(); exists {
+		f.auth.apiKeyHeader = envVar
+	}
+
+	if envVar, exists := env.AuthAPIKeyParam.Lookup(); exists {
+		f.auth.apiKeyParam = envVar
+	}
+
+	if envVar, exists := env.AuthHtpasswdFile.Lookup(); exists {
+		f.auth.htpasswdFile = envVar
+	}
+
+	if envVar, exists := env.AuthJWTJWKS.Lookup(); exists {
+		f.auth.jwt.jwks = envVar
+	}
+
+	if envVar, exists := env.AuthJWTJWKSRefresh.Lookup(); exists {
+		if d, err := time.ParseDuration(envVar); err == nil {
+			f.auth.jwt.jwksRefresh = d
+		} else {
+			return fmt.Errorf("wrong JWKS refresh interval [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.AuthJWTIssuer.Lookup(); exists {
+		f.auth.jwt.issuer = envVar
+	}
+
+	if envVar, exists := env.AuthJWTAudience.Lookup(); exists {
+		f.auth.jwt.audience = envVar
+	}
+
+	if envVar, exists := env.AuthJWTPermissionsClaim.Lookup(); exists {
+		f.auth.jwt.permissionsClaim = envVar
+	}
+
+	if envVar, exists := env.RateLimit.Lookup(); exists {
+		f.rateLimit.limit = envVar
+	}
+
+	if envVar, exists := env.RateLimitHosts.Lookup(); exists {
+		f.rateLimit.hostLimits = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.MaxInFlight.Lookup(); exists {
+		if n, err := strconv.ParseUint(envVar, 10, 32); err == nil { //nolint:gomnd
+			f.admission.maxInFlight = uint(n)
+		} else {
+			return fmt.Errorf("wrong max in-flight requests [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.MaxInFlightPerHost.Lookup(); exists {
+		if n, err := strconv.ParseUint(envVar, 10, 32); err == nil { //nolint:gomnd
+			f.admission.maxInFlightPerHost = uint(n)
+		} else {
+			return fmt.Errorf("wrong max in-flight requests per host [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.AdmissionQueueSize.Lookup(); exists {
+		if n, err := strconv.ParseUint(envVar, 10, 32); err == nil { //nolint:gomnd
+			f.admission.queueSize = uint(n)
+		} else {
+			return fmt.Errorf("wrong admission queue size [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.AdmissionQueueTimeout.Lookup(); exists {
+		if d, err := time.ParseDuration(envVar); err == nil {
+			f.admission.queueTimeout = d
+		} else {
+			return fmt.Errorf("wrong admission queue timeout [%s] value", envVar)
+		}
+	}
+
+	if err := f.overrideLimitsUsingEnv(); err != nil {
+		return err
+	}
+
+	if envVar, exists := env.Cache.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.cache.enabled = b
+		} else {
+			return fmt.Errorf("wrong cache [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.CacheMaxSize.Lookup(); exists {
+		f.cache.maxSize = envVar
+	}
+
+	if envVar, exists := env.CacheMaxEntrySize.Lookup(); exists {
+		f.cache.maxEntrySize = envVar
+	}
+
+	if envVar, exists := env.CacheStorage.Lookup(); exists {
+		f.cache.storage = envVar
+	}
+
+	if envVar, exists := env.CacheDir.Lookup(); exists {
+		f.cache.dir = envVar
+	}
+
+	if envVar, exists := env.CacheRedisURL.Lookup(); exists {
+		f.cache.redisURL = envVar
+	}
+
+	if envVar, exists := env.CacheRedisTTL.Lookup(); exists {
+		if d, err := time.ParseDuration(envVar); err == nil {
+			f.cache.redisTTL = d
+		} else {
+			return fmt.Errorf("wrong cache redis TTL [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.Retries.Lookup(); exists {
+		if n, err := strconv.ParseUint(envVar, 10, 32); err == nil { //nolint:gomnd
+			f.retry.maxRetries = uint(n)
+		} else {
+			return fmt.Errorf("wrong retries [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.RetryBackoff.Lookup(); exists {
+		if d, err := time.ParseDuration(envVar); err == nil {
+			f.retry.backoff = d
+		} else {
+			return fmt.Errorf("wrong retry backoff [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.RetryMaxBackoff.Lookup(); exists {
+		if d, err := time.ParseDuration(envVar); err == nil {
+			f.retry.maxBackoff = d
+		} else {
+			return fmt.Errorf("wrong retry max backoff [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.RetryStatusCodes.Lookup(); exists {
+		if codes, err := parseUints(envVar); err == nil {
+			f.retry.statusCodes = codes
+		} else {
+			return fmt.Errorf("wrong retry status codes [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.RetryMaxBodySize.Lookup(); exists {
+		f.retry.maxBodySize = envVar
+	}
+
+	if err := f.overrideCircuitBreakerUsingEnv(); err != nil {
+		return err
+	}
+
+	if envVar, exists := env.AdminAPIKeys.Lookup(); exists {
+		f.admin.apiKeys = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.UpstreamDenyPrivate.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.upstream.denyPrivate = b
+		} else {
+			return fmt.Errorf("wrong upstream deny private [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.UpstreamAllowNetworks.Lookup(); exists {
+		f.upstream.allowNetworks = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.UpstreamDenyNetworks.Lookup(); exists {
+		f.upstream.denyNetworks = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.UpstreamAllowHosts.Lookup(); exists {
+		f.upstream.allowHosts = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.UpstreamDenyHosts.Lookup(); exists {
+		f.upstream.denyHosts = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.UpstreamAllowedPorts.Lookup(); exists {
+		if ports, err := parseUints(envVar); err == nil {
+			f.upstream.allowedPorts = ports
+		} else {
+			return fmt.Errorf("wrong upstream allowed ports [%s] value", envVar)
+		}
+	}
+
+	if err := f.overrideUpstreamTLSUsingEnv(); err != nil {
+		return err
+	}
+
+	if err := f.overrideParentProxyUsingEnv(); err != nil {
+		return err
+	}
+
+	if envVar, exists := env.ForwardProxy.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.forwardProxy.enabled = b
+		} else {
+			return fmt.Errorf("wrong forward proxy [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.ConnectAllowedPorts.Lookup(); exists {
+		if ports, err := parseUints(envVar); err == nil {
+			f.forwardProxy.connectAllowedPorts = ports
+		} else {
+			return fmt.Errorf("wrong CONNECT allowed ports [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.ConnectIdleTimeout.Lookup(); exists {
+		if d, err := time.ParseDuration(envVar); err == nil {
+			f.forwardProxy.connectIdleTimeout = d
+		} else {
+			return fmt.Errorf("wrong CONNECT idle timeout [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.MITM.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.mitm.enabled = b
+		} else {
+			return fmt.Errorf("wrong MITM [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.MITMCACert.Lookup(); exists {
+		f.mitm.caCert = envVar
+	}
+
+	if envVar, exists := env.MITMCAKey.Lookup(); exists {
+		f.mitm.caKey = envVar
+	}
+
+	if envVar, exists := env.MITMHosts.Lookup(); exists {
+		f.mitm.hosts = strings.Split(envVar, ",")
+	}
+
+	return nil
+}
+
+// overrideRedirectsUsingEnv overrides the redirects flags using the environment variables.
+func (f *flags) overrideRedirectsUsingEnv() error {
+	if envVar, exists := env.Redirects.Lookup(); exists {
+		f.redirects.mode = envVar
+	}
+
+	if envVar, exists := env.RedirectsMax.Lookup(); exists {
+		if n, err := strconv.ParseUint(envVar, 10, 32); err == nil { //nolint:gomnd
+			f.redirects.max = uint(n)
+		} else {
+			return fmt.Errorf("wrong redirects max [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.RedirectsSameHost.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.redirects.sameHost = b
+		} else {
+			return fmt.Errorf("wrong redirects same host [%s] value", envVar)
+		}
+	}
+
+	return nil
+}
+
+// overrideUpstreamTLSUsingEnv overrides the upstream TLS flags using the environment variables.
+func (f *flags) overrideUpstreamTLSUsingEnv() error {
+	if envVar, exists := env.UpstreamTLSInsecure.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.upstreamTLS.insecure = b
+		} else {
+			return fmt.Errorf("wrong upstream TLS insecure [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.UpstreamTLSCA.Lookup(); exists {
+		f.upstreamTLS.caFiles = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.UpstreamTLSInsecureHosts.Lookup(); exists {
+		f.upstreamTLS.insecureHosts = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.UpstreamTLSPins.Lookup(); exists {
+		f.upstreamTLS.pins = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.UpstreamTLSMinVersion.Lookup(); exists {
+		f.upstreamTLS.minVersion = envVar
+	}
+
+	if envVar, exists := env.UpstreamTLSCipherSuites.Lookup(); exists {
+		f.upstreamTLS.cipherSuites = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.UpstreamTLSClientCerts.Lookup(); exists {
+		f.upstreamTLS.clientCerts = strings.Split(envVar, ",")
+	}
+
+	return nil
+}
+
+// overrideCORSUsingEnv overrides the CORS flags using the environment variables.
+func (f *flags) overrideCORSUsingEnv() error {
+	if envVar, exists := env.CORSAllowedOrigins.Lookup(); exists {
+		f.cors.allowedOrigins = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.CORSAllowedMethods.Lookup(); exists {
+		f.cors.allowedMethods = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.CORSAllowedHeaders.Lookup(); exists {
+		f.cors.allowedHeaders = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.CORSExposedHeaders.Lookup(); exists {
+		f.cors.exposedHeaders = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.CORSAllowCredentials.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.cors.allowCredentials = b
+		} else {
+			return fmt.Errorf("wrong CORS allow credentials [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.CORSMaxAge.Lookup(); exists {
+		if d, err := time.ParseDuration(envVar); err == nil {
+			f.cors.maxAge = d
+		} else {
+			return fmt.Errorf("wrong CORS max age [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.CORSUpstreamHeaders.Lookup(); exists {
+		f.cors.upstreamHeaders = envVar
+	}
+
+	return nil
+}
+
+// overrideCompressionUsingEnv overrides the compression flags using the environment variables.
+func (f *flags) overrideCompressionUsingEnv() error {
+	if envVar, exists := env.Compress.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.compression.enabled = b
+		} else {
+			return fmt.Errorf("wrong compress [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.CompressEncodings.Lookup(); exists {
+		f.compression.encodings = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.CompressTypes.Lookup(); exists {
+		f.compression.contentTypes = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.CompressMinSize.Lookup(); exists {
+		f.compression.minSize = envVar
+	}
+
+	if envVar, exists := env.CompressTranscodeGzip.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.compression.transcodeGzip = b
+		} else {
+			return fmt.Errorf("wrong compress transcode gzip [%s] value", envVar)
+		}
+	}
+
+	return nil
+}
+
+// overrideParentProxyUsingEnv overrides the parent proxy flags using the environment variables.
+func (f *flags) overrideParentProxyUsingEnv() error {
+	if envVar, exists := env.ParentProxy.Lookup(); exists {
+		f.parentProxy.url = envVar
+	}
+
+	if envVar, exists := env.ParentProxyRules.Lookup(); exists {
+		f.parentProxy.rules = strings.Split(envVar, ",")
+	}
+
+	if envVar, exists := env.ParentProxyFromEnv.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.parentProxy.fromEnv = b
+		} else {
+			return fmt.Errorf("wrong parent proxy from env [%s] value", envVar)
+		}
+	}
+
+	return nil
 }
 
-func (f *flags) init(flagSet *pflag.FlagSet) {
-	flagSet.StringVarP(
-		&f.listen.ip,
-		"listen",
-		"l",
-		"0.0.0.0",
-		fmt.Sprintf("IP address to listen on [$%s]", env.ListenAddr),
-	)
-	flagSet.Uint16VarP(
-		&f.listen.port,
-		"port",
-		"p",
-		8080, //nolint:gomnd
-		fmt.Sprintf("TCP port number [$%s]", env.ListenPort),
-	)
-	flagSet.StringVarP(
-		&f.proxy.routePrefix,
-		"prefix",
-		"x",
-		"proxy",
-		fmt.Sprintf("Proxy route prefix [$%s]", env.ProxyRoutePrefix),
-	)
-	flagSet.DurationVarP(
-		&f.proxy.requestTimeout,
-		"proxy-request-timeout",
-		"",
-		time.Second*30, //nolint:gomnd
-		fmt.Sprintf("Proxy request timeout (examples: 5s, 15s30ms) [$%s]", env.ProxyRequestTimeout),
-	)
+// overrideLimitsUsingEnv overrides the size limits flags using environment variables.
+func (f *flags) overrideLimitsUsingEnv() error {
+	if envVar, exists := env.MaxRequestBodySize.Lookup(); exists {
+		f.limits.maxRequestBodySize = envVar
+	}
+
+	if envVar, exists := env.MaxResponseBodySize.Lookup(); exists {
+		f.limits.maxResponseBodySize = envVar
+	}
+
+	if envVar, exists := env.MaxURLLength.Lookup(); exists {
+		if n, err := strconv.ParseUint(envVar, 10, 32); err == nil { //nolint:gomnd
+			f.limits.maxURLLength = uint(n)
+		} else {
+			return fmt.Errorf("wrong max URL length [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.MaxHeaderSize.Lookup(); exists {
+		f.limits.maxHeaderSize = envVar
+	}
+
+	return nil
 }
 
-func (f *flags) overrideUsingEnv() error {
-	if envVar, exists := env.ListenAddr.Lookup(); exists {
-		f.listen.ip = envVar
+// overrideCircuitBreakerUsingEnv overrides the circuit breakers flags using the environment variables.
+func (f *flags) overrideCircuitBreakerUsingEnv() error {
+	if envVar, exists := env.CircuitBreaker.Lookup(); exists {
+		if b, err := strconv.ParseBool(envVar); err == nil {
+			f.circuitBreaker.enabled = b
+		} else {
+			return fmt.Errorf("wrong circuit breaker [%s] value", envVar)
+		}
 	}
 
-	if envVar, exists := env.ListenPort.Lookup(); exists {
-		if p, err := strconv.ParseUint(envVar, 10, 16); err == nil { //nolint:gomnd
-			f.listen.port = uint16(p)
+	if envVar, exists := env.CircuitBreakerFailures.Lookup(); exists {
+		if n, err := strconv.ParseUint(envVar, 10, 32); err == nil { //nolint:gomnd
+			f.circuitBreaker.failures = uint(n)
 		} else {
-			return fmt.Errorf("wrong TCP port environment variable [%s] value", envVar)
+			return fmt.Errorf("wrong circuit breaker failures [%s] value", envVar)
 		}
 	}
 
-	if envVar, exists := env.ProxyRoutePrefix.Lookup(); exists {
-		f.proxy.routePrefix = envVar
+	if envVar, exists := env.CircuitBreakerErrorRate.Lookup(); exists {
+		if rate, err := strconv.ParseFloat(envVar, 64); err == nil { //nolint:gomnd
+			f.circuitBreaker.errorRate = rate
+		} else {
+			return fmt.Errorf("wrong circuit breaker error rate [%s] value", envVar)
+		}
 	}
 
-	if envVar, exists := env.ProxyRequestTimeout.Lookup(); exists {
+	if envVar, exists := env.CircuitBreakerMinRequests.Lookup(); exists {
+		if n, err := strconv.ParseUint(envVar, 10, 32); err == nil { //nolint:gomnd
+			f.circuitBreaker.minRequests = uint(n)
+		} else {
+			return fmt.Errorf("wrong circuit breaker min requests [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.CircuitBreakerWindow.Lookup(); exists {
 		if d, err := time.ParseDuration(envVar); err == nil {
-			f.proxy.requestTimeout = d
+			f.circuitBreaker.window = d
 		} else {
-			return fmt.Errorf("wrong proxy request timeout [%s] value", envVar)
+			return fmt.Errorf("wrong circuit breaker window [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.CircuitBreakerOpenTimeout.Lookup(); exists {
+		if d, err := time.ParseDuration(envVar); err == nil {
+			f.circuitBreaker.openTimeout = d
+		} else {
+			return fmt.Errorf("wrong circuit breaker open timeout [%s] value", envVar)
+		}
+	}
+
+	if envVar, exists := env.CircuitBreakerTrials.Lookup(); exists {
+		if n, err := strconv.ParseUint(envVar, 10, 32); err == nil { //nolint:gomnd
+			f.circuitBreaker.trials = uint(n)
+		} else {
+			return fmt.Errorf("wrong circuit breaker trials [%s] value", envVar)
 		}
 	}
 
@@ -96,14 +1457,477 @@ func (f *flags) validate() error {
 		return fmt.Errorf("wrong proxy prefix [%s] value", f.proxy.routePrefix)
 	}
 
+	if _, err := netpolicy.ParseCIDRs(f.proxy.trustedProxies...); err != nil {
+		return fmt.Errorf("wrong trusted proxies: %w", err)
+	}
+
+	if _, err := forwarded.ParseMode(f.forwardedHeaders.mode); err != nil {
+		return err
+	}
+
+	if _, err := redirect.ParseMode(f.redirects.mode); err != nil {
+		return err
+	}
+
+	if err := f.validateCORS(); err != nil {
+		return err
+	}
+
+	if f.compression.enabled {
+		if err := f.validateCompression(); err != nil {
+			return err
+		}
+	}
+
+	if len(f.auth.apiKeys) > 0 && f.auth.apiKeyHeader == "" && f.auth.apiKeyParam == "" {
+		return errors.New("API keys require the header or query parameter name")
+	}
+
+	if f.auth.htpasswdFile != "" {
+		if info, err := os.Stat(f.auth.htpasswdFile); err != nil || !info.Mode().IsRegular() {
+			return fmt.Errorf("htpasswd file [%s] not found", f.auth.htpasswdFile)
+		}
+	}
+
+	if f.auth.jwt.jwks != "" {
+		if f.auth.jwt.issuer == "" || f.auth.jwt.audience == "" {
+			return errors.New("JWT validation requires the issuer and audience")
+		}
+
+		if f.auth.jwt.jwksRefresh < 0 {
+			return errors.New("wrong JWKS refresh interval")
+		}
+	}
+
+	if f.rateLimit.limit != "" {
+		if _, err := ratelimit.ParseLimit(f.rateLimit.limit); err != nil {
+			return err
+		}
+	}
+
+	for _, hostLimit := range f.rateLimit.hostLimits {
+		if _, _, err := ratelimit.ParseHostLimit(hostLimit); err != nil {
+			return err
+		}
+	}
+
+	if f.admission.queueTimeout < 0 {
+		return errors.New("wrong admission queue timeout")
+	}
+
+	if err := f.validateLimits(); err != nil {
+		return err
+	}
+
+	if f.cache.enabled {
+		if size, err := bytesize.Parse(f.cache.maxSize); err != nil || size == 0 {
+			return fmt.Errorf("wrong cache max size [%s]", f.cache.maxSize)
+		}
+
+		if size, err := bytesize.Parse(f.cache.maxEntrySize); err != nil || size == 0 {
+			return fmt.Errorf("wrong cache max entry size [%s]", f.cache.maxEntrySize)
+		}
+
+		if err := f.validateCacheStorage(); err != nil {
+			return err
+		}
+	}
+
+	if f.retry.maxRetries > 0 {
+		if err := f.validateRetry(); err != nil {
+			return err
+		}
+	}
+
+	if f.circuitBreaker.enabled {
+		if err := f.circuitBreakerSettings().Validate(); err != nil {
+			return fmt.Errorf("wrong circuit breaker settings: %w", err)
+		}
+	}
+
+	if _, err := netpolicy.ParseCIDRs(f.upstream.allowNetworks...); err != nil {
+		return fmt.Errorf("wrong upstream allowed networks: %w", err)
+	}
+
+	if _, err := netpolicy.ParseCIDRs(f.upstream.denyNetworks...); err != nil {
+		return fmt.Errorf("wrong upstream denied networks: %w", err)
+	}
+
+	for _, port := range f.upstream.allowedPorts {
+		if port == 0 || port > math.MaxUint16 {
+			return fmt.Errorf("wrong upstream allowed port [%d]", port)
+		}
+	}
+
+	if err := f.validateUpstreamTLS(); err != nil {
+		return err
+	}
+
+	if err := f.validateParentProxy(); err != nil {
+		return err
+	}
+
+	for _, port := range f.forwardProxy.connectAllowedPorts {
+		if port == 0 || port > math.MaxUint16 {
+			return fmt.Errorf("wrong CONNECT allowed port [%d]", port)
+		}
+	}
+
+	if f.mitm.enabled {
+		if !f.forwardProxy.enabled {
+			return errors.New("TLS interception requires the forward-proxy mode")
+		}
+
+		if f.mitm.caCert == "" || f.mitm.caKey == "" {
+			return errors.New("TLS interception requires CA certificate and private key files")
+		}
+	}
+
+	return nil
+}
+
+// validateCacheStorage validates the cache storage flags.
+func (f *flags) validateCacheStorage() error {
+	switch f.cache.storage {
+	case httpcache.StorageMemory:
+	case httpcache.StorageDisk:
+		if f.cache.dir == "" {
+			return errors.New("disk cache storage requires the directory")
+		}
+
+	case httpcache.StorageRedis:
+		if _, err := redis.ParseURL(f.cache.redisURL); err != nil {
+			return fmt.Errorf("wrong cache redis URL: %w", err)
+		}
+
+		if f.cache.redisTTL < 0 {
+			return errors.New("wrong cache redis TTL")
+		}
+
+	default:
+		return fmt.Errorf("unsupported cache storage [%s]", f.cache.storage)
+	}
+
+	return nil
+}
+
+// validateLimits validates the size limits flags.
+func (f *flags) validateLimits() error {
+	if size, err := bytesize.Parse(f.limits.maxRequestBodySize); err != nil || size > math.MaxInt64 {
+		return fmt.Errorf("wrong max request body size [%s]", f.limits.maxRequestBodySize)
+	}
+
+	if size, err := bytesize.Parse(f.limits.maxResponseBodySize); err != nil || size > math.MaxInt64 {
+		return fmt.Errorf("wrong max response body size [%s]", f.limits.maxResponseBodySize)
+	}
+
+	if size, err := bytesize.Parse(f.limits.maxHeaderSize); err != nil || size > math.MaxInt32 {
+		return fmt.Errorf("wrong max header size [%s]", f.limits.maxHeaderSize)
+	}
+
+	return nil
+}
+
+// validateRetry validates the upstream requests retrying flags.
+func (f *flags) validateRetry() error {
+	if f.retry.backoff <= 0 || f.retry.maxBackoff < f.retry.backoff {
+		return fmt.Errorf("wrong retry backoff [%s] or max backoff [%s]", f.retry.backoff, f.retry.maxBackoff)
+	}
+
+	for _, code := range f.retry.statusCodes {
+		if code < 100 || code > 599 { //nolint:gomnd
+			return fmt.Errorf("wrong retry status code [%d]", code)
+		}
+	}
+
+	if _, err := bytesize.Parse(f.retry.maxBodySize); err != nil {
+		return fmt.Errorf("wrong retry max body size [%s]", f.retry.maxBodySize)
+	}
+
+	return nil
+}
+
+// validateUpstreamTLS validates the upstream TLS flags.
+func (f *flags) validateUpstreamTLS() error {
+	for _, path := range f.upstreamTLS.caFiles {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("upstream TLS CA [%s] not found", path)
+		}
+	}
+
+	for _, pin := range f.upstreamTLS.pins {
+		if strings.TrimSpace(pin) == "" {
+			continue
+		}
+
+		if _, _, err := upstreamtls.ParsePin(pin); err != nil {
+			return err
+		}
+	}
+
+	if _, err := upstreamtls.ParseVersion(f.upstreamTLS.minVersion); err != nil {
+		return err
+	}
+
+	if _, err := upstreamtls.ParseCipherSuites(f.upstreamTLS.cipherSuites...); err != nil {
+		return err
+	}
+
+	for _, value := range f.upstreamTLS.clientCerts {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+
+		_, certFile, keyFile, err := upstreamtls.ParseClientCertificate(value)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range []string{certFile, keyFile} {
+			if info, statErr := os.Stat(path); statErr != nil || !info.Mode().IsRegular() {
+				return fmt.Errorf("upstream TLS client certificate file [%s] not found", path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateCORS validates the CORS flags.
+func (f *flags) validateCORS() error {
+	mode, err := cors.ParseUpstreamMode(f.cors.upstreamHeaders)
+	if err != nil {
+		return err
+	}
+
+	var settings = cors.Settings{
+		AllowedOrigins:   trimmedValues(f.cors.allowedOrigins),
+		AllowCredentials: f.cors.allowCredentials,
+		MaxAge:           f.cors.maxAge,
+		Upstream:         mode,
+	}
+
+	if len(settings.AllowedOrigins) == 0 { // CORS policy is disabled
+		return nil
+	}
+
+	if _, err = cors.New(settings); err != nil {
+		return fmt.Errorf("wrong CORS settings: %w", err)
+	}
+
+	return nil
+}
+
+// validateCompression validates the compression flags.
+func (f *flags) validateCompression() error {
+	size, err := bytesize.Parse(f.compression.minSize)
+	if err != nil || size > math.MaxInt64 {
+		return fmt.Errorf("wrong compression min size [%s]", f.compression.minSize)
+	}
+
+	var settings = compression.Settings{ContentTypes: trimmedValues(f.compression.contentTypes)}
+
+	for _, value := range trimmedValues(f.compression.encodings) {
+		e, parseErr := compression.ParseEncoding(value)
+		if parseErr != nil {
+			return parseErr
+		}
+
+		settings.Encodings = append(settings.Encodings, e)
+	}
+
+	if len(settings.Encodings) == 0 {
+		return errors.New("compression encodings are not set")
+	}
+
+	if _, err = compression.New(settings); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateParentProxy validates the parent proxy flags.
+func (f *flags) validateParentProxy() error {
+	if value := strings.TrimSpace(f.parentProxy.url); value != "" {
+		if _, err := parentproxy.ParseURL(value); err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range f.parentProxy.rules {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+
+		if _, _, err := parentproxy.ParseRule(rule); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// circuitBreakerSettings returns the circuit breakers settings for the validation.
+func (f *flags) circuitBreakerSettings() circuit.Settings {
+	return circuit.Settings{
+		ConsecutiveFailures: int(f.circuitBreaker.failures),
+		ErrorRate:           f.circuitBreaker.errorRate,
+		MinRequests:         int(f.circuitBreaker.minRequests),
+		Window:              f.circuitBreaker.window,
+		OpenTimeout:         f.circuitBreaker.openTimeout,
+		HalfOpenRequests:    int(f.circuitBreaker.trials),
+	}
+}
+
 func (f *flags) toConfig() config.Config {
 	cfg := config.Config{}
 
 	cfg.Proxy.Prefix = f.proxy.routePrefix
 	cfg.Proxy.RequestTimeout = f.proxy.requestTimeout
+	cfg.Proxy.StreamIdleTimeout = f.proxy.streamIdleTimeout
+	cfg.Proxy.WebsocketPingInterval = f.proxy.wsPingInterval
+	cfg.Proxy.RewriteContent = f.proxy.rewriteContent
+	cfg.Proxy.TrustedProxies = f.proxy.trustedProxies
+
+	cfg.Proxy.ForwardedHeaders.Mode = f.forwardedHeaders.mode
+	cfg.Proxy.ForwardedHeaders.AnonymizeHosts = f.forwardedHeaders.anonymizeHosts
+	cfg.Proxy.Redirects.Mode = f.redirects.mode
+	cfg.Proxy.Redirects.Max = f.redirects.max
+	cfg.Proxy.Redirects.SameHost = f.redirects.sameHost
+
+	cfg.CORS.AllowedOrigins = trimmedValues(f.cors.allowedOrigins)
+	cfg.CORS.AllowedMethods = trimmedValues(f.cors.allowedMethods)
+	cfg.CORS.AllowedHeaders = trimmedValues(f.cors.allowedHeaders)
+	cfg.CORS.ExposedHeaders = trimmedValues(f.cors.exposedHeaders)
+	cfg.CORS.AllowCredentials = f.cors.allowCredentials
+	cfg.CORS.MaxAge = f.cors.maxAge
+	cfg.CORS.UpstreamHeaders = f.cors.upstreamHeaders
+
+	cfg.Compression.Enabled = f.compression.enabled
+	cfg.Compression.Encodings = trimmedValues(f.compression.encodings)
+	cfg.Compression.ContentTypes = trimmedValues(f.compression.contentTypes)
+	cfg.Compression.MinSize, _ = bytesize.Parse(f.compression.minSize) // validated already (when enabled)
+	cfg.Compression.TranscodeGzip = f.compression.transcodeGzip
+
+	for _, key := range f.auth.apiKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			cfg.Auth.APIKeys = append(cfg.Auth.APIKeys, key)
+		}
+	}
+
+	cfg.Auth.APIKeyHeader = f.auth.apiKeyHeader
+	cfg.Auth.APIKeyQueryParam = f.auth.apiKeyParam
+	cfg.Auth.HtpasswdFile = f.auth.htpasswdFile
+
+	cfg.Auth.JWT.JWKS = f.auth.jwt.jwks
+	cfg.Auth.JWT.JWKSRefreshInterval = f.auth.jwt.jwksRefresh
+	cfg.Auth.JWT.Issuer = f.auth.jwt.issuer
+	cfg.Auth.JWT.Audience = f.auth.jwt.audience
+	cfg.Auth.JWT.PermissionsClaim = f.auth.jwt.permissionsClaim
+
+	cfg.RateLimit.Limit = f.rateLimit.limit
+	cfg.RateLimit.HostLimits = f.rateLimit.hostLimits
+
+	cfg.Admission.MaxInFlight = f.admission.maxInFlight
+	cfg.Admission.MaxInFlightPerHost = f.admission.maxInFlightPerHost
+	cfg.Admission.QueueSize = f.admission.queueSize
+	cfg.Admission.QueueTimeout = f.admission.queueTimeout
+
+	cfg.Limits.MaxRequestBodySize, _ = bytesize.Parse(f.limits.maxRequestBodySize) // validated already
+	cfg.Limits.MaxResponseBodySize, _ = bytesize.Parse(f.limits.maxResponseBodySize)
+	cfg.Limits.MaxURLLength = f.limits.maxURLLength
+	cfg.Limits.MaxHeaderSize, _ = bytesize.Parse(f.limits.maxHeaderSize)
+
+	cfg.Cache.Enabled = f.cache.enabled
+	cfg.Cache.MaxSize, _ = bytesize.Parse(f.cache.maxSize) // validated already
+	cfg.Cache.MaxEntrySize, _ = bytesize.Parse(f.cache.maxEntrySize)
+	cfg.Cache.Storage = f.cache.storage
+	cfg.Cache.Dir = f.cache.dir
+	cfg.Cache.RedisURL = f.cache.redisURL
+	cfg.Cache.RedisTTL = f.cache.redisTTL
+
+	cfg.Retry.MaxRetries = f.retry.maxRetries
+	cfg.Retry.Backoff = f.retry.backoff
+	cfg.Retry.MaxBackoff = f.retry.maxBackoff
+	cfg.Retry.MaxBodySize, _ = bytesize.Parse(f.retry.maxBodySize) // validated already
+
+	for _, code := range f.retry.statusCodes {
+		cfg.Retry.StatusCodes = append(cfg.Retry.StatusCodes, int(code))
+	}
+
+	cfg.CircuitBreaker.Enabled = f.circuitBreaker.enabled
+	cfg.CircuitBreaker.ConsecutiveFailures = f.circuitBreaker.failures
+	cfg.CircuitBreaker.ErrorRate = f.circuitBreaker.errorRate
+	cfg.CircuitBreaker.MinRequests = f.circuitBreaker.minRequests
+	cfg.CircuitBreaker.Window = f.circuitBreaker.window
+	cfg.CircuitBreaker.OpenTimeout = f.circuitBreaker.openTimeout
+	cfg.CircuitBreaker.Trials = f.circuitBreaker.trials
+
+	for _, key := range f.admin.apiKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			cfg.Admin.APIKeys = append(cfg.Admin.APIKeys, key)
+		}
+	}
+
+	cfg.Upstream.DenyPrivateNetworks = f.upstream.denyPrivate
+	cfg.Upstream.AllowNetworks = f.upstream.allowNetworks
+	cfg.Upstream.DenyNetworks = f.upstream.denyNetworks
+	cfg.Upstream.AllowHosts = f.upstream.allowHosts
+	cfg.Upstream.DenyHosts = f.upstream.denyHosts
+
+	for _, port := range f.upstream.allowedPorts {
+		cfg.Upstream.AllowedPorts = append(cfg.Upstream.AllowedPorts, uint16(port))
+	}
+
+	cfg.UpstreamTLS.Insecure = f.upstreamTLS.insecure
+	cfg.UpstreamTLS.InsecureHosts = f.upstreamTLS.insecureHosts
+
+	for _, path := range f.upstreamTLS.caFiles {
+		if path = strings.TrimSpace(path); path != "" {
+			cfg.UpstreamTLS.CAFiles = append(cfg.UpstreamTLS.CAFiles, path)
+		}
+	}
+
+	for _, pin := range f.upstreamTLS.pins {
+		if pin = strings.TrimSpace(pin); pin != "" {
+			cfg.UpstreamTLS.Pins = append(cfg.UpstreamTLS.Pins, pin)
+		}
+	}
+
+	for _, value := range f.upstreamTLS.clientCerts {
+		if value = strings.TrimSpace(value); value != "" {
+			cfg.UpstreamTLS.ClientCerts = append(cfg.UpstreamTLS.ClientCerts, value)
+		}
+	}
+
+	cfg.UpstreamTLS.MinVersion = f.upstreamTLS.minVersion
+	cfg.UpstreamTLS.CipherSuites = f.upstreamTLS.cipherSuites
+
+	cfg.ParentProxy.URL = strings.TrimSpace(f.parentProxy.url)
+	cfg.ParentProxy.FromEnv = f.parentProxy.fromEnv
+
+	for _, rule := range f.parentProxy.rules {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			cfg.ParentProxy.Rules = append(cfg.ParentProxy.Rules, rule)
+		}
+	}
+
+	cfg.ForwardProxy.Enabled = f.forwardProxy.enabled
+	cfg.ForwardProxy.ConnectIdleTimeout = f.forwardProxy.connectIdleTimeout
+
+	for _, port := range f.forwardProxy.connectAllowedPorts {
+		cfg.ForwardProxy.ConnectAllowedPorts = append(cfg.ForwardProxy.ConnectAllowedPorts, uint16(port))
+	}
+
+	cfg.ForwardProxy.MITM.Enabled = f.mitm.enabled
+	cfg.ForwardProxy.MITM.CACertFile = f.mitm.caCert
+	cfg.ForwardProxy.MITM.CAKeyFile = f.mitm.caKey
+	cfg.ForwardProxy.MITM.Hosts = f.mitm.hosts
 
 	return cfg
 }
@@ -0,0 +1,253 @@
+// Package compression contains the HTTP responses compression: the content encoding negotiation (using the
+// `Accept-Encoding` request header quality values) and the pooled encoders.
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/zstd"
+)
+
+// Encoding is the content encoding (coding name).
+type Encoding string
+
+const (
+	Brotli Encoding = "br"
+	Zstd   Encoding = "zstd"
+	Gzip   Encoding = "gzip"
+)
+
+// Encodings returns all supported encodings.
+func Encodings() []Encoding { return []Encoding{Brotli, Zstd, Gzip} }
+
+// ParseEncoding parses the encoding (case-insensitive).
+func ParseEncoding(s string) (Encoding, error) {
+	for _, e := range Encodings() {
+		if strings.EqualFold(strings.TrimSpace(s), string(e)) {
+			return e, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported compression encoding [%s]", s)
+}
+
+const brotliLevel = 4 // fast enough for the on-the-fly compression
+
+// Settings are the compression settings.
+type Settings struct {
+	Encodings     []Encoding // supported encodings in the preference order (used, when the client has no preference)
+	ContentTypes  []string   // compressible media types, like "application/json", "text/*" or "application/*+json"
+	MinSize       int64      // responses with the known smaller length are not compressed
+	TranscodeGzip bool       // gzip encoded responses are re-encoded using brotli (when the client accepts it)
+}
+
+// Compressor negotiates the responses content encoding and creates the encoders.
+type Compressor struct {
+	encodings     []Encoding
+	types         []string
+	minSize       int64
+	transcodeGzip bool
+	pools         map[Encoding]*sync.Pool
+}
+
+// New creates a new Compressor.
+func New(s Settings) (*Compressor, error) {
+	var c = Compressor{
+		encodings:     s.Encodings,
+		minSize:       s.MinSize,
+		transcodeGzip: s.TranscodeGzip,
+		pools:         make(map[Encoding]*sync.Pool, len(s.Encodings)),
+	}
+
+	for _, e := range s.Encodings {
+		if _, err := ParseEncoding(string(e)); err != nil {
+			return nil, err
+		}
+
+		c.pools[e] = newPool(e)
+	}
+
+	for _, t := range s.ContentTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+
+		if mainType, subType, ok := strings.Cut(t, "/"); !ok || mainType == "" || mainType == "*" || subType == "" {
+			return nil, fmt.Errorf("wrong compressible content type [%s]", t)
+		}
+
+		c.types = append(c.types, t)
+	}
+
+	if c.minSize < 0 {
+		return nil, fmt.Errorf("wrong compression min size [%d]", c.minSize)
+	}
+
+	return &c, nil
+}
+
+// MinSize returns the minimal compressed response size.
+func (c *Compressor) MinSize() int64 { return c.minSize }
+
+// TranscodesGzip reports whether the gzip encoded responses are re-encoded using brotli.
+func (c *Compressor) TranscodesGzip() bool { return c.transcodeGzip }
+
+// Compressible reports whether the response with the content type can be compressed.
+func (c *Compressor) Compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	mainType, subType, _ := strings.Cut(mediaType, "/")
+
+	for _, t := range c.types {
+		switch {
+		case t == mediaType, t == mainType+"/*":
+			return true
+
+		case strings.HasPrefix(t, mainType+"/*+") && strings.HasSuffix(subType, t[len(mainType)+2:]): // like "*+json"
+			return true
+		}
+	}
+
+	return false
+}
+
+// Negotiate returns the encoding, that is the most preferred by the client (using the `Accept-Encoding` request
+// header value), and supported. The server preference order is used for the equally preferred encodings. Empty
+// string is returned, when none of the supported encodings is acceptable.
+func (c *Compressor) Negotiate(acceptEncoding string) Encoding {
+	var (
+		qualities = parseAcceptEncoding(acceptEncoding)
+		best      Encoding
+		bestQ     float64
+	)
+
+	for _, e := range c.encodings {
+		q, ok := qualities[string(e)]
+		if !ok {
+			q = qualities["*"] // zero, when the wildcard is not set
+		}
+
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+
+	return best
+}
+
+// parseAcceptEncoding parses the `Accept-Encoding` header value into the codings quality values.
+func parseAcceptEncoding(value string) map[string]float64 {
+	var qualities = make(map[string]float64)
+
+	for _, part := range strings.Split(value, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+
+		if coding = strings.ToLower(strings.TrimSpace(coding)); coding == "" {
+			continue
+		}
+
+		var q = 1.0
+
+		for _, param := range strings.Split(params, ";") {
+			name, v, _ := strings.Cut(param, "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && parsed >= 0 && parsed <= 1 {
+				q = parsed
+			}
+		}
+
+		qualities[coding] = q
+	}
+
+	return qualities
+}
+
+// Encoder is the compressing writer. Close must be called to finish the stream (the encoder must not be used after
+// it).
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// resettableEncoder is the pooled encoder.
+type resettableEncoder interface {
+	Encoder
+	Reset(io.Writer)
+}
+
+func newPool(e Encoding) *sync.Pool {
+	return &sync.Pool{New: func() any {
+		switch e {
+		case Brotli:
+			return brotli.NewWriterLevel(nil, brotliLevel)
+		case Zstd:
+			return zstd.NewWriter(nil)
+		}
+
+		return gzip.NewWriter(nil)
+	}}
+}
+
+// NewEncoder returns the encoder, that writes the encoded data into the w. The encoding must be negotiated by the
+// Compressor.
+func (c *Compressor) NewEncoder(e Encoding, w io.Writer) Encoder {
+	var (
+		pool = c.pools[e]
+		enc  = pool.Get().(resettableEncoder) //nolint:forcetypeassert
+	)
+
+	enc.Reset(w)
+
+	return &pooledEncoder{resettableEncoder: enc, pool: pool}
+}
+
+// pooledEncoder returns the encoder into the pool, when it is closed successfully.
+type pooledEncoder struct {
+	resettableEncoder
+	pool *sync.Pool
+}
+
+func (e *pooledEncoder) Close() error {
+	if err := e.resettableEncoder.Close(); err != nil {
+		return err
+	}
+
+	e.resettableEncoder.Reset(nil) // the underlying writer must not be kept
+	e.pool.Put(e.resettableEncoder)
+
+	return nil
+}
+
+// GzipReader returns the gzip decoding reader. Unlike the gzip.NewReader, it reads the gzip header on the first
+// reading, so the header errors are returned by the Read.
+func GzipReader(r io.Reader) io.Reader { return &gzipReader{src: r} }
+
+type gzipReader struct {
+	src     io.Reader
+	decoded *gzip.Reader
+}
+
+func (r *gzipReader) Read(p []byte) (int, error) {
+	if r.decoded == nil {
+		decoded, err := gzip.NewReader(r.src)
+		if err != nil {
+			return 0, err
+		}
+
+		r.decoded = decoded
+	}
+
+	return r.decoded.Read(p)
+}
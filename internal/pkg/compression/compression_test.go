@@ -0,0 +1,185 @@
+package compression_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/compression"
+)
+
+func TestParseEncoding(t *testing.T) {
+	for _, e := range compression.Encodings() {
+		parsed, err := compression.ParseEncoding(" " + strings.ToUpper(string(e)) + " ")
+		assert.NoError(t, err)
+		assert.Equal(t, e, parsed)
+	}
+
+	_, err := compression.ParseEncoding("deflate")
+	assert.EqualError(t, err, "unsupported compression encoding [deflate]")
+}
+
+func TestNew(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		giveSettings  compression.Settings
+		wantErrSubstr string
+	}{
+		{
+			name: "valid",
+			giveSettings: compression.Settings{
+				Encodings:    compression.Encodings(),
+				ContentTypes: []string{"text/*", "application/json", "application/*+xml"},
+			},
+		},
+		{
+			name:          "wrong encoding",
+			giveSettings:  compression.Settings{Encodings: []compression.Encoding{"foo"}},
+			wantErrSubstr: "unsupported compression encoding [foo]",
+		},
+		{
+			name:          "wrong content type",
+			giveSettings:  compression.Settings{ContentTypes: []string{"json"}},
+			wantErrSubstr: "wrong compressible content type [json]",
+		},
+		{
+			name:          "any content type",
+			giveSettings:  compression.Settings{ContentTypes: []string{"*/*"}},
+			wantErrSubstr: "wrong compressible content type [*/*]",
+		},
+		{
+			name:          "negative min size",
+			giveSettings:  compression.Settings{MinSize: -1},
+			wantErrSubstr: "wrong compression min size",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := compression.New(tt.giveSettings)
+
+			if tt.wantErrSubstr == "" {
+				assert.NoError(t, err)
+				assert.NotNil(t, c)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErrSubstr)
+				assert.Nil(t, c)
+			}
+		})
+	}
+}
+
+func TestCompressor_Compressible(t *testing.T) {
+	c, err := compression.New(compression.Settings{
+		ContentTypes: []string{"text/*", "Application/JSON", "application/*+xml"},
+	})
+	assert.NoError(t, err)
+
+	for contentType, want := range map[string]bool{
+		"text/html; charset=utf-8":               true,
+		"text/event-stream":                      true,
+		"application/json":                       true,
+		"application/problem+xml":                true,
+		"application/xml":                        false,
+		"application/problem+json":               false,
+		"image/png":                              false,
+		"application/octet-stream":               false,
+		"":                                       false,
+		"foo; bar":                               false,
+		"application/vnd.api+xml; charset=utf-8": true,
+	} {
+		assert.Equal(t, want, c.Compressible(contentType), contentType)
+	}
+}
+
+func TestCompressor_Negotiate(t *testing.T) {
+	c, err := compression.New(compression.Settings{Encodings: compression.Encodings()}) // br, zstd, gzip
+	assert.NoError(t, err)
+
+	for acceptEncoding, want := range map[string]compression.Encoding{
+		"":                              "",
+		"identity":                      "",
+		"deflate":                       "",
+		"gzip":                          compression.Gzip,
+		"GZIP, deflate":                 compression.Gzip,
+		"gzip, br":                      compression.Brotli, // server preference
+		"gzip, zstd":                    compression.Zstd,
+		"gzip;q=1.0, br;q=0.5":          compression.Gzip,
+		"br;q=0, gzip;q=0.1":            compression.Gzip,
+		"br;q=0, gzip;q=0":              "",
+		"*":                             compression.Brotli,
+		"*;q=0.5, br;q=0.1":             compression.Zstd,
+		"gzip;q=foo":                    compression.Gzip, // wrong quality is ignored
+		"gzip ; q=0.8 , zstd ; q=0.9":   compression.Zstd,
+		"deflate, gzip;q=1.0, *;q=0.5 ": compression.Gzip,
+	} {
+		assert.Equal(t, want, c.Negotiate(acceptEncoding), acceptEncoding)
+	}
+
+	c, err = compression.New(compression.Settings{Encodings: []compression.Encoding{compression.Gzip}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, compression.Encoding(""), c.Negotiate("br, zstd"))
+	assert.Equal(t, compression.Gzip, c.Negotiate("br, *"))
+}
+
+func TestCompressor_NewEncoder(t *testing.T) {
+	c, err := compression.New(compression.Settings{Encodings: compression.Encodings()})
+	assert.NoError(t, err)
+
+	var data = strings.Repeat("foo bar baz ", 1000)
+
+	for _, e := range compression.Encodings() {
+		for i := 0; i < 2; i++ { // the second encoder is taken from the pool
+			var (
+				buf bytes.Buffer
+				enc = c.NewEncoder(e, &buf)
+			)
+
+			_, err = enc.Write([]byte(data[:100]))
+			assert.NoError(t, err)
+			assert.NoError(t, enc.Flush())
+			assert.NotZero(t, buf.Len(), e)
+
+			_, err = enc.Write([]byte(data[100:]))
+			assert.NoError(t, err)
+			assert.NoError(t, enc.Close())
+			assert.Less(t, buf.Len(), len(data)/10, e)
+
+			switch e {
+			case compression.Gzip:
+				r, gzErr := gzip.NewReader(&buf)
+				assert.NoError(t, gzErr)
+
+				decoded, _ := io.ReadAll(r)
+				assert.Equal(t, data, string(decoded))
+
+			case compression.Brotli:
+				decoded, _ := io.ReadAll(brotli.NewReader(&buf))
+				assert.Equal(t, data, string(decoded))
+
+			case compression.Zstd: // the zstd package has its own decoding tests
+				assert.Equal(t, []byte{0x28, 0xb5, 0x2f, 0xfd}, buf.Bytes()[:4])
+			}
+		}
+	}
+}
+
+func TestGzipReader(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write([]byte("foo"))
+	_ = w.Close()
+
+	decoded, err := io.ReadAll(compression.GzipReader(&buf))
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(decoded))
+
+	_, err = io.ReadAll(compression.GzipReader(strings.NewReader("it is not a gzip stream")))
+	assert.ErrorIs(t, err, gzip.ErrHeader)
+}
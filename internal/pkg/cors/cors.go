@@ -0,0 +1,243 @@
+// Package cors contains the CORS (cross-origin resource sharing) policy: preflight requests are answered by the
+// proxy, and the responses are decorated with the `Access-Control-*` headers for the allowed origins.
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UpstreamMode is the upstream `Access-Control-*` response headers handling mode.
+type UpstreamMode string
+
+const (
+	UpstreamReplace UpstreamMode = "replace" // upstream headers are removed, the policy headers are used only
+	UpstreamMerge   UpstreamMode = "merge"   // upstream exposed headers are added to the policy ones, others removed
+)
+
+// UpstreamModes returns all supported upstream modes.
+func UpstreamModes() []UpstreamMode { return []UpstreamMode{UpstreamReplace, UpstreamMerge} }
+
+// ParseUpstreamMode parses the upstream mode (case-insensitive).
+func ParseUpstreamMode(s string) (UpstreamMode, error) {
+	for _, m := range UpstreamModes() {
+		if strings.EqualFold(strings.TrimSpace(s), string(m)) {
+			return m, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported CORS upstream headers mode [%s]", s)
+}
+
+// Settings are the CORS policy settings.
+type Settings struct {
+	AllowedOrigins   []string      // exact ("https://example.com"), wildcard ("https://*.example.com"), "~regex" or "*"
+	AllowedMethods   []string      // allowed methods for the preflight requests (simple methods are always allowed)
+	AllowedHeaders   []string      // allowed request headers ("*" allows any)
+	ExposedHeaders   []string      // response headers, exposed to the browser scripts
+	AllowCredentials bool          // cookies and the authorization headers are allowed
+	MaxAge           time.Duration // preflight responses caching time (zero means "not set")
+	Upstream         UpstreamMode  // upstream CORS headers handling (replace by default)
+}
+
+// Policy is the CORS policy.
+type Policy struct {
+	origins     []originMatcher
+	anyOrigin   bool
+	methods     map[string]struct{}
+	headers     map[string]struct{}
+	anyHeader   bool
+	exposed     string
+	credentials bool
+	maxAge      string
+	upstream    UpstreamMode
+}
+
+// simpleMethods are always allowed (browsers do not send the preflight requests for them).
+var simpleMethods = [...]string{http.MethodGet, http.MethodHead, http.MethodPost} //nolint:gochecknoglobals
+
+// New creates a new Policy.
+func New(s Settings) (*Policy, error) {
+	var p = Policy{
+		methods:     make(map[string]struct{}),
+		headers:     make(map[string]struct{}),
+		exposed:     strings.Join(s.ExposedHeaders, ", "),
+		credentials: s.AllowCredentials,
+		upstream:    s.Upstream,
+	}
+
+	for _, pattern := range s.AllowedOrigins {
+		if pattern == "*" {
+			p.anyOrigin = true
+
+			continue
+		}
+
+		m, err := newOriginMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		p.origins = append(p.origins, m)
+	}
+
+	if p.anyOrigin && p.credentials {
+		return nil, errors.New("CORS credentials cannot be allowed for any origin")
+	}
+
+	for _, method := range append(simpleMethods[:], s.AllowedMethods...) {
+		p.methods[strings.ToUpper(method)] = struct{}{}
+	}
+
+	for _, header := range s.AllowedHeaders {
+		if header == "*" {
+			p.anyHeader = true
+		}
+
+		p.headers[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+
+	if s.MaxAge < 0 {
+		return nil, errors.New("wrong CORS max age")
+	} else if s.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(s.MaxAge.Seconds()))
+	}
+
+	if p.upstream == "" {
+		p.upstream = UpstreamReplace
+	}
+
+	return &p, nil
+}
+
+// IsPreflight reports whether the request is the CORS preflight request.
+func IsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// AllowsOrigin reports whether the origin is allowed.
+func (p *Policy) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	if p.anyOrigin {
+		return true
+	}
+
+	for _, m := range p.origins {
+		if m(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Preflight sets the preflight response headers. An error is returned, when the origin, method or any of the
+// requested headers is not allowed (the CORS headers are not set in this case).
+func (p *Policy) Preflight(h http.Header, r *http.Request) error {
+	h.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+
+	var (
+		origin = r.Header.Get("Origin")
+		method = r.Header.Get("Access-Control-Request-Method")
+	)
+
+	if !p.AllowsOrigin(origin) {
+		return fmt.Errorf("origin [%s] is not allowed", origin)
+	}
+
+	if _, ok := p.methods[strings.ToUpper(method)]; !ok {
+		return fmt.Errorf("method [%s] is not allowed", method)
+	}
+
+	var requested = make([]string, 0)
+
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+
+			if _, ok := p.headers[http.CanonicalHeaderKey(name)]; !ok && !p.anyHeader {
+				return fmt.Errorf("header [%s] is not allowed", name)
+			}
+
+			requested = append(requested, name)
+		}
+	}
+
+	p.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.ToUpper(method))
+
+	if len(requested) > 0 { // the requested headers are reflected (the wildcard is not honored with credentials)
+		h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+
+	if p.maxAge != "" {
+		h.Set("Access-Control-Max-Age", p.maxAge)
+	}
+
+	return nil
+}
+
+// Apply sets the CORS headers for the actual (not preflight) request response. Nothing is set, when the request
+// origin is not allowed.
+func (p *Policy) Apply(h http.Header, r *http.Request) {
+	var origin = r.Header.Get("Origin")
+
+	if !p.anyOrigin || p.credentials { // the response depends on the request origin
+		h.Add("Vary", "Origin")
+	}
+
+	if !p.AllowsOrigin(origin) {
+		return
+	}
+
+	p.setOrigin(h, origin)
+
+	if p.exposed != "" {
+		h.Set("Access-Control-Expose-Headers", p.exposed)
+	}
+}
+
+func (p *Policy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// FilterUpstream removes the `Access-Control-*` headers from the upstream response headers, so the policy headers
+// (already set in the client response headers h) are not overridden. In the merge mode the upstream exposed headers
+// are added to the policy ones (when the origin is allowed by the policy).
+func (p *Policy) FilterUpstream(h, upstream http.Header) {
+	var exposed = upstream.Values("Access-Control-Expose-Headers")
+
+	for name := range upstream {
+		if strings.HasPrefix(name, "Access-Control-") {
+			upstream.Del(name)
+		}
+	}
+
+	if p.upstream != UpstreamMerge || len(exposed) == 0 || h.Get("Access-Control-Allow-Origin") == "" {
+		return
+	}
+
+	if current := h.Get("Access-Control-Expose-Headers"); current != "" {
+		exposed = append([]string{current}, exposed...)
+	}
+
+	h.Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+}
@@ -0,0 +1,341 @@
+package cors_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/cors"
+)
+
+func TestParseUpstreamMode(t *testing.T) {
+	for _, m := range cors.UpstreamModes() {
+		parsed, err := cors.ParseUpstreamMode(" " + string(m) + " ")
+		assert.NoError(t, err)
+		assert.Equal(t, m, parsed)
+	}
+
+	_, err := cors.ParseUpstreamMode("foo")
+	assert.EqualError(t, err, "unsupported CORS upstream headers mode [foo]")
+}
+
+func TestNew(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		giveSettings  cors.Settings
+		wantErrSubstr string
+	}{
+		{
+			name:         "any origin",
+			giveSettings: cors.Settings{AllowedOrigins: []string{"*"}},
+		},
+		{
+			name:         "credentials with the listed origins",
+			giveSettings: cors.Settings{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true},
+		},
+		{
+			name:          "credentials with any origin",
+			giveSettings:  cors.Settings{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			wantErrSubstr: "credentials cannot be allowed for any origin",
+		},
+		{
+			name:          "wrong regular expression",
+			giveSettings:  cors.Settings{AllowedOrigins: []string{"~(foo"}},
+			wantErrSubstr: "wrong CORS origin regular expression [(foo]",
+		},
+		{
+			name:          "origin without scheme",
+			giveSettings:  cors.Settings{AllowedOrigins: []string{"example.com"}},
+			wantErrSubstr: "scheme is required",
+		},
+		{
+			name:          "wrong wildcard",
+			giveSettings:  cors.Settings{AllowedOrigins: []string{"https://foo*.example.com"}},
+			wantErrSubstr: "wrong CORS origin wildcard",
+		},
+		{
+			name:          "negative max age",
+			giveSettings:  cors.Settings{AllowedOrigins: []string{"*"}, MaxAge: -time.Second},
+			wantErrSubstr: "wrong CORS max age",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := cors.New(tt.giveSettings)
+
+			if tt.wantErrSubstr == "" {
+				assert.NoError(t, err)
+				assert.NotNil(t, p)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErrSubstr)
+				assert.Nil(t, p)
+			}
+		})
+	}
+}
+
+func TestPolicy_AllowsOrigin(t *testing.T) {
+	p, err := cors.New(cors.Settings{AllowedOrigins: []string{
+		"https://Example.com/",
+		"https://*.example.org",
+		`~^http://(foo|bar)\.local:\d+$`,
+	}})
+	assert.NoError(t, err)
+
+	for origin, want := range map[string]bool{
+		"https://example.com":           true,
+		"HTTPS://EXAMPLE.COM":           true,
+		"http://example.com":            false,
+		"https://example.com:8443":      false,
+		"https://app.example.org":       true,
+		"https://a.b.example.org":       true,
+		"https://example.org":           false,
+		"https://evil.com/.example.org": false,
+		"https://app.example.org:443":   false,
+		"https://app.example.org.evil":  false,
+		"http://foo.local:8080":         true,
+		"http://baz.local:8080":         false,
+		"":                              false,
+		"null":                          false,
+	} {
+		assert.Equal(t, want, p.AllowsOrigin(origin), origin)
+	}
+}
+
+func TestPolicy_Preflight(t *testing.T) {
+	p, err := cors.New(cors.Settings{
+		AllowedOrigins:   []string{"https://example.com"},
+		AllowedMethods:   []string{"put", "DELETE"},
+		AllowedHeaders:   []string{"content-type", "X-Api-Key"},
+		AllowCredentials: true,
+		MaxAge:           time.Minute * 10,
+	})
+	assert.NoError(t, err)
+
+	for _, tt := range []struct {
+		name        string
+		giveOrigin  string
+		giveMethod  string
+		giveHeaders string
+		wantErr     string
+		wantHeaders map[string]string
+	}{
+		{
+			name:        "allowed",
+			giveOrigin:  "https://example.com",
+			giveMethod:  "PUT",
+			giveHeaders: "Content-Type, x-api-key",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Methods":     "PUT",
+				"Access-Control-Allow-Headers":     "Content-Type, x-api-key",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			name:       "simple method is always allowed",
+			giveOrigin: "https://example.com",
+			giveMethod: "POST",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "https://example.com",
+				"Access-Control-Allow-Methods": "POST",
+				"Access-Control-Allow-Headers": "",
+			},
+		},
+		{
+			name:       "origin is not allowed",
+			giveOrigin: "https://evil.com",
+			giveMethod: "PUT",
+			wantErr:    "origin [https://evil.com] is not allowed",
+		},
+		{
+			name:       "method is not allowed",
+			giveOrigin: "https://example.com",
+			giveMethod: "PATCH",
+			wantErr:    "method [PATCH] is not allowed",
+		},
+		{
+			name:        "header is not allowed",
+			giveOrigin:  "https://example.com",
+			giveMethod:  "PUT",
+			giveHeaders: "content-type,x-foo",
+			wantErr:     "header [x-foo] is not allowed",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				req = httptest.NewRequest(http.MethodOptions, "/", http.NoBody)
+				h   = http.Header{}
+			)
+
+			req.Header.Set("Origin", tt.giveOrigin)
+			req.Header.Set("Access-Control-Request-Method", tt.giveMethod)
+
+			if tt.giveHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.giveHeaders)
+			}
+
+			assert.True(t, cors.IsPreflight(req))
+
+			err := p.Preflight(h, req)
+
+			assert.Contains(t, h.Get("Vary"), "Origin")
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Empty(t, h.Get("Access-Control-Allow-Origin"))
+
+				return
+			}
+
+			assert.NoError(t, err)
+
+			for name, value := range tt.wantHeaders {
+				assert.Equal(t, value, h.Get(name), name)
+			}
+		})
+	}
+}
+
+func TestIsPreflight(t *testing.T) {
+	req := httptest.NewRequest(http.MethodOptions, "/", http.NoBody)
+	assert.False(t, cors.IsPreflight(req))
+
+	req.Header.Set("Origin", "https://example.com")
+	assert.False(t, cors.IsPreflight(req))
+
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	assert.True(t, cors.IsPreflight(req))
+
+	req.Method = http.MethodGet
+	assert.False(t, cors.IsPreflight(req))
+}
+
+func TestPolicy_Apply(t *testing.T) {
+	anyOrigin, err := cors.New(cors.Settings{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-Foo", "X-Bar"}})
+	assert.NoError(t, err)
+
+	listed, err := cors.New(cors.Settings{AllowedOrigins: []string{"https://example.com"}, AllowCredentials: true})
+	assert.NoError(t, err)
+
+	for _, tt := range []struct {
+		name        string
+		givePolicy  *cors.Policy
+		giveOrigin  string
+		wantHeaders map[string]string
+	}{
+		{
+			name:       "any origin",
+			givePolicy: anyOrigin,
+			giveOrigin: "https://example.com",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "*",
+				"Access-Control-Expose-Headers": "X-Foo, X-Bar",
+				"Vary":                          "",
+			},
+		},
+		{
+			name:       "without origin",
+			givePolicy: anyOrigin,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:       "listed origin with credentials",
+			givePolicy: listed,
+			giveOrigin: "https://example.com",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:       "not allowed origin",
+			givePolicy: listed,
+			giveOrigin: "https://evil.com",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "",
+				"Access-Control-Allow-Credentials": "",
+				"Vary":                             "Origin",
+			},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				req = httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+				h   = http.Header{}
+			)
+
+			if tt.giveOrigin != "" {
+				req.Header.Set("Origin", tt.giveOrigin)
+			}
+
+			tt.givePolicy.Apply(h, req)
+
+			for name, value := range tt.wantHeaders {
+				assert.Equal(t, value, h.Get(name), name)
+			}
+		})
+	}
+}
+
+func TestPolicy_FilterUpstream(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		giveMode    cors.UpstreamMode
+		giveOrigin  string // Access-Control-Allow-Origin, set by the policy
+		wantExposed string
+	}{
+		{
+			name:        "replace",
+			giveMode:    cors.UpstreamReplace,
+			giveOrigin:  "https://example.com",
+			wantExposed: "X-Policy",
+		},
+		{
+			name:        "merge",
+			giveMode:    cors.UpstreamMerge,
+			giveOrigin:  "https://example.com",
+			wantExposed: "X-Policy, X-Upstream, X-Total-Count",
+		},
+		{
+			name:        "merge for not allowed origin",
+			giveMode:    cors.UpstreamMerge,
+			wantExposed: "X-Policy",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := cors.New(cors.Settings{AllowedOrigins: []string{"https://example.com"}, Upstream: tt.giveMode})
+			assert.NoError(t, err)
+
+			var (
+				h        = http.Header{"Access-Control-Expose-Headers": {"X-Policy"}}
+				upstream = http.Header{
+					"Access-Control-Allow-Origin":   {"*"},
+					"Access-Control-Allow-Methods":  {"GET"},
+					"Access-Control-Expose-Headers": {"X-Upstream", "X-Total-Count"},
+					"Content-Type":                  {"text/plain"},
+				}
+			)
+
+			if tt.giveOrigin != "" {
+				h.Set("Access-Control-Allow-Origin", tt.giveOrigin)
+			}
+
+			p.FilterUpstream(h, upstream)
+
+			assert.Equal(t, http.Header{"Content-Type": {"text/plain"}}, upstream)
+			assert.Equal(t, tt.wantExposed, h.Get("Access-Control-Expose-Headers"))
+			assert.Equal(t, tt.giveOrigin, h.Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
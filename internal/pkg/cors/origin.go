@@ -0,0 +1,59 @@
+package cors
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// originMatcher matches the request `Origin` header value.
+type originMatcher func(origin string) bool
+
+// newOriginMatcher creates the origin matcher for the pattern:
+//
+//   - "~<regex>" - regular expression (e.g. `~^https://(foo|bar)\.example\.com$`)
+//   - "<scheme>://*.<domain>" - any subdomain of the domain (e.g. "https://*.example.com", the domain itself is not
+//     matched)
+//   - exact origin (e.g. "https://example.com:8443")
+//
+// Origins are compared case-insensitive (except the regular expressions).
+func newOriginMatcher(pattern string) (originMatcher, error) {
+	pattern = strings.TrimSpace(pattern)
+
+	if strings.HasPrefix(pattern, "~") {
+		var expr = pattern[1:]
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("wrong CORS origin regular expression [%s]: %w", expr, err)
+		}
+
+		return re.MatchString, nil
+	}
+
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "/"))
+
+	if !strings.Contains(pattern, "://") {
+		return nil, fmt.Errorf("wrong CORS origin [%s] (scheme is required)", pattern)
+	}
+
+	if prefix, suffix, isWildcard := strings.Cut(pattern, "*"); isWildcard {
+		if strings.Contains(suffix, "*") || !strings.HasSuffix(prefix, "://") || !strings.HasPrefix(suffix, ".") {
+			return nil, fmt.Errorf("wrong CORS origin wildcard [%s]", pattern)
+		}
+
+		return func(origin string) bool {
+			origin = strings.ToLower(origin)
+
+			if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) ||
+				len(origin) <= len(prefix)+len(suffix) {
+				return false
+			}
+
+			// the subdomain must not contain the port or path separators
+			return !strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], ":/")
+		}, nil
+	}
+
+	return func(origin string) bool { return strings.ToLower(origin) == pattern }, nil
+}
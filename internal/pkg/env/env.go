@@ -6,10 +6,93 @@ import "os"
 type envVariable string
 
 const (
-	ListenAddr          envVariable = "LISTEN_ADDR"           // IP address for listening
-	ListenPort          envVariable = "LISTEN_PORT"           // port number for listening
-	ProxyRoutePrefix    envVariable = "PROXY_PREFIX"          // proxy route prefix
-	ProxyRequestTimeout envVariable = "PROXY_REQUEST_TIMEOUT" // proxy request timeout
+	ListenAddr                 envVariable = "LISTEN_ADDR"                   // IP address for listening
+	ListenPort                 envVariable = "LISTEN_PORT"                   // port number for listening
+	ProxyRoutePrefix           envVariable = "PROXY_PREFIX"                  // proxy route prefix
+	ProxyRequestTimeout        envVariable = "PROXY_REQUEST_TIMEOUT"         // proxy request timeout
+	ProxyStreamIdleTimeout     envVariable = "PROXY_STREAM_IDLE_TIMEOUT"     // proxy stream idle timeout
+	ProxyWebsocketPingInterval envVariable = "PROXY_WEBSOCKET_PING_INTERVAL" // WebSocket keepalive pings interval
+	ForwardedHeaders           envVariable = "FORWARDED_HEADERS"             // proxy-related headers mode
+	ForwardedAnonymizeHosts    envVariable = "FORWARDED_ANONYMIZE_HOSTS"     // anonymized hosts (comma-separated)
+	Redirects                  envVariable = "REDIRECTS"                     // upstream redirects mode
+	RedirectsMax               envVariable = "REDIRECTS_MAX"                 // maximal followed redirects number
+	RedirectsSameHost          envVariable = "REDIRECTS_SAME_HOST"           // follow the same host redirects only
+	RewriteContent             envVariable = "REWRITE_CONTENT"               // web-browsing mode (content rewriting)
+	TrustedProxies             envVariable = "TRUSTED_PROXIES"               // trusted proxies networks (comma-separated)
+	CORSAllowedOrigins         envVariable = "CORS_ALLOWED_ORIGINS"          // CORS allowed origins (comma-separated)
+	CORSAllowedMethods         envVariable = "CORS_ALLOWED_METHODS"          // CORS allowed methods (comma-separated)
+	CORSAllowedHeaders         envVariable = "CORS_ALLOWED_HEADERS"          // CORS allowed headers (comma-separated)
+	CORSExposedHeaders         envVariable = "CORS_EXPOSED_HEADERS"          // CORS exposed headers (comma-separated)
+	CORSAllowCredentials       envVariable = "CORS_ALLOW_CREDENTIALS"        // CORS credentials allowing
+	CORSMaxAge                 envVariable = "CORS_MAX_AGE"                  // CORS preflight responses caching time
+	CORSUpstreamHeaders        envVariable = "CORS_UPSTREAM_HEADERS"         // upstream CORS headers handling mode
+	Compress                   envVariable = "COMPRESS"                      // enable responses compression
+	CompressEncodings          envVariable = "COMPRESS_ENCODINGS"            // compression encodings (comma-separated)
+	CompressTypes              envVariable = "COMPRESS_TYPES"                // compressible content types
+	CompressMinSize            envVariable = "COMPRESS_MIN_SIZE"             // minimal compressed response size
+	CompressTranscodeGzip      envVariable = "COMPRESS_TRANSCODE_GZIP"       // re-encode gzip responses using brotli
+	AuthAPIKeys                envVariable = "AUTH_API_KEYS"                 // API keys (comma-separated)
+	AuthAPIKeyHeader           envVariable = "AUTH_API_KEY_HEADER"           // API key header name
+	AuthAPIKeyParam            envVariable = "AUTH_API_KEY_PARAM"            // API key query parameter name
+	AuthHtpasswdFile           envVariable = "AUTH_HTPASSWD_FILE"            // htpasswd file for the Basic auth
+	AuthJWTJWKS                envVariable = "AUTH_JWT_JWKS"                 // JWKS file path or URL
+	AuthJWTJWKSRefresh         envVariable = "AUTH_JWT_JWKS_REFRESH"         // JWKS refreshing interval
+	AuthJWTIssuer              envVariable = "AUTH_JWT_ISSUER"               // expected JWT issuer
+	AuthJWTAudience            envVariable = "AUTH_JWT_AUDIENCE"             // expected JWT audience
+	AuthJWTPermissionsClaim    envVariable = "AUTH_JWT_PERMISSIONS_CLAIM"    // JWT claim with the client permissions
+	RateLimit                  envVariable = "RATE_LIMIT"                    // per-client requests rate limit
+	RateLimitHosts             envVariable = "RATE_LIMIT_HOSTS"              // per-client upstream hosts rate limits
+	MaxInFlight                envVariable = "MAX_IN_FLIGHT"                 // global in-flight requests limit
+	MaxInFlightPerHost         envVariable = "MAX_IN_FLIGHT_PER_HOST"        // per upstream host in-flight requests limit
+	AdmissionQueueSize         envVariable = "ADMISSION_QUEUE_SIZE"          // admission waiting queue size
+	AdmissionQueueTimeout      envVariable = "ADMISSION_QUEUE_TIMEOUT"       // admission waiting queue timeout
+	MaxRequestBodySize         envVariable = "MAX_REQUEST_BODY_SIZE"         // maximal request body size (like "10MiB")
+	MaxResponseBodySize        envVariable = "MAX_RESPONSE_BODY_SIZE"        // maximal upstream response body size
+	MaxURLLength               envVariable = "MAX_URL_LENGTH"                // maximal request URL length
+	MaxHeaderSize              envVariable = "MAX_HEADER_SIZE"               // maximal request headers size
+	Cache                      envVariable = "CACHE"                         // enable responses caching
+	CacheMaxSize               envVariable = "CACHE_MAX_SIZE"                // maximal cache size (like "64MiB")
+	CacheMaxEntrySize          envVariable = "CACHE_MAX_ENTRY_SIZE"          // maximal cached response size
+	CacheStorage               envVariable = "CACHE_STORAGE"                 // cache storage (memory, disk or redis)
+	CacheDir                   envVariable = "CACHE_DIR"                     // disk cache storage directory
+	CacheRedisURL              envVariable = "CACHE_REDIS_URL"               // redis cache storage URL
+	CacheRedisTTL              envVariable = "CACHE_REDIS_TTL"               // cached responses expiration in redis
+	Retries                    envVariable = "RETRIES"                       // maximal upstream request retries count
+	RetryBackoff               envVariable = "RETRY_BACKOFF"                 // delay before the first retry
+	RetryMaxBackoff            envVariable = "RETRY_MAX_BACKOFF"             // maximal delay between the retries
+	RetryStatusCodes           envVariable = "RETRY_STATUS_CODES"            // retried status codes (comma-separated)
+	RetryMaxBodySize           envVariable = "RETRY_MAX_BODY_SIZE"           // maximal replayable request body size
+	CircuitBreaker             envVariable = "CIRCUIT_BREAKER"               // enable upstream circuit breakers
+	CircuitBreakerFailures     envVariable = "CIRCUIT_BREAKER_FAILURES"      // consecutive failures to open the breaker
+	CircuitBreakerErrorRate    envVariable = "CIRCUIT_BREAKER_ERROR_RATE"    // error rate to open the breaker
+	CircuitBreakerMinRequests  envVariable = "CIRCUIT_BREAKER_MIN_REQUESTS"  // minimal requests for the error rate
+	CircuitBreakerWindow       envVariable = "CIRCUIT_BREAKER_WINDOW"        // error rate measuring window
+	CircuitBreakerOpenTimeout  envVariable = "CIRCUIT_BREAKER_OPEN_TIMEOUT"  // open state duration
+	CircuitBreakerTrials       envVariable = "CIRCUIT_BREAKER_TRIALS"        // trial requests to close the breaker
+	AdminAPIKeys               envVariable = "ADMIN_API_KEYS"                // admin API keys (comma-separated)
+	UpstreamDenyPrivate        envVariable = "UPSTREAM_DENY_PRIVATE"         // deny private upstream networks
+	UpstreamAllowNetworks      envVariable = "UPSTREAM_ALLOW_NETWORKS"       // allowed upstream networks (comma-separated)
+	UpstreamDenyNetworks       envVariable = "UPSTREAM_DENY_NETWORKS"        // denied upstream networks (comma-separated)
+	UpstreamAllowHosts         envVariable = "UPSTREAM_ALLOW_HOSTS"          // allowed upstream hosts (comma-separated)
+	UpstreamDenyHosts          envVariable = "UPSTREAM_DENY_HOSTS"           // denied upstream hosts (comma-separated)
+	UpstreamAllowedPorts       envVariable = "UPSTREAM_ALLOWED_PORTS"        // allowed upstream ports (comma-separated)
+	UpstreamTLSInsecure        envVariable = "UPSTREAM_TLS_INSECURE"         // skip upstream certificates verification
+	UpstreamTLSCA              envVariable = "UPSTREAM_TLS_CA"               // additional CA files (comma-separated)
+	UpstreamTLSInsecureHosts   envVariable = "UPSTREAM_TLS_INSECURE_HOSTS"   // hosts without the verification
+	UpstreamTLSPins            envVariable = "UPSTREAM_TLS_PINS"             // public key pins (comma-separated)
+	UpstreamTLSMinVersion      envVariable = "UPSTREAM_TLS_MIN_VERSION"      // minimal upstream TLS version
+	UpstreamTLSCipherSuites    envVariable = "UPSTREAM_TLS_CIPHER_SUITES"    // upstream TLS cipher suites
+	UpstreamTLSClientCerts     envVariable = "UPSTREAM_TLS_CLIENT_CERTS"     // upstream mTLS certificates
+	ParentProxy                envVariable = "PARENT_PROXY"                  // default parent proxy URL
+	ParentProxyRules           envVariable = "PARENT_PROXY_RULES"            // parent proxy routing rules
+	ParentProxyFromEnv         envVariable = "PARENT_PROXY_FROM_ENV"         // use HTTP_PROXY and NO_PROXY variables
+	ForwardProxy               envVariable = "FORWARD_PROXY"                 // enable forward-proxy mode
+	ConnectAllowedPorts        envVariable = "CONNECT_ALLOWED_PORTS"         // allowed CONNECT ports (comma-separated)
+	ConnectIdleTimeout         envVariable = "CONNECT_IDLE_TIMEOUT"          // CONNECT tunnels idle timeout
+	MITM                       envVariable = "MITM"                          // enable TLS interception
+	MITMCACert                 envVariable = "MITM_CA_CERT"                  // TLS interception CA certificate file
+	MITMCAKey                  envVariable = "MITM_CA_KEY"                   // TLS interception CA private key file
+	MITMHosts                  envVariable = "MITM_HOSTS"                    // intercepted hosts (comma-separated)
 )
 
 // String returns environment variable name in the string representation.
@@ -12,6 +12,89 @@ func TestConstants(t *testing.T) {
 	assert.Equal(t, "LISTEN_PORT", string(ListenPort))
 	assert.Equal(t, "PROXY_PREFIX", string(ProxyRoutePrefix))
 	assert.Equal(t, "PROXY_REQUEST_TIMEOUT", string(ProxyRequestTimeout))
+	assert.Equal(t, "PROXY_STREAM_IDLE_TIMEOUT", string(ProxyStreamIdleTimeout))
+	assert.Equal(t, "PROXY_WEBSOCKET_PING_INTERVAL", string(ProxyWebsocketPingInterval))
+	assert.Equal(t, "FORWARDED_HEADERS", string(ForwardedHeaders))
+	assert.Equal(t, "FORWARDED_ANONYMIZE_HOSTS", string(ForwardedAnonymizeHosts))
+	assert.Equal(t, "REDIRECTS", string(Redirects))
+	assert.Equal(t, "REDIRECTS_MAX", string(RedirectsMax))
+	assert.Equal(t, "REDIRECTS_SAME_HOST", string(RedirectsSameHost))
+	assert.Equal(t, "REWRITE_CONTENT", string(RewriteContent))
+	assert.Equal(t, "TRUSTED_PROXIES", string(TrustedProxies))
+	assert.Equal(t, "CORS_ALLOWED_ORIGINS", string(CORSAllowedOrigins))
+	assert.Equal(t, "CORS_ALLOWED_METHODS", string(CORSAllowedMethods))
+	assert.Equal(t, "CORS_ALLOWED_HEADERS", string(CORSAllowedHeaders))
+	assert.Equal(t, "CORS_EXPOSED_HEADERS", string(CORSExposedHeaders))
+	assert.Equal(t, "CORS_ALLOW_CREDENTIALS", string(CORSAllowCredentials))
+	assert.Equal(t, "CORS_MAX_AGE", string(CORSMaxAge))
+	assert.Equal(t, "CORS_UPSTREAM_HEADERS", string(CORSUpstreamHeaders))
+	assert.Equal(t, "COMPRESS", string(Compress))
+	assert.Equal(t, "COMPRESS_ENCODINGS", string(CompressEncodings))
+	assert.Equal(t, "COMPRESS_TYPES", string(CompressTypes))
+	assert.Equal(t, "COMPRESS_MIN_SIZE", string(CompressMinSize))
+	assert.Equal(t, "COMPRESS_TRANSCODE_GZIP", string(CompressTranscodeGzip))
+	assert.Equal(t, "AUTH_API_KEYS", string(AuthAPIKeys))
+	assert.Equal(t, "AUTH_API_KEY_HEADER", string(AuthAPIKeyHeader))
+	assert.Equal(t, "AUTH_API_KEY_PARAM", string(AuthAPIKeyParam))
+	assert.Equal(t, "AUTH_HTPASSWD_FILE", string(AuthHtpasswdFile))
+	assert.Equal(t, "AUTH_JWT_JWKS", string(AuthJWTJWKS))
+	assert.Equal(t, "AUTH_JWT_JWKS_REFRESH", string(AuthJWTJWKSRefresh))
+	assert.Equal(t, "AUTH_JWT_ISSUER", string(AuthJWTIssuer))
+	assert.Equal(t, "AUTH_JWT_AUDIENCE", string(AuthJWTAudience))
+	assert.Equal(t, "AUTH_JWT_PERMISSIONS_CLAIM", string(AuthJWTPermissionsClaim))
+	assert.Equal(t, "RATE_LIMIT", string(RateLimit))
+	assert.Equal(t, "RATE_LIMIT_HOSTS", string(RateLimitHosts))
+	assert.Equal(t, "MAX_IN_FLIGHT", string(MaxInFlight))
+	assert.Equal(t, "MAX_IN_FLIGHT_PER_HOST", string(MaxInFlightPerHost))
+	assert.Equal(t, "ADMISSION_QUEUE_SIZE", string(AdmissionQueueSize))
+	assert.Equal(t, "ADMISSION_QUEUE_TIMEOUT", string(AdmissionQueueTimeout))
+	assert.Equal(t, "MAX_REQUEST_BODY_SIZE", string(MaxRequestBodySize))
+	assert.Equal(t, "MAX_RESPONSE_BODY_SIZE", string(MaxResponseBodySize))
+	assert.Equal(t, "MAX_URL_LENGTH", string(MaxURLLength))
+	assert.Equal(t, "MAX_HEADER_SIZE", string(MaxHeaderSize))
+	assert.Equal(t, "CACHE", string(Cache))
+	assert.Equal(t, "CACHE_MAX_SIZE", string(CacheMaxSize))
+	assert.Equal(t, "CACHE_MAX_ENTRY_SIZE", string(CacheMaxEntrySize))
+	assert.Equal(t, "CACHE_STORAGE", string(CacheStorage))
+	assert.Equal(t, "CACHE_DIR", string(CacheDir))
+	assert.Equal(t, "CACHE_REDIS_URL", string(CacheRedisURL))
+	assert.Equal(t, "CACHE_REDIS_TTL", string(CacheRedisTTL))
+	assert.Equal(t, "RETRIES", string(Retries))
+	assert.Equal(t, "RETRY_BACKOFF", string(RetryBackoff))
+	assert.Equal(t, "RETRY_MAX_BACKOFF", string(RetryMaxBackoff))
+	assert.Equal(t, "RETRY_STATUS_CODES", string(RetryStatusCodes))
+	assert.Equal(t, "RETRY_MAX_BODY_SIZE", string(RetryMaxBodySize))
+	assert.Equal(t, "CIRCUIT_BREAKER", string(CircuitBreaker))
+	assert.Equal(t, "CIRCUIT_BREAKER_FAILURES", string(CircuitBreakerFailures))
+	assert.Equal(t, "CIRCUIT_BREAKER_ERROR_RATE", string(CircuitBreakerErrorRate))
+	assert.Equal(t, "CIRCUIT_BREAKER_MIN_REQUESTS", string(CircuitBreakerMinRequests))
+	assert.Equal(t, "CIRCUIT_BREAKER_WINDOW", string(CircuitBreakerWindow))
+	assert.Equal(t, "CIRCUIT_BREAKER_OPEN_TIMEOUT", string(CircuitBreakerOpenTimeout))
+	assert.Equal(t, "CIRCUIT_BREAKER_TRIALS", string(CircuitBreakerTrials))
+	assert.Equal(t, "ADMIN_API_KEYS", string(AdminAPIKeys))
+	assert.Equal(t, "UPSTREAM_DENY_PRIVATE", string(UpstreamDenyPrivate))
+	assert.Equal(t, "UPSTREAM_ALLOW_NETWORKS", string(UpstreamAllowNetworks))
+	assert.Equal(t, "UPSTREAM_DENY_NETWORKS", string(UpstreamDenyNetworks))
+	assert.Equal(t, "UPSTREAM_ALLOW_HOSTS", string(UpstreamAllowHosts))
+	assert.Equal(t, "UPSTREAM_DENY_HOSTS", string(UpstreamDenyHosts))
+	assert.Equal(t, "UPSTREAM_ALLOWED_PORTS", string(UpstreamAllowedPorts))
+	assert.Equal(t, "UPSTREAM_TLS_INSECURE", string(UpstreamTLSInsecure))
+	assert.Equal(t, "UPSTREAM_TLS_CA", string(UpstreamTLSCA))
+	assert.Equal(t, "UPSTREAM_TLS_INSECURE_HOSTS", string(UpstreamTLSInsecureHosts))
+	assert.Equal(t, "UPSTREAM_TLS_PINS", string(UpstreamTLSPins))
+	assert.Equal(t, "UPSTREAM_TLS_MIN_VERSION", string(UpstreamTLSMinVersion))
+	assert.Equal(t, "UPSTREAM_TLS_CIPHER_SUITES", string(UpstreamTLSCipherSuites))
+	assert.Equal(t, "UPSTREAM_TLS_CLIENT_CERTS", string(UpstreamTLSClientCerts))
+	assert.Equal(t, "PARENT_PROXY", string(ParentProxy))
+	assert.Equal(t, "PARENT_PROXY_RULES", string(ParentProxyRules))
+	assert.Equal(t, "PARENT_PROXY_FROM_ENV", string(ParentProxyFromEnv))
+	assert.Equal(t, "FORWARD_PROXY", string(ForwardProxy))
+	assert.Equal(t, "CONNECT_ALLOWED_PORTS", string(ConnectAllowedPorts))
+	assert.Equal(t, "CONNECT_IDLE_TIMEOUT", string(ConnectIdleTimeout))
+	assert.Equal(t, "MITM", string(MITM))
+	assert.Equal(t, "MITM_CA_CERT", string(MITMCACert))
+	assert.Equal(t, "MITM_CA_KEY", string(MITMCAKey))
+	assert.Equal(t, "MITM_HOSTS", string(MITMHosts))
 }
 
 func TestEnvVariable_Lookup(t *testing.T) {
@@ -22,6 +105,89 @@ func TestEnvVariable_Lookup(t *testing.T) {
 		{giveEnv: ListenPort},
 		{giveEnv: ProxyRoutePrefix},
 		{giveEnv: ProxyRequestTimeout},
+		{giveEnv: ProxyStreamIdleTimeout},
+		{giveEnv: ProxyWebsocketPingInterval},
+		{giveEnv: ForwardedHeaders},
+		{giveEnv: ForwardedAnonymizeHosts},
+		{giveEnv: Redirects},
+		{giveEnv: RedirectsMax},
+		{giveEnv: RedirectsSameHost},
+		{giveEnv: RewriteContent},
+		{giveEnv: TrustedProxies},
+		{giveEnv: CORSAllowedOrigins},
+		{giveEnv: CORSAllowedMethods},
+		{giveEnv: CORSAllowedHeaders},
+		{giveEnv: CORSExposedHeaders},
+		{giveEnv: CORSAllowCredentials},
+		{giveEnv: CORSMaxAge},
+		{giveEnv: CORSUpstreamHeaders},
+		{giveEnv: Compress},
+		{giveEnv: CompressEncodings},
+		{giveEnv: CompressTypes},
+		{giveEnv: CompressMinSize},
+		{giveEnv: CompressTranscodeGzip},
+		{giveEnv: AuthAPIKeys},
+		{giveEnv: AuthAPIKeyHeader},
+		{giveEnv: AuthAPIKeyParam},
+		{giveEnv: AuthHtpasswdFile},
+		{giveEnv: AuthJWTJWKS},
+		{giveEnv: AuthJWTJWKSRefresh},
+		{giveEnv: AuthJWTIssuer},
+		{giveEnv: AuthJWTAudience},
+		{giveEnv: AuthJWTPermissionsClaim},
+		{giveEnv: RateLimit},
+		{giveEnv: RateLimitHosts},
+		{giveEnv: MaxInFlight},
+		{giveEnv: MaxInFlightPerHost},
+		{giveEnv: AdmissionQueueSize},
+		{giveEnv: AdmissionQueueTimeout},
+		{giveEnv: MaxRequestBodySize},
+		{giveEnv: MaxResponseBodySize},
+		{giveEnv: MaxURLLength},
+		{giveEnv: MaxHeaderSize},
+		{giveEnv: Cache},
+		{giveEnv: CacheMaxSize},
+		{giveEnv: CacheMaxEntrySize},
+		{giveEnv: CacheStorage},
+		{giveEnv: CacheDir},
+		{giveEnv: CacheRedisURL},
+		{giveEnv: CacheRedisTTL},
+		{giveEnv: Retries},
+		{giveEnv: RetryBackoff},
+		{giveEnv: RetryMaxBackoff},
+		{giveEnv: RetryStatusCodes},
+		{giveEnv: RetryMaxBodySize},
+		{giveEnv: CircuitBreaker},
+		{giveEnv: CircuitBreakerFailures},
+		{giveEnv: CircuitBreakerErrorRate},
+		{giveEnv: CircuitBreakerMinRequests},
+		{giveEnv: CircuitBreakerWindow},
+		{giveEnv: CircuitBreakerOpenTimeout},
+		{giveEnv: CircuitBreakerTrials},
+		{giveEnv: AdminAPIKeys},
+		{giveEnv: UpstreamDenyPrivate},
+		{giveEnv: UpstreamAllowNetworks},
+		{giveEnv: UpstreamDenyNetworks},
+		{giveEnv: UpstreamAllowHosts},
+		{giveEnv: UpstreamDenyHosts},
+		{giveEnv: UpstreamAllowedPorts},
+		{giveEnv: UpstreamTLSInsecure},
+		{giveEnv: UpstreamTLSCA},
+		{giveEnv: UpstreamTLSInsecureHosts},
+		{giveEnv: UpstreamTLSPins},
+		{giveEnv: UpstreamTLSMinVersion},
+		{giveEnv: UpstreamTLSCipherSuites},
+		{giveEnv: UpstreamTLSClientCerts},
+		{giveEnv: ParentProxy},
+		{giveEnv: ParentProxyRules},
+		{giveEnv: ParentProxyFromEnv},
+		{giveEnv: ForwardProxy},
+		{giveEnv: ConnectAllowedPorts},
+		{giveEnv: ConnectIdleTimeout},
+		{giveEnv: MITM},
+		{giveEnv: MITMCACert},
+		{giveEnv: MITMCAKey},
+		{giveEnv: MITMHosts},
 	}
 
 	for _, tt := range cases {
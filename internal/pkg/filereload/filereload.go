@@ -0,0 +1,95 @@
+// Package filereload contains the helper for the files, that are re-read, when they change.
+package filereload
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reloader calls the load function, when any of the files is changed (the files modification times and sizes are
+// compared). Changes are checked not more often than once per interval.
+type Reloader struct {
+	paths    []string
+	interval time.Duration
+	load     func() error
+
+	mu        sync.Mutex
+	version   string // files modification times and sizes, the last successful loading was made with
+	checkedAt time.Time
+}
+
+// New creates a new Reloader and calls the load function (its error is returned).
+func New(interval time.Duration, load func() error, paths ...string) (*Reloader, error) {
+	r := &Reloader{paths: paths, interval: interval, load: load}
+
+	version, err := r.filesVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = load(); err != nil {
+		return nil, err
+	}
+
+	r.version, r.checkedAt = version, time.Now()
+
+	return r, nil
+}
+
+// ReloadIfChanged calls the load function, if the files were changed since the last successful loading. It returns
+// true, when the files were reloaded. On error, the previously loaded version should be used (the loading is retried
+// after the interval).
+func (r *Reloader) ReloadIfChanged() (bool, error) {
+	r.mu.Lock()
+
+	if time.Since(r.checkedAt) < r.interval {
+		r.mu.Unlock()
+
+		return false, nil
+	}
+
+	r.checkedAt = time.Now()
+	r.mu.Unlock()
+
+	version, err := r.filesVersion()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	changed := version != r.version
+	r.mu.Unlock()
+
+	if !changed {
+		return false, nil
+	}
+
+	if err = r.load(); err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.version = version
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// filesVersion returns the string, which is changed, when any of the files is changed.
+func (r *Reloader) filesVersion() (string, error) {
+	var version strings.Builder
+
+	for _, path := range r.paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+
+		_, _ = fmt.Fprintf(&version, "%d:%d;", stat.ModTime().UnixNano(), stat.Size())
+	}
+
+	return version.String(), nil
+}
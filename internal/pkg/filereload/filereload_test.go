@@ -0,0 +1,87 @@
+package filereload_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/filereload"
+)
+
+func TestReloader(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		foo     = filepath.Join(dir, "foo")
+		bar     = filepath.Join(dir, "bar")
+		loads   int
+		loadErr error
+	)
+
+	assert.NoError(t, os.WriteFile(foo, []byte("foo"), 0o600))
+	assert.NoError(t, os.WriteFile(bar, []byte("bar"), 0o600))
+
+	r, err := filereload.New(0, func() error { loads++; return loadErr }, foo, bar)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, loads)
+
+	reloaded, err := r.ReloadIfChanged()
+	assert.NoError(t, err)
+	assert.False(t, reloaded, "the files are not changed")
+	assert.Equal(t, 1, loads)
+
+	assert.NoError(t, os.WriteFile(bar, []byte("bar2"), 0o600)) // the size is changed
+
+	loadErr = errors.New("foo")
+
+	_, err = r.ReloadIfChanged()
+	assert.EqualError(t, err, "foo")
+	assert.Equal(t, 2, loads)
+
+	loadErr = nil
+
+	reloaded, err = r.ReloadIfChanged()
+	assert.NoError(t, err)
+	assert.True(t, reloaded, "the failed loading must be retried")
+	assert.Equal(t, 3, loads)
+
+	assert.NoError(t, os.Remove(foo))
+
+	_, err = r.ReloadIfChanged()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Equal(t, 3, loads)
+}
+
+func TestReloader_Interval(t *testing.T) {
+	var (
+		path  = filepath.Join(t.TempDir(), "foo")
+		loads int
+	)
+
+	assert.NoError(t, os.WriteFile(path, []byte("foo"), 0o600))
+
+	r, err := filereload.New(time.Hour, func() error { loads++; return nil }, path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(path, []byte("foo2"), 0o600))
+
+	reloaded, err := r.ReloadIfChanged()
+	assert.NoError(t, err)
+	assert.False(t, reloaded, "the changes must not be checked more often than once per interval")
+	assert.Equal(t, 1, loads)
+}
+
+func TestNewErrors(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "foo")
+
+	_, err := filereload.New(0, func() error { return nil }, path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	assert.NoError(t, os.WriteFile(path, []byte("foo"), 0o600))
+
+	_, err = filereload.New(0, func() error { return errors.New("bar") }, path)
+	assert.EqualError(t, err, "bar")
+}
@@ -0,0 +1,192 @@
+// Package forwarded contains the proxy-related request headers (`X-Forwarded-*`, RFC 7239 `Forwarded` and `Via`)
+// emitting.
+package forwarded
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/realip"
+)
+
+// Mode is the headers emitting mode.
+type Mode string
+
+const (
+	ModeAppend    Mode = "append"    // the current hop is appended to the incoming headers values
+	ModeReplace   Mode = "replace"   // the incoming headers values are replaced with the current hop only
+	ModeStrip     Mode = "strip"     // `X-Forwarded-*` and `Forwarded` headers are removed, only `Via` is sent
+	ModeAnonymize Mode = "anonymize" // all the proxy-related and client identifying headers are removed
+)
+
+// Modes returns all supported modes.
+func Modes() []Mode { return []Mode{ModeAppend, ModeReplace, ModeStrip, ModeAnonymize} }
+
+// ParseMode parses the mode (case-insensitive).
+func ParseMode(s string) (Mode, error) {
+	for _, m := range Modes() {
+		if strings.EqualFold(s, string(m)) {
+			return m, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported forwarded headers mode [%s]", s)
+}
+
+const pseudonym = "http-proxy-daemon" // used in the `Via` header instead of the real host name
+
+var (
+	forwardingHeaders = [...]string{ //nolint:gochecknoglobals
+		"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "Forwarded",
+	}
+	identifyingHeaders = [...]string{ //nolint:gochecknoglobals
+		"X-Real-Ip", "Cf-Connecting-Ip", "True-Client-Ip", "X-Client-Ip", "Client-Ip", "X-Cluster-Client-Ip",
+	}
+)
+
+// Headers emits the proxy-related headers for the upstream requests.
+type Headers struct {
+	mode      Mode
+	anonymize hostmatch.Matcher
+}
+
+// New creates Headers. Requests to the hosts, that match the anonymize hosts matcher, are always anonymized.
+func New(mode Mode, anonymizeHosts hostmatch.Matcher) *Headers {
+	return &Headers{mode: mode, anonymize: anonymizeHosts}
+}
+
+// Apply modifies the upstream request headers (out) using the client request (in) details. The target host is the
+// upstream host (it is used for the anonymize hosts matching).
+func (h *Headers) Apply(in *http.Request, out http.Header, targetHost string) {
+	var mode = h.mode
+
+	if h.anonymize.Match(targetHost) {
+		mode = ModeAnonymize
+	}
+
+	switch mode {
+	case ModeAnonymize:
+		del(out, forwardingHeaders[:]...)
+		del(out, identifyingHeaders[:]...)
+		del(out, "Via")
+
+	case ModeStrip:
+		del(out, forwardingHeaders[:]...)
+		appendValue(out, "Via", via(in))
+
+	case ModeReplace:
+		del(out, forwardingHeaders[:]...)
+		del(out, "Via")
+
+		// the incoming headers are dropped, so the real client address (extracted from them) is used
+		appendCurrentHop(in, out, realip.FromHTTPRequest(in))
+
+	case ModeAppend:
+		// the chain already contains the previous hops, so the peer address is appended
+		appendCurrentHop(in, out, peerIP(in))
+	}
+}
+
+// appendCurrentHop appends the current hop details to the proxy-related headers.
+func appendCurrentHop(in *http.Request, out http.Header, clientIP string) {
+	var proto = scheme(in)
+
+	appendValue(out, "X-Forwarded-For", clientIP)
+	setIfEmpty(out, "X-Forwarded-Proto", proto)
+	setIfEmpty(out, "X-Forwarded-Host", in.Host)
+	appendValue(out, "Forwarded", forwardedElement(clientIP, in.Host, proto))
+	appendValue(out, "Via", via(in))
+}
+
+func del(h http.Header, names ...string) {
+	for _, name := range names {
+		h.Del(name)
+	}
+}
+
+// appendValue appends the value to the comma-separated list (multiple header lines are joined).
+func appendValue(h http.Header, name, value string) {
+	if prior := h.Values(name); len(prior) > 0 {
+		value = strings.Join(prior, ", ") + ", " + value
+	}
+
+	h.Set(name, value)
+}
+
+func setIfEmpty(h http.Header, name, value string) {
+	if h.Get(name) == "" && value != "" {
+		h.Set(name, value)
+	}
+}
+
+// peerIP returns the IP address of the directly connected client.
+func peerIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
+
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// via returns the `Via` header value for the current hop (e.g. `1.1 http-proxy-daemon`).
+func via(r *http.Request) string {
+	var version = strconv.Itoa(r.ProtoMajor)
+
+	if r.ProtoMajor < 2 { //nolint:gomnd
+		version += "." + strconv.Itoa(r.ProtoMinor)
+	}
+
+	return version + " " + pseudonym
+}
+
+// forwardedElement returns the RFC 7239 `Forwarded` header element (e.g. `for=1.2.3.4;host=example.com;proto=http`).
+func forwardedElement(clientIP, host, proto string) string {
+	var b strings.Builder
+
+	b.WriteString("for=")
+
+	switch ip := net.ParseIP(clientIP); {
+	case ip == nil:
+		b.WriteString("unknown")
+	case ip.To4() == nil: // IPv6 addresses must be enclosed in square brackets and quoted
+		b.WriteString(`"[` + clientIP + `]"`)
+	default:
+		b.WriteString(clientIP)
+	}
+
+	if host != "" {
+		b.WriteString(";host=" + quoteIfNeeded(host))
+	}
+
+	b.WriteString(";proto=" + proto)
+
+	return b.String()
+}
+
+// quoteIfNeeded quotes the value, if it is not a valid token (RFC 7230, section 3.2.6).
+func quoteIfNeeded(s string) string {
+	for _, c := range s {
+		if !isTokenChar(c) {
+			return strconv.Quote(s)
+		}
+	}
+
+	return s
+}
+
+func isTokenChar(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
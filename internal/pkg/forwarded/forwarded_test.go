@@ -0,0 +1,160 @@
+package forwarded_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/forwarded"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+)
+
+func TestParseMode(t *testing.T) {
+	for _, m := range forwarded.Modes() {
+		parsed, err := forwarded.ParseMode(string(m))
+		assert.NoError(t, err)
+		assert.Equal(t, m, parsed)
+	}
+
+	parsed, err := forwarded.ParseMode("APPEND")
+	assert.NoError(t, err)
+	assert.Equal(t, forwarded.ModeAppend, parsed)
+
+	_, err = forwarded.ParseMode("foo")
+	assert.Error(t, err)
+}
+
+func TestHeaders_Apply(t *testing.T) {
+	var incoming = http.Header{
+		"X-Forwarded-For":   {"10.0.0.1, 10.0.0.2"},
+		"X-Forwarded-Proto": {"https"},
+		"X-Forwarded-Host":  {"origin.com"},
+		"Forwarded":         {"for=10.0.0.1;proto=https"},
+		"Via":               {"1.1 foo"},
+		"X-Real-Ip":         {"10.0.0.1"},
+		"Accept":            {"*/*"},
+	}
+
+	for _, tt := range []struct {
+		name           string
+		giveMode       forwarded.Mode
+		giveAnonymize  []string
+		giveHeaders    http.Header
+		giveRemoteAddr string
+		giveTLS        bool
+		wantHeaders    map[string]string
+		wantAbsent     []string
+	}{
+		{
+			name:           "append without incoming headers",
+			giveMode:       forwarded.ModeAppend,
+			giveHeaders:    http.Header{"Accept": {"*/*"}},
+			giveRemoteAddr: "1.2.3.4:5678",
+			wantHeaders: map[string]string{
+				"X-Forwarded-For":   "1.2.3.4",
+				"X-Forwarded-Proto": "http",
+				"X-Forwarded-Host":  "proxy.local:8080",
+				"Forwarded":         `for=1.2.3.4;host="proxy.local:8080";proto=http`,
+				"Via":               "1.1 http-proxy-daemon",
+			},
+		},
+		{
+			name:           "append to the incoming headers",
+			giveMode:       forwarded.ModeAppend,
+			giveHeaders:    incoming,
+			giveRemoteAddr: "1.2.3.4:5678",
+			wantHeaders: map[string]string{
+				"X-Forwarded-For":   "10.0.0.1, 10.0.0.2, 1.2.3.4",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "origin.com",
+				"Forwarded":         `for=10.0.0.1;proto=https, for=1.2.3.4;host="proxy.local:8080";proto=http`,
+				"Via":               "1.1 foo, 1.1 http-proxy-daemon",
+				"X-Real-Ip":         "10.0.0.1",
+			},
+		},
+		{
+			name:           "append IPv6 client over TLS",
+			giveMode:       forwarded.ModeAppend,
+			giveHeaders:    http.Header{"Accept": {"*/*"}},
+			giveRemoteAddr: "[2001:db8::1]:5678",
+			giveTLS:        true,
+			wantHeaders: map[string]string{
+				"X-Forwarded-For":   "2001:db8::1",
+				"X-Forwarded-Proto": "https",
+				"Forwarded":         `for="[2001:db8::1]";host="proxy.local:8080";proto=https`,
+			},
+		},
+		{
+			name:           "replace",
+			giveMode:       forwarded.ModeReplace,
+			giveHeaders:    incoming,
+			giveRemoteAddr: "1.2.3.4:5678",
+			wantHeaders: map[string]string{
+				"X-Forwarded-For":   "10.0.0.1", // the real client IP
+				"X-Forwarded-Proto": "http",
+				"X-Forwarded-Host":  "proxy.local:8080",
+				"Forwarded":         `for=10.0.0.1;host="proxy.local:8080";proto=http`,
+				"Via":               "1.1 http-proxy-daemon",
+			},
+		},
+		{
+			name:           "strip",
+			giveMode:       forwarded.ModeStrip,
+			giveHeaders:    incoming,
+			giveRemoteAddr: "1.2.3.4:5678",
+			wantHeaders: map[string]string{
+				"Via":       "1.1 foo, 1.1 http-proxy-daemon",
+				"X-Real-Ip": "10.0.0.1",
+			},
+			wantAbsent: []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "Forwarded"},
+		},
+		{
+			name:           "anonymize",
+			giveMode:       forwarded.ModeAnonymize,
+			giveHeaders:    incoming,
+			giveRemoteAddr: "1.2.3.4:5678",
+			wantAbsent: []string{
+				"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "Forwarded", "Via", "X-Real-Ip",
+			},
+		},
+		{
+			name:           "anonymize by the target host",
+			giveMode:       forwarded.ModeAppend,
+			giveAnonymize:  []string{"*.example.com"},
+			giveHeaders:    incoming,
+			giveRemoteAddr: "1.2.3.4:5678",
+			wantAbsent: []string{
+				"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "Forwarded", "Via", "X-Real-Ip",
+			},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				in, _ = http.NewRequest(http.MethodGet, "http://proxy.local:8080/proxy/api.example.com", http.NoBody)
+				out   = tt.giveHeaders.Clone()
+			)
+
+			in.Header = tt.giveHeaders.Clone()
+			in.RemoteAddr = tt.giveRemoteAddr
+
+			if tt.giveTLS {
+				in.TLS = &tls.ConnectionState{}
+			}
+
+			forwarded.New(tt.giveMode, hostmatch.New(tt.giveAnonymize...)).Apply(in, out, "api.example.com")
+
+			for name, value := range tt.wantHeaders {
+				assert.Equal(t, value, out.Get(name), name)
+			}
+
+			for _, name := range tt.wantAbsent {
+				assert.Empty(t, out.Values(name), name)
+			}
+
+			assert.Equal(t, "*/*", out.Get("Accept"))
+		})
+	}
+}
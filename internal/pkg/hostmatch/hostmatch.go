@@ -0,0 +1,45 @@
+// Package hostmatch contains hostname matching using glob patterns (like `*.example.com`).
+package hostmatch
+
+import (
+	"net"
+	"path"
+	"strings"
+)
+
+// Matcher matches hostnames against the list of glob patterns. Supported wildcards are `*` (any sequence of
+// characters), `?` (any single character) and `[...]` (characters class). Matching is case-insensitive.
+type Matcher []string
+
+// New creates a new Matcher. Empty patterns are ignored.
+func New(patterns ...string) Matcher {
+	var m = make(Matcher, 0, len(patterns))
+
+	for _, p := range patterns {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			m = append(m, p)
+		}
+	}
+
+	return m
+}
+
+// Match reports whether the host (the port will be ignored, if any) matches any of the patterns.
+func (m Matcher) Match(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, pattern := range m {
+		if ok, err := path.Match(pattern, host); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Empty reports whether the matcher has no patterns.
+func (m Matcher) Empty() bool { return len(m) == 0 }
@@ -0,0 +1,40 @@
+package hostmatch_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+)
+
+func TestMatcher_Match(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		givePatterns []string
+		giveHost     string
+		want         bool
+	}{
+		{name: "exact", givePatterns: []string{"example.com"}, giveHost: "example.com", want: true},
+		{name: "case-insensitive", givePatterns: []string{"Example.COM"}, giveHost: "EXAMPLE.com", want: true},
+		{name: "with port", givePatterns: []string{"example.com"}, giveHost: "example.com:443", want: true},
+		{name: "trailing dot", givePatterns: []string{"example.com"}, giveHost: "example.com.", want: true},
+		{name: "wildcard subdomain", givePatterns: []string{"*.example.com"}, giveHost: "api.example.com", want: true},
+		{name: "wildcard not apex", givePatterns: []string{"*.example.com"}, giveHost: "example.com"},
+		{name: "any host", givePatterns: []string{"*"}, giveHost: "foo.bar", want: true},
+		{name: "ip address", givePatterns: []string{"10.0.0.?"}, giveHost: "10.0.0.1:80", want: true},
+		{name: "no match", givePatterns: []string{"foo.com", "bar.com"}, giveHost: "baz.com"},
+		{name: "empty patterns", givePatterns: []string{"", " "}, giveHost: "baz.com"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hostmatch.New(tt.givePatterns...).Match(tt.giveHost))
+		})
+	}
+}
+
+func TestMatcher_Empty(t *testing.T) {
+	assert.True(t, hostmatch.New().Empty())
+	assert.True(t, hostmatch.New("").Empty())
+	assert.False(t, hostmatch.New("*").Empty())
+}
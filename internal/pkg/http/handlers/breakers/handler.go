@@ -0,0 +1,80 @@
+// Package breakers contains the upstream hosts circuit breakers listing and resetting handlers.
+package breakers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/circuit"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers"
+)
+
+type group interface {
+	List() []circuit.Status
+	Reset(host string) bool
+	ResetAll() int
+}
+
+// ResetRequest is the circuit breakers resetting request. All the breakers are reset, when the host is empty (or the
+// request body is empty).
+type ResetRequest struct {
+	Host string `json:"host"` // like "example.com:443" (the port is required for the non-default ports)
+}
+
+type (
+	listResponse struct {
+		Breakers []circuit.Status `json:"breakers"`
+	}
+
+	resetResponse struct {
+		Reset int `json:"reset"`
+	}
+)
+
+const maxRequestBodySize = 64 << 10
+
+// NewListHandler creates the circuit breakers listing handler. It responds with the breakers states, like
+// `{"breakers": [{"host": "example.com", "state": "open", ...}]}`.
+func NewListHandler(g group) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(listResponse{Breakers: g.List()})
+	}
+}
+
+// NewResetHandler creates the circuit breakers resetting handler. It accepts the JSON-encoded ResetRequest and
+// responds with the count of reset breakers (like `{"reset": 1}`).
+func NewResetHandler(log *zap.Logger, g group) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ResetRequest
+
+		err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBodySize)).Decode(&req)
+		if err != nil && !errors.Is(err, io.EOF) {
+			handlers.RespondJSONError(w, http.StatusBadRequest, "wrong request body: "+err.Error())
+
+			return
+		}
+
+		var reset int
+
+		if host := strings.ToLower(strings.TrimSpace(req.Host)); host == "" {
+			reset = g.ResetAll()
+		} else if g.Reset(host) {
+			reset = 1
+		} else {
+			handlers.RespondJSONError(w, http.StatusNotFound, "circuit breaker for ["+host+"] not found")
+
+			return
+		}
+
+		log.Info("Circuit breakers reset", zap.String("host", req.Host), zap.Int("reset", reset))
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resetResponse{Reset: reset})
+	}
+}
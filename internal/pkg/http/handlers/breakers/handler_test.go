@@ -0,0 +1,130 @@
+package breakers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/circuit"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/breakers"
+)
+
+type fakeGroup struct {
+	hosts []string
+	calls []string
+}
+
+func (g *fakeGroup) List() []circuit.Status {
+	var list = make([]circuit.Status, 0, len(g.hosts))
+
+	for _, host := range g.hosts {
+		list = append(list, circuit.Status{Host: host, State: circuit.StateOpen, ConsecutiveFailures: 5})
+	}
+
+	return list
+}
+
+func (g *fakeGroup) Reset(host string) bool {
+	g.calls = append(g.calls, "reset "+host)
+
+	for _, h := range g.hosts {
+		if h == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *fakeGroup) ResetAll() int {
+	g.calls = append(g.calls, "reset all")
+
+	return len(g.hosts)
+}
+
+func TestNewListHandler(t *testing.T) {
+	var (
+		rr     = httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodGet, "/admin/circuit-breakers", http.NoBody)
+	)
+
+	breakers.NewListHandler(&fakeGroup{hosts: []string{"example.com"}}).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t,
+		`{"breakers":[{"host":"example.com","state":"open","consecutive_failures":5,"requests":0,"failures":0}]}`,
+		rr.Body.String(),
+	)
+
+	rr = httptest.NewRecorder()
+
+	breakers.NewListHandler(&fakeGroup{}).ServeHTTP(rr, req)
+
+	assert.JSONEq(t, `{"breakers":[]}`, rr.Body.String())
+}
+
+func TestNewResetHandler(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		giveBody       string
+		wantStatusCode int
+		wantBody       string
+		wantCalls      []string
+	}{
+		{
+			name:           "by host",
+			giveBody:       `{"host": "Example.com"}`,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"reset":1}`,
+			wantCalls:      []string{"reset example.com"},
+		},
+		{
+			name:           "unknown host",
+			giveBody:       `{"host": "foo.com"}`,
+			wantStatusCode: http.StatusNotFound,
+			wantBody:       `circuit breaker for [foo.com] not found`,
+			wantCalls:      []string{"reset foo.com"},
+		},
+		{
+			name:           "all",
+			giveBody:       `{}`,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"reset":2}`,
+			wantCalls:      []string{"reset all"},
+		},
+		{
+			name:           "empty body",
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"reset":2}`,
+			wantCalls:      []string{"reset all"},
+		},
+		{
+			name:           "wrong body",
+			giveBody:       `foo`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `wrong request body`,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				rr = httptest.NewRecorder()
+				g  = fakeGroup{hosts: []string{"example.com", "example.org"}}
+			)
+
+			req, _ := http.NewRequest(http.MethodPost, "/admin/circuit-breakers/reset", strings.NewReader(tt.giveBody))
+
+			breakers.NewResetHandler(zap.NewNop(), &g).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Contains(t, rr.Body.String(), tt.wantBody)
+			assert.Equal(t, tt.wantCalls, g.calls)
+		})
+	}
+}
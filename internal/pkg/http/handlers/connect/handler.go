@@ -0,0 +1,304 @@
+// Package connect contains HTTP CONNECT requests (tunneling) handler.
+package connect
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/netpolicy"
+)
+
+type dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+type metrics interface {
+	IncrementSuccessful()
+	IncrementFailed()
+	IncrementOpen()
+	DecrementOpen()
+	AddSentBytes(int)
+	AddReceivedBytes(int)
+	IncrementIntercepted()
+	IncrementBlocked()
+}
+
+type interceptor interface {
+	// ShouldIntercept reports whether the connection to the target (host:port) should be intercepted.
+	ShouldIntercept(target string) bool
+
+	// Serve terminates TLS on the client connection and serves the decrypted requests.
+	Serve(ctx context.Context, conn net.Conn, target string) error
+}
+
+// Handler handles CONNECT requests: it dials the destination, hijacks the client connection and splices the bytes
+// in both directions.
+type Handler struct {
+	ctx    context.Context
+	log    *zap.Logger
+	dialer dialer
+	m      metrics
+
+	allowedPorts map[uint16]struct{} // empty map means "any port is allowed"
+	dialTimeout  time.Duration
+	idleTimeout  time.Duration
+	interceptor  interceptor // nil means "interception is disabled"
+}
+
+// Option allows to configure the Handler.
+type Option func(*Handler)
+
+// WithAllowedPorts limits the destination ports. Without this option any port is allowed.
+func WithAllowedPorts(ports ...uint16) Option {
+	return func(h *Handler) {
+		for _, p := range ports {
+			h.allowedPorts[p] = struct{}{}
+		}
+	}
+}
+
+// WithDialTimeout sets the destination dialing timeout. Zero value means "no timeout".
+func WithDialTimeout(d time.Duration) Option { return func(h *Handler) { h.dialTimeout = d } }
+
+// WithIdleTimeout sets the maximal duration without any data transferring in both directions, after which the
+// tunnel will be closed. Zero value means "no timeout".
+func WithIdleTimeout(d time.Duration) Option { return func(h *Handler) { h.idleTimeout = d } }
+
+// WithInterceptor enables TLS interception for the tunnels (only for the targets, accepted by the interceptor).
+func WithInterceptor(i interceptor) Option { return func(h *Handler) { h.interceptor = i } }
+
+const errPrefix = "tunnel: "
+
+// NewHandler creates CONNECT requests handler.
+func NewHandler(ctx context.Context, log *zap.Logger, dialer dialer, m metrics, opts ...Option) *Handler {
+	h := &Handler{ctx: ctx, log: log, dialer: dialer, m: m, allowedPorts: make(map[uint16]struct{})}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// IsConnectRequest reports whether the request is a CONNECT (tunneling) request.
+func IsConnectRequest(r *http.Request) bool { return r.Method == http.MethodConnect }
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) { //nolint:funlen
+	if !IsConnectRequest(r) {
+		h.m.IncrementFailed()
+		http.Error(w, errPrefix+"CONNECT method expected", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var target = r.URL.Host
+	if target == "" {
+		target = r.Host
+	}
+
+	_, portStr, splitErr := net.SplitHostPort(target)
+	port, portErr := strconv.ParseUint(portStr, 10, 16) //nolint:gomnd
+
+	if splitErr != nil || portErr != nil {
+		h.m.IncrementFailed()
+		http.Error(w, errPrefix+"wrong tunnel target ["+target+"]", http.StatusBadRequest)
+
+		return
+	}
+
+	if !h.isPortAllowed(uint16(port)) {
+		h.m.IncrementFailed()
+		http.Error(w, errPrefix+"port "+portStr+" is not allowed", http.StatusForbidden)
+
+		return
+	}
+
+	if !auth.PermissionsFromContext(r.Context()).Allows(r.Method, target) {
+		h.m.IncrementFailed()
+		http.Error(w, errPrefix+"tunnel to ["+target+"] is not permitted for the client", http.StatusForbidden)
+
+		return
+	}
+
+	hijacker, isHijacker := w.(http.Hijacker)
+	if !isHijacker {
+		h.m.IncrementFailed()
+		http.Error(w, errPrefix+"connection hijacking is not supported", http.StatusInternalServerError)
+
+		return
+	}
+
+	if h.interceptor != nil && h.interceptor.ShouldIntercept(target) {
+		h.serveIntercepted(w, r, hijacker, target)
+
+		return
+	}
+
+	upstream, dialErr := h.dial(target)
+	if dialErr != nil {
+		var blocked *netpolicy.BlockedError
+		if errors.As(dialErr, &blocked) {
+			h.m.IncrementBlocked()
+			http.Error(w, errPrefix+blocked.Error(), http.StatusForbidden)
+
+			return
+		}
+
+		h.m.IncrementFailed()
+		http.Error(w, errPrefix+dialErr.Error(), http.StatusBadGateway)
+
+		return
+	}
+
+	defer func() { _ = upstream.Close() }()
+
+	conn, br, ok := h.establish(w, hijacker)
+	if !ok {
+		return
+	}
+
+	defer func() { _ = conn.Close() }()
+
+	// the client could send some data right after the request (before the response receiving)
+	if n := br.Buffered(); n > 0 {
+		buffered, _ := br.Peek(n)
+
+		if _, err := upstream.Write(buffered); err != nil {
+			h.m.IncrementFailed()
+
+			return
+		}
+
+		h.m.AddSentBytes(n)
+	}
+
+	h.m.IncrementSuccessful()
+	h.m.IncrementOpen()
+
+	defer h.m.DecrementOpen()
+
+	var (
+		startedAt = time.Now()
+		t         = newTunnel(conn, upstream, h.idleTimeout, h.m)
+	)
+
+	t.run(h.ctx)
+
+	h.log.Debug("Tunnel closed",
+		zap.String("target", target),
+		zap.Int64("sent bytes", t.sent.Load()),
+		zap.Int64("received bytes", t.received.Load()),
+		zap.Duration("duration", time.Since(startedAt)),
+	)
+}
+
+// establish hijacks the client connection and responds with the "200 Connection Established" status. The returned
+// reader must be used for the client data reading, since it may contain already buffered data.
+func (h *Handler) establish(w http.ResponseWriter, hijacker http.Hijacker) (net.Conn, *bufio.Reader, bool) {
+	conn, brw, hijackErr := hijacker.Hijack()
+	if hijackErr != nil {
+		h.m.IncrementFailed()
+		http.Error(w, errPrefix+hijackErr.Error(), http.StatusInternalServerError)
+
+		return nil, nil, false
+	}
+
+	_ = conn.SetDeadline(time.Time{}) // reset the server read/write deadlines
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		h.m.IncrementFailed()
+
+		_ = conn.Close()
+
+		return nil, nil, false
+	}
+
+	return conn, brw.Reader, true
+}
+
+// serveIntercepted establishes the tunnel and passes the client connection into the interceptor (TLS will be
+// terminated by the proxy, and the decrypted requests will be proxied as regular requests). The decrypted requests
+// inherit the CONNECT request context values (like the authenticated user and the client permissions).
+func (h *Handler) serveIntercepted(w http.ResponseWriter, r *http.Request, hijacker http.Hijacker, target string) {
+	conn, br, ok := h.establish(w, hijacker)
+	if !ok {
+		return
+	}
+
+	defer func() { _ = conn.Close() }()
+
+	h.m.IncrementSuccessful()
+	h.m.IncrementIntercepted()
+	h.m.IncrementOpen()
+
+	defer h.m.DecrementOpen()
+
+	ctx, cancel := h.tunnelContext(r)
+	defer cancel()
+
+	if err := h.interceptor.Serve(ctx, &bufferedConn{Conn: conn, r: br}, target); err != nil {
+		h.log.Debug("Intercepted tunnel error", zap.String("target", target), zap.Error(err))
+	}
+}
+
+// tunnelContext returns the context with the CONNECT request values, that is canceled when the handler context is
+// done (the hijacked connections are not closed by the server shutdown).
+func (h *Handler) tunnelContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+
+	go func() {
+		select {
+		case <-h.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// bufferedConn is a connection, that reads the data, buffered by the server, first. The rest of the data is read
+// from the connection directly, since the server reader cancels the CONNECT request context on any read error
+// (including the read deadline exceeding, that is used by the HTTP server for the pending reads aborting).
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	if c.r.Buffered() > 0 {
+		return c.r.Read(b) // reads the buffered data only
+	}
+
+	return c.Conn.Read(b)
+}
+
+func (h *Handler) isPortAllowed(port uint16) bool {
+	if len(h.allowedPorts) == 0 {
+		return true
+	}
+
+	_, ok := h.allowedPorts[port]
+
+	return ok
+}
+
+func (h *Handler) dial(target string) (net.Conn, error) {
+	var ctx, cancel = h.ctx, context.CancelFunc(func() {})
+
+	if h.dialTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, h.dialTimeout)
+	}
+
+	defer cancel()
+
+	return h.dialer.DialContext(ctx, "tcp", target)
+}
@@ -0,0 +1,288 @@
+package connect_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/connect"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/netpolicy"
+)
+
+type fakeMetrics struct {
+	mu                                          sync.Mutex
+	success, failed, open, intercepted, blocked int
+	sentBytes, receivedBytes                    int
+}
+
+func (m *fakeMetrics) IncrementSuccessful()   { m.mu.Lock(); m.success++; m.mu.Unlock() }
+func (m *fakeMetrics) IncrementFailed()       { m.mu.Lock(); m.failed++; m.mu.Unlock() }
+func (m *fakeMetrics) IncrementOpen()         { m.mu.Lock(); m.open++; m.mu.Unlock() }
+func (m *fakeMetrics) DecrementOpen()         { m.mu.Lock(); m.open--; m.mu.Unlock() }
+func (m *fakeMetrics) AddSentBytes(n int)     { m.mu.Lock(); m.sentBytes += n; m.mu.Unlock() }
+func (m *fakeMetrics) AddReceivedBytes(n int) { m.mu.Lock(); m.receivedBytes += n; m.mu.Unlock() }
+func (m *fakeMetrics) IncrementIntercepted()  { m.mu.Lock(); m.intercepted++; m.mu.Unlock() }
+func (m *fakeMetrics) IncrementBlocked()      { m.mu.Lock(); m.blocked++; m.mu.Unlock() }
+
+func TestHandler_ServeHTTPErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		giveMethod     string
+		giveTarget     string
+		giveOptions    []connect.Option
+		wantStatusCode int
+		wantStrings    []string
+	}{
+		{
+			name:           "not a CONNECT method",
+			giveMethod:     http.MethodGet,
+			giveTarget:     "example.com:443",
+			wantStatusCode: http.StatusMethodNotAllowed,
+			wantStrings:    []string{"CONNECT method expected"},
+		},
+		{
+			name:           "without port",
+			giveMethod:     http.MethodConnect,
+			giveTarget:     "example.com",
+			wantStatusCode: http.StatusBadRequest,
+			wantStrings:    []string{"wrong tunnel target", "example.com"},
+		},
+		{
+			name:           "port is not allowed",
+			giveMethod:     http.MethodConnect,
+			giveTarget:     "example.com:22",
+			giveOptions:    []connect.Option{connect.WithAllowedPorts(443, 8443)},
+			wantStatusCode: http.StatusForbidden,
+			wantStrings:    []string{"port 22 is not allowed"},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				rr = httptest.NewRecorder()
+				m  = fakeMetrics{}
+			)
+
+			req := &http.Request{
+				Method: tt.giveMethod,
+				URL:    &url.URL{Host: tt.giveTarget},
+				Host:   tt.giveTarget,
+				Header: http.Header{},
+			}
+
+			connect.NewHandler(context.Background(), zap.NewNop(), &net.Dialer{}, &m, tt.giveOptions...).
+				ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+
+			for _, s := range tt.wantStrings {
+				assert.Contains(t, rr.Body.String(), s)
+			}
+
+			assert.Equal(t, 1, m.failed)
+			assert.Equal(t, 0, m.success)
+		})
+	}
+}
+
+// sendConnect sends CONNECT request to the proxy and returns the connection with the response.
+func sendConnect(t *testing.T, proxyURL, target string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(proxyURL, "http://"))
+	assert.NoError(t, err)
+
+	_, err = conn.Write([]byte("CONNECT " + target + " HTTP/1.1\r\nHost: " + target + "\r\n\r\n"))
+	assert.NoError(t, err)
+
+	br := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	assert.NoError(t, err)
+
+	return conn, br, resp
+}
+
+func TestHandler_ServeHTTPTunnel(t *testing.T) {
+	// echo server as an upstream
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	defer upstream.Close()
+
+	go func() {
+		for {
+			c, acceptErr := upstream.Accept()
+			if acceptErr != nil {
+				return
+			}
+
+			go func() { defer c.Close(); _, _ = io.Copy(c, c) }()
+		}
+	}()
+
+	var m = fakeMetrics{}
+
+	proxySrv := httptest.NewServer(connect.NewHandler(context.Background(), zap.NewNop(), &net.Dialer{}, &m,
+		connect.WithIdleTimeout(time.Second),
+	))
+	defer proxySrv.Close()
+
+	conn, br, resp := sendConnect(t, proxySrv.URL, upstream.Addr().String())
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = conn.Write([]byte("ping"))
+	assert.NoError(t, err)
+
+	echo := make([]byte, 4)
+	_, err = io.ReadFull(br, echo)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(echo))
+
+	assert.NoError(t, conn.Close())
+
+	assert.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		return m.open == 0 && m.success == 1 && m.sentBytes == 4 && m.receivedBytes == 4
+	}, time.Second*2, time.Millisecond*5)
+}
+
+func TestHandler_ServeHTTPDialError(t *testing.T) {
+	// reserve a port and close the listener, so nobody listens on it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	target := l.Addr().String()
+	assert.NoError(t, l.Close())
+
+	var m = fakeMetrics{}
+
+	proxySrv := httptest.NewServer(connect.NewHandler(context.Background(), zap.NewNop(), &net.Dialer{}, &m))
+	defer proxySrv.Close()
+
+	conn, _, resp := sendConnect(t, proxySrv.URL, target)
+	defer conn.Close()
+
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, 1, m.failed)
+}
+
+func TestHandler_ServeHTTPBlocked(t *testing.T) {
+	var (
+		m      = fakeMetrics{}
+		dialer = netpolicy.NewDialer(&net.Dialer{}, netpolicy.New(netpolicy.WithDenyPrivateNetworks()))
+	)
+
+	proxySrv := httptest.NewServer(connect.NewHandler(context.Background(), zap.NewNop(), dialer, &m))
+	defer proxySrv.Close()
+
+	conn, br, resp := sendConnect(t, proxySrv.URL, "127.0.0.1:22")
+	defer conn.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(br, resp.ContentLength))
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, string(body), "network 127.0.0.0/8 is denied")
+	assert.Equal(t, 1, m.blocked)
+	assert.Equal(t, 0, m.failed)
+}
+
+type fakeInterceptor struct {
+	served chan string
+}
+
+func (i *fakeInterceptor) ShouldIntercept(target string) bool {
+	return strings.HasPrefix(target, "intercept.me:")
+}
+
+func (i *fakeInterceptor) Serve(_ context.Context, conn net.Conn, target string) error {
+	defer conn.Close()
+
+	i.served <- target
+
+	return nil
+}
+
+func TestHandler_ServeHTTPIntercepted(t *testing.T) {
+	var (
+		m           = fakeMetrics{}
+		interceptor = &fakeInterceptor{served: make(chan string, 1)}
+	)
+
+	proxySrv := httptest.NewServer(connect.NewHandler(context.Background(), zap.NewNop(), &net.Dialer{}, &m,
+		connect.WithInterceptor(interceptor),
+	))
+	defer proxySrv.Close()
+
+	conn, _, resp := sendConnect(t, proxySrv.URL, "intercept.me:443")
+	defer conn.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "intercept.me:443", <-interceptor.served)
+
+	assert.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		return m.open == 0 && m.success == 1 && m.intercepted == 1
+	}, time.Second*2, time.Millisecond*5)
+}
+
+// abortingInterceptor aborts the pending read (like the HTTP server does after each request), and reports the tunnel
+// context error and the next read data.
+type abortingInterceptor struct {
+	ctxErr chan error
+	read   chan string
+}
+
+func (i *abortingInterceptor) ShouldIntercept(string) bool { return true }
+
+func (i *abortingInterceptor) Serve(ctx context.Context, conn net.Conn, _ string) error {
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(-time.Second))
+	_, _ = conn.Read(make([]byte, 1))
+	_ = conn.SetReadDeadline(time.Time{})
+
+	i.ctxErr <- ctx.Err()
+
+	buf := make([]byte, 3)
+	_, _ = io.ReadFull(conn, buf)
+
+	i.read <- string(buf)
+
+	return nil
+}
+
+func TestHandler_ServeHTTPInterceptedReadAborting(t *testing.T) {
+	interceptor := &abortingInterceptor{ctxErr: make(chan error, 1), read: make(chan string, 1)}
+
+	proxySrv := httptest.NewServer(connect.NewHandler(context.Background(), zap.NewNop(), &net.Dialer{}, &fakeMetrics{},
+		connect.WithInterceptor(interceptor),
+	))
+	defer proxySrv.Close()
+
+	conn, _, resp := sendConnect(t, proxySrv.URL, "intercept.me:443")
+	defer conn.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, <-interceptor.ctxErr) // the tunnel must not be closed
+
+	_, err := conn.Write([]byte("foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", <-interceptor.read)
+}
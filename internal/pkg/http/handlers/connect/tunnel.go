@@ -0,0 +1,125 @@
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tunnel splices the bytes between the client and the upstream connections.
+type tunnel struct {
+	client, upstream net.Conn
+	idleTimeout      time.Duration
+	m                metrics
+
+	lastActivity atomic.Int64 // unix nanoseconds
+	sent         atomic.Int64 // client -> upstream
+	received     atomic.Int64 // upstream -> client
+
+	closeOnce sync.Once
+}
+
+func newTunnel(client, upstream net.Conn, idleTimeout time.Duration, m metrics) *tunnel {
+	t := &tunnel{client: client, upstream: upstream, idleTimeout: idleTimeout, m: m}
+	t.touch()
+
+	return t
+}
+
+func (t *tunnel) touch() { t.lastActivity.Store(time.Now().UnixNano()) }
+
+func (t *tunnel) idleFor() time.Duration { return time.Since(time.Unix(0, t.lastActivity.Load())) }
+
+// run splices the data until both sides close the connections, an error occurs, the tunnel is idle for too long, or
+// the context is canceled.
+func (t *tunnel) run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	wg.Add(2) //nolint:gomnd
+
+	go func() {
+		defer wg.Done()
+
+		t.pipe(t.upstream, t.client, func(n int) { t.sent.Add(int64(n)); t.m.AddSentBytes(n) })
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		t.pipe(t.client, t.upstream, func(n int) { t.received.Add(int64(n)); t.m.AddReceivedBytes(n) })
+	}()
+
+	done := make(chan struct{})
+
+	go func() { wg.Wait(); close(done) }()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.close()
+		<-done
+	}
+
+	t.close()
+}
+
+// closeWriter is implemented by connections, that support half-closing (e.g. *net.TCPConn).
+type closeWriter interface {
+	CloseWrite() error
+}
+
+const bufferSize = 32 * 1024
+
+func (t *tunnel) pipe(dst, src net.Conn, onTransfer func(int)) {
+	var buf = make([]byte, bufferSize)
+
+	for {
+		if t.idleTimeout > 0 {
+			_ = src.SetReadDeadline(time.Now().Add(t.idleTimeout))
+		}
+
+		n, readErr := src.Read(buf)
+
+		if n > 0 {
+			t.touch()
+
+			if _, err := dst.Write(buf[:n]); err != nil {
+				t.close()
+
+				return
+			}
+
+			onTransfer(n)
+		}
+
+		if readErr != nil {
+			var netErr net.Error
+
+			// the opposite direction can be still active
+			if errors.As(readErr, &netErr) && netErr.Timeout() && t.idleFor() < t.idleTimeout {
+				continue
+			}
+
+			if cw, ok := dst.(closeWriter); ok && errors.Is(readErr, io.EOF) {
+				_ = cw.CloseWrite() // half-close, the opposite direction continues working
+
+				return
+			}
+
+			t.close()
+
+			return
+		}
+	}
+}
+
+func (t *tunnel) close() {
+	t.closeOnce.Do(func() {
+		_ = t.client.Close()
+		_ = t.upstream.Close()
+	})
+}
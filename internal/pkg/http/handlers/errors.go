@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -18,6 +19,19 @@ func NewHTMLErrorHandler(code int) http.Handler {
 	})
 }
 
+// jsonError is the JSON-formatted error response body.
+type jsonError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// RespondJSONError responds with JSON-formatted error (the message and the status code) with passed status code.
+func RespondJSONError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(jsonError{Message: message, Code: code})
+}
+
 type errorPageTemplate string
 
 const defaultErrorTemplate errorPageTemplate = `<!DOCTYPE html>
@@ -27,3 +27,13 @@ func TestNewHTMLErrorHandler(t *testing.T) {
 	assert.Contains(t, body, "Not Found")
 	assert.Contains(t, body, "404")
 }
+
+func TestRespondJSONError(t *testing.T) {
+	var rr = httptest.NewRecorder()
+
+	handlers.RespondJSONError(rr, http.StatusBadRequest, "foo")
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"message":"foo","code":400}`, rr.Body.String())
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/compression"
+)
+
+// compressedWriter writes the encoded response body.
+type compressedWriter struct {
+	http.ResponseWriter
+	enc compression.Encoder
+}
+
+func (w *compressedWriter) Write(p []byte) (int, error) { return w.enc.Write(p) }
+
+// Flush writes the buffered encoded data, and flushes it to the client.
+func (w *compressedWriter) Flush() {
+	if err := w.enc.Flush(); err != nil {
+		return
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close finishes the encoded stream.
+func (w *compressedWriter) Close() error { return w.enc.Close() }
+
+// compressResponse negotiates the response content encoding with the client, and updates the client response
+// headers. The compressing writer and the body to be written into it are returned (nil writer means "the response is
+// not compressed", and the body is returned as is).
+func (h *Handler) compressResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	resp *http.Response,
+	body io.Reader,
+) (*compressedWriter, io.Reader) {
+	var (
+		headers   = w.Header()
+		encoding  = strings.ToLower(strings.TrimSpace(headers.Get("Content-Encoding")))
+		transcode = encoding == string(compression.Gzip) && h.compressor.TranscodesGzip()
+	)
+
+	if r.Method == http.MethodHead || resp.Body == http.NoBody || !isCompressibleStatus(resp.StatusCode) ||
+		(encoding != "" && encoding != "identity" && !transcode) ||
+		!h.compressor.Compressible(headers.Get("Content-Type")) || hasNoTransform(headers) {
+		return nil, body
+	}
+
+	if size, err := strconv.ParseInt(headers.Get("Content-Length"), 10, 64); err == nil && !transcode &&
+		size < h.compressor.MinSize() { // the size of the gzip encoded content is not compared
+		return nil, body
+	}
+
+	addVary(headers, "Accept-Encoding") // the response depends on the client accepted encodings from now on
+
+	var negotiated = h.compressor.Negotiate(r.Header.Get("Accept-Encoding"))
+
+	if negotiated == "" || (transcode && negotiated != compression.Brotli) { // gzip is passed as is
+		return nil, body
+	}
+
+	if transcode {
+		body = compression.GzipReader(body)
+	}
+
+	headers.Set("Content-Encoding", string(negotiated))
+	headers.Del("Content-Length")
+	headers.Del("Accept-Ranges") // the ranges of the encoded content are not supported
+
+	if etag := headers.Get("ETag"); strings.HasPrefix(etag, `"`) { // the encoded content is not the same byte-to-byte
+		headers.Set("ETag", "W/"+etag)
+	}
+
+	return &compressedWriter{ResponseWriter: w, enc: h.compressor.NewEncoder(negotiated, w)}, body
+}
+
+func isCompressibleStatus(code int) bool {
+	return code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusPartialContent &&
+		code != http.StatusNotModified
+}
+
+// hasNoTransform reports whether the `Cache-Control: no-transform` directive forbids the content modifying.
+func hasNoTransform(h http.Header) bool {
+	for _, value := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-transform") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// addVary adds the header name into the `Vary` header, when it is not there yet.
+func addVary(h http.Header, name string) {
+	for _, value := range h.Values("Vary") {
+		for _, existing := range strings.Split(value, ",") {
+			if existing = strings.TrimSpace(existing); existing == "*" || strings.EqualFold(existing, name) {
+				return
+			}
+		}
+	}
+
+	h.Add("Vary", name)
+}
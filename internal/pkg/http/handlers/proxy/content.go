@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/rewrite"
+)
+
+// filterAcceptEncoding removes the encodings, that cannot be decoded before the content rewriting, from the
+// `Accept-Encoding` request header.
+func filterAcceptEncoding(h http.Header) {
+	if value := h.Get("Accept-Encoding"); value != "" {
+		if filtered := rewrite.AcceptEncoding(value); filtered != "" {
+			h.Set("Accept-Encoding", filtered)
+		} else {
+			h.Del("Accept-Encoding")
+		}
+	}
+}
+
+// rewriteContent rewrites the response cookies attributes (in the client response headers) and returns the
+// rewritten response body. Nil is returned, when the response content cannot be rewritten (it is passed as is).
+func (h *Handler) rewriteContent(headers http.Header, req *http.Request, resp *http.Response) io.ReadCloser {
+	var base = req.URL
+
+	if resp.Request != nil { // the last request (redirects may be followed)
+		base = resp.Request.URL
+	}
+
+	if cookies := headers.Values("Set-Cookie"); len(cookies) > 0 {
+		headers.Del("Set-Cookie")
+
+		for _, cookie := range cookies {
+			headers.Add("Set-Cookie", h.rewriter.SetCookie(cookie, base))
+		}
+	}
+
+	var contentType, contentEncoding = resp.Header.Get("Content-Type"), resp.Header.Get("Content-Encoding")
+
+	if resp.Body == http.NoBody || req.Method == http.MethodHead || !rewrite.Supports(contentType, contentEncoding) {
+		return nil
+	}
+
+	// the rewritten body is decoded, and its length is unknown
+	headers.Del("Content-Encoding")
+	headers.Del("Content-Length")
+
+	return h.rewriter.Reader(resp.Body, contentType, contentEncoding, base)
+}
@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// statusClientClosedRequest is a non-standard (nginx) status code, used when the client closes the connection before
+// the response is sent.
+const statusClientClosedRequest = 499
+
+// upstreamContext returns the context for the upstream request. It is canceled when the client request is canceled
+// (the client has gone) or the server context is done (the server is shutting down).
+func upstreamContext(r *http.Request, serverCtx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+
+	go func() {
+		select {
+		case <-serverCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// isClientClosed reports whether the client has closed the connection (the request context is canceled by the
+// server).
+func isClientClosed(r *http.Request) bool { return errors.Is(r.Context().Err(), context.Canceled) }
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// NewForwardHandler creates a classic forward-proxy handler, which accepts requests with the absolute-form request
+// target (e.g. `GET http://example.com/foo HTTP/1.1`), as HTTP clients do when the `HTTP_PROXY` is set.
+func NewForwardHandler(ctx context.Context, httpClient httpClient, m metrics, opts ...Option) *Handler {
+	h := NewHandler(ctx, httpClient, m, opts...)
+	h.forward = true
+
+	return h
+}
+
+// IsForwardProxyRequest reports whether the request is a forward-proxy request (the request target is in the
+// absolute-form).
+func IsForwardProxyRequest(r *http.Request) bool { return r.URL.IsAbs() }
+
+// TargetHost returns the target host (with the port, if any) of the proxy route, forward-proxy or CONNECT request.
+// Empty string is returned, if the host cannot be resolved.
+func TargetHost(r *http.Request) string {
+	switch {
+	case r.Method == http.MethodConnect:
+		if r.URL.Host != "" {
+			return r.URL.Host
+		}
+
+		return r.Host
+
+	case IsForwardProxyRequest(r):
+		return r.URL.Host
+	}
+
+	uri, uriFound := mux.Vars(r)["uri"]
+	if !uriFound {
+		return ""
+	}
+
+	_, path := uriToSchemaAndPath(uri)
+	host, _, _ := strings.Cut(path, "/")
+
+	return host
+}
+
+// targetURIFromRequestLine resolves the target URI using the absolute-form request target.
+func (h *Handler) targetURIFromRequestLine(r *http.Request) (string, *targetError) {
+	if !IsForwardProxyRequest(r) || r.URL.Host == "" {
+		return "", &targetError{http.StatusBadRequest, "absolute request URI expected"}
+	}
+
+	switch r.URL.Scheme {
+	case "http", "https":
+	default:
+		return "", &targetError{http.StatusBadRequest, "unsupported request URI schema: " + r.URL.Scheme}
+	}
+
+	u := *r.URL
+	u.Fragment = ""
+
+	return u.String(), nil
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// hopByHopHeaders are meaningful only for a single transport-level connection and must not be forwarded by proxies
+// (RFC 9110, section 7.6.1). "Proxy-Connection" is non-standard, but still sent by some clients.
+var hopByHopHeaders = [...]string{ //nolint:gochecknoglobals
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopByHopHeaders removes hop-by-hop headers, including the headers listed in the "Connection" header.
+func removeHopByHopHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+// endToEndHeaders returns a copy of the headers without the hop-by-hop headers. When the connection upgrade is
+// negotiated, the "Connection" and "Upgrade" headers are kept, since the upgrade is the subject of the handshake.
+func endToEndHeaders(src http.Header, isUpgrade bool) http.Header {
+	var h = src.Clone()
+
+	removeHopByHopHeaders(h)
+
+	if isUpgrade {
+		h.Set("Connection", "Upgrade")
+		h.Set("Upgrade", src.Get("Upgrade"))
+	}
+
+	return h
+}
+
+// copyHeaders copies the headers (each value as a separate header line, so multi-value headers like "Set-Cookie" are
+// not corrupted).
+func copyHeaders(dst, src http.Header) {
+	for name, values := range src {
+		for _, v := range values {
+			dst.Add(name, v)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Limits are the requests and responses size limits. Zero value means "no limit".
+type Limits struct {
+	MaxRequestBodySize  int64 // bytes
+	MaxResponseBodySize int64 // bytes
+	MaxURLLength        int   // request target (URI) length
+	MaxHeaderBytes      int   // request line and headers size
+}
+
+var (
+	errRequestBodyTooLarge  = errors.New("request body is too large")
+	errResponseBodyTooLarge = errors.New("response body is too large")
+)
+
+// checkRequestLimits checks the request URL, headers and body (when its length is known) sizes, and responds with
+// the error, when any limit is exceeded (false is returned in this case). The request body with unknown length is
+// wrapped, so its reading fails with the errRequestBodyTooLarge error, when the limit is exceeded.
+func (h *Handler) checkRequestLimits(w http.ResponseWriter, r *http.Request) bool {
+	var l = h.limits
+
+	switch {
+	case l.MaxURLLength > 0 && len(r.RequestURI) > l.MaxURLLength:
+		h.m.IncrementURLTooLong()
+		http.Error(w, proxyErrPrefix+"request URL is too long", http.StatusRequestURITooLong)
+
+		return false
+
+	case l.MaxHeaderBytes > 0 && requestHeaderSize(r) > l.MaxHeaderBytes:
+		h.m.IncrementHeadersTooLarge()
+		http.Error(w, proxyErrPrefix+"request headers are too large", http.StatusRequestHeaderFieldsTooLarge)
+
+		return false
+
+	case l.MaxRequestBodySize > 0 && r.ContentLength > l.MaxRequestBodySize:
+		h.m.IncrementRequestBodyTooLarge()
+		http.Error(w, proxyErrPrefix+errRequestBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+
+		return false
+	}
+
+	if l.MaxRequestBodySize > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = &limitedBody{ReadCloser: r.Body, remaining: l.MaxRequestBodySize, err: errRequestBodyTooLarge}
+	}
+
+	return true
+}
+
+// requestHeaderSize returns the request line and headers size (like the HTTP server counts it).
+func requestHeaderSize(r *http.Request) int {
+	var size = len(r.Method) + len(r.RequestURI) + len(r.Proto) + len(" \r\n ") + len("Host: \r\n") + len(r.Host)
+
+	for name, values := range r.Header {
+		for _, v := range values {
+			size += len(name) + len(v) + len(": \r\n")
+		}
+	}
+
+	return size
+}
+
+// limitedBody fails with the err, when more than remaining bytes are read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64 // negative, when the limit is exceeded
+	err       error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, b.err
+	}
+
+	if int64(len(p)) > b.remaining+1 { // one extra byte is enough to detect the limit exceeding
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.remaining {
+		b.remaining -= int64(n)
+
+		return n, err
+	}
+
+	n, b.remaining = int(b.remaining), -1
+
+	return n, b.err
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/compression"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/cors"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redirect"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/rewrite"
+)
+
+// Option allows to configure the Handler.
+type Option func(*Handler)
+
+// WithRequestTimeout sets the upstream request timeout. For the regular responses it limits the whole request
+// processing (including the response body reading), for the streaming responses - only the time to the response
+// headers. Zero value means "no timeout".
+func WithRequestTimeout(d time.Duration) Option {
+	return func(h *Handler) { h.requestTimeout = d }
+}
+
+// WithStreamIdleTimeout sets the maximal duration between two chunks of the streaming response (SSE, chunked
+// responses, etc.). Zero value means "no timeout".
+func WithStreamIdleTimeout(d time.Duration) Option {
+	return func(h *Handler) { h.streamIdleTimeout = d }
+}
+
+// WithWebsocketPingInterval sets the interval for the keepalive pings sending into the proxied WebSocket connections.
+// The stream idle timeout is used as the WebSocket idle timeout. Zero value disables pinging.
+func WithWebsocketPingInterval(d time.Duration) Option {
+	return func(h *Handler) { h.websocketPingInterval = d }
+}
+
+// WithForwardedHeaders sets the proxy-related headers (`X-Forwarded-*`, `Forwarded`, `Via`) emitter. Without this
+// option the client headers are passed as is.
+func WithForwardedHeaders(f forwardedHeaders) Option {
+	return func(h *Handler) { h.forwarded = f }
+}
+
+// WithRedirectPolicy sets the redirects policy, that can be overridden per request using the redirect.Header request
+// header (the policy is passed to the HTTP client using the request context).
+func WithRedirectPolicy(p redirect.Policy) Option {
+	return func(h *Handler) { h.redirects = p }
+}
+
+// WithRoutePrefix sets the proxy route prefix (like "/proxy"), that is used for the `Location` and
+// `Content-Location` response headers rewriting, so the clients keep going through the proxy. Without this option
+// (and in the forward-proxy mode) the headers are passed as is.
+func WithRoutePrefix(prefix string) Option {
+	return func(h *Handler) { h.routePrefix = prefix }
+}
+
+// WithContentRewriting enables the web-browsing mode: URLs in the HTML and CSS responses (and the cookies attributes)
+// are rewritten into the proxy route form, so the pages work through the proxy. It is not applicable in the
+// forward-proxy mode.
+func WithContentRewriting(rw *rewrite.Rewriter) Option {
+	return func(h *Handler) { h.rewriter = rw }
+}
+
+// WithCORS sets the CORS policy, that is used for the upstream `Access-Control-*` response headers filtering (the
+// policy headers are set by the corsreq middleware). Without this option (and in the forward-proxy mode) the upstream
+// headers are passed as is.
+func WithCORS(p *cors.Policy) Option {
+	return func(h *Handler) { h.cors = p }
+}
+
+// WithCompression enables the responses compression: the content encoding is negotiated with the client, and the
+// compressible responses are encoded on the fly (including the streaming ones). It is not applicable in the
+// forward-proxy mode.
+func WithCompression(c *compression.Compressor) Option {
+	return func(h *Handler) { h.compressor = c }
+}
+
+// WithLimits sets the requests and responses size limits. Requests over the limits are rejected with the 413 (body),
+// 414 (URL) or 431 (headers) status, responses over the limit - with the 502 status (or aborted, when the response
+// body length is unknown).
+func WithLimits(l Limits) Option {
+	return func(h *Handler) { h.limits = l }
+}
@@ -4,11 +4,25 @@ import (
 	"context"
 	"errors"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/circuit"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/compression"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/cors"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/netconn"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/netpolicy"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redirect"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/rewrite"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/upstreamtls"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/websocket"
 )
 
 type httpClient interface {
@@ -18,13 +32,44 @@ type httpClient interface {
 type metrics interface {
 	IncrementSuccessful()
 	IncrementFailed()
+	IncrementClientClosed()
+	IncrementBlocked()
 	IncrementErrors()
+	IncrementOpenWebsockets()
+	DecrementOpenWebsockets()
+	IncrementRequestBodyTooLarge()
+	IncrementResponseBodyTooLarge()
+	IncrementURLTooLong()
+	IncrementHeadersTooLarge()
+}
+
+type forwardedHeaders interface {
+	// Apply modifies the upstream request headers (out) using the client request (in) details.
+	Apply(in *http.Request, out http.Header, targetHost string)
 }
 
 type Handler struct {
 	ctx        context.Context
 	httpClient httpClient
 	m          metrics
+
+	requestTimeout        time.Duration
+	streamIdleTimeout     time.Duration
+	websocketPingInterval time.Duration
+
+	forwarded forwardedHeaders // nil means "pass the client headers as is"
+
+	redirects   redirect.Policy
+	routePrefix string // empty means "do not rewrite the Location headers"
+
+	rewriter *rewrite.Rewriter // nil means "do not rewrite the response content"
+	cors     *cors.Policy      // nil means "pass the upstream CORS headers as is"
+
+	compressor *compression.Compressor // nil means "do not compress the responses"
+
+	limits Limits
+
+	forward bool // the target URI is taken from the request line (absolute-form) instead of the route
 }
 
 const (
@@ -32,40 +77,64 @@ const (
 	defaultTargetSchema = "http"
 )
 
-func NewHandler(ctx context.Context, httpClient httpClient, m metrics) *Handler {
-	return &Handler{ctx: ctx, httpClient: httpClient, m: m}
-}
+// websocketSchemas maps WebSocket schemas into the schemas, used for the handshake request.
+var websocketSchemas = map[string]string{"ws": "http", "wss": "https"} //nolint:gochecknoglobals
 
-func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) { //nolint:funlen
-	// make sure that "uri" are presents
-	uri, uriFound := mux.Vars(r)["uri"]
-	if !uriFound {
-		h.m.IncrementErrors()
-		http.Error(w, proxyErrPrefix+"cannot extract requested URI", http.StatusInternalServerError)
+func NewHandler(ctx context.Context, httpClient httpClient, m metrics, opts ...Option) *Handler {
+	h := &Handler{ctx: ctx, httpClient: httpClient, m: m}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
 
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) { //nolint:funlen,gocognit
+	if !h.checkRequestLimits(w, r) {
 		return
 	}
 
-	// extract request schema and path from requested uri
-	var schema, path = h.uriToSchemaAndPath(uri) // schema is optional
-	if path == "" {
+	var resolve = h.targetURIFromRoute
+	if h.forward {
+		resolve = h.targetURIFromRequestLine
+	}
+
+	targetURI, targetErr := resolve(r)
+	if targetErr != nil {
 		h.m.IncrementErrors()
-		http.Error(w, proxyErrPrefix+"empty request path", http.StatusBadRequest)
+		http.Error(w, proxyErrPrefix+targetErr.message, targetErr.code)
 
 		return
 	}
 
-	// build target uri
-	targetURI, targetURIErr := h.buildTargetURI(schema, path, r.URL.RawQuery)
-	if targetURIErr != nil {
+	redirects, redirectsErr := h.redirectPolicy(r)
+	if redirectsErr != nil {
 		h.m.IncrementErrors()
-		http.Error(w, proxyErrPrefix+"cannot build target URI", http.StatusBadRequest)
+		http.Error(w, proxyErrPrefix+redirectsErr.Error(), http.StatusBadRequest)
 
 		return
 	}
 
+	// the upstream request must be canceled as soon as the client has gone
+	ctx, cancel := upstreamContext(r, h.ctx)
+	defer cancel()
+
+	if redirects.Mode != "" { // otherwise, the HTTP client default policy is used
+		ctx = redirect.WithPolicy(ctx, redirects)
+	}
+
+	// the watchdog limits the request processing time (and the time between stream chunks later)
+	wd := newWatchdog(h.requestTimeout, cancel)
+	defer wd.Stop()
+
+	ctx = &timeoutContext{Context: ctx, wd: wd}
+
+	// long-polling upstreams can respond later than the server write timeout allows
+	netconn.ExtendWriteDeadline(r.Context(), h.requestTimeout)
+
 	// create an HTTP request
-	req, reqErr := http.NewRequestWithContext(h.ctx, r.Method, targetURI, r.Body)
+	req, reqErr := http.NewRequestWithContext(ctx, r.Method, targetURI, r.Body)
 	if reqErr != nil {
 		h.m.IncrementErrors()
 		http.Error(w, proxyErrPrefix+reqErr.Error(), http.StatusInternalServerError)
@@ -73,15 +142,81 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) { //nolint:f
 		return
 	}
 
-	// proxy all request headers
-	req.Header = r.Header.Clone()
+	if !auth.PermissionsFromContext(r.Context()).Allows(r.Method, req.URL.Host) {
+		h.m.IncrementErrors()
+		http.Error(w, proxyErrPrefix+"request to ["+req.URL.Host+"] is not permitted for the client", http.StatusForbidden)
+
+		return
+	}
+
+	// proxy request headers (except the hop-by-hop headers)
+	req.Header = endToEndHeaders(r.Header, websocket.IsUpgradeRequest(r))
+	req.Header.Del(redirect.Header)
+
+	var rewriting = h.rewriter != nil && !h.forward
+
+	if rewriting { // the upstream must not use the encodings, that cannot be decoded for the rewriting
+		filterAcceptEncoding(req.Header)
+	}
+
+	if h.forwarded != nil {
+		h.forwarded.Apply(r, req.Header, req.URL.Host)
+	}
 
 	// make an http request
 	resp, respErr := h.httpClient.Do(req)
 	if respErr != nil {
+		if errors.Is(respErr, errRequestBodyTooLarge) { // the upload is aborted
+			h.m.IncrementRequestBodyTooLarge()
+			http.Error(w, proxyErrPrefix+errRequestBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+
+			return
+		}
+
+		if !wd.Fired() && isClientClosed(r) {
+			h.m.IncrementClientClosed()
+			w.WriteHeader(statusClientClosedRequest) // nobody reads it, but it is logged
+
+			return
+		}
+
+		var notPermitted *redirect.NotPermittedError
+		if errors.As(respErr, &notPermitted) { // the followed redirect target is checked like the requested one
+			h.m.IncrementErrors()
+			http.Error(w, proxyErrPrefix+notPermitted.Error(), http.StatusForbidden)
+
+			return
+		}
+
+		var blocked *netpolicy.BlockedError
+		if errors.As(respErr, &blocked) {
+			h.m.IncrementBlocked()
+			http.Error(w, proxyErrPrefix+blocked.Error(), http.StatusForbidden)
+
+			return
+		}
+
 		defer h.m.IncrementFailed()
 
-		if e, ok := respErr.(*url.Error); ok && e.Timeout() { //nolint:errorlint
+		var open *circuit.OpenError
+		if errors.As(respErr, &open) {
+			if open.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(open.RetryAfter.Seconds()))))
+			}
+
+			http.Error(w, proxyErrPrefix+open.Error(), http.StatusServiceUnavailable)
+
+			return
+		}
+
+		var certErr *upstreamtls.CertificateError
+		if errors.As(respErr, &certErr) { // untrusted upstream is not the client fault, but it is not a timeout too
+			http.Error(w, proxyErrPrefix+certErr.Error(), http.StatusBadGateway)
+
+			return
+		}
+
+		if e, ok := respErr.(*url.Error); wd.Fired() || (ok && e.Timeout()) { //nolint:errorlint
 			http.Error(w, proxyErrPrefix+"request timeout exceeded", http.StatusRequestTimeout)
 
 			return
@@ -94,19 +229,106 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) { //nolint:f
 
 	defer func() { _ = resp.Body.Close() }()
 
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		h.serveUpgraded(ctx, w, r, resp, wd)
+
+		return
+	}
+
+	if limit := h.limits.MaxResponseBodySize; limit > 0 && resp.Body != http.NoBody {
+		if resp.ContentLength > limit {
+			h.m.IncrementResponseBodyTooLarge()
+			h.m.IncrementFailed()
+			http.Error(w, proxyErrPrefix+errResponseBodyTooLarge.Error(), http.StatusBadGateway)
+
+			return
+		}
+
+		resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: limit, err: errResponseBodyTooLarge}
+	}
+
+	var respHeaders = endToEndHeaders(resp.Header, false)
+
+	if h.cors != nil && !h.forward { // the policy headers are already set (see the corsreq middleware)
+		h.cors.FilterUpstream(w.Header(), respHeaders)
+	}
+
 	// write HTTP response headers into current HTTP request headers
-	for k, v := range resp.Header {
-		w.Header().Set(k, strings.Join(v, ";"))
+	copyHeaders(w.Header(), respHeaders)
+
+	if h.routePrefix != "" && !h.forward && (redirects.Mode == redirect.ModePass || isRedirect(resp.StatusCode)) {
+		rewriteLocations(w.Header(), req, resp, h.routePrefix)
 	}
 
-	// allow access from anywhere
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	var (
+		streaming           = isStreaming(resp)
+		body      io.Reader = resp.Body
+	)
+
+	if rewriting {
+		if rewritten := h.rewriteContent(w.Header(), req, resp); rewritten != nil {
+			defer func() { _ = rewritten.Close() }()
+
+			body = rewritten
+		}
+	}
+
+	var compressed *compressedWriter
+
+	if h.compressor != nil && !h.forward {
+		compressed, body = h.compressResponse(w, r, resp, body)
+	}
+
+	if streaming {
+		// from now on the request timeout is not applicable, only the time between chunks is limited
+		wd.Reset(h.streamIdleTimeout)
+		netconn.ExtendWriteDeadline(r.Context(), h.streamIdleTimeout)
+	}
 
 	w.WriteHeader(resp.StatusCode)
 
-	if _, copyErr := io.Copy(w, resp.Body); copyErr != nil {
-		h.m.IncrementErrors()
-		http.Error(w, proxyErrPrefix+copyErr.Error(), http.StatusInternalServerError)
+	if streaming { // send headers to the client immediately
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	var dst http.ResponseWriter = w
+
+	if compressed != nil {
+		dst = compressed
+	}
+
+	copyErr := copyResponse(dst, body, streaming, func() {
+		if streaming {
+			wd.Reset(h.streamIdleTimeout)
+			netconn.ExtendWriteDeadline(r.Context(), h.streamIdleTimeout)
+		}
+	})
+
+	// on the copying error, the unfinished encoded stream is dropped with the aborted connection (and the encoder is
+	// not pooled)
+	if copyErr == nil && compressed != nil {
+		copyErr = compressed.Close() // the encoded stream must be finished
+	}
+
+	if copyErr != nil {
+		if errors.Is(copyErr, errResponseBodyTooLarge) { // the response headers are sent already
+			h.m.IncrementResponseBodyTooLarge()
+			h.m.IncrementFailed()
+			netconn.Abort(r.Context())
+
+			return
+		}
+
+		if isClientClosed(r) {
+			h.m.IncrementClientClosed()
+
+			return
+		}
+
+		h.m.IncrementFailed()
+		netconn.Abort(r.Context()) // the response headers are sent already, so the error response cannot be written
 
 		return
 	}
@@ -114,13 +336,75 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) { //nolint:f
 	h.m.IncrementSuccessful()
 }
 
-func (h *Handler) uriToSchemaAndPath(uri string) (string, string) {
-	slashPos := strings.IndexByte(uri, '/')
+// redirectPolicy returns the redirects policy for the request (the mode can be overridden by the request header).
+func (h *Handler) redirectPolicy(r *http.Request) (redirect.Policy, error) {
+	var p = h.redirects
+
+	if value := r.Header.Get(redirect.Header); value != "" {
+		mode, err := redirect.ParseMode(value)
+		if err != nil {
+			return p, err
+		}
+
+		p.Mode = mode
+	}
+
+	return p, nil
+}
+
+func isRedirect(code int) bool { return code >= 300 && code < 400 } //nolint:gomnd
+
+// rewriteLocations rewrites the `Location` and `Content-Location` headers into the proxy route form, so the clients
+// keep going through the proxy.
+func rewriteLocations(h http.Header, req *http.Request, resp *http.Response, prefix string) {
+	var base = req.URL
+
+	if resp.Request != nil { // the last request (redirects may be followed)
+		base = resp.Request.URL
+	}
+
+	for _, name := range [...]string{"Location", "Content-Location"} {
+		if value := h.Get(name); value != "" {
+			h.Set(name, redirect.RewriteLocation(value, base, prefix))
+		}
+	}
+}
+
+// targetError is a target URI resolving error.
+type targetError struct {
+	code    int
+	message string
+}
 
-	if slashPos != -1 {
-		schema := strings.ToLower(uri[:slashPos])
+// targetURIFromRoute resolves the target URI using the "uri" route variable (e.g. "https/example.com/foo").
+func (h *Handler) targetURIFromRoute(r *http.Request) (string, *targetError) {
+	// make sure that "uri" are presents
+	uri, uriFound := mux.Vars(r)["uri"]
+	if !uriFound {
+		return "", &targetError{http.StatusInternalServerError, "cannot extract requested URI"}
+	}
+
+	// extract request schema and path from requested uri
+	var schema, path = uriToSchemaAndPath(uri) // schema is optional
+	if path == "" {
+		return "", &targetError{http.StatusBadRequest, "empty request path"}
+	}
+
+	// build target uri
+	targetURI, targetURIErr := h.buildTargetURI(schema, path, r.URL.RawQuery)
+	if targetURIErr != nil {
+		return "", &targetError{http.StatusBadRequest, "cannot build target URI"}
+	}
+
+	return targetURI, nil
+}
+
+func uriToSchemaAndPath(uri string) (string, string) {
+	slashPos := strings.IndexByte(uri, '/')
 
-		if (schema == "http" || schema == "https") && len(uri) > slashPos+1 {
+	if slashPos != -1 && len(uri) > slashPos+1 {
+		switch schema := strings.ToLower(uri[:slashPos]); schema {
+		case "http", "https", "ws", "wss":
 			return schema, uri[slashPos+1:]
 		}
 	}
@@ -133,7 +417,9 @@ func (h *Handler) buildTargetURI(schema, path, params string) (string, error) {
 
 	b.Grow(len(schema) + len(path) + len(params) + 3) //nolint:gomnd
 
-	if len(schema) != 0 {
+	if httpSchema, isWebsocket := websocketSchemas[schema]; isWebsocket {
+		b.WriteString(httpSchema)
+	} else if len(schema) != 0 {
 		b.WriteString(schema)
 	} else {
 		b.WriteString(defaultTargetSchema)
@@ -1,26 +1,58 @@
 package proxy_test
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"errors"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/circuit"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/compression"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/cors"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/forwarded"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/proxy"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/netconn"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/netpolicy"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redirect"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/rewrite"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/upstreamtls"
 )
 
 type fakeMetric struct {
-	success, failed, errors int
+	success, failed, clientClosed, blocked, errors, websockets int
+
+	requestBodyTooLarge, responseBodyTooLarge, urlTooLong, headersTooLarge int
 }
 
-func (r *fakeMetric) IncrementSuccessful() { r.success++ }
-func (r *fakeMetric) IncrementFailed()     { r.failed++ }
-func (r *fakeMetric) IncrementErrors()     { r.errors++ }
+func (r *fakeMetric) IncrementSuccessful()           { r.success++ }
+func (r *fakeMetric) IncrementFailed()               { r.failed++ }
+func (r *fakeMetric) IncrementClientClosed()         { r.clientClosed++ }
+func (r *fakeMetric) IncrementBlocked()              { r.blocked++ }
+func (r *fakeMetric) IncrementErrors()               { r.errors++ }
+func (r *fakeMetric) IncrementOpenWebsockets()       { r.websockets++ }
+func (r *fakeMetric) DecrementOpenWebsockets()       { r.websockets-- }
+func (r *fakeMetric) IncrementRequestBodyTooLarge()  { r.requestBodyTooLarge++ }
+func (r *fakeMetric) IncrementResponseBodyTooLarge() { r.responseBodyTooLarge++ }
+func (r *fakeMetric) IncrementURLTooLong()           { r.urlTooLong++ }
+func (r *fakeMetric) IncrementHeadersTooLarge()      { r.headersTooLarge++ }
 
 type httpClientFunc func(*http.Request) (*http.Response, error)
 
@@ -146,3 +178,1417 @@ func TestHandler_ServeHTTPSuccess(t *testing.T) {
 	assert.Equal(t, 0, m.failed)
 	assert.Equal(t, 0, m.errors)
 }
+
+func TestHandler_ServeHTTPRequestHeaders(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		giveHeaders http.Header
+		wantHeaders http.Header
+		wantAbsent  []string
+	}{
+		{
+			name: "multi-value headers are kept as is",
+			giveHeaders: http.Header{
+				"Accept":          {"text/html", "application/json"},
+				"X-Forwarded-For": {"1.1.1.1", "2.2.2.2"},
+			},
+			wantHeaders: http.Header{
+				"Accept":          {"text/html", "application/json"},
+				"X-Forwarded-For": {"1.1.1.1", "2.2.2.2"},
+			},
+		},
+		{
+			name: "hop-by-hop headers are removed",
+			giveHeaders: http.Header{
+				"Connection":          {"keep-alive"},
+				"Proxy-Connection":    {"keep-alive"},
+				"Keep-Alive":          {"timeout=5"},
+				"Proxy-Authorization": {"Basic Zm9vOmJhcg=="},
+				"Te":                  {"trailers"},
+				"Trailer":             {"Expires"},
+				"Upgrade":             {"h2c"},
+				"Authorization":       {"Bearer foo"},
+			},
+			wantHeaders: http.Header{"Authorization": {"Bearer foo"}},
+			wantAbsent: []string{
+				"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authorization", "Te", "Trailer", "Upgrade",
+			},
+		},
+		{
+			name: "headers listed in the Connection header are removed",
+			giveHeaders: http.Header{
+				"Connection": {"close, X-Foo", "x-bar"},
+				"X-Foo":      {"foo"},
+				"X-Bar":      {"bar"},
+				"X-Baz":      {"baz"},
+			},
+			wantHeaders: http.Header{"X-Baz": {"baz"}},
+			wantAbsent:  []string{"Connection", "X-Foo", "X-Bar"},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				req, _  = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+				rr      = httptest.NewRecorder()
+				sent    http.Header
+				handler = proxy.NewHandler(context.Background(), httpClientFunc(func(req *http.Request) (*http.Response, error) {
+					sent = req.Header
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{},
+						Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+					}, nil
+				}), &fakeMetric{})
+			)
+
+			req = mux.SetURLVars(req, map[string]string{"uri": "example.com"})
+			req.Header = tt.giveHeaders
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			for name, values := range tt.wantHeaders {
+				assert.Equal(t, values, sent.Values(name))
+			}
+
+			for _, name := range tt.wantAbsent {
+				assert.Empty(t, sent.Values(name))
+			}
+		})
+	}
+}
+
+func TestHandler_ServeHTTPForwardedHeaders(t *testing.T) {
+	var (
+		req, _ = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+		rr     = httptest.NewRecorder()
+		sent   http.Header
+		client httpClientFunc = func(req *http.Request) (*http.Response, error) {
+			sent = req.Header
+
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}, nil
+		}
+		handler = proxy.NewHandler(context.Background(), client, &fakeMetric{},
+			proxy.WithForwardedHeaders(forwarded.New(forwarded.ModeAppend, hostmatch.New())),
+		)
+	)
+
+	req = mux.SetURLVars(req, map[string]string{"uri": "example.com"})
+	req.RemoteAddr = "1.2.3.4:5678"
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "10.0.0.1, 1.2.3.4", sent.Get("X-Forwarded-For"))
+	assert.Equal(t, "1.1 http-proxy-daemon", sent.Get("Via"))
+}
+
+func TestHandler_ServeHTTPResponseHeaders(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		giveHeaders http.Header
+		wantHeaders http.Header
+		wantAbsent  []string
+	}{
+		{
+			name: "multi-value headers are written as separate lines",
+			giveHeaders: http.Header{
+				"Set-Cookie":       {"foo=1; Path=/", "bar=2; HttpOnly"},
+				"Link":             {"</a.css>; rel=preload", "</b.js>; rel=preload"},
+				"Vary":             {"Accept", "Accept-Encoding"},
+				"Www-Authenticate": {"Basic realm=\"foo\"", "Bearer"},
+			},
+			wantHeaders: http.Header{
+				"Set-Cookie":       {"foo=1; Path=/", "bar=2; HttpOnly"},
+				"Link":             {"</a.css>; rel=preload", "</b.js>; rel=preload"},
+				"Vary":             {"Accept", "Accept-Encoding"},
+				"Www-Authenticate": {"Basic realm=\"foo\"", "Bearer"},
+			},
+		},
+		{
+			name: "hop-by-hop headers are removed",
+			giveHeaders: http.Header{
+				"Connection":         {"keep-alive, X-Internal"},
+				"Keep-Alive":         {"timeout=5"},
+				"Proxy-Authenticate": {"Basic"},
+				"Transfer-Encoding":  {"chunked"},
+				"Upgrade":            {"h2c"},
+				"X-Internal":         {"secret"},
+				"Content-Type":       {"text/plain"},
+			},
+			wantHeaders: http.Header{"Content-Type": {"text/plain"}},
+			wantAbsent:  []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Upgrade", "X-Internal"},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				req, _  = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+				rr      = httptest.NewRecorder()
+				handler = proxy.NewHandler(context.Background(), httpClientFunc(func(*http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode:    http.StatusOK,
+						Header:        tt.giveHeaders,
+						Body:          ioutil.NopCloser(bytes.NewReader(nil)),
+						ContentLength: 0,
+					}, nil
+				}), &fakeMetric{})
+			)
+
+			req = mux.SetURLVars(req, map[string]string{"uri": "example.com"})
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			for name, values := range tt.wantHeaders {
+				assert.Equal(t, values, rr.Header().Values(name))
+			}
+
+			for _, name := range tt.wantAbsent {
+				assert.Empty(t, rr.Header().Values(name))
+			}
+		})
+	}
+}
+
+func TestHandler_ServeHTTPStreaming(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		giveHeader  http.Header
+		giveLength  int64
+		wantFlushed bool
+	}{
+		{
+			name:        "server-sent events",
+			giveHeader:  http.Header{"Content-Type": {"text/event-stream; charset=utf-8"}},
+			giveLength:  -1,
+			wantFlushed: true,
+		},
+		{
+			name:        "ndjson with known length",
+			giveHeader:  http.Header{"Content-Type": {"application/x-ndjson"}},
+			giveLength:  11,
+			wantFlushed: true,
+		},
+		{
+			name:        "chunked response",
+			giveHeader:  http.Header{"Content-Type": {"application/json"}},
+			giveLength:  -1,
+			wantFlushed: true,
+		},
+		{
+			name:        "regular response",
+			giveHeader:  http.Header{"Content-Type": {"application/json"}},
+			giveLength:  11,
+			wantFlushed: false,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				req, _                = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+				rr                    = httptest.NewRecorder()
+				m                     = fakeMetric{}
+				client httpClientFunc = func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode:    http.StatusOK,
+						Header:        tt.giveHeader,
+						ContentLength: tt.giveLength,
+						Body:          ioutil.NopCloser(bytes.NewReader([]byte("data: foo\n\n"))),
+					}, nil
+				}
+			)
+
+			req = mux.SetURLVars(req, map[string]string{"uri": "https/example.com/stream"})
+
+			proxy.NewHandler(context.Background(), client, &m).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantFlushed, rr.Flushed)
+			assert.Equal(t, "data: foo\n\n", rr.Body.String())
+			assert.Equal(t, 1, m.success)
+		})
+	}
+}
+
+func TestHandler_ServeHTTPStreamIdleTimeout(t *testing.T) {
+	var (
+		req, _                = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+		rr                    = httptest.NewRecorder()
+		m                     = fakeMetric{}
+		client httpClientFunc = func(req *http.Request) (*http.Response, error) {
+			pr, pw := io.Pipe()
+
+			go func() {
+				_, _ = pw.Write([]byte("data: first\n\n"))
+
+				<-req.Context().Done() // stream "hangs" until the request cancellation
+
+				_ = pw.CloseWithError(req.Context().Err())
+			}()
+
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Type": {"text/event-stream"}},
+				ContentLength: -1,
+				Body:          pr,
+			}, nil
+		}
+		handler = proxy.NewHandler(context.Background(), client, &m,
+			proxy.WithRequestTimeout(time.Millisecond*10),
+			proxy.WithStreamIdleTimeout(time.Millisecond*50),
+		)
+	)
+
+	req = mux.SetURLVars(req, map[string]string{"uri": "https/example.com/stream"})
+
+	start := time.Now()
+
+	handler.ServeHTTP(rr, req)
+
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*50) // request timeout is not applied to the stream
+	assert.Equal(t, "data: first\n\n", rr.Body.String())             // the error is not written into the sent stream
+	assert.Equal(t, 1, m.failed)
+}
+
+func TestHandler_ServeHTTPRequestTimeout(t *testing.T) {
+	var ctxErr error
+
+	var (
+		req, _                = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+		rr                    = httptest.NewRecorder()
+		m                     = fakeMetric{}
+		client httpClientFunc = func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+
+			ctxErr = req.Context().Err()
+
+			return nil, &url.Error{Op: req.Method, URL: req.URL.String(), Err: ctxErr}
+		}
+		handler = proxy.NewHandler(context.Background(), client, &m, proxy.WithRequestTimeout(time.Millisecond))
+	)
+
+	req = mux.SetURLVars(req, map[string]string{"uri": "https/example.com/slow"})
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusRequestTimeout, rr.Code)
+	assert.Contains(t, rr.Body.String(), "request timeout exceeded")
+	assert.Equal(t, 1, m.failed)
+	assert.ErrorIs(t, ctxErr, context.DeadlineExceeded) // distinguishable from the client leaving
+}
+
+func TestHandler_ServeHTTPCancellation(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		cancelClient     bool
+		cancelServer     bool
+		wantStatusCode   int
+		wantClientClosed int
+		wantFailed       int
+	}{
+		{
+			name:             "client has gone",
+			cancelClient:     true,
+			wantStatusCode:   499,
+			wantClientClosed: 1,
+		},
+		{
+			name:           "server is shutting down",
+			cancelServer:   true,
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantFailed:     1,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				clientCtx, cancelClient = context.WithCancel(context.Background())
+				serverCtx, cancelServer = context.WithCancel(context.Background())
+				rr                      = httptest.NewRecorder()
+				m                       = fakeMetric{}
+			)
+
+			var client httpClientFunc = func(req *http.Request) (*http.Response, error) {
+				<-req.Context().Done() // upstream request must be canceled
+
+				return nil, &url.Error{Op: req.Method, URL: req.URL.String(), Err: req.Context().Err()}
+			}
+
+			handler := proxy.NewHandler(serverCtx, client, &m, proxy.WithRequestTimeout(time.Minute))
+			req, _ := http.NewRequestWithContext(clientCtx, http.MethodGet, "http://testing", http.NoBody)
+
+			defer cancelClient()
+			defer cancelServer()
+
+			req = mux.SetURLVars(req, map[string]string{"uri": "https/example.com/slow"})
+
+			time.AfterFunc(time.Millisecond*10, func() {
+				if tt.cancelClient {
+					cancelClient()
+				}
+
+				if tt.cancelServer {
+					cancelServer()
+				}
+			})
+
+			start := time.Now()
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Less(t, time.Since(start), time.Second)
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			assert.Equal(t, tt.wantClientClosed, m.clientClosed)
+			assert.Equal(t, tt.wantFailed, m.failed)
+			assert.Equal(t, 0, m.success)
+		})
+	}
+}
+
+func TestHandler_ServeHTTPBlocked(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		t.Error("upstream must not be called")
+	}))
+	defer upstream.Close()
+
+	var (
+		req, _ = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+		rr     = httptest.NewRecorder()
+		m      = fakeMetric{}
+		dialer = netpolicy.NewDialer(&net.Dialer{}, netpolicy.New(netpolicy.WithDenyPrivateNetworks()))
+		client = &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}
+	)
+
+	req = mux.SetURLVars(req, map[string]string{"uri": "http/" + strings.TrimPrefix(upstream.URL, "http://") + "/metrics"})
+
+	proxy.NewHandler(context.Background(), client, &m).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "network 127.0.0.0/8 is denied")
+	assert.Equal(t, 1, m.blocked)
+	assert.Equal(t, 0, m.failed)
+}
+
+func TestHandler_ServeHTTPCircuitOpen(t *testing.T) {
+	var (
+		req, _                = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+		rr                    = httptest.NewRecorder()
+		m                     = fakeMetric{}
+		client httpClientFunc = func(req *http.Request) (*http.Response, error) {
+			return nil, &circuit.OpenError{Host: req.URL.Host, RetryAfter: time.Millisecond * 1500}
+		}
+	)
+
+	req = mux.SetURLVars(req, map[string]string{"uri": "https/example.com/foo"})
+
+	proxy.NewHandler(context.Background(), client, &m).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "circuit breaker for [example.com] is open")
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+	assert.Equal(t, 1, m.failed)
+}
+
+func TestHandler_ServeHTTPUntrustedUpstream(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Fail(t, "should not be called")
+	}))
+	defer upstream.Close()
+
+	var (
+		req, _ = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+		rr     = httptest.NewRecorder()
+		m      = fakeMetric{}
+		client = &http.Client{Transport: &http.Transport{
+			DialTLSContext: upstreamtls.NewDialer(&net.Dialer{}).DialTLSContext, // system roots only
+		}}
+	)
+
+	req = mux.SetURLVars(req, map[string]string{"uri": "https/" + upstream.Listener.Addr().String() + "/foo"})
+
+	proxy.NewHandler(context.Background(), client, &m).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.Contains(t, rr.Body.String(), "upstream [127.0.0.1] certificate verification failed")
+	assert.Equal(t, 1, m.failed)
+}
+
+func TestHandler_ServeHTTPWebsocket(t *testing.T) {
+	// upstream echoes the first received frame back (unmasked)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "websocket", r.Header.Get("Upgrade"))
+		assert.Equal(t, "/socket", r.URL.Path)
+
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		assert.NoError(t, err)
+
+		defer conn.Close()
+
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: fake\r\n\r\n")
+		_ = brw.Flush()
+
+		hdr := make([]byte, 6) // 2 bytes header + 4 bytes mask key (payload is short)
+		_, _ = io.ReadFull(brw, hdr)
+
+		payload := make([]byte, hdr[1]&0x7F)
+		_, _ = io.ReadFull(brw, payload)
+
+		for i := range payload {
+			payload[i] ^= hdr[2+i%4]
+		}
+
+		_, _ = conn.Write(append([]byte{hdr[0], byte(len(payload))}, payload...))
+	}))
+	defer upstream.Close()
+
+	var (
+		m      = fakeMetric{}
+		router = mux.NewRouter()
+	)
+
+	router.Handle("/proxy/{uri:.*}", proxy.NewHandler(context.Background(), &http.Client{}, &m))
+
+	proxySrv := httptest.NewServer(router)
+	defer proxySrv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(proxySrv.URL, "http://"))
+	assert.NoError(t, err)
+
+	defer conn.Close()
+
+	_, _ = conn.Write([]byte("GET /proxy/ws/" + strings.TrimPrefix(upstream.URL, "http://") + "/socket HTTP/1.1\r\n" +
+		"Host: testing\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+
+	br := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(br, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "fake", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	_, _ = conn.Write([]byte{0x81, 0x80 | 5, 1, 2, 3, 4, 'h' ^ 1, 'e' ^ 2, 'l' ^ 3, 'l' ^ 4, 'o' ^ 1}) // masked "hello"
+
+	echo := make([]byte, 7)
+	_, err = io.ReadFull(br, echo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x81, 5, 'h', 'e', 'l', 'l', 'o'}, echo)
+
+	assert.Equal(t, 1, m.success)
+}
+
+func TestForwardHandler_ServeHTTP(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		giveRequest    func() *http.Request
+		wantStatusCode int
+		wantTargetURI  string
+		wantStrings    []string
+	}{
+		{
+			name: "absolute-form request target",
+			giveRequest: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodGet, "http://example.com/foo?bar=baz#hash", http.NoBody)
+
+				return req
+			},
+			wantStatusCode: http.StatusOK,
+			wantTargetURI:  "http://example.com/foo?bar=baz",
+		},
+		{
+			name: "origin-form request target",
+			giveRequest: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodGet, "/foo", http.NoBody)
+
+				return req
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantStrings:    []string{"absolute request URI expected"},
+		},
+		{
+			name: "unsupported schema",
+			giveRequest: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodGet, "ftp://example.com/foo", http.NoBody)
+
+				return req
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantStrings:    []string{"unsupported request URI schema", "ftp"},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				rr                    = httptest.NewRecorder()
+				m                     = fakeMetric{}
+				client httpClientFunc = func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, tt.wantTargetURI, req.URL.String())
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{},
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte("ok"))),
+					}, nil
+				}
+			)
+
+			proxy.NewForwardHandler(context.Background(), client, &m).ServeHTTP(rr, tt.giveRequest())
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+
+			for _, s := range tt.wantStrings {
+				assert.Contains(t, rr.Body.String(), s)
+			}
+		})
+	}
+}
+
+func TestIsForwardProxyRequest(t *testing.T) {
+	absolute, _ := http.NewRequest(http.MethodGet, "http://example.com/foo", http.NoBody)
+	assert.True(t, proxy.IsForwardProxyRequest(absolute))
+
+	origin, _ := http.NewRequest(http.MethodGet, "/foo", http.NoBody)
+	assert.False(t, proxy.IsForwardProxyRequest(origin))
+}
+
+func TestTargetHost(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		giveMethod string
+		giveURL    string
+		giveURI    string
+		want       string
+	}{
+		{
+			name:       "route with schema",
+			giveMethod: http.MethodGet,
+			giveURL:    "/proxy",
+			giveURI:    "https/example.com:8443/foo",
+			want:       "example.com:8443",
+		},
+		{name: "route without schema", giveMethod: http.MethodGet, giveURL: "/p", giveURI: "foo.com", want: "foo.com"},
+		{name: "forward-proxy", giveMethod: http.MethodPost, giveURL: "http://example.com/foo", want: "example.com"},
+		{name: "connect", giveMethod: http.MethodConnect, giveURL: "example.com:443", want: "example.com:443"},
+		{name: "no route variable", giveMethod: http.MethodGet, giveURL: "/foo"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.giveMethod, tt.giveURL, http.NoBody)
+
+			if tt.giveURI != "" {
+				req = mux.SetURLVars(req, map[string]string{"uri": tt.giveURI})
+			}
+
+			assert.Equal(t, tt.want, proxy.TargetHost(req))
+		})
+	}
+}
+
+func TestHandler_ServeHTTPNotPermitted(t *testing.T) {
+	var (
+		req, _ = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+		rr     = httptest.NewRecorder()
+		m      = fakeMetric{}
+		client = httpClientFunc(func(*http.Request) (*http.Response, error) {
+			t.Error("upstream must not be called")
+
+			return nil, errors.New("unexpected call")
+		})
+	)
+
+	req = mux.SetURLVars(req, map[string]string{"uri": "https/example.org/foo"})
+	req = req.WithContext(auth.WithPermissions(req.Context(), auth.PermissionsFromScopes("proxy:host:example.com")))
+
+	proxy.NewHandler(context.Background(), client, &m).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "request to [example.org] is not permitted")
+	assert.Equal(t, 1, m.errors)
+}
+
+func TestHandler_ServeHTTPRedirects(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get(redirect.Header))
+
+		switch r.URL.Path {
+		case "/relative":
+			http.Redirect(w, r, "/target?foo=bar", http.StatusFound)
+		case "/absolute":
+			http.Redirect(w, r, "https://example.com/path", http.StatusMovedPermanently)
+		case "/other-host": // the same upstream, but another host name
+			_, port, _ := net.SplitHostPort(r.Host)
+			http.Redirect(w, r, "http://localhost:"+port+"/target", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			w.Header().Set("Content-Location", "/target.json")
+			_, _ = w.Write([]byte("target"))
+		}
+	}))
+
+	defer upstream.Close()
+
+	var (
+		upstreamHost       = upstream.Listener.Addr().String()
+		_, upstreamPort, _ = net.SplitHostPort(upstreamHost)
+	)
+
+	for _, tt := range []struct {
+		name         string
+		givePolicy   redirect.Policy
+		givePath     string
+		giveHeader   string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+		wantContent  string // Content-Location header
+	}{
+		{
+			name:        "followed",
+			givePolicy:  redirect.Policy{Mode: redirect.ModeFollow, MaxRedirects: 3},
+			givePath:    "/relative",
+			wantCode:    http.StatusOK,
+			wantBody:    "target",
+			wantContent: "/target.json",
+		},
+		{
+			name:       "too many redirects",
+			givePolicy: redirect.Policy{Mode: redirect.ModeFollow, MaxRedirects: 3},
+			givePath:   "/loop",
+			wantCode:   http.StatusServiceUnavailable,
+			wantBody:   "too many (3) redirects",
+		},
+		{
+			name:         "passed through with the relative location",
+			givePolicy:   redirect.Policy{Mode: redirect.ModePass},
+			givePath:     "/relative",
+			wantCode:     http.StatusFound,
+			wantLocation: "/proxy/http/" + upstreamHost + "/target?foo=bar",
+		},
+		{
+			name:         "passed through with the absolute location",
+			givePolicy:   redirect.Policy{Mode: redirect.ModePass},
+			givePath:     "/absolute",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/proxy/https/example.com/path",
+		},
+		{
+			name:         "passed through by the request header",
+			givePolicy:   redirect.Policy{Mode: redirect.ModeFollow, MaxRedirects: 3},
+			givePath:     "/relative",
+			giveHeader:   "pass",
+			wantCode:     http.StatusFound,
+			wantLocation: "/proxy/http/" + upstreamHost + "/target?foo=bar",
+		},
+		{
+			name:       "followed by the request header",
+			givePolicy: redirect.Policy{Mode: redirect.ModePass, MaxRedirects: 3},
+			givePath:   "/relative",
+			giveHeader: "Follow",
+			wantCode:   http.StatusOK,
+			wantBody:   "target",
+		},
+		{
+			name:         "other host redirect is passed through",
+			givePolicy:   redirect.Policy{Mode: redirect.ModeFollow, MaxRedirects: 3, SameHost: true},
+			givePath:     "/other-host",
+			wantCode:     http.StatusFound,
+			wantLocation: "/proxy/http/localhost:" + upstreamPort + "/target",
+		},
+		{
+			name:        "content location is rewritten in the pass mode",
+			givePolicy:  redirect.Policy{Mode: redirect.ModePass},
+			givePath:    "/target",
+			wantCode:    http.StatusOK,
+			wantBody:    "target",
+			wantContent: "/proxy/http/" + upstreamHost + "/target.json",
+		},
+		{
+			name:       "wrong request header",
+			givePolicy: redirect.Policy{Mode: redirect.ModeFollow, MaxRedirects: 3},
+			givePath:   "/relative",
+			giveHeader: "foo",
+			wantCode:   http.StatusBadRequest,
+			wantBody:   "unsupported redirects mode [foo]",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				req, _ = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+				rr     = httptest.NewRecorder()
+				client = &http.Client{CheckRedirect: redirect.CheckRedirect(redirect.Policy{})}
+			)
+
+			req = mux.SetURLVars(req, map[string]string{"uri": "http/" + upstreamHost + tt.givePath})
+
+			if tt.giveHeader != "" {
+				req.Header.Set(redirect.Header, tt.giveHeader)
+			}
+
+			proxy.NewHandler(context.Background(), client, &fakeMetric{},
+				proxy.WithRedirectPolicy(tt.givePolicy),
+				proxy.WithRoutePrefix("/proxy"),
+			).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Equal(t, tt.wantLocation, rr.Header().Get("Location"))
+			assert.Contains(t, rr.Body.String(), tt.wantBody)
+
+			if tt.wantContent != "" {
+				assert.Equal(t, tt.wantContent, rr.Header().Get("Content-Location"))
+			}
+		})
+	}
+}
+
+func TestHandler_ServeHTTPRedirectNotPermitted(t *testing.T) {
+	var secretRequested bool
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/secret" {
+			secretRequested = true
+
+			return
+		}
+
+		_, port, _ := net.SplitHostPort(r.Host) // the open redirect to the same upstream, but another host name
+		http.Redirect(w, r, "http://localhost:"+port+"/secret", http.StatusFound)
+	}))
+
+	defer upstream.Close()
+
+	var (
+		req, _ = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+		rr     = httptest.NewRecorder()
+		m      = fakeMetric{}
+		client = &http.Client{CheckRedirect: redirect.CheckRedirect(redirect.Policy{
+			Mode:         redirect.ModeFollow,
+			MaxRedirects: 3,
+		})}
+	)
+
+	req = mux.SetURLVars(req, map[string]string{"uri": "http/" + upstream.Listener.Addr().String() + "/open"})
+	req = req.WithContext(auth.WithPermissions(req.Context(), auth.PermissionsFromScopes("proxy:host:127.0.0.1")))
+
+	proxy.NewHandler(context.Background(), client, &m).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "redirect to [localhost:")
+	assert.Contains(t, rr.Body.String(), "is not permitted for the client")
+	assert.False(t, secretRequested)
+	assert.Equal(t, 1, m.errors)
+}
+
+func TestHandler_ServeHTTPContentRewriting(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip", r.Header.Get("Accept-Encoding"))
+
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1", Path: "/", Domain: "example.com"})
+
+		switch r.URL.Path {
+		case "/page":
+			var buf bytes.Buffer
+
+			gz := gzip.NewWriter(&buf)
+			_, _ = gz.Write([]byte(`<a href="/next">next</a>`))
+			_ = gz.Close()
+
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(buf.Bytes())
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			_, _ = w.Write([]byte(`body { background: url(bg.png) }`))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"href": "/next"}`))
+		}
+	}))
+
+	defer upstream.Close()
+
+	var upstreamHost = upstream.Listener.Addr().String()
+
+	for _, tt := range []struct {
+		name       string
+		givePath   string
+		wantBody   string
+		wantCookie string
+	}{
+		{
+			name:       "compressed html",
+			givePath:   "/page",
+			wantBody:   `<a href="/proxy/http/` + upstreamHost + `/next">next</a>`,
+			wantCookie: "sid=1; Path=/proxy/http/" + upstreamHost + "/",
+		},
+		{
+			name:       "css",
+			givePath:   "/style.css",
+			wantBody:   `body { background: url("/proxy/http/` + upstreamHost + `/bg.png") }`,
+			wantCookie: "sid=1; Path=/proxy/http/" + upstreamHost + "/",
+		},
+		{
+			name:       "not rewritable content",
+			givePath:   "/data.json",
+			wantBody:   `{"href": "/next"}`,
+			wantCookie: "sid=1; Path=/proxy/http/" + upstreamHost + "/",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				req, _ = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+				rr     = httptest.NewRecorder()
+			)
+
+			req = mux.SetURLVars(req, map[string]string{"uri": "http/" + upstreamHost + tt.givePath})
+			req.Header.Set("Accept-Encoding", "br, gzip")
+
+			proxy.NewHandler(context.Background(), &http.Client{Transport: &http.Transport{DisableCompression: true}},
+				&fakeMetric{},
+				proxy.WithContentRewriting(rewrite.New("/proxy")),
+			).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.wantBody, rr.Body.String())
+			assert.Empty(t, rr.Header().Get("Content-Encoding"))
+			assert.Equal(t, tt.wantCookie, rr.Header().Get("Set-Cookie"))
+		})
+	}
+}
+
+func TestHandler_ServeHTTPUpstreamCORSHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count")
+		w.Header().Set("X-Total-Count", "42")
+	}))
+
+	defer upstream.Close()
+
+	var upstreamHost = upstream.Listener.Addr().String()
+
+	for _, tt := range []struct {
+		name        string
+		giveMode    cors.UpstreamMode
+		giveNoCORS  bool
+		wantOrigin  []string
+		wantExposed []string
+	}{
+		{
+			name:        "replaced",
+			giveMode:    cors.UpstreamReplace,
+			wantOrigin:  []string{"https://example.com"},
+			wantExposed: []string{"X-Policy"},
+		},
+		{
+			name:        "merged",
+			giveMode:    cors.UpstreamMerge,
+			wantOrigin:  []string{"https://example.com"},
+			wantExposed: []string{"X-Policy, X-Total-Count"},
+		},
+		{
+			name:        "passed as is without the policy",
+			giveNoCORS:  true,
+			wantOrigin:  []string{"*"},
+			wantExposed: []string{"X-Total-Count"},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				req, _ = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+				rr     = httptest.NewRecorder()
+				opts   []proxy.Option
+			)
+
+			req = mux.SetURLVars(req, map[string]string{"uri": "http/" + upstreamHost + "/"})
+
+			if !tt.giveNoCORS {
+				p, err := cors.New(cors.Settings{
+					AllowedOrigins: []string{"https://example.com"},
+					ExposedHeaders: []string{"X-Policy"},
+					Upstream:       tt.giveMode,
+				})
+				assert.NoError(t, err)
+
+				req.Header.Set("Origin", "https://example.com")
+				p.Apply(rr.Header(), req) // like the corsreq middleware does
+
+				opts = append(opts, proxy.WithCORS(p))
+			}
+
+			proxy.NewHandler(context.Background(), http.DefaultClient, &fakeMetric{}, opts...).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.wantOrigin, rr.Header().Values("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.wantExposed, rr.Header().Values("Access-Control-Expose-Headers"))
+			assert.Equal(t, "42", rr.Header().Get("X-Total-Count"))
+		})
+	}
+}
+
+func TestHandler_ServeHTTPLimits(t *testing.T) {
+	var limits = proxy.Limits{MaxRequestBodySize: 32, MaxResponseBodySize: 32, MaxURLLength: 64, MaxHeaderBytes: 512}
+
+	for _, tt := range []struct {
+		name              string
+		givePath          string
+		giveBody          io.Reader
+		giveContentLength int64
+		giveHeader        string
+		wantCode          int
+		wantBody          string
+		wantUpstreamCalls int32 // negative means "any"
+		wantMetrics       fakeMetric
+	}{
+		{
+			name:              "within the limits",
+			givePath:          "/",
+			giveBody:          strings.NewReader("foo"),
+			giveContentLength: 3,
+			wantCode:          http.StatusOK,
+			wantBody:          "ok",
+			wantUpstreamCalls: 1,
+			wantMetrics:       fakeMetric{success: 1},
+		},
+		{
+			name:        "url is too long",
+			givePath:    "/" + strings.Repeat("a", 64),
+			wantCode:    http.StatusRequestURITooLong,
+			wantBody:    "request URL is too long",
+			wantMetrics: fakeMetric{urlTooLong: 1},
+		},
+		{
+			name:        "headers are too large",
+			givePath:    "/",
+			giveHeader:  strings.Repeat("a", 512),
+			wantCode:    http.StatusRequestHeaderFieldsTooLarge,
+			wantBody:    "request headers are too large",
+			wantMetrics: fakeMetric{headersTooLarge: 1},
+		},
+		{
+			name:              "request body with known length is too large",
+			givePath:          "/",
+			giveBody:          strings.NewReader(strings.Repeat("a", 33)),
+			giveContentLength: 33,
+			wantCode:          http.StatusRequestEntityTooLarge,
+			wantBody:          "request body is too large",
+			wantMetrics:       fakeMetric{requestBodyTooLarge: 1},
+		},
+		{
+			name:              "request body with unknown length is too large",
+			givePath:          "/",
+			giveBody:          strings.NewReader(strings.Repeat("a", 1024)),
+			giveContentLength: -1,
+			wantCode:          http.StatusRequestEntityTooLarge,
+			wantBody:          "request body is too large",
+			wantUpstreamCalls: -1, // the upload is aborted, so the upstream may not get the request
+			wantMetrics:       fakeMetric{requestBodyTooLarge: 1},
+		},
+		{
+			name:              "response body with known length is too large",
+			givePath:          "/large",
+			wantCode:          http.StatusBadGateway,
+			wantBody:          "response body is too large",
+			wantUpstreamCalls: 1,
+			wantMetrics:       fakeMetric{failed: 1, responseBodyTooLarge: 1},
+		},
+		{
+			name:              "response body with unknown length is too large",
+			givePath:          "/large-chunked",
+			wantCode:          http.StatusOK,
+			wantBody:          strings.Repeat("a", 32), // the connection is aborted after the limit
+			wantUpstreamCalls: 1,
+			wantMetrics:       fakeMetric{failed: 1, responseBodyTooLarge: 1},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreamCalls int32
+
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&upstreamCalls, 1)
+
+				if _, err := io.Copy(io.Discard, r.Body); err != nil {
+					return
+				}
+
+				switch r.URL.Path {
+				case "/large":
+					_, _ = w.Write(bytes.Repeat([]byte("a"), 64))
+				case "/large-chunked":
+					for i := 0; i < 4; i++ {
+						_, _ = w.Write(bytes.Repeat([]byte("a"), 16))
+						w.(http.Flusher).Flush()
+					}
+				default:
+					_, _ = w.Write([]byte("ok"))
+				}
+			}))
+
+			var (
+				upstreamHost = upstream.Listener.Addr().String()
+				rr           = httptest.NewRecorder()
+				m            = fakeMetric{}
+				body         = tt.giveBody
+			)
+
+			if body == nil {
+				body = http.NoBody
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/proxy/http/"+upstreamHost+tt.givePath, body)
+			req.ContentLength = tt.giveContentLength
+			req = mux.SetURLVars(req, map[string]string{"uri": "http/" + upstreamHost + tt.givePath})
+
+			if tt.giveHeader != "" {
+				req.Header.Set("X-Foo", tt.giveHeader)
+			}
+
+			proxy.NewHandler(context.Background(), http.DefaultClient, &m, proxy.WithLimits(limits)).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.wantBody)
+			upstream.Close() // waits for the upstream handlers
+
+			if tt.wantUpstreamCalls >= 0 {
+				assert.Equal(t, tt.wantUpstreamCalls, atomic.LoadInt32(&upstreamCalls))
+			}
+
+			assert.Equal(t, tt.wantMetrics, m)
+		})
+	}
+}
+
+func TestHandler_ServeHTTPResponseLimitAbort(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		for i := 0; i < 4; i++ {
+			_, _ = w.Write(bytes.Repeat([]byte("a"), 16))
+			w.(http.Flusher).Flush()
+		}
+	}))
+
+	defer upstream.Close()
+
+	var (
+		m       = fakeMetric{}
+		handler = proxy.NewHandler(context.Background(), http.DefaultClient, &m,
+			proxy.WithLimits(proxy.Limits{MaxResponseBodySize: 32}),
+		)
+		srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTP(w, mux.SetURLVars(r, map[string]string{"uri": "http/" + upstream.Listener.Addr().String()}))
+		}))
+	)
+
+	srv.Config.ConnContext = netconn.WithConn
+	srv.Start()
+
+	resp, err := http.Get(srv.URL) //nolint:noctx
+	assert.NoError(t, err)
+
+	_, err = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	srv.Close() // waits for the handler
+
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF) // the truncated response must not look like a complete one
+	assert.Equal(t, 1, m.responseBodyTooLarge)
+}
+
+// failingReader returns the error after the data is read.
+type failingReader struct {
+	data io.Reader
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if n, err := r.data.Read(p); err != io.EOF { //nolint:errorlint
+		return n, err
+	}
+
+	return 0, r.err
+}
+
+func TestHandler_ServeHTTPResponseCopyAbort(t *testing.T) {
+	compressor, err := compression.New(compression.Settings{
+		Encodings:    compression.Encodings(),
+		ContentTypes: []string{"text/*"},
+	})
+	assert.NoError(t, err)
+
+	for _, tt := range []struct {
+		name               string
+		giveOptions        []proxy.Option
+		giveAcceptEncoding string
+		wantEncoding       string
+	}{
+		{
+			name: "plain",
+		},
+		{
+			name:               "compressed (the encoded stream is not finished)",
+			giveOptions:        []proxy.Option{proxy.WithCompression(compressor)},
+			giveAcceptEncoding: "gzip",
+			wantEncoding:       "gzip",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				m      = fakeMetric{}
+				client = httpClientFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{"Content-Type": {"text/plain"}},
+						Body: io.NopCloser(&failingReader{ // the headers are sent with the first (big enough) chunk
+							data: io.LimitReader(rand.Reader, 64<<10), // random data is not compressed well
+							err:  errors.New("connection reset"),
+						}),
+						Request: req,
+					}, nil
+				})
+				handler = proxy.NewHandler(context.Background(), client, &m, tt.giveOptions...)
+				srv     = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					handler.ServeHTTP(w, mux.SetURLVars(r, map[string]string{"uri": "http/example.com"}))
+				}))
+			)
+
+			srv.Config.ConnContext = netconn.WithConn
+			srv.Start()
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, http.NoBody)
+			if tt.giveAcceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.giveAcceptEncoding) // the response is not decoded by the client
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+
+			body, err := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			srv.Close() // waits for the handler
+
+			assert.Equal(t, tt.wantEncoding, resp.Header.Get("Content-Encoding"))
+			assert.ErrorIs(t, err, io.ErrUnexpectedEOF) // the truncated response must not look like a complete one
+			assert.NotContains(t, string(body), "connection reset")
+			assert.Equal(t, fakeMetric{failed: 1}, m)
+		})
+	}
+}
+
+func TestHandler_ServeHTTPCompression(t *testing.T) {
+	var data = strings.Repeat(`{"foo":"bar"},`, 100)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"foo"`)
+
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(data))
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{}`))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte(data))
+		case "/no-transform":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "public, no-transform")
+			_, _ = w.Write([]byte(data))
+		case "/gzip":
+			var buf bytes.Buffer
+
+			gz := gzip.NewWriter(&buf)
+			_, _ = gz.Write([]byte(data))
+			_ = gz.Close()
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(buf.Bytes())
+		case "/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+
+			for i := 0; i < 3; i++ {
+				_, _ = w.Write([]byte("data: " + data + "\n\n"))
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+
+	defer upstream.Close()
+
+	var decode = func(t *testing.T, encoding string, body io.Reader) string {
+		t.Helper()
+
+		switch encoding {
+		case "br":
+			body = brotli.NewReader(body)
+		case "gzip":
+			r, err := gzip.NewReader(body)
+			assert.NoError(t, err)
+
+			body = r
+		}
+
+		decoded, err := io.ReadAll(body)
+		assert.NoError(t, err)
+
+		return string(decoded)
+	}
+
+	for _, tt := range []struct {
+		name               string
+		giveMethod         string
+		givePath           string
+		giveAcceptEncoding string
+		giveTranscode      bool
+		wantEncoding       string
+		wantVary           bool
+		wantTransformed    bool
+		wantBody           string
+	}{
+		{
+			name:               "preferred by the server",
+			givePath:           "/json",
+			giveAcceptEncoding: "gzip, br",
+			wantEncoding:       "br",
+			wantVary:           true,
+			wantTransformed:    true,
+			wantBody:           data,
+		},
+		{
+			name:               "preferred by the client",
+			givePath:           "/json",
+			giveAcceptEncoding: "gzip;q=1.0, br;q=0.5",
+			wantEncoding:       "gzip",
+			wantVary:           true,
+			wantTransformed:    true,
+			wantBody:           data,
+		},
+		{
+			name:         "compression is not accepted",
+			givePath:     "/json",
+			wantEncoding: "",
+			wantVary:     true,
+			wantBody:     data,
+		},
+		{
+			name:               "small body",
+			givePath:           "/small",
+			giveAcceptEncoding: "br",
+			wantBody:           `{}`,
+		},
+		{
+			name:               "not compressible content type",
+			givePath:           "/image",
+			giveAcceptEncoding: "br",
+			wantBody:           data,
+		},
+		{
+			name:               "no-transform",
+			givePath:           "/no-transform",
+			giveAcceptEncoding: "br",
+			wantBody:           data,
+		},
+		{
+			name:               "head request",
+			giveMethod:         http.MethodHead,
+			givePath:           "/json",
+			giveAcceptEncoding: "br",
+		},
+		{
+			name:               "already compressed",
+			givePath:           "/gzip",
+			giveAcceptEncoding: "br, gzip",
+			wantEncoding:       "gzip",
+			wantBody:           data,
+		},
+		{
+			name:               "gzip transcoding",
+			givePath:           "/gzip",
+			giveAcceptEncoding: "br, gzip",
+			giveTranscode:      true,
+			wantEncoding:       "br",
+			wantVary:           true,
+			wantTransformed:    true,
+			wantBody:           data,
+		},
+		{
+			name:               "gzip is not transcoded for the client, that does not accept brotli",
+			givePath:           "/gzip",
+			giveAcceptEncoding: "zstd, gzip",
+			giveTranscode:      true,
+			wantEncoding:       "gzip",
+			wantVary:           true,
+			wantBody:           data,
+		},
+		{
+			name:               "streaming",
+			givePath:           "/events",
+			giveAcceptEncoding: "gzip",
+			wantEncoding:       "gzip",
+			wantVary:           true,
+			wantTransformed:    true,
+			wantBody:           strings.Repeat("data: "+data+"\n\n", 3),
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				method = tt.giveMethod
+				rr     = httptest.NewRecorder()
+			)
+
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			req, _ := http.NewRequest(method, "http://testing", http.NoBody)
+			req = mux.SetURLVars(req, map[string]string{"uri": "http/" + upstream.Listener.Addr().String() + tt.givePath})
+
+			if tt.giveAcceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.giveAcceptEncoding)
+			}
+
+			compressor, err := compression.New(compression.Settings{
+				Encodings:     compression.Encodings(),
+				ContentTypes:  []string{"application/json", "text/*"},
+				MinSize:       1024,
+				TranscodeGzip: tt.giveTranscode,
+			})
+			assert.NoError(t, err)
+
+			proxy.NewHandler(context.Background(), &http.Client{Transport: &http.Transport{DisableCompression: true}},
+				&fakeMetric{},
+				proxy.WithCompression(compressor),
+			).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.wantEncoding, rr.Header().Get("Content-Encoding"))
+			assert.Equal(t, tt.wantBody, decode(t, tt.wantEncoding, rr.Body))
+
+			if tt.wantVary {
+				assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+			} else {
+				assert.Empty(t, rr.Header().Get("Vary"))
+			}
+
+			if tt.wantTransformed {
+				assert.Empty(t, rr.Header().Get("Content-Length"))
+				assert.Equal(t, `W/"foo"`, rr.Header().Get("ETag"))
+			} else {
+				assert.Equal(t, `"foo"`, rr.Header().Get("ETag"))
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// streamingContentTypes is a list of content types, that are always streamed to the client chunk-by-chunk.
+var streamingContentTypes = map[string]struct{}{ //nolint:gochecknoglobals
+	"text/event-stream":         {}, // Server-Sent Events
+	"application/x-ndjson":      {}, // newline delimited JSON
+	"application/ndjson":        {},
+	"application/jsonl":         {},
+	"application/stream+json":   {},
+	"application/json-seq":      {}, // RFC 7464
+	"multipart/x-mixed-replace": {}, // MJPEG streams, etc.
+}
+
+// isStreaming determines whether the response must be streamed to the client with flushing after each chunk.
+// Responses with the unknown length (chunked transfer encoding, HTTP/1.0 "read until close") are streamed too,
+// because the upstream can hold them open for an undefined time (long-polling, feeds, etc.).
+func isStreaming(resp *http.Response) bool {
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		if mediaType, _, err := mime.ParseMediaType(ct); err == nil {
+			if _, ok := streamingContentTypes[strings.ToLower(mediaType)]; ok {
+				return true
+			}
+		}
+	}
+
+	return resp.ContentLength == -1
+}
+
+const copyBufferSize = 32 * 1024
+
+// copyResponse copies the response body into the response writer. When flush is true, the data will be flushed to
+// the client after each chunk. The onChunk callback is called before each chunk writing.
+func copyResponse(w http.ResponseWriter, body io.Reader, flush bool, onChunk func()) error {
+	var (
+		buf        = make([]byte, copyBufferSize)
+		flusher, _ = w.(http.Flusher)
+	)
+
+	for {
+		n, readErr := body.Read(buf)
+
+		if n > 0 {
+			onChunk()
+
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+
+			if flush && flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		if readErr == io.EOF { //nolint:errorlint // io.EOF is never wrapped by the readers
+			return nil
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// watchdog cancels the upstream request context when the timer fires.
+type watchdog struct {
+	timer *time.Timer
+	fired atomic.Bool
+}
+
+// newWatchdog creates the watchdog, which calls cancel after the d. Zero duration means "never".
+func newWatchdog(d time.Duration, cancel context.CancelFunc) *watchdog {
+	w := &watchdog{}
+
+	w.timer = time.AfterFunc(time.Hour, func() {
+		w.fired.Store(true)
+
+		cancel()
+	})
+
+	w.Reset(d)
+
+	return w
+}
+
+// Reset restarts the watchdog timer with a new duration. Zero duration disables the watchdog.
+func (w *watchdog) Reset(d time.Duration) {
+	w.timer.Stop()
+
+	if d > 0 {
+		w.timer.Reset(d)
+	}
+}
+
+// Stop the watchdog.
+func (w *watchdog) Stop() { w.timer.Stop() }
+
+// Fired reports whether the watchdog has been fired.
+func (w *watchdog) Fired() bool { return w.fired.Load() }
+
+// timeoutContext is the upstream request context, that reports context.DeadlineExceeded after the watchdog has
+// canceled it, so the request timeout can be distinguished from the client leaving (e.g. by the circuit breakers).
+type timeoutContext struct {
+	context.Context
+	wd *watchdog
+}
+
+func (c *timeoutContext) Err() error {
+	if err := c.Context.Err(); err != nil && c.wd.Fired() {
+		return context.DeadlineExceeded
+	}
+
+	return c.Context.Err()
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/websocket"
+)
+
+// serveUpgraded tunnels the upgraded (switched protocols) connection between the client and the upstream.
+func (h *Handler) serveUpgraded(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	resp *http.Response,
+	wd *watchdog,
+) {
+	upstream, isRWC := resp.Body.(io.ReadWriteCloser)
+	if !isRWC || !websocket.IsUpgradeRequest(r) {
+		h.m.IncrementFailed()
+		http.Error(w, proxyErrPrefix+"upstream switched to the unsupported protocol", http.StatusBadGateway)
+
+		return
+	}
+
+	hijacker, isHijacker := w.(http.Hijacker)
+	if !isHijacker {
+		h.m.IncrementErrors()
+		http.Error(w, proxyErrPrefix+"connection hijacking is not supported", http.StatusInternalServerError)
+
+		return
+	}
+
+	conn, brw, hijackErr := hijacker.Hijack()
+	if hijackErr != nil {
+		h.m.IncrementErrors()
+		http.Error(w, proxyErrPrefix+hijackErr.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	defer func() { _ = conn.Close() }()
+
+	wd.Reset(0)                       // the tunnel manages timeouts by itself
+	_ = conn.SetDeadline(time.Time{}) // reset the server read/write deadlines
+
+	// complete the handshake with the client
+	_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	_ = endToEndHeaders(resp.Header, true).Write(brw)
+	_, _ = brw.WriteString("\r\n")
+
+	if err := brw.Flush(); err != nil {
+		h.m.IncrementErrors()
+
+		return
+	}
+
+	h.m.IncrementSuccessful()
+	h.m.IncrementOpenWebsockets()
+
+	defer h.m.DecrementOpenWebsockets()
+
+	websocket.NewTunnel(brw.Reader, conn, upstream,
+		websocket.WithPingInterval(h.websocketPingInterval),
+		websocket.WithIdleTimeout(h.streamIdleTimeout),
+	).Run(ctx)
+}
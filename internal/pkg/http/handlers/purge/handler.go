@@ -0,0 +1,79 @@
+// Package purge contains the cached responses purging handler.
+package purge
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers"
+)
+
+type purger interface {
+	PurgeURL(ctx context.Context, rawURL string) (int, error)
+	PurgeHost(ctx context.Context, host string) (int, error)
+	PurgePrefix(ctx context.Context, prefix string) (int, error)
+}
+
+// Request is the purging request. Exactly one of the properties must be set.
+type Request struct {
+	URL    string `json:"url"`    // exact URL (all the response variants are purged)
+	Host   string `json:"host"`   // all the URLs of the host (any port, when the port is not specified)
+	Prefix string `json:"prefix"` // all the URLs with the prefix, like "https://example.com/static/"
+}
+
+type response struct {
+	Purged int `json:"purged"`
+}
+
+const maxRequestBodySize = 64 << 10
+
+// NewHandler creates the cached responses purging handler. It accepts the JSON-encoded Request and responds with
+// the count of purged URLs (like `{"purged": 3}`).
+func NewHandler(log *zap.Logger, p purger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBodySize)).Decode(&req); err != nil {
+			handlers.RespondJSONError(w, http.StatusBadRequest, "wrong request body: "+err.Error())
+
+			return
+		}
+
+		var (
+			purged int
+			err    error
+		)
+
+		switch {
+		case req.URL != "" && req.Host == "" && req.Prefix == "":
+			purged, err = p.PurgeURL(r.Context(), req.URL)
+
+		case req.Host != "" && req.URL == "" && req.Prefix == "":
+			purged, err = p.PurgeHost(r.Context(), req.Host)
+
+		case req.Prefix != "" && req.URL == "" && req.Host == "":
+			purged, err = p.PurgePrefix(r.Context(), req.Prefix)
+
+		default:
+			handlers.RespondJSONError(w, http.StatusBadRequest, "exactly one of url, host or prefix is required")
+
+			return
+		}
+
+		if err != nil {
+			log.Error("Cache purging failed", zap.Any("request", req), zap.Error(err))
+			handlers.RespondJSONError(w, http.StatusInternalServerError, "cache purging failed: "+err.Error())
+
+			return
+		}
+
+		log.Info("Cache purged", zap.Any("request", req), zap.Int("purged", purged))
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response{Purged: purged})
+	}
+}
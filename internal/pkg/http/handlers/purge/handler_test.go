@@ -0,0 +1,114 @@
+package purge_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/purge"
+)
+
+type fakePurger struct {
+	calls []string
+	err   error
+}
+
+func (p *fakePurger) PurgeURL(_ context.Context, rawURL string) (int, error) {
+	p.calls = append(p.calls, "url "+rawURL)
+
+	return 1, p.err
+}
+
+func (p *fakePurger) PurgeHost(_ context.Context, host string) (int, error) {
+	p.calls = append(p.calls, "host "+host)
+
+	return 2, p.err
+}
+
+func (p *fakePurger) PurgePrefix(_ context.Context, prefix string) (int, error) {
+	p.calls = append(p.calls, "prefix "+prefix)
+
+	return 3, p.err
+}
+
+func TestNewHandler(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		giveBody       string
+		giveErr        error
+		wantStatusCode int
+		wantBody       string
+		wantCalls      []string
+	}{
+		{
+			name:           "by URL",
+			giveBody:       `{"url": "https://example.com/foo"}`,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"purged":1}`,
+			wantCalls:      []string{"url https://example.com/foo"},
+		},
+		{
+			name:           "by host",
+			giveBody:       `{"host": "example.com"}`,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"purged":2}`,
+			wantCalls:      []string{"host example.com"},
+		},
+		{
+			name:           "by prefix",
+			giveBody:       `{"prefix": "https://example.com/static/"}`,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"purged":3}`,
+			wantCalls:      []string{"prefix https://example.com/static/"},
+		},
+		{
+			name:           "wrong body",
+			giveBody:       `foo`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `wrong request body`,
+		},
+		{
+			name:           "nothing to purge",
+			giveBody:       `{}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `exactly one of url, host or prefix is required`,
+		},
+		{
+			name:           "ambiguous request",
+			giveBody:       `{"url": "https://example.com/foo", "host": "example.com"}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `exactly one of url, host or prefix is required`,
+		},
+		{
+			name:           "purging error",
+			giveBody:       `{"host": "example.com"}`,
+			giveErr:        errors.New("storage is down"),
+			wantStatusCode: http.StatusInternalServerError,
+			wantBody:       `cache purging failed: storage is down`,
+			wantCalls:      []string{"host example.com"},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				rr = httptest.NewRecorder()
+				p  = fakePurger{err: tt.giveErr}
+			)
+
+			req, _ := http.NewRequest(http.MethodPost, "/admin/cache/purge", strings.NewReader(tt.giveBody))
+
+			purge.NewHandler(zap.NewNop(), &p).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Contains(t, rr.Body.String(), tt.wantBody)
+			assert.Equal(t, tt.wantCalls, p.calls)
+		})
+	}
+}
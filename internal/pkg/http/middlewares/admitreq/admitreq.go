@@ -0,0 +1,110 @@
+// Package admitreq contains middleware for HTTP requests concurrency limiting.
+package admitreq
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/admission"
+)
+
+type metrics interface {
+	IncrementInFlight()
+	DecrementInFlight()
+	IncrementRejected()
+}
+
+// statusClientClosedRequest is a non-standard status code (introduced by nginx), used for the logging only.
+const statusClientClosedRequest = 499
+
+// New creates mux.MiddlewareFunc for HTTP requests concurrency limiting. The global limiter (nil means "no global
+// limit") is applied to all the requests, and the hosts limiters group (nil means "no per-host limit") - to the
+// requests to the upstream host, resolved using the targetHost function. Requests are queued per client, identified
+// by the clientID function (see auth.ClientID), so the middleware must be applied after the authentication.
+//
+// Rejected requests are responded with the "503 Service Unavailable" status and the "Retry-After" header. Waiting
+// requests are counted by the limiters (see admission.WithQueueHooks).
+func New(
+	log *zap.Logger,
+	m metrics,
+	global *admission.Limiter,
+	hosts *admission.Group,
+	targetHost func(*http.Request) string,
+	clientID func(*http.Request) string,
+	retryAfter time.Duration,
+) mux.MiddlewareFunc {
+	var retryAfterSeconds = strconv.FormatInt(int64(math.Max(1, math.Ceil(retryAfter.Seconds()))), 10)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				ctx    = r.Context()
+				client = clientID(r)
+			)
+
+			// the host slot is taken first, so the global slot is not wasted on waiting for the busy host
+			release, err := acquire(ctx, hosts, global, targetHost(r), client)
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					w.WriteHeader(statusClientClosedRequest) // nobody reads it, but it is logged
+
+					return
+				}
+
+				m.IncrementRejected()
+				log.Debug("Request rejected by the admission control", zap.String("client", client), zap.Error(err))
+
+				w.Header().Set("Retry-After", retryAfterSeconds)
+				http.Error(w, "server is busy: "+err.Error(), http.StatusServiceUnavailable)
+
+				return
+			}
+
+			defer release()
+
+			m.IncrementInFlight()
+			defer m.DecrementInFlight()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// acquire takes the host and global slots.
+func acquire(
+	ctx context.Context,
+	hosts *admission.Group,
+	global *admission.Limiter,
+	host, client string,
+) (func(), error) {
+	var releaseHost = func() {}
+
+	if hosts != nil && host != "" {
+		release, err := hosts.Acquire(ctx, host, client)
+		if err != nil {
+			return nil, err
+		}
+
+		releaseHost = release
+	}
+
+	if global == nil {
+		return releaseHost, nil
+	}
+
+	releaseGlobal, err := global.Acquire(ctx, client)
+	if err != nil {
+		releaseHost()
+
+		return nil, err
+	}
+
+	return func() { releaseGlobal(); releaseHost() }, nil
+}
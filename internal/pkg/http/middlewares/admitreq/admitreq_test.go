@@ -0,0 +1,104 @@
+package admitreq_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/admission"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/middlewares/admitreq"
+)
+
+type fakeMetrics struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	rejected    int
+}
+
+func (m *fakeMetrics) IncrementInFlight() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.inFlight++; m.inFlight > m.maxInFlight {
+		m.maxInFlight = m.inFlight
+	}
+}
+
+func (m *fakeMetrics) DecrementInFlight() { m.mu.Lock(); m.inFlight--; m.mu.Unlock() }
+func (m *fakeMetrics) IncrementRejected() { m.mu.Lock(); m.rejected++; m.mu.Unlock() }
+
+func TestMiddleware(t *testing.T) {
+	global, err := admission.New(2, 10, time.Second)
+	assert.NoError(t, err)
+
+	hosts, err := admission.NewGroup(1, 10, time.Second)
+	assert.NoError(t, err)
+
+	var (
+		m       = fakeMetrics{}
+		handler = admitreq.New(zap.NewNop(), &m, global, hosts,
+			func(r *http.Request) string { return r.URL.Query().Get("host") },
+			func(r *http.Request) string { return auth.ClientID(r, nil) },
+			time.Second,
+		)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			time.Sleep(time.Millisecond * 20)
+			w.WriteHeader(http.StatusOK)
+		}))
+		wg sync.WaitGroup
+	)
+
+	for _, host := range []string{"foo.com", "foo.com", "bar.com", "baz.com"} {
+		wg.Add(1)
+
+		go func(host string) {
+			defer wg.Done()
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/?host="+host, http.NoBody))
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+		}(host)
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 2, m.maxInFlight)
+	assert.Equal(t, 0, m.inFlight)
+	assert.Equal(t, 0, m.rejected)
+}
+
+func TestMiddlewareRejected(t *testing.T) {
+	global, err := admission.New(1, 0, 0)
+	assert.NoError(t, err)
+
+	release, err := global.Acquire(context.Background(), "busy")
+	assert.NoError(t, err)
+
+	defer release()
+
+	var (
+		m  = fakeMetrics{}
+		rr = httptest.NewRecorder()
+	)
+
+	admitreq.New(zap.NewNop(), &m, global, nil,
+		func(*http.Request) string { return "" },
+		func(*http.Request) string { return "" },
+		time.Millisecond*1500,
+	)(
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) { t.Error("must not be called") }),
+	).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+	assert.Contains(t, rr.Body.String(), "admission queue is full")
+	assert.Equal(t, 1, m.rejected)
+}
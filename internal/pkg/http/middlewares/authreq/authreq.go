@@ -0,0 +1,88 @@
+// Package authreq contains middleware for HTTP requests authentication.
+package authreq
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/realip"
+)
+
+type metrics interface {
+	IncrementSuccessful()
+	IncrementFailed()
+}
+
+// challenger is implemented by the authenticators, that can ask the client for the credentials (like Basic auth).
+type challenger interface {
+	Challenge() string
+}
+
+// New creates mux.MiddlewareFunc for HTTP requests authentication. The request is allowed, if any of authenticators
+// accepts it. Credentials are removed from the request before passing it to the next handler. The client permissions
+// (if any) are passed to the next handler using the request context.
+//
+// Forward-proxy (absolute-form and CONNECT) requests are rejected with the "407 Proxy Authentication Required"
+// status, other requests - with the "401 Unauthorized".
+func New(log *zap.Logger, m metrics, authenticators ...auth.Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				identity      auth.Identity
+				authenticated bool
+			)
+
+			for _, a := range authenticators {
+				if identity, authenticated = a.Authenticate(r); authenticated {
+					break
+				}
+			}
+
+			for _, a := range authenticators { // credentials must not be forwarded (and logged)
+				a.Strip(r)
+			}
+
+			if authenticated {
+				m.IncrementSuccessful()
+				log.Debug("Request authenticated", zap.String("user", identity.User))
+
+				auth.SetUser(r.Context(), identity.User) // for the requests logger
+
+				if identity.Permissions != nil { // permissions are checked by the proxy handlers
+					r = r.WithContext(auth.WithPermissions(r.Context(), identity.Permissions))
+				}
+
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			m.IncrementFailed()
+			log.Warn("Authentication failed",
+				zap.String("remote addr", realip.FromHTTPRequest(r)),
+				zap.String("method", r.Method),
+				zap.String("url", r.URL.String()),
+			)
+
+			var (
+				status          = http.StatusUnauthorized
+				challengeHeader = "WWW-Authenticate"
+			)
+
+			if r.Method == http.MethodConnect || r.URL.IsAbs() {
+				status, challengeHeader = http.StatusProxyAuthRequired, "Proxy-Authenticate"
+			}
+
+			for _, a := range authenticators {
+				if c, ok := a.(challenger); ok {
+					w.Header().Add(challengeHeader, c.Challenge())
+				}
+			}
+
+			http.Error(w, "auth: authentication required", status)
+		})
+	}
+}
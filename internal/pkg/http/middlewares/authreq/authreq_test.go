@@ -0,0 +1,111 @@
+package authreq_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/middlewares/authreq"
+)
+
+type fakeMetrics struct{ success, failed int }
+
+func (m *fakeMetrics) IncrementSuccessful() { m.success++ }
+func (m *fakeMetrics) IncrementFailed()     { m.failed++ }
+
+// fakeAuthenticator accepts the "X-Token: valid" header.
+type fakeAuthenticator struct{ challenge string }
+
+func (a *fakeAuthenticator) Authenticate(r *http.Request) (auth.Identity, bool) {
+	return auth.Identity{
+		User:        "user",
+		Permissions: auth.PermissionsFromScopes("proxy:host:example.com"),
+	}, r.Header.Get("X-Token") == "valid"
+}
+
+func (a *fakeAuthenticator) Strip(r *http.Request) { r.Header.Del("X-Token") }
+
+func (a *fakeAuthenticator) Challenge() string { return a.challenge }
+
+func TestMiddleware(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		giveMethod      string
+		giveURL         string
+		giveToken       string
+		wantStatusCode  int
+		wantChallenge   string
+		wantChallengeIn string
+	}{
+		{
+			name:           "authenticated",
+			giveMethod:     http.MethodGet,
+			giveURL:        "/proxy/example.com",
+			giveToken:      "valid",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:            "wrong credentials",
+			giveMethod:      http.MethodGet,
+			giveURL:         "/proxy/example.com",
+			giveToken:       "invalid",
+			wantStatusCode:  http.StatusUnauthorized,
+			wantChallenge:   "Basic",
+			wantChallengeIn: "WWW-Authenticate",
+		},
+		{
+			name:            "forward-proxy request without credentials",
+			giveMethod:      http.MethodGet,
+			giveURL:         "http://example.com/",
+			wantStatusCode:  http.StatusProxyAuthRequired,
+			wantChallenge:   "Basic",
+			wantChallengeIn: "Proxy-Authenticate",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				rr       = httptest.NewRecorder()
+				m        = fakeMetrics{}
+				req      = httptest.NewRequest(tt.giveMethod, tt.giveURL, http.NoBody)
+				executed bool
+			)
+
+			if tt.giveToken != "" {
+				req.Header.Set("X-Token", tt.giveToken)
+			}
+
+			req = req.WithContext(auth.WithUserHolder(req.Context()))
+
+			authreq.New(zap.NewNop(), &m, &fakeAuthenticator{challenge: "Basic"})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					executed = true
+
+					assert.Empty(t, r.Header.Get("X-Token"), "credentials must be stripped")
+					assert.Equal(t, "user", auth.UserFromContext(r.Context()))
+
+					permissions := auth.PermissionsFromContext(r.Context())
+					assert.True(t, permissions.Allows(http.MethodGet, "example.com"))
+					assert.False(t, permissions.Allows(http.MethodGet, "example.org"))
+				}),
+			).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+
+			if tt.wantStatusCode == http.StatusOK {
+				assert.True(t, executed)
+				assert.Equal(t, 1, m.success)
+				assert.Equal(t, 0, m.failed)
+			} else {
+				assert.False(t, executed)
+				assert.Equal(t, 0, m.success)
+				assert.Equal(t, 1, m.failed)
+				assert.Equal(t, tt.wantChallenge, rr.Header().Get(tt.wantChallengeIn))
+			}
+		})
+	}
+}
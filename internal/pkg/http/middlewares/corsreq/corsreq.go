@@ -0,0 +1,40 @@
+// Package corsreq contains middleware for the CORS policy applying.
+package corsreq
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/cors"
+)
+
+// New creates mux.MiddlewareFunc for the CORS policy applying. Preflight requests are answered by the middleware
+// (without passing them to the next handler) with the "204 No Content" status, or with the "403 Forbidden", when
+// the origin, method or headers are not allowed. For other requests the CORS headers are set before the next handler
+// calling, so even the errors (like authentication failures) are readable by the browser scripts.
+//
+// The middleware must be applied before the authentication, since browsers never send credentials with the preflight
+// requests.
+func New(log *zap.Logger, p *cors.Policy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !cors.IsPreflight(r) {
+				p.Apply(w.Header(), r)
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			if err := p.Preflight(w.Header(), r); err != nil {
+				log.Debug("CORS preflight request rejected", zap.Error(err))
+				http.Error(w, "cors: "+err.Error(), http.StatusForbidden)
+
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package corsreq_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/cors"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/middlewares/corsreq"
+)
+
+func TestMiddleware(t *testing.T) {
+	p, err := cors.New(cors.Settings{
+		AllowedOrigins: []string{"https://*.example.com"},
+		AllowedMethods: []string{http.MethodPut},
+		AllowedHeaders: []string{"*"},
+	})
+	assert.NoError(t, err)
+
+	var (
+		calls   int
+		handler = corsreq.New(zap.NewNop(), p)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			calls++
+
+			http.Error(w, "unauthorized", http.StatusUnauthorized) // like the authentication middleware does
+		}))
+	)
+
+	for _, tt := range []struct {
+		name       string
+		giveMethod string
+		giveHeader map[string]string
+		wantCode   int
+		wantOrigin string
+		wantCalls  int
+	}{
+		{
+			name:       "allowed preflight",
+			giveMethod: http.MethodOptions,
+			giveHeader: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "Authorization",
+			},
+			wantCode:   http.StatusNoContent,
+			wantOrigin: "https://app.example.com",
+		},
+		{
+			name:       "not allowed preflight",
+			giveMethod: http.MethodOptions,
+			giveHeader: map[string]string{
+				"Origin":                        "https://evil.com",
+				"Access-Control-Request-Method": "PUT",
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:       "options without preflight headers",
+			giveMethod: http.MethodOptions,
+			wantCode:   http.StatusUnauthorized,
+			wantCalls:  1,
+		},
+		{
+			name:       "actual request",
+			giveMethod: http.MethodGet,
+			giveHeader: map[string]string{"Origin": "https://app.example.com"},
+			wantCode:   http.StatusUnauthorized,
+			wantOrigin: "https://app.example.com",
+			wantCalls:  1,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				rr  = httptest.NewRecorder()
+				req = httptest.NewRequest(tt.giveMethod, "/proxy/https/example.com", http.NoBody)
+			)
+
+			for name, value := range tt.giveHeader {
+				req.Header.Set(name, value)
+			}
+
+			calls = 0
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Equal(t, tt.wantOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Package limitreq contains middleware for HTTP requests rate limiting.
+package limitreq
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/ratelimit"
+)
+
+type metrics interface {
+	IncrementThrottled()
+	IncrementThrottledHost()
+}
+
+// HostLimit is the client rate limit for the requests to the upstream hosts, matched by the patterns.
+type HostLimit struct {
+	Hosts   hostmatch.Matcher
+	Limiter *ratelimit.Limiter
+}
+
+// New creates mux.MiddlewareFunc for HTTP requests rate limiting. Clients are identified by the clientID function
+// (see auth.ClientID), so the middleware must be applied after the authentication. The global limiter (nil
+// means "no global limit") is applied to all the client requests, and the first matched host limit - to the client
+// requests to the upstream host, resolved using the targetHost function. Requests, rejected by the host limit, are
+// not counted by the global limiter.
+//
+// Rejected requests are responded with the "429 Too Many Requests" status and the "Retry-After" and "RateLimit-*"
+// headers.
+func New(
+	log *zap.Logger,
+	m metrics,
+	global *ratelimit.Limiter,
+	hostLimits []HostLimit,
+	targetHost func(*http.Request) string,
+	clientID func(*http.Request) string,
+) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var client = clientID(r)
+
+			if global != nil {
+				if result := global.Allow(client); !result.Allowed {
+					m.IncrementThrottled()
+					log.Debug("Request throttled", zap.String("client", client))
+					reject(w, result)
+
+					return
+				}
+			}
+
+			if len(hostLimits) > 0 {
+				host := targetHost(r)
+
+				for _, hl := range hostLimits {
+					if !hl.Hosts.Match(host) {
+						continue
+					}
+
+					if result := hl.Limiter.Allow(client); !result.Allowed { // each host limit has its own buckets
+						if global != nil { // other hosts must not be throttled because of this one
+							global.Refund(client)
+						}
+
+						m.IncrementThrottledHost()
+						log.Debug("Request throttled", zap.String("client", client), zap.String("host", host))
+						reject(w, result)
+
+						return
+					}
+
+					break
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// reject responds with the "429 Too Many Requests" status and the rate limit headers (IETF
+// draft-ietf-httpapi-ratelimit-headers).
+func reject(w http.ResponseWriter, result ratelimit.Result) {
+	w.Header().Set("Retry-After", seconds(result.RetryAfter))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", seconds(result.Reset))
+
+	http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+}
+
+// seconds returns the duration in seconds, rounded up (zero is never returned).
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Max(1, math.Ceil(d.Seconds()))), 10)
+}
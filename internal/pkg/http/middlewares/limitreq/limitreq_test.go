@@ -0,0 +1,113 @@
+package limitreq_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/middlewares/limitreq"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/ratelimit"
+)
+
+type fakeMetrics struct{ throttled, throttledHost int }
+
+func (m *fakeMetrics) IncrementThrottled()     { m.throttled++ }
+func (m *fakeMetrics) IncrementThrottledHost() { m.throttledHost++ }
+
+func newLimiter(t *testing.T, requests int) *ratelimit.Limiter {
+	t.Helper()
+
+	l, err := ratelimit.New(ratelimit.Limit{Requests: requests, Period: time.Minute})
+	assert.NoError(t, err)
+
+	return l
+}
+
+func TestMiddleware(t *testing.T) {
+	var (
+		m          = fakeMetrics{}
+		middleware = limitreq.New(zap.NewNop(), &m,
+			newLimiter(t, 3),
+			[]limitreq.HostLimit{
+				{Hosts: hostmatch.New("*.example.com"), Limiter: newLimiter(t, 1)},
+				{Hosts: hostmatch.New("*"), Limiter: newLimiter(t, 2)}, // not applied to the *.example.com
+			},
+			func(r *http.Request) string { return r.URL.Query().Get("host") },
+			func(r *http.Request) string { return auth.ClientID(r, nil) },
+		)
+		handler = middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	)
+
+	var spoofed int
+
+	do := func(remoteAddr, user, host string) *httptest.ResponseRecorder {
+		var (
+			rr  = httptest.NewRecorder()
+			req = httptest.NewRequest(http.MethodGet, "/proxy?host="+host, http.NoBody)
+		)
+
+		spoofed++
+
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "10.0.0."+strconv.Itoa(spoofed)) // must not give a new bucket
+
+		if user != "" {
+			ctx := auth.WithUserHolder(req.Context())
+			auth.SetUser(ctx, user)
+			req = req.WithContext(ctx)
+		}
+
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	// per-host limit
+	assert.Equal(t, http.StatusOK, do("1.1.1.1:1", "", "api.example.com").Code)
+
+	rr := do("1.1.1.1:1", "", "api.example.com")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", rr.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+	assert.Equal(t, 1, m.throttledHost)
+
+	// global limit (3 requests, 1 of them is already made - the throttled one is not counted)
+	assert.Equal(t, http.StatusOK, do("1.1.1.1:1", "", "foo.com").Code)
+	assert.Equal(t, http.StatusOK, do("1.1.1.1:1", "", "foo.com").Code)
+
+	rr = do("1.1.1.1:1", "", "foo.com")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "3", rr.Header().Get("RateLimit-Limit"))
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	assert.Equal(t, 1, m.throttled)
+
+	// other clients are not affected
+	assert.Equal(t, http.StatusOK, do("2.2.2.2:1", "", "api.example.com").Code)
+	assert.Equal(t, http.StatusOK, do("1.1.1.1:1", "alice", "api.example.com").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do("3.3.3.3:1", "alice", "api.example.com").Code,
+		"authenticated clients must be identified by the user name")
+}
+
+func TestMiddlewareWithoutLimits(t *testing.T) {
+	var (
+		rr      = httptest.NewRecorder()
+		handler = limitreq.New(zap.NewNop(), &fakeMetrics{}, nil, nil, nil, func(*http.Request) string { return "" })(
+			http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) }),
+		)
+	)
+
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/parentproxy"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/realip"
 )
 
@@ -15,16 +17,29 @@ import (
 func New(log *zap.Logger) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(auth.WithUserHolder(r.Context()))         // the user is set by the authentication middleware
+			r = r.WithContext(parentproxy.WithRouteHolder(r.Context())) // the route is set by the upstream dialer
+
 			metrics := httpsnoop.CaptureMetrics(next, w, r)
 
-			log.Info("HTTP request processed",
+			fields := []zap.Field{
 				zap.String("remote addr", realip.FromHTTPRequest(r)),
 				zap.String("useragent", r.UserAgent()),
 				zap.String("method", r.Method),
 				zap.String("url", r.URL.String()),
 				zap.Int("status code", metrics.Code),
 				zap.Duration("duration", metrics.Duration),
-			)
+			}
+
+			if user := auth.UserFromContext(r.Context()); user != "" {
+				fields = append(fields, zap.String("user", user))
+			}
+
+			if route := parentproxy.RouteFromContext(r.Context()); route != "" {
+				fields = append(fields, zap.String("route", route))
+			}
+
+			log.Info("HTTP request processed", fields...)
 		})
 	}
 }
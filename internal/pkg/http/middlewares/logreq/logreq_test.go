@@ -11,9 +11,15 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/middlewares/logreq"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/parentproxy"
 )
 
+type clientFunc func(*http.Request) (*http.Response, error)
+
+func (f clientFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
+
 func TestMiddleware(t *testing.T) {
 	cases := []struct {
 		name              string
@@ -43,6 +49,8 @@ func TestMiddleware(t *testing.T) {
 				assert.Equal(t, float64(http.StatusUnsupportedMediaType), in["status code"])
 				assert.Equal(t, "http://unit/test/?foo=bar&baz", in["url"])
 				assert.Equal(t, "Foo Useragent", in["useragent"])
+				assert.NotContains(t, in, "user")
+				assert.NotContains(t, in, "route")
 			},
 		},
 		{
@@ -96,6 +104,40 @@ func TestMiddleware(t *testing.T) {
 				assert.Equal(t, "10.0.0.1", in["remote addr"])
 			},
 		},
+		{
+			name: "authenticated user",
+			giveHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth.SetUser(r.Context(), "service-a")
+				w.WriteHeader(http.StatusOK)
+			}),
+			giveRequest: func() (req *http.Request) {
+				req, _ = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+
+				return
+			},
+			checkOutputFields: func(t *testing.T, in map[string]interface{}) {
+				assert.Equal(t, "service-a", in["user"])
+			},
+		},
+		{
+			name: "upstream route",
+			giveHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstream, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, "https://example.com", http.NoBody)
+				_, _ = parentproxy.NewClient(clientFunc(func(*http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: http.StatusOK}, nil
+				}), parentproxy.NewRouter(nil, nil, nil)).Do(upstream)
+
+				w.WriteHeader(http.StatusOK)
+			}),
+			giveRequest: func() (req *http.Request) {
+				req, _ = http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+
+				return
+			},
+			checkOutputFields: func(t *testing.T, in map[string]interface{}) {
+				assert.Equal(t, "direct", in["route"])
+			},
+		},
 	}
 
 	for _, tt := range cases {
@@ -0,0 +1,49 @@
+// Package netconn allows HTTP handlers to access the underlying network connection (e.g. for the write deadline
+// extending).
+package netconn
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+type ctxKey struct{}
+
+// WithConn returns a copy of the parent context with the connection attached. Can be used as a
+// http.Server.ConnContext function.
+func WithConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, ctxKey{}, c)
+}
+
+// FromContext extracts the connection from the context.
+func FromContext(ctx context.Context) (net.Conn, bool) {
+	c, ok := ctx.Value(ctxKey{}).(net.Conn)
+
+	return c, ok && c != nil
+}
+
+// ExtendWriteDeadline sets the write deadline for the connection attached to the context (if any). The server-wide
+// write timeout is set once per request, so long-living (streaming) responses should extend it on each write.
+func ExtendWriteDeadline(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	if c, ok := FromContext(ctx); ok {
+		_ = c.SetWriteDeadline(time.Now().Add(d))
+	}
+}
+
+// Abort closes the connection attached to the context (if any), so the client gets the incomplete response instead
+// of the truncated, but well-formed one (e.g. when the response headers are sent already). It returns false, when
+// there is no attached connection.
+func Abort(ctx context.Context) bool {
+	if c, ok := FromContext(ctx); ok {
+		_ = c.Close()
+
+		return true
+	}
+
+	return false
+}
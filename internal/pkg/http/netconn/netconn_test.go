@@ -0,0 +1,57 @@
+package netconn_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/netconn"
+)
+
+type fakeConn struct {
+	net.Conn
+	writeDeadline time.Time
+	closed        bool
+}
+
+func (c *fakeConn) SetWriteDeadline(t time.Time) error { c.writeDeadline = t; return nil }
+func (c *fakeConn) Close() error                       { c.closed = true; return nil }
+
+func TestFromContext(t *testing.T) {
+	c, ok := netconn.FromContext(context.Background())
+	assert.False(t, ok)
+	assert.Nil(t, c)
+
+	conn := &fakeConn{}
+
+	c, ok = netconn.FromContext(netconn.WithConn(context.Background(), conn))
+	assert.True(t, ok)
+	assert.Same(t, conn, c)
+}
+
+func TestExtendWriteDeadline(t *testing.T) {
+	var (
+		conn = &fakeConn{}
+		ctx  = netconn.WithConn(context.Background(), conn)
+	)
+
+	netconn.ExtendWriteDeadline(ctx, 0)
+	assert.True(t, conn.writeDeadline.IsZero())
+
+	netconn.ExtendWriteDeadline(ctx, time.Minute)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), conn.writeDeadline, time.Second)
+
+	netconn.ExtendWriteDeadline(context.Background(), time.Minute) // must not panic
+}
+
+func TestAbort(t *testing.T) {
+	var conn = &fakeConn{}
+
+	assert.True(t, netconn.Abort(netconn.WithConn(context.Background(), conn)))
+	assert.True(t, conn.closed)
+
+	assert.False(t, netconn.Abort(context.Background()))
+}
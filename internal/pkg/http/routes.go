@@ -2,23 +2,64 @@ package http
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
-	"strconv"
+	"os"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/admission"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/checkers"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/circuit"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/compression"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/config"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/cors"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/forwarded"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/breakers"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/connect"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/healthz"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/index"
 	metricsHandler "github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/metrics"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/proxy"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/purge"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/middlewares/admitreq"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/middlewares/authreq"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/middlewares/corsreq"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/middlewares/limitreq"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/httpcache"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/metrics"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/mitm"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/netpolicy"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/parentproxy"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/ratelimit"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redirect"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redis"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/retry"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/rewrite"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/upstreamtls"
 )
 
-func (s *Server) registerProxyRoutes(ctx context.Context, cfg config.Config, registerer prometheus.Registerer) error {
+const (
+	dialerKeepAlive     = time.Second * 30
+	admissionRetryAfter = time.Second * 5 // "Retry-After" for the requests, rejected by the admission control
+	redisPingTimeout    = time.Second * 5
+	redisCacheKeyPrefix = "http-proxy-daemon:cache:"
+	adminAPIKeyHeader   = "X-Admin-Key"
+	rateLimitMaxClients = 100_000 // active clients (buckets) count of each rate limiter
+)
+
+func (s *Server) registerProxyRoutes(
+	ctx context.Context,
+	cfg config.Config,
+	registerer prometheus.Registerer,
+	admin mux.MiddlewareFunc, // nil, when the administrative API is disabled
+) error {
 	if cfg.Proxy.Prefix == "" {
 		return errors.New("empty proxy prefix")
 	}
@@ -28,31 +69,762 @@ func (s *Server) registerProxyRoutes(ctx context.Context, cfg config.Config, reg
 		return err
 	}
 
-	httpClient := &http.Client{
+	dialer, httpClient, err := s.newUpstreamTransport(cfg)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.newUpstreamClient(ctx, cfg, registerer, admin, httpClient)
+	if err != nil {
+		return err
+	}
+
+	corsPolicy, err := newCORSPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	proxyOptions, err := newProxyOptions(cfg, corsPolicy)
+	if err != nil {
+		return err
+	}
+
+	guard, throttle, err := s.newGuardMiddleware(cfg, registerer)
+	if err != nil {
+		return err
+	}
+
+	var handler = guard(proxy.NewHandler(ctx, client, &proxyMetrics, proxyOptions...))
+
+	if corsPolicy != nil { // preflight requests are answered before the authentication (they have no credentials)
+		handler = corsreq.New(s.log, corsPolicy)(handler)
+	}
+
+	s.router.Handle("/"+cfg.Proxy.Prefix+"/{uri:.*}", handler).Name("proxy")
+
+	if cfg.ForwardProxy.Enabled {
+		return s.registerForwardProxy(ctx, cfg, registerer, dialer, guard, throttle,
+			proxy.NewForwardHandler(ctx, client, &proxyMetrics, proxyOptions...),
+		)
+	}
+
+	return nil
+}
+
+// newUpstreamTransport creates the outbound connections dialer (with the access policy, enforced at dial time, and
+// the parent proxies routing) and the HTTP client for the upstream requests.
+func (s *Server) newUpstreamTransport(cfg config.Config) (contextDialer, upstreamClient, error) {
+	policy, err := newUpstreamPolicy(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the policy is enforced at dial time, after the DNS resolution
+	var dialer contextDialer = netpolicy.NewDialer(
+		&net.Dialer{Timeout: cfg.Proxy.RequestTimeout, KeepAlive: dialerKeepAlive}, policy,
+	)
+
+	router, err := newParentProxyRouter(cfg, dialer, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if router != nil { // the outbound connections are routed through the parent proxies
+		dialer = router
+	}
+
+	tlsDialer, err := s.newUpstreamTLSDialer(cfg, dialer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	redirects, err := newRedirectPolicy(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var client upstreamClient = newHTTPClient(dialer, tlsDialer, redirects)
+
+	if router != nil {
+		client = parentproxy.NewClient(client, router) // the route is recorded for the reused connections too
+	}
+
+	return dialer, client, nil
+}
+
+// contextDialer establishes the outbound connections.
+type contextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// newHTTPClient creates the HTTP client for the upstream requests.
+func newHTTPClient(dialer contextDialer, tlsDialer *upstreamtls.Dialer, redirects redirect.Policy) *http.Client {
+	return &http.Client{
 		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, //nolint:gosec //lgtm [go/disabled-certificate-check]
-			},
+			DialContext:    dialer.DialContext,
+			DialTLSContext: tlsDialer.DialTLSContext,
 		},
-		Timeout: cfg.Proxy.RequestTimeout,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			const maxRedirects int = 3
+		CheckRedirect: redirect.CheckRedirect(redirects), // the policy can be overridden per request
+	}
+}
 
-			if len(via) >= maxRedirects {
-				return errors.New("too many (" + strconv.Itoa(maxRedirects) + ") redirects")
-			}
+// newRedirectPolicy creates the upstream redirects policy (the redirects are followed, when the mode is not set).
+func newRedirectPolicy(cfg config.Config) (redirect.Policy, error) {
+	var p = redirect.Policy{
+		Mode:         redirect.ModeFollow,
+		MaxRedirects: int(cfg.Proxy.Redirects.Max),
+		SameHost:     cfg.Proxy.Redirects.SameHost,
+	}
 
-			return nil
-		},
+	if cfg.Proxy.Redirects.Mode != "" {
+		mode, err := redirect.ParseMode(cfg.Proxy.Redirects.Mode)
+		if err != nil {
+			return p, err
+		}
+
+		p.Mode = mode
 	}
 
-	s.router.
-		Handle("/"+cfg.Proxy.Prefix+"/{uri:.*}", proxy.NewHandler(ctx, httpClient, &proxyMetrics)).
-		Name("proxy")
+	return p, nil
+}
+
+// newUpstreamTLSDialer creates the dialer for the TLS connections to the upstreams (certificates are verified,
+// unless the insecure mode is enabled) with the client certificates (mTLS) for the configured hosts.
+func (s *Server) newUpstreamTLSDialer(cfg config.Config, dialer contextDialer) (*upstreamtls.Dialer, error) {
+	roots, err := upstreamtls.LoadRootCAs(cfg.UpstreamTLS.CAFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("upstream TLS CA loading failed: %w", err)
+	}
+
+	cipherSuites, err := upstreamtls.ParseCipherSuites(cfg.UpstreamTLS.CipherSuites...)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts = []upstreamtls.Option{
+		upstreamtls.WithRootCAs(roots),
+		upstreamtls.WithInsecureHosts(hostmatch.New(cfg.UpstreamTLS.InsecureHosts...)),
+	}
+
+	if cfg.UpstreamTLS.MinVersion != "" { // empty means "TLS 1.2"
+		minVersion, parseErr := upstreamtls.ParseVersion(cfg.UpstreamTLS.MinVersion)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+
+		opts = append(opts, upstreamtls.WithMinVersion(minVersion))
+	}
+
+	if len(cipherSuites) > 0 {
+		opts = append(opts, upstreamtls.WithCipherSuites(cipherSuites...))
+	}
+
+	for _, value := range cfg.UpstreamTLS.Pins {
+		host, pin, parseErr := upstreamtls.ParsePin(value)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+
+		opts = append(opts, upstreamtls.WithPins(host, pin))
+	}
+
+	for _, value := range cfg.UpstreamTLS.ClientCerts {
+		pattern, certFile, keyFile, parseErr := upstreamtls.ParseClientCertificate(value)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+
+		cert, loadErr := upstreamtls.NewClientCertificate(certFile, keyFile, s.log)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+
+		opts = append(opts, upstreamtls.WithClientCertificate(hostmatch.New(pattern), cert))
+	}
+
+	if cfg.UpstreamTLS.Insecure {
+		opts = append(opts, upstreamtls.WithInsecure())
+	}
+
+	return upstreamtls.NewDialer(dialer, opts...), nil
+}
+
+// upstreamClient sends the proxied requests to the upstreams.
+type upstreamClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// newUpstreamClient wraps the HTTP client with the circuit breakers, retrying and caching (each layer is optional).
+// Every retry attempt passes through the circuit breaker, and the cache is consulted before any attempt.
+func (s *Server) newUpstreamClient(
+	ctx context.Context,
+	cfg config.Config,
+	registerer prometheus.Registerer,
+	admin mux.MiddlewareFunc,
+	client upstreamClient,
+) (upstreamClient, error) {
+	client, err := s.newCircuitClient(cfg, registerer, admin, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if client, err = newRetryingClient(cfg, registerer, client); err != nil {
+		return nil, err
+	}
+
+	return s.newCachingClient(ctx, cfg, registerer, admin, client)
+}
+
+// newCircuitClient wraps the HTTP client with the per upstream host circuit breakers (when they are enabled). The
+// breakers listing and resetting handlers are registered, when the administrative API is enabled.
+func (s *Server) newCircuitClient(
+	cfg config.Config,
+	registerer prometheus.Registerer,
+	admin mux.MiddlewareFunc,
+	client upstreamClient,
+) (upstreamClient, error) {
+	var cbCfg = cfg.CircuitBreaker
+
+	if !cbCfg.Enabled {
+		return client, nil
+	}
+
+	circuitMetrics := metrics.NewCircuit()
+	if err := circuitMetrics.Register(registerer); err != nil {
+		return nil, err
+	}
+
+	group, err := circuit.NewGroup(circuit.Settings{
+		ConsecutiveFailures: int(cbCfg.ConsecutiveFailures),
+		ErrorRate:           cbCfg.ErrorRate,
+		MinRequests:         int(cbCfg.MinRequests),
+		Window:              cbCfg.Window,
+		OpenTimeout:         cbCfg.OpenTimeout,
+		HalfOpenRequests:    int(cbCfg.Trials),
+	}, &circuitMetrics)
+	if err != nil {
+		return nil, err
+	}
+
+	if admin != nil {
+		s.router.
+			Handle("/admin/circuit-breakers", admin(breakers.NewListHandler(group))).
+			Methods(http.MethodGet).
+			Name("circuit-breakers")
+
+		s.router.
+			Handle("/admin/circuit-breakers/reset", admin(breakers.NewResetHandler(s.log, group))).
+			Methods(http.MethodPost).
+			Name("circuit-breakers-reset")
+	}
+
+	return circuit.NewClient(client, group), nil
+}
+
+// newRetryingClient wraps the HTTP client with the transient failures retrying (when the retrying is enabled). The
+// retries are made within the proxy request timeout.
+func newRetryingClient(
+	cfg config.Config,
+	registerer prometheus.Registerer,
+	client upstreamClient,
+) (upstreamClient, error) {
+	if cfg.Retry.MaxRetries == 0 {
+		return client, nil
+	}
+
+	retryMetrics := metrics.NewRetry()
+	if err := retryMetrics.Register(registerer); err != nil {
+		return nil, err
+	}
+
+	return retry.NewClient(client, &retryMetrics,
+		retry.WithMaxRetries(int(cfg.Retry.MaxRetries)),
+		retry.WithBackoff(cfg.Retry.Backoff, cfg.Retry.MaxBackoff),
+		retry.WithBudget(cfg.Proxy.RequestTimeout),
+		retry.WithStatusCodes(cfg.Retry.StatusCodes...),
+		retry.WithMaxBodySize(int64(cfg.Retry.MaxBodySize)),
+	), nil
+}
+
+// newCachingClient wraps the HTTP client with the shared responses cache (when the caching is enabled). The cache
+// purging handler is registered, when the administrative API is enabled.
+func (s *Server) newCachingClient(
+	ctx context.Context,
+	cfg config.Config,
+	registerer prometheus.Registerer,
+	admin mux.MiddlewareFunc,
+	client upstreamClient,
+) (upstreamClient, error) {
+	if !cfg.Cache.Enabled {
+		return client, nil
+	}
+
+	storage, err := newCacheStorage(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheMetrics := metrics.NewCache()
+	if err = cacheMetrics.Register(registerer); err != nil {
+		return nil, err
+	}
+
+	cachingClient := httpcache.NewClient(ctx, s.log, client, storage, &cacheMetrics, int64(cfg.Cache.MaxEntrySize))
+
+	if admin != nil {
+		s.router.
+			Handle("/admin/cache/purge", admin(purge.NewHandler(s.log, cachingClient))).
+			Methods(http.MethodPost).
+			Name("cache-purge")
+	}
+
+	return cachingClient, nil
+}
+
+// newCacheStorage creates the cached responses storage. Redis connection is closed, when the context is canceled.
+func newCacheStorage(ctx context.Context, cfg config.Config) (httpcache.Storage, error) {
+	switch cfg.Cache.Storage {
+	case httpcache.StorageDisk:
+		storage, err := httpcache.NewDisk(cfg.Cache.Dir, int64(cfg.Cache.MaxSize))
+		if err != nil {
+			return nil, fmt.Errorf("cannot open disk cache storage: %w", err)
+		}
+
+		return storage, nil
+
+	case httpcache.StorageRedis:
+		opts, err := redis.ParseURL(cfg.Cache.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+
+		client := redis.New(opts)
+
+		pingCtx, cancel := context.WithTimeout(ctx, redisPingTimeout)
+		defer cancel()
+
+		if err = client.Ping(pingCtx); err != nil {
+			_ = client.Close()
+
+			return nil, fmt.Errorf("cannot connect to the redis cache storage: %w", err)
+		}
+
+		go func() { <-ctx.Done(); _ = client.Close() }()
+
+		return httpcache.NewRedis(client, redisCacheKeyPrefix, cfg.Cache.RedisTTL), nil
+	}
+
+	return httpcache.NewMemory(int64(cfg.Cache.MaxSize)), nil
+}
+
+// newAdminMiddleware creates the administrative API authentication middleware. It returns nil, if the administrative
+// API is disabled (no API keys are set).
+func (s *Server) newAdminMiddleware(cfg config.Config, registerer prometheus.Registerer) (mux.MiddlewareFunc, error) {
+	if len(cfg.Admin.APIKeys) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	adminMetrics := metrics.NewAdmin()
+	if err := adminMetrics.Register(registerer); err != nil {
+		return nil, err
+	}
+
+	return authreq.New(s.log, &adminMetrics, auth.NewAPIKeys(cfg.Admin.APIKeys, adminAPIKeyHeader, "")), nil
+}
+
+func (s *Server) registerForwardProxy(
+	ctx context.Context,
+	cfg config.Config,
+	registerer prometheus.Registerer,
+	dialer contextDialer,
+	guard mux.MiddlewareFunc, // authentication, rate and concurrency limiting
+	throttle mux.MiddlewareFunc, // limiting only, for the requests of the authenticated tunnels
+	forwardHandler http.Handler,
+) error {
+	tunnelMetrics := metrics.NewTunnel()
+	if err := tunnelMetrics.Register(registerer); err != nil {
+		return err
+	}
+
+	var (
+		intercepted    = s.withGlobalMiddlewares(throttle(forwardHandler))
+		connectOptions = []connect.Option{
+			connect.WithAllowedPorts(cfg.ForwardProxy.ConnectAllowedPorts...),
+			connect.WithDialTimeout(cfg.Proxy.RequestTimeout),
+			connect.WithIdleTimeout(cfg.ForwardProxy.ConnectIdleTimeout),
+		}
+	)
+
+	if mitmCfg := cfg.ForwardProxy.MITM; mitmCfg.Enabled {
+		ca, err := mitm.LoadCA(mitmCfg.CACertFile, mitmCfg.CAKeyFile)
+		if err != nil {
+			return fmt.Errorf("cannot load MITM CA: %w", err)
+		}
+
+		// decrypted requests are processed by the same forward-proxy handler (the tunnel is already authenticated, and
+		// the client permissions are checked by the handler for each request, since the tunnel context is inherited);
+		// each request is limited (rate and concurrency), like the regular one of the tunnel client
+		connectOptions = append(connectOptions, connect.WithInterceptor(mitm.NewInterceptor(
+			mitm.NewCertCache(ca, 0),
+			hostmatch.New(mitmCfg.Hosts...),
+			intercepted,
+			s.log,
+		)))
+	}
+
+	s.registerForwardProxyHandlers(
+		s.withGlobalMiddlewares(guard(forwardHandler)),
+		s.withGlobalMiddlewares(guard(connect.NewHandler(ctx, s.log, dialer, &tunnelMetrics, connectOptions...))),
+	)
 
 	return nil
 }
 
+// newGuardMiddleware creates the proxy clients authentication, rate and concurrency limiting middleware (guard), and
+// the limiting only middleware (throttle) for the already authenticated requests (like the intercepted tunnel ones).
+func (s *Server) newGuardMiddleware(
+	cfg config.Config,
+	registerer prometheus.Registerer,
+) (mux.MiddlewareFunc, mux.MiddlewareFunc, error) {
+	authenticate, err := s.newAuthMiddleware(cfg, registerer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	trustedProxies, err := netpolicy.ParseCIDRs(cfg.Proxy.TrustedProxies...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the client IP headers are trusted for the requests from the trusted proxies only (otherwise, they are spoofed)
+	var clientID = func(r *http.Request) string { return auth.ClientID(r, trustedProxies) }
+
+	limit, err := s.newRateLimitMiddleware(cfg, registerer, clientID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	admit, err := s.newAdmissionMiddleware(cfg, registerer, clientID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// clients are limited after the authentication, since the authenticated user name is used as a client key
+	var throttle = func(next http.Handler) http.Handler { return limit(admit(next)) }
+
+	return func(next http.Handler) http.Handler { return authenticate(throttle(next)) }, throttle, nil
+}
+
+// newAuthMiddleware creates the proxy clients authentication middleware. If the authentication is not configured,
+// the middleware passes all the requests as is.
+func (s *Server) newAuthMiddleware(cfg config.Config, registerer prometheus.Registerer) (mux.MiddlewareFunc, error) {
+	var authenticators []auth.Authenticator
+
+	if len(cfg.Auth.APIKeys) > 0 {
+		authenticators = append(authenticators,
+			auth.NewAPIKeys(cfg.Auth.APIKeys, cfg.Auth.APIKeyHeader, cfg.Auth.APIKeyQueryParam),
+		)
+	}
+
+	if cfg.Auth.HtpasswdFile != "" {
+		htpasswd, err := auth.NewHtpasswd(cfg.Auth.HtpasswdFile, s.log)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load htpasswd file: %w", err)
+		}
+
+		authenticators = append(authenticators, htpasswd)
+	}
+
+	if jwtCfg := cfg.Auth.JWT; jwtCfg.JWKS != "" {
+		jwks, err := auth.NewJWKS(jwtCfg.JWKS, jwtCfg.JWKSRefreshInterval, s.log)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load JWKS: %w", err)
+		}
+
+		authenticators = append(authenticators,
+			auth.NewJWT(jwks, jwtCfg.Issuer, jwtCfg.Audience, jwtCfg.PermissionsClaim, s.log),
+		)
+	}
+
+	if len(authenticators) == 0 {
+		return func(next http.Handler) http.Handler { return next }, nil
+	}
+
+	authMetrics := metrics.NewAuth()
+	if err := authMetrics.Register(registerer); err != nil {
+		return nil, err
+	}
+
+	return authreq.New(s.log, &authMetrics, authenticators...), nil
+}
+
+// newRateLimitMiddleware creates the proxy clients rate limiting middleware. If the rate limiting is not configured,
+// the middleware passes all the requests as is.
+func (s *Server) newRateLimitMiddleware(
+	cfg config.Config,
+	registerer prometheus.Registerer,
+	clientID func(*http.Request) string,
+) (mux.MiddlewareFunc, error) {
+	if cfg.RateLimit.Limit == "" && len(cfg.RateLimit.HostLimits) == 0 {
+		return func(next http.Handler) http.Handler { return next }, nil
+	}
+
+	var (
+		global     *ratelimit.Limiter
+		hostLimits = make([]limitreq.HostLimit, 0, len(cfg.RateLimit.HostLimits))
+	)
+
+	if cfg.RateLimit.Limit != "" {
+		limit, err := ratelimit.ParseLimit(cfg.RateLimit.Limit)
+		if err != nil {
+			return nil, err
+		}
+
+		if global, err = ratelimit.New(limit, ratelimit.WithMaxKeys(rateLimitMaxClients)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, hostLimit := range cfg.RateLimit.HostLimits {
+		pattern, limit, err := ratelimit.ParseHostLimit(hostLimit)
+		if err != nil {
+			return nil, err
+		}
+
+		limiter, err := ratelimit.New(limit, ratelimit.WithMaxKeys(rateLimitMaxClients))
+		if err != nil {
+			return nil, err
+		}
+
+		hostLimits = append(hostLimits, limitreq.HostLimit{Hosts: hostmatch.New(pattern), Limiter: limiter})
+	}
+
+	rateLimitMetrics := metrics.NewRateLimit()
+	if err := rateLimitMetrics.Register(registerer); err != nil {
+		return nil, err
+	}
+
+	return limitreq.New(s.log, &rateLimitMetrics, global, hostLimits, proxy.TargetHost, clientID), nil
+}
+
+// newAdmissionMiddleware creates the in-flight requests concurrency limiting middleware. If the limits are not
+// configured, the middleware passes all the requests as is.
+func (s *Server) newAdmissionMiddleware(
+	cfg config.Config,
+	registerer prometheus.Registerer,
+	clientID func(*http.Request) string,
+) (mux.MiddlewareFunc, error) {
+	var admCfg = cfg.Admission
+
+	if admCfg.MaxInFlight == 0 && admCfg.MaxInFlightPerHost == 0 {
+		return func(next http.Handler) http.Handler { return next }, nil
+	}
+
+	admissionMetrics := metrics.NewAdmission()
+	if err := admissionMetrics.Register(registerer); err != nil {
+		return nil, err
+	}
+
+	var (
+		global *admission.Limiter
+		hosts  *admission.Group
+		err    error
+		hooks  = admission.WithQueueHooks(admissionMetrics.IncrementQueued, admissionMetrics.DecrementQueued)
+	)
+
+	if admCfg.MaxInFlight > 0 {
+		if global, err = admission.New(
+			int(admCfg.MaxInFlight), int(admCfg.QueueSize), admCfg.QueueTimeout, hooks,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if admCfg.MaxInFlightPerHost > 0 {
+		if hosts, err = admission.NewGroup(
+			int(admCfg.MaxInFlightPerHost), int(admCfg.QueueSize), admCfg.QueueTimeout, hooks,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	return admitreq.New(s.log, &admissionMetrics, global, hosts, proxy.TargetHost, clientID, admissionRetryAfter), nil
+}
+
+// newCORSPolicy creates the CORS policy for the proxy route. Nil is returned, when no origins are allowed (the CORS
+// policy is disabled).
+func newCORSPolicy(cfg config.Config) (*cors.Policy, error) {
+	if len(cfg.CORS.AllowedOrigins) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	var mode cors.UpstreamMode // the upstream headers are replaced, when the mode is not set
+
+	if cfg.CORS.UpstreamHeaders != "" {
+		parsed, err := cors.ParseUpstreamMode(cfg.CORS.UpstreamHeaders)
+		if err != nil {
+			return nil, err
+		}
+
+		mode = parsed
+	}
+
+	return cors.New(cors.Settings{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.CORS.ExposedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+		Upstream:         mode,
+	})
+}
+
+// newCompressor creates the responses compressor.
+func newCompressor(cfg config.Config) (*compression.Compressor, error) {
+	var settings = compression.Settings{
+		ContentTypes:  cfg.Compression.ContentTypes,
+		MinSize:       int64(cfg.Compression.MinSize),
+		TranscodeGzip: cfg.Compression.TranscodeGzip,
+	}
+
+	for _, value := range cfg.Compression.Encodings {
+		e, err := compression.ParseEncoding(value)
+		if err != nil {
+			return nil, err
+		}
+
+		settings.Encodings = append(settings.Encodings, e)
+	}
+
+	return compression.New(settings)
+}
+
+// newProxyOptions creates the proxy handlers options. The CORS policy (nil means "disabled") is used for the upstream
+// CORS headers filtering.
+func newProxyOptions(cfg config.Config, corsPolicy *cors.Policy) ([]proxy.Option, error) {
+	redirects, redirectsErr := newRedirectPolicy(cfg)
+	if redirectsErr != nil {
+		return nil, redirectsErr
+	}
+
+	opts := []proxy.Option{
+		proxy.WithRequestTimeout(cfg.Proxy.RequestTimeout),
+		proxy.WithStreamIdleTimeout(cfg.Proxy.StreamIdleTimeout),
+		proxy.WithWebsocketPingInterval(cfg.Proxy.WebsocketPingInterval),
+		proxy.WithRedirectPolicy(redirects),
+		proxy.WithRoutePrefix("/" + cfg.Proxy.Prefix), // the Location headers are rewritten into the route form
+		proxy.WithLimits(proxy.Limits{ // the sizes are validated already (must fit the int types)
+			MaxRequestBodySize:  int64(cfg.Limits.MaxRequestBodySize),
+			MaxResponseBodySize: int64(cfg.Limits.MaxResponseBodySize),
+			MaxURLLength:        int(cfg.Limits.MaxURLLength),
+			MaxHeaderBytes:      int(cfg.Limits.MaxHeaderSize),
+		}),
+	}
+
+	if corsPolicy != nil {
+		opts = append(opts, proxy.WithCORS(corsPolicy))
+	}
+
+	if cfg.Proxy.RewriteContent {
+		opts = append(opts, proxy.WithContentRewriting(rewrite.New("/"+cfg.Proxy.Prefix)))
+	}
+
+	if cfg.Compression.Enabled {
+		compressor, err := newCompressor(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, proxy.WithCompression(compressor))
+	}
+
+	if fwdCfg := cfg.Proxy.ForwardedHeaders; fwdCfg.Mode != "" { // empty mode means "pass the client headers as is"
+		mode, err := forwarded.ParseMode(fwdCfg.Mode)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, proxy.WithForwardedHeaders(forwarded.New(mode, hostmatch.New(fwdCfg.AnonymizeHosts...))))
+	}
+
+	return opts, nil
+}
+
+// newParentProxyRouter creates the outbound connections router (nil is returned, when the parent proxies are not
+// configured). The direct connections are established by the dialer, and the destinations, connected through the
+// parent proxies, are checked by the policy.
+func newParentProxyRouter(
+	cfg config.Config,
+	dialer contextDialer,
+	policy *netpolicy.Policy,
+) (*parentproxy.Router, error) {
+	if cfg.ParentProxy.URL == "" && len(cfg.ParentProxy.Rules) == 0 && !cfg.ParentProxy.FromEnv {
+		return nil, nil //nolint:nilnil
+	}
+
+	var opts = make([]parentproxy.Option, 0, len(cfg.ParentProxy.Rules)+2) //nolint:gomnd
+
+	for _, value := range cfg.ParentProxy.Rules {
+		pattern, route, err := parentproxy.ParseRule(value)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, parentproxy.WithRule(hostmatch.New(pattern), route))
+	}
+
+	if cfg.ParentProxy.FromEnv {
+		env, err := parentproxy.ParseEnvironment(os.Getenv)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, parentproxy.WithEnvironment(env))
+	}
+
+	if cfg.ParentProxy.URL != "" {
+		proxyURL, err := parentproxy.ParseURL(cfg.ParentProxy.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, parentproxy.WithDefault(parentproxy.ProxyRoute(proxyURL)))
+	}
+
+	// the parent proxies themselves are trusted, so their addresses are not checked by the policy
+	parent := &net.Dialer{Timeout: cfg.Proxy.RequestTimeout, KeepAlive: dialerKeepAlive}
+
+	return parentproxy.NewRouter(dialer, parent, policy, opts...), nil
+}
+
+// newUpstreamPolicy creates the upstream destinations access policy.
+func newUpstreamPolicy(cfg config.Config) (*netpolicy.Policy, error) {
+	allowNetworks, err := netpolicy.ParseCIDRs(cfg.Upstream.AllowNetworks...)
+	if err != nil {
+		return nil, err
+	}
+
+	denyNetworks, err := netpolicy.ParseCIDRs(cfg.Upstream.DenyNetworks...)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts = []netpolicy.Option{
+		netpolicy.WithAllowNetworks(allowNetworks...),
+		netpolicy.WithDenyNetworks(denyNetworks...),
+		netpolicy.WithAllowHosts(hostmatch.New(cfg.Upstream.AllowHosts...)),
+		netpolicy.WithDenyHosts(hostmatch.New(cfg.Upstream.DenyHosts...)),
+		netpolicy.WithAllowedPorts(cfg.Upstream.AllowedPorts...),
+	}
+
+	if cfg.Upstream.DenyPrivateNetworks {
+		opts = append(opts, netpolicy.WithDenyPrivateNetworks())
+	}
+
+	return netpolicy.New(opts...), nil
+}
+
 func (s *Server) registerIndexHandler() {
 	s.router.
 		Handle("/", index.NewHandler()).
@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -12,8 +13,11 @@ import (
 
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/config"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/connect"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/handlers/proxy"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/middlewares/logreq"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/middlewares/panic"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/netconn"
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/metrics"
 )
 
@@ -28,6 +32,10 @@ type (
 const (
 	readTimeout  = time.Second * 3
 	writeTimeout = time.Second * 60 // this is maximal proxy response timeout also
+
+	// maxHeaderBytesMargin is added to the configured headers size limit for the server: the configured limit is
+	// enforced by the proxy handlers, and the server rejects the far exceeding headers only.
+	maxHeaderBytesMargin = 64 << 10 // 64 KiB
 )
 
 // NewServer creates new server instance.
@@ -40,6 +48,7 @@ func NewServer(log *zap.Logger) *Server {
 			ReadTimeout:       readTimeout,
 			WriteTimeout:      writeTimeout,
 			ReadHeaderTimeout: readTimeout,
+			ConnContext:       netconn.WithConn, // allows handlers to extend the write deadline for streaming
 		}
 	)
 
@@ -54,16 +63,58 @@ func NewServer(log *zap.Logger) *Server {
 func (s *Server) Register(ctx context.Context, cfg config.Config) error {
 	registry := metrics.NewRegistry()
 
+	if size := cfg.Limits.MaxHeaderSize; size > 0 { // otherwise, the server default is used
+		if size += maxHeaderBytesMargin; size > math.MaxInt32 {
+			size = math.MaxInt32
+		}
+
+		s.server.MaxHeaderBytes = int(size)
+	}
+
 	s.registerGlobalMiddlewares()
 
 	return s.registerHandlers(ctx, cfg, registry)
 }
 
 func (s *Server) registerGlobalMiddlewares() {
-	s.router.Use(
+	s.router.Use(s.globalMiddlewares()...)
+}
+
+// globalMiddlewares returns middlewares, that must be applied for all the server handlers.
+func (s *Server) globalMiddlewares() []mux.MiddlewareFunc {
+	return []mux.MiddlewareFunc{
 		logreq.New(s.log),
 		panic.New(s.log),
-	)
+	}
+}
+
+// withGlobalMiddlewares wraps the handler, that is not registered in the router, with the global middlewares.
+func (s *Server) withGlobalMiddlewares(handler http.Handler) http.Handler {
+	middlewares := s.globalMiddlewares()
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// registerForwardProxyHandlers makes the handlers process all the forward-proxy (absolute-form) and CONNECT
+// requests. Such requests must be dispatched before the router, since the router matches the request path only (and
+// cleans it up). Handlers must be already wrapped with the global middlewares.
+func (s *Server) registerForwardProxyHandlers(forward, tunnel http.Handler) {
+	s.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case connect.IsConnectRequest(r):
+			tunnel.ServeHTTP(w, r)
+
+		case proxy.IsForwardProxyRequest(r):
+			forward.ServeHTTP(w, r)
+
+		default:
+			s.router.ServeHTTP(w, r)
+		}
+	})
 }
 
 // registerHandlers register server http handlers.
@@ -71,7 +122,12 @@ func (s *Server) registerHandlers(ctx context.Context, cfg config.Config, regist
 	s.router.NotFoundHandler = handlers.NewHTMLErrorHandler(http.StatusNotFound)
 	s.router.MethodNotAllowedHandler = handlers.NewHTMLErrorHandler(http.StatusMethodNotAllowed)
 
-	if err := s.registerProxyRoutes(ctx, cfg, registry); err != nil {
+	admin, err := s.newAdminMiddleware(cfg, registry)
+	if err != nil {
+		return err
+	}
+
+	if err = s.registerProxyRoutes(ctx, cfg, registry, admin); err != nil {
 		return err
 	}
 
@@ -2,17 +2,33 @@ package http
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"errors"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 
 	"github.com/tarampampam/http-proxy-daemon/internal/pkg/config"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/mitm"
 )
 
 func getRandomTCPPort(t *testing.T) (int, error) {
@@ -122,3 +138,909 @@ func TestServer_RegisterWithoutProxyPrefix(t *testing.T) {
 
 	assert.EqualError(t, srv.Register(context.Background(), config.Config{}), "empty proxy prefix")
 }
+
+func TestServer_RegisterForwardProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("upstream " + r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.ForwardProxy.Enabled = true
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	// the forward-proxy request path must not be matched with the server routes
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, upstream.URL+"/metrics", http.NoBody)
+
+	srv.server.Handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "upstream /metrics", rr.Body.String())
+
+	// and regular requests are still processed by the router
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/live", http.NoBody)
+
+	srv.server.Handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "upstream")
+}
+
+func TestServer_RegisterWithAuth(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("X-Api-Key"), "credentials must not be forwarded")
+
+		_, _ = w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.ForwardProxy.Enabled = true
+	cfg.Auth.APIKeys = []string{"secret"}
+	cfg.Auth.APIKeyHeader = "X-Api-Key"
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	for _, tt := range []struct {
+		name           string
+		giveURL        string
+		giveKey        string
+		wantStatusCode int
+	}{
+		{name: "proxy route without key", giveURL: "/foo/" + upstream.URL[7:], wantStatusCode: http.StatusUnauthorized},
+		{name: "proxy route with key", giveURL: "/foo/" + upstream.URL[7:], giveKey: "secret", wantStatusCode: http.StatusOK},
+		{name: "forward-proxy without key", giveURL: upstream.URL, wantStatusCode: http.StatusProxyAuthRequired},
+		{name: "forward-proxy with key", giveURL: upstream.URL, giveKey: "secret", wantStatusCode: http.StatusOK},
+		{name: "service routes are open", giveURL: "/live", wantStatusCode: http.StatusOK},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.giveURL, http.NoBody)
+
+			if tt.giveKey != "" {
+				req.Header.Set("X-Api-Key", tt.giveKey)
+			}
+
+			srv.server.Handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestServer_RegisterWithRateLimit(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.RateLimit.Limit = "2/m" // requests, throttled by the host limit, are not counted
+	cfg.RateLimit.HostLimits = []string{"127.0.0.1=1/m"}
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	for _, tt := range []struct {
+		name           string
+		giveURL        string
+		wantStatusCode int
+	}{
+		{name: "first request", giveURL: "/foo/" + upstream.URL[7:], wantStatusCode: http.StatusOK},
+		{name: "host limit exceeded", giveURL: "/foo/" + upstream.URL[7:], wantStatusCode: http.StatusTooManyRequests},
+		{name: "other host", giveURL: "/foo/localhost:1", wantStatusCode: http.StatusServiceUnavailable},
+		{name: "global limit exceeded", giveURL: "/foo/localhost:1", wantStatusCode: http.StatusTooManyRequests},
+		{name: "service routes are not limited", giveURL: "/live", wantStatusCode: http.StatusOK},
+	} {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, tt.giveURL, http.NoBody)
+
+		srv.server.Handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, tt.wantStatusCode, rr.Code, tt.name)
+	}
+}
+
+func TestServer_RegisterWithAdmission(t *testing.T) {
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.Admission.MaxInFlight = 10
+	cfg.Admission.MaxInFlightPerHost = 2
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+
+	srv.server.Handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "proxy_admission_in_flight")
+	assert.Contains(t, rr.Body.String(), "proxy_admission_queued")
+}
+
+func TestServer_RegisterWithCache(t *testing.T) {
+	var calls int
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.Cache.Enabled = true
+	cfg.Cache.MaxSize = 1 << 20
+	cfg.Cache.MaxEntrySize = 1 << 10
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	for _, wantCache := range []string{"MISS", "HIT"} {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/foo/"+upstream.URL[7:], http.NoBody)
+
+		srv.server.Handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "upstream", rr.Body.String())
+		assert.Equal(t, wantCache, rr.Header().Get("X-Cache"))
+	}
+
+	assert.Equal(t, 1, calls)
+}
+
+func TestServer_RegisterWithCachePurge(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.Cache.Enabled = true
+	cfg.Cache.Storage = "disk"
+	cfg.Cache.Dir = t.TempDir()
+	cfg.Cache.MaxSize = 1 << 20
+	cfg.Cache.MaxEntrySize = 1 << 10
+	cfg.Admin.APIKeys = []string{"secret"}
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	get := func() string {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/foo/"+upstream.URL[7:], http.NoBody)
+
+		srv.server.Handler.ServeHTTP(rr, req)
+
+		return rr.Header().Get("X-Cache")
+	}
+
+	purge := func(key string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/admin/cache/purge",
+			strings.NewReader(`{"url":"`+upstream.URL+`"}`))
+
+		if key != "" {
+			req.Header.Set("X-Admin-Key", key)
+		}
+
+		srv.server.Handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	assert.Equal(t, "MISS", get())
+	assert.Equal(t, "HIT", get())
+
+	assert.Equal(t, http.StatusUnauthorized, purge("").Code)
+	assert.Equal(t, http.StatusUnauthorized, purge("wrong").Code)
+
+	rr := purge("secret")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"purged":1}`, rr.Body.String())
+
+	assert.Equal(t, "MISS", get())
+}
+
+func TestServer_RegisterWithRetries(t *testing.T) {
+	var calls int
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.Proxy.RequestTimeout = time.Second * 5
+	cfg.Retry.MaxRetries = 2
+	cfg.Retry.Backoff = time.Millisecond
+	cfg.Retry.MaxBackoff = time.Millisecond * 5
+	cfg.Retry.StatusCodes = []int{http.StatusServiceUnavailable}
+	cfg.Retry.MaxBodySize = 1 << 10
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/foo/"+upstream.URL[7:], http.NoBody)
+
+	srv.server.Handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "upstream", rr.Body.String())
+	assert.Equal(t, 3, calls)
+}
+
+func TestServer_RegisterWithCircuitBreaker(t *testing.T) {
+	var calls int
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.CircuitBreaker.Enabled = true
+	cfg.CircuitBreaker.ConsecutiveFailures = 2
+	cfg.CircuitBreaker.OpenTimeout = time.Minute
+	cfg.CircuitBreaker.Trials = 1
+	cfg.Admin.APIKeys = []string{"secret"}
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	serve := func(method, url, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("X-Admin-Key", "secret")
+
+		srv.server.Handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	for _, wantCode := range []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusServiceUnavailable} {
+		rr := serve(http.MethodGet, "/foo/"+upstream.URL[7:], "")
+
+		assert.Equal(t, wantCode, rr.Code)
+	}
+
+	assert.Equal(t, 2, calls, "the open breaker fails fast")
+
+	rr := serve(http.MethodGet, "/admin/circuit-breakers", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"host":"`+upstream.URL[7:]+`","state":"open"`)
+
+	rr = serve(http.MethodPost, "/admin/circuit-breakers/reset", `{"host":"`+upstream.URL[7:]+`"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"reset":1}`, rr.Body.String())
+
+	assert.Equal(t, http.StatusBadGateway, serve(http.MethodGet, "/foo/"+upstream.URL[7:], "").Code)
+	assert.Equal(t, 3, calls)
+}
+
+func TestServer_RegisterWithUpstreamTLS(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: upstream.Certificate().Raw,
+	}), 0o600))
+
+	for name, tt := range map[string]struct {
+		giveConfig func(*config.Config)
+		wantCode   int
+	}{
+		"verified by default": {giveConfig: func(*config.Config) {}, wantCode: http.StatusBadGateway},
+		"custom CA":           {giveConfig: func(c *config.Config) { c.UpstreamTLS.CAFiles = []string{caFile} }},
+		"insecure":            {giveConfig: func(c *config.Config) { c.UpstreamTLS.Insecure = true }},
+		"insecure host": {giveConfig: func(c *config.Config) {
+			c.UpstreamTLS.InsecureHosts = []string{"127.0.0.1"}
+		}},
+		"wrong pin": {giveConfig: func(c *config.Config) {
+			c.UpstreamTLS.Insecure = true
+			c.UpstreamTLS.Pins = []string{"127.0.0.1=sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}
+		}, wantCode: http.StatusBadGateway},
+	} {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			srv := NewServer(zap.NewNop())
+
+			cfg := config.Config{}
+			cfg.Proxy.Prefix = "foo"
+			cfg.UpstreamTLS.MinVersion = "1.2"
+			tt.giveConfig(&cfg)
+
+			assert.NoError(t, srv.Register(context.Background(), cfg))
+
+			rr := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/foo/https/"+upstream.URL[8:], http.NoBody)
+
+			srv.server.Handler.ServeHTTP(rr, req)
+
+			if tt.wantCode == 0 {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "upstream", rr.Body.String())
+
+				return
+			}
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Contains(t, rr.Body.String(), "certificate verification failed")
+		})
+	}
+
+	for _, modify := range []func(*config.Config){
+		func(c *config.Config) { c.UpstreamTLS.CAFiles = []string{filepath.Join(t.TempDir(), "missing.pem")} },
+		func(c *config.Config) { c.UpstreamTLS.Pins = []string{"foo"} },
+		func(c *config.Config) { c.UpstreamTLS.MinVersion = "foo" },
+		func(c *config.Config) { c.UpstreamTLS.CipherSuites = []string{"foo"} },
+	} {
+		cfg := config.Config{}
+		cfg.Proxy.Prefix = "foo"
+		modify(&cfg)
+
+		assert.Error(t, NewServer(zap.NewNop()).Register(context.Background(), cfg))
+	}
+}
+
+func TestServer_RegisterWithUpstreamClientCertificate(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	upstream.StartTLS()
+
+	defer upstream.Close()
+
+	var (
+		dir      = t.TempDir()
+		certFile = filepath.Join(dir, "client.crt")
+		keyFile  = filepath.Join(dir, "client.key")
+	)
+
+	certPEM, keyPEM, err := mitm.GenerateCA("foo", time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.UpstreamTLS.Insecure = true
+	cfg.UpstreamTLS.ClientCerts = []string{"127.0.0.1=" + certFile + ":" + keyFile}
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/foo/https/"+upstream.URL[8:], http.NoBody)
+
+	srv.server.Handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "foo", rr.Body.String())
+
+	cfg.UpstreamTLS.ClientCerts = []string{"127.0.0.1=" + keyFile + ":" + certFile} // wrong order
+
+	assert.Error(t, NewServer(zap.NewNop()).Register(context.Background(), cfg))
+}
+
+func TestServer_RegisterWithParentProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	defer upstream.Close()
+
+	var tunnels atomic.Int32
+
+	parent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamConn, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		tunnels.Add(1)
+
+		conn, _, _ := w.(http.Hijacker).Hijack() //nolint:forcetypeassert
+		_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+
+		go func() { _, _ = io.Copy(upstreamConn, conn) }()
+
+		_, _ = io.Copy(conn, upstreamConn)
+		_ = conn.Close()
+	}))
+
+	defer parent.Close()
+
+	get := func(cfg config.Config) int {
+		srv := NewServer(zap.NewNop())
+		assert.NoError(t, srv.Register(context.Background(), cfg))
+
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/foo/http/"+upstream.URL[7:], http.NoBody)
+
+		srv.server.Handler.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.ParentProxy.URL = parent.URL
+
+	assert.Equal(t, http.StatusOK, get(cfg))
+	assert.EqualValues(t, 1, tunnels.Load())
+
+	cfg.ParentProxy.Rules = []string{"127.0.0.1=direct"}
+
+	assert.Equal(t, http.StatusOK, get(cfg))
+	assert.EqualValues(t, 1, tunnels.Load(), "the direct connection is used")
+
+	cfg.ParentProxy.Rules = []string{"127.0.0.1"}
+
+	assert.Error(t, NewServer(zap.NewNop()).Register(context.Background(), cfg))
+}
+
+func TestServer_RegisterWithRedirects(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/a" {
+			http.Redirect(w, r, "/b", http.StatusFound)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("b"))
+	}))
+
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.Proxy.Redirects.Mode = "pass"
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/foo/http/"+upstream.URL[7:]+"/a", http.NoBody)
+
+	srv.server.Handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "/foo/http/"+upstream.URL[7:]+"/b", rr.Header().Get("Location"))
+
+	cfg.Proxy.Redirects.Mode = "foo"
+
+	assert.Error(t, NewServer(zap.NewNop()).Register(context.Background(), cfg))
+}
+
+func TestServer_RegisterWithContentRewriting(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<img src="/logo.png">`))
+	}))
+
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.Proxy.RewriteContent = true
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/foo/http/"+upstream.URL[7:]+"/", http.NoBody)
+
+	srv.server.Handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `<img src="/foo/http/`+upstream.URL[7:]+`/logo.png">`, rr.Body.String())
+}
+
+func TestServer_RegisterWithCORS(t *testing.T) {
+	var upstreamCalls int
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}))
+
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.Auth.APIKeys = []string{"secret"}
+	cfg.Auth.APIKeyHeader = "X-Api-Key"
+	cfg.CORS.AllowedOrigins = []string{"https://*.example.com"}
+	cfg.CORS.AllowedHeaders = []string{"X-Api-Key"}
+	cfg.CORS.AllowCredentials = true
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	// preflight is answered without the authentication and upstream request
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodOptions, "/foo/http/"+upstream.URL[7:]+"/", http.NoBody)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "x-api-key")
+
+	srv.server.Handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, 0, upstreamCalls)
+
+	// authentication errors are readable by the browser scripts
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/foo/http/"+upstream.URL[7:]+"/", http.NoBody)
+	req.Header.Set("Origin", "https://app.example.com")
+
+	srv.server.Handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	// the upstream CORS headers are replaced with the policy ones
+	rr = httptest.NewRecorder()
+	req.Header.Set("X-Api-Key", "secret")
+
+	srv.server.Handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"https://app.example.com"}, rr.Header().Values("Access-Control-Allow-Origin"))
+	assert.Equal(t, 1, upstreamCalls)
+
+	cfg.CORS.AllowedOrigins = []string{"*"}
+
+	assert.Error(t, NewServer(zap.NewNop()).Register(context.Background(), cfg))
+}
+
+func TestServer_RegisterWithLimits(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("a", 2048)))
+	}))
+
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.Limits.MaxRequestBodySize = 16
+	cfg.Limits.MaxResponseBodySize = 1024
+	cfg.Limits.MaxURLLength = 128
+	cfg.Limits.MaxHeaderSize = 4096
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+	assert.Equal(t, 4096+maxHeaderBytesMargin, srv.server.MaxHeaderBytes)
+
+	for _, tt := range []struct {
+		name     string
+		givePath string
+		giveBody string
+		wantCode int
+	}{
+		{name: "url", givePath: "/" + strings.Repeat("a", 128), wantCode: http.StatusRequestURITooLong},
+		{name: "request body", givePath: "/", giveBody: strings.Repeat("a", 17), wantCode: http.StatusRequestEntityTooLarge},
+		{name: "response body", givePath: "/", wantCode: http.StatusBadGateway},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				rr  = httptest.NewRecorder()
+				req = httptest.NewRequest(http.MethodPost, "/foo/http/"+upstream.URL[7:]+tt.givePath,
+					strings.NewReader(tt.giveBody),
+				)
+			)
+
+			srv.server.Handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+		})
+	}
+}
+
+func TestServer_RegisterWithHeaderSizeLimit(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.Limits.MaxHeaderSize = 4096
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	proxyServer := httptest.NewUnstartedServer(nil)
+	proxyServer.Config = srv.server // the real server limits are applied
+	proxyServer.Start()
+
+	defer proxyServer.Close()
+
+	for _, tt := range []struct {
+		name           string
+		giveHeaderSize int
+		wantCode       int
+		wantBody       string
+	}{
+		{name: "under the limit", giveHeaderSize: 1024, wantCode: http.StatusNoContent},
+		{
+			name:           "over the limit",
+			giveHeaderSize: 32 << 10, // the server itself allows a few kilobytes over its limit
+			wantCode:       http.StatusRequestHeaderFieldsTooLarge,
+			wantBody:       "request headers are too large", // responded by the handler
+		},
+		{
+			name:           "far over the limit",
+			giveHeaderSize: 4096 + maxHeaderBytesMargin*2,
+			wantCode:       http.StatusRequestHeaderFieldsTooLarge, // responded by the server
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, proxyServer.URL+"/foo/http/"+upstream.URL[7:]+"/", http.NoBody)
+			assert.NoError(t, err)
+
+			req.Header.Set("X-Foo", strings.Repeat("a", tt.giveHeaderSize))
+
+			resp, err := proxyServer.Client().Do(req)
+			assert.NoError(t, err)
+
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.wantCode, resp.StatusCode)
+			assert.Contains(t, string(body), tt.wantBody)
+		})
+	}
+}
+
+func TestServer_RegisterWithCompression(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(strings.Repeat(`{"foo":"bar"},`, 100)))
+	}))
+
+	defer upstream.Close()
+
+	srv := NewServer(zap.NewNop())
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.Compression.Enabled = true
+	cfg.Compression.Encodings = []string{"zstd", "gzip"}
+	cfg.Compression.ContentTypes = []string{"application/json"}
+
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	var (
+		rr     = httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodGet, "/foo/http/"+upstream.URL[7:]+"/", http.NoBody)
+	)
+
+	req.Header.Set("Accept-Encoding", "br, gzip")
+
+	srv.server.Handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+
+	cfg.Compression.Encodings = []string{"deflate"}
+
+	assert.Error(t, NewServer(zap.NewNop()).Register(context.Background(), cfg))
+}
+
+// startInterceptingProxy starts the forward-proxy, that intercepts all the tunnels (the configuration can be modified
+// by the modify function). The proxy URL and the MITM CA pool (for the clients) are returned.
+func startInterceptingProxy(t *testing.T, modify func(*config.Config)) (*url.URL, *x509.CertPool) {
+	t.Helper()
+
+	var (
+		dir      = t.TempDir()
+		certFile = filepath.Join(dir, "ca.crt")
+		keyFile  = filepath.Join(dir, "ca.key")
+	)
+
+	certPEM, keyPEM, err := mitm.GenerateCA("foo", time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	roots := x509.NewCertPool()
+	assert.True(t, roots.AppendCertsFromPEM(certPEM))
+
+	cfg := config.Config{}
+	cfg.Proxy.Prefix = "foo"
+	cfg.ForwardProxy.Enabled = true
+	cfg.ForwardProxy.MITM.Enabled = true
+	cfg.ForwardProxy.MITM.CACertFile = certFile
+	cfg.ForwardProxy.MITM.CAKeyFile = keyFile
+	cfg.ForwardProxy.MITM.Hosts = []string{"*"}
+	cfg.UpstreamTLS.Insecure = true
+	modify(&cfg)
+
+	srv := NewServer(zap.NewNop())
+	assert.NoError(t, srv.Register(context.Background(), cfg))
+
+	proxyServer := httptest.NewServer(srv.server.Handler)
+	t.Cleanup(proxyServer.Close)
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+
+	return proxyURL, roots
+}
+
+// interceptedClient creates the HTTP client, that sends the requests through the single intercepted tunnel.
+func interceptedClient(proxyURL *url.URL, roots *x509.CertPool, connectHeader http.Header) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		Proxy:               http.ProxyURL(proxyURL),
+		ProxyConnectHeader:  connectHeader,
+		TLSClientConfig:     &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+		MaxConnsPerHost:     1,
+		MaxIdleConnsPerHost: 1,
+	}}
+}
+
+func TestServer_RegisterWithMITMPermissions(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Method))
+	}))
+
+	defer upstream.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(jwksFile, []byte(`{"keys":[{"kty":"EC","kid":"k1","crv":"P-256","x":"`+
+		base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32)))+`","y":"`+
+		base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32)))+`"}]}`), 0o600))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"sub":   "alice",
+		"iss":   "issuer",
+		"aud":   "proxy",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "proxy:method:GET proxy:method:CONNECT",
+	})
+	token.Header["kid"] = "k1"
+
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+
+	proxyURL, roots := startInterceptingProxy(t, func(cfg *config.Config) {
+		cfg.Auth.JWT.JWKS = jwksFile
+		cfg.Auth.JWT.Issuer = "issuer"
+		cfg.Auth.JWT.Audience = "proxy"
+		cfg.Auth.JWT.PermissionsClaim = "scope"
+	})
+
+	client := interceptedClient(proxyURL, roots, http.Header{"Proxy-Authorization": {"Bearer " + signed}})
+
+	for _, tt := range []struct {
+		giveMethod string
+		wantCode   int
+	}{
+		{giveMethod: http.MethodGet, wantCode: http.StatusOK},
+		{giveMethod: http.MethodDelete, wantCode: http.StatusForbidden},
+		{giveMethod: http.MethodPost, wantCode: http.StatusForbidden},
+	} {
+		req, _ := http.NewRequest(tt.giveMethod, upstream.URL, http.NoBody)
+
+		resp, reqErr := client.Do(req)
+		assert.NoError(t, reqErr)
+
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, tt.wantCode, resp.StatusCode, tt.giveMethod)
+
+		if tt.wantCode == http.StatusOK {
+			assert.Equal(t, tt.giveMethod, string(body))
+		} else {
+			assert.Contains(t, string(body), "is not permitted for the client")
+		}
+	}
+}
+
+func TestServer_RegisterWithMITMRateLimit(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("upstream"))
+	}))
+
+	defer upstream.Close()
+
+	proxyURL, roots := startInterceptingProxy(t, func(cfg *config.Config) {
+		cfg.RateLimit.Limit = "3/m" // the CONNECT request is counted too
+	})
+
+	client := interceptedClient(proxyURL, roots, nil)
+
+	for i, wantCode := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		resp, err := client.Get(upstream.URL)
+		assert.NoError(t, err)
+
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, wantCode, resp.StatusCode, "request %d", i)
+	}
+}
+
+func TestServer_RegisterWithMITMAdmission(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("upstream"))
+	}))
+
+	defer upstream.Close()
+
+	proxyURL, roots := startInterceptingProxy(t, func(cfg *config.Config) {
+		cfg.Admission.MaxInFlight = 1 // the only slot is held by the open tunnel
+	})
+
+	resp, err := interceptedClient(proxyURL, roots, nil).Get(upstream.URL)
+	assert.NoError(t, err)
+
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	assert.Contains(t, string(body), "server is busy")
+}
@@ -0,0 +1,500 @@
+// Package httpcache contains the shared HTTP responses cache (RFC 9111).
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type httpClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+type metrics interface {
+	IncrementHits()
+	IncrementMisses()
+	IncrementStale()
+}
+
+// Client is an HTTP client with the shared responses cache (RFC 9111). Only GET requests are served from the cache.
+// Responses are marked using the "X-Cache" header with the "HIT", "MISS" or "STALE" value.
+type Client struct {
+	ctx          context.Context
+	log          *zap.Logger
+	next         httpClient
+	storage      Storage
+	m            metrics
+	maxEntrySize int64
+
+	mu           sync.Mutex
+	revalidating map[string]struct{} // keys of the responses, that are revalidating in background
+}
+
+const (
+	// HeaderName is the cache status response header name.
+	HeaderName = "X-Cache"
+
+	statusHit   = "HIT"
+	statusMiss  = "MISS"
+	statusStale = "STALE"
+
+	backgroundRevalidationTimeout = time.Second * 30
+	storageTimeout                = time.Second * 5 // for the storage operations without the request context
+)
+
+// NewClient creates a new caching Client. Responses with the body larger than maxEntrySize are not stored. The
+// context is used for the background revalidation requests and storage operations.
+func NewClient(
+	ctx context.Context,
+	log *zap.Logger,
+	next httpClient,
+	storage Storage,
+	m metrics,
+	maxEntrySize int64,
+) *Client {
+	return &Client{
+		ctx:          ctx,
+		log:          log,
+		next:         next,
+		storage:      storage,
+		m:            m,
+		maxEntrySize: maxEntrySize,
+		revalidating: make(map[string]struct{}),
+	}
+}
+
+// Do sends the request or serves it from the cache.
+func (c *Client) Do(req *http.Request) (*http.Response, error) { //nolint:funlen
+	if req.Method != http.MethodGet {
+		resp, err := c.next.Do(req)
+
+		// unsafe methods invalidate the stored responses (RFC 9111, section 4.4)
+		if err == nil && isUnsafe(req.Method) && resp.StatusCode < http.StatusBadRequest {
+			c.invalidate(req.Context(), cacheKey(req))
+		}
+
+		return resp, err
+	}
+
+	var reqCC = parseCacheControl(req.Header)
+
+	// upgrades (WebSocket) and partial content are not supported
+	if req.Header.Get("Upgrade") != "" || req.Header.Get("Range") != "" || reqCC.has("no-store") {
+		return c.fetch(req)
+	}
+
+	var (
+		key = cacheKey(req)
+		e   = c.lookup(req, key)
+	)
+
+	if e == nil {
+		if reqCC.has("only-if-cached") {
+			c.m.IncrementMisses()
+
+			return newResponse(req, http.StatusGatewayTimeout, http.Header{HeaderName: {statusMiss}}, nil), nil
+		}
+
+		return c.fetch(req)
+	}
+
+	var (
+		now       = time.Now()
+		age       = e.age(now)
+		lifetime  = e.freshnessLifetime()
+		respCC    = parseCacheControl(e.header)
+		noCache   = respCC.has("no-cache") || reqCC.has("no-cache")
+		fresh     = age < lifetime
+		staleness = age - lifetime
+		// "s-maxage" implies "proxy-revalidate" for the shared caches
+		canServeStale = !noCache && !respCC.has("must-revalidate") && !respCC.has("proxy-revalidate") &&
+			!respCC.has("s-maxage")
+	)
+
+	if maxAge, ok := reqCC.duration("max-age"); ok && age > maxAge {
+		fresh = false
+	}
+
+	if fresh && !noCache {
+		c.m.IncrementHits()
+
+		return serve(req, e, age, statusHit), nil
+	}
+
+	if swr, ok := respCC.duration("stale-while-revalidate"); ok && canServeStale && staleness <= swr {
+		c.revalidateInBackground(req, e)
+		c.m.IncrementStale()
+
+		return serve(req, e, age, statusStale), nil
+	}
+
+	resp, err := c.revalidate(req, e)
+
+	if sie, ok := respCC.duration("stale-if-error"); ok && canServeStale && staleness <= sie && isError(resp, err) {
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+
+		c.m.IncrementStale()
+
+		return serve(req, e, e.age(time.Now()), statusStale), nil
+	}
+
+	return resp, err
+}
+
+// fetch sends the request and stores the response, if it is possible.
+func (c *Client) fetch(req *http.Request) (*http.Response, error) {
+	c.m.IncrementMisses()
+
+	var requestTime = time.Now()
+
+	resp, err := c.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.storeOnRead(req, resp, requestTime, time.Now())
+	resp.Header.Set(HeaderName, statusMiss)
+
+	return resp, nil
+}
+
+// revalidate sends the conditional request (RFC 9111, section 4.3.1) and updates the stored response.
+func (c *Client) revalidate(req *http.Request, e *entry) (*http.Response, error) {
+	var conditional = req.Clone(req.Context())
+
+	if etag := e.header.Get("ETag"); etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+
+	if lastModified := e.header.Get("Last-Modified"); lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	var requestTime = time.Now()
+
+	resp, err := c.next.Do(conditional)
+	if err != nil {
+		c.m.IncrementMisses()
+
+		return nil, err
+	}
+
+	var responseTime = time.Now()
+
+	if resp.StatusCode == http.StatusNotModified && e.hasValidators() {
+		_ = resp.Body.Close()
+
+		updated := e.updated(resp, requestTime, responseTime)
+		c.put(updated)
+		c.m.IncrementHits()
+
+		return serve(req, updated, updated.age(responseTime), statusHit), nil
+	}
+
+	c.m.IncrementMisses()
+
+	if !isError(resp, nil) {
+		c.storeOnRead(req, resp, requestTime, responseTime)
+	}
+
+	resp.Header.Set(HeaderName, statusMiss)
+
+	return resp, nil
+}
+
+// revalidateInBackground revalidates the stored response without blocking the caller (only one background
+// revalidation per key at a time).
+func (c *Client) revalidateInBackground(req *http.Request, e *entry) {
+	c.mu.Lock()
+
+	if _, exists := c.revalidating[e.key]; exists {
+		c.mu.Unlock()
+
+		return
+	}
+
+	c.revalidating[e.key] = struct{}{}
+	c.mu.Unlock()
+
+	// the client request context is canceled as soon as the response is sent
+	ctx, cancel := context.WithTimeout(c.ctx, backgroundRevalidationTimeout)
+
+	bgReq := req.Clone(ctx)
+	bgReq.Body, bgReq.ContentLength = http.NoBody, 0
+
+	go func() {
+		defer func() {
+			cancel()
+
+			c.mu.Lock()
+			delete(c.revalidating, e.key)
+			c.mu.Unlock()
+		}()
+
+		if resp, err := c.revalidate(bgReq, e); err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body) // the response is stored after the body reading
+			_ = resp.Body.Close()
+		}
+	}()
+}
+
+// lookup returns the stored response variant, that matches the request (or nil).
+func (c *Client) lookup(req *http.Request, key string) *entry {
+	entries, err := c.load(req.Context(), key)
+	if err != nil {
+		c.log.Warn("Cached response reading failed", zap.String("key", key), zap.Error(err))
+
+		return nil
+	}
+
+	for _, e := range entries {
+		if e.matches(req) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// put stores the response. The stored variant with the same "Vary" headers values is replaced.
+func (c *Client) put(e *entry) {
+	ctx, cancel := context.WithTimeout(c.ctx, storageTimeout)
+	defer cancel()
+
+	entries, err := c.load(ctx, e.key)
+	if err != nil { // broken value will be overwritten
+		c.log.Warn("Cached response reading failed", zap.String("key", e.key), zap.Error(err))
+	}
+
+	var variants = []*entry{e} // the most recent variant goes first
+
+	for _, stored := range entries {
+		if !sameVary(stored, e) {
+			variants = append(variants, stored)
+		}
+	}
+
+	value, err := encodeEntries(variants)
+	if err == nil {
+		err = c.storage.Set(ctx, e.key, value)
+	}
+
+	if err != nil {
+		c.log.Warn("Response caching failed", zap.String("key", e.key), zap.Error(err))
+	}
+}
+
+// invalidate removes all the response variants.
+func (c *Client) invalidate(ctx context.Context, key string) {
+	if err := c.storage.Delete(ctx, key); err != nil {
+		c.log.Warn("Cached response invalidation failed", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// load returns all the stored response variants (nil, if there is nothing stored).
+func (c *Client) load(ctx context.Context, key string) ([]*entry, error) {
+	value, err := c.storage.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return decodeEntries(value)
+}
+
+// storeOnRead makes the response stored, when its body is completely read by the caller (if the response is
+// storable).
+func (c *Client) storeOnRead(req *http.Request, resp *http.Response, requestTime, responseTime time.Time) {
+	if !isStorable(req, resp) || resp.ContentLength > c.maxEntrySize {
+		return
+	}
+
+	var e = &entry{
+		key:          cacheKey(req),
+		vary:         make(http.Header),
+		status:       resp.StatusCode,
+		header:       resp.Header.Clone(),
+		requestTime:  requestTime,
+		responseTime: responseTime,
+	}
+
+	for _, value := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				e.vary.Set(name, headerValue(req.Header, name))
+			}
+		}
+	}
+
+	// such response cannot be reused
+	if cc := parseCacheControl(resp.Header); e.freshnessLifetime() <= 0 && !e.hasValidators() &&
+		!cc.has("stale-while-revalidate") && !cc.has("stale-if-error") {
+		return
+	}
+
+	resp.Body = &teeBody{ReadCloser: resp.Body, limit: c.maxEntrySize, onEOF: func(body []byte) {
+		e.body = body
+		c.put(e)
+	}}
+}
+
+// isStorable reports whether the response can be stored in the shared cache (RFC 9111, section 3).
+func isStorable(req *http.Request, resp *http.Response) bool {
+	// personalized (with cookies) responses must not be shared, and the responses for the redirected requests are
+	// stored under another URL
+	switch {
+	case resp.StatusCode < http.StatusOK,
+		resp.StatusCode == http.StatusPartialContent,
+		resp.StatusCode == http.StatusNotModified,
+		resp.Header.Get("Set-Cookie") != "",
+		resp.Request != nil && resp.Request.URL.String() != req.URL.String():
+		return false
+	}
+
+	for _, value := range resp.Header.Values("Vary") {
+		if strings.TrimSpace(value) == "*" {
+			return false
+		}
+	}
+
+	var cc = parseCacheControl(resp.Header)
+
+	if cc.has("no-store") || cc.has("private") {
+		return false
+	}
+
+	if req.Header.Get("Authorization") != "" {
+		return cc.has("public") || cc.has("s-maxage") || cc.has("must-revalidate")
+	}
+
+	return true
+}
+
+// isError reports whether the request was failed (including the server errors), so the stale response can be used.
+func isError(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+func isUnsafe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+
+	return true
+}
+
+// cacheKey returns the primary cache key (the GET method is implied).
+func cacheKey(req *http.Request) string { return req.URL.String() }
+
+// serve creates the response using the stored one. Conditional requests are evaluated (RFC 9110, section 13).
+func serve(req *http.Request, e *entry, age time.Duration, status string) *http.Response {
+	var header = e.header.Clone()
+
+	header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	header.Set(HeaderName, status)
+
+	if notModified(req, e) {
+		header.Del("Content-Length")
+
+		return newResponse(req, http.StatusNotModified, header, nil)
+	}
+
+	return newResponse(req, e.status, header, e.body)
+}
+
+// notModified reports whether the stored response matches the request conditions ("If-None-Match" or
+// "If-Modified-Since" headers).
+func notModified(req *http.Request, e *entry) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		etag := strings.TrimPrefix(e.header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+
+		for _, candidate := range strings.Split(ifNoneMatch, ",") { // weak comparison
+			if candidate = strings.TrimSpace(candidate); candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	lastModified, err := http.ParseTime(e.header.Get("Last-Modified"))
+
+	return err == nil && !lastModified.After(ifModifiedSince)
+}
+
+func newResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// teeBody buffers the read body (up to the limit) and calls the onEOF function, when the body is completely read.
+type teeBody struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	limit    int64
+	overflow bool
+	done     bool
+	onEOF    func(body []byte)
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	if !b.overflow && n > 0 {
+		if int64(b.buf.Len()+n) > b.limit {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF && !b.overflow && !b.done { //nolint:errorlint
+		b.done = true
+		b.onEOF(b.buf.Bytes())
+	}
+
+	return n, err
+}
@@ -0,0 +1,376 @@
+package httpcache_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/httpcache"
+)
+
+type fakeMetrics struct {
+	mu                  sync.Mutex
+	hits, misses, stale int
+}
+
+func (m *fakeMetrics) IncrementHits()   { m.mu.Lock(); m.hits++; m.mu.Unlock() }
+func (m *fakeMetrics) IncrementMisses() { m.mu.Lock(); m.misses++; m.mu.Unlock() }
+func (m *fakeMetrics) IncrementStale()  { m.mu.Lock(); m.stale++; m.mu.Unlock() }
+
+type doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// newClient creates the caching Client with the 1KiB maximal entry size.
+func newClient(next doer, storage httpcache.Storage, m *fakeMetrics) *httpcache.Client {
+	return httpcache.NewClient(context.Background(), zap.NewNop(), next, storage, m, 1<<10)
+}
+
+// do sends the GET request using the client and returns the response with the read body.
+func do(t *testing.T, c *httpcache.Client, url string, header http.Header) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	assert.NoError(t, err)
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.Do(req)
+	assert.NoError(t, err)
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	return resp, string(body)
+}
+
+func TestClient_DoFreshResponse(t *testing.T) {
+	var calls int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("response " + strconv.Itoa(int(n))))
+	}))
+	defer upstream.Close()
+
+	var (
+		m     = fakeMetrics{}
+		store = httpcache.NewMemory(1 << 20)
+		c     = newClient(upstream.Client(), store, &m)
+	)
+
+	resp, body := do(t, c, upstream.URL, nil)
+	assert.Equal(t, "MISS", resp.Header.Get(httpcache.HeaderName))
+	assert.Equal(t, "response 1", body)
+
+	resp, body = do(t, c, upstream.URL, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "HIT", resp.Header.Get(httpcache.HeaderName))
+	assert.Equal(t, "0", resp.Header.Get("Age"))
+	assert.Equal(t, "response 1", body)
+
+	// the client requires the response from the origin
+	resp, body = do(t, c, upstream.URL, http.Header{"Cache-Control": {"no-cache"}})
+	assert.Equal(t, "MISS", resp.Header.Get(httpcache.HeaderName))
+	assert.Equal(t, "response 2", body)
+
+	// other URL
+	resp, _ = do(t, c, upstream.URL+"/foo", nil)
+	assert.Equal(t, "MISS", resp.Header.Get(httpcache.HeaderName))
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, 2, store.Len())
+	assert.Equal(t, 1, m.hits)
+	assert.Equal(t, 3, m.misses)
+}
+
+func TestClient_DoNotStorable(t *testing.T) {
+	const lastModified = "Mon, 01 Jan 2001 00:00:00 GMT"
+
+	for _, tt := range []struct {
+		name         string
+		giveHeader   http.Header
+		giveReqAuth  bool
+		giveStatus   int
+		wantToBeUsed bool
+	}{
+		{name: "no-store", giveHeader: http.Header{"Cache-Control": {"no-store, max-age=60"}}},
+		{name: "private", giveHeader: http.Header{"Cache-Control": {"private, max-age=60"}}},
+		{name: "vary by all", giveHeader: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}},
+		{name: "with cookie", giveHeader: http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"a=b"}}},
+		{name: "without freshness", giveHeader: http.Header{}},
+		{name: "not heuristically cacheable status", giveHeader: http.Header{"Last-Modified": {lastModified}},
+			giveStatus: http.StatusInternalServerError},
+		{name: "heuristic freshness", giveHeader: http.Header{"Last-Modified": {lastModified}}, wantToBeUsed: true},
+		{name: "authorized request", giveHeader: http.Header{"Cache-Control": {"max-age=60"}}, giveReqAuth: true},
+		{name: "public authorized request", giveHeader: http.Header{"Cache-Control": {"public, max-age=60"}},
+			giveReqAuth: true, wantToBeUsed: true},
+		{name: "fresh", giveHeader: http.Header{"Cache-Control": {"max-age=60"}}, wantToBeUsed: true},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for name, values := range tt.giveHeader {
+					w.Header()[name] = values
+				}
+
+				if tt.giveStatus != 0 {
+					w.WriteHeader(tt.giveStatus)
+				}
+			}))
+			defer upstream.Close()
+
+			var (
+				store  = httpcache.NewMemory(1 << 20)
+				c      = newClient(upstream.Client(), store, &fakeMetrics{})
+				header = http.Header{}
+			)
+
+			if tt.giveReqAuth {
+				header.Set("Authorization", "Basic Zm9vOmJhcg==")
+			}
+
+			_, _ = do(t, c, upstream.URL, header)
+			resp, _ := do(t, c, upstream.URL, header)
+
+			assert.Equal(t, tt.wantToBeUsed, resp.Header.Get(httpcache.HeaderName) == "HIT")
+		})
+	}
+}
+
+func TestClient_DoVary(t *testing.T) {
+	var calls int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte("lang " + r.Header.Get("Accept-Language")))
+	}))
+	defer upstream.Close()
+
+	var (
+		store = httpcache.NewMemory(1 << 20)
+		c     = newClient(upstream.Client(), store, &fakeMetrics{})
+		en    = http.Header{"Accept-Language": {"en"}}
+		de    = http.Header{"Accept-Language": {"de"}}
+	)
+
+	_, body := do(t, c, upstream.URL, en)
+	assert.Equal(t, "lang en", body)
+
+	_, body = do(t, c, upstream.URL, de)
+	assert.Equal(t, "lang de", body)
+
+	resp, body := do(t, c, upstream.URL, en)
+	assert.Equal(t, "HIT", resp.Header.Get(httpcache.HeaderName))
+	assert.Equal(t, "lang en", body)
+
+	resp, body = do(t, c, upstream.URL, de)
+	assert.Equal(t, "HIT", resp.Header.Get(httpcache.HeaderName))
+	assert.Equal(t, "lang de", body)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, 1, store.Len(), "variants are stored together")
+}
+
+func TestClient_DoRevalidation(t *testing.T) {
+	var calls, notModified int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer upstream.Close()
+
+	var (
+		m = fakeMetrics{}
+		c = newClient(upstream.Client(), httpcache.NewMemory(1<<20), &m)
+	)
+
+	resp, body := do(t, c, upstream.URL, nil)
+	assert.Equal(t, "MISS", resp.Header.Get(httpcache.HeaderName))
+	assert.Equal(t, "content", body)
+
+	resp, body = do(t, c, upstream.URL, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "HIT", resp.Header.Get(httpcache.HeaderName))
+	assert.Equal(t, "content", body)
+
+	// conditional request from the client is evaluated using the cached response
+	resp, body = do(t, c, upstream.URL, http.Header{"If-None-Match": {`W/"v1"`}})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Empty(t, body)
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&notModified))
+	assert.Equal(t, 2, m.hits)
+	assert.Equal(t, 1, m.misses)
+}
+
+func TestClient_DoStaleIfError(t *testing.T) {
+	var failing int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer upstream.Close()
+
+	var (
+		m = fakeMetrics{}
+		c = newClient(upstream.Client(), httpcache.NewMemory(1<<20), &m)
+	)
+
+	_, _ = do(t, c, upstream.URL, nil)
+
+	atomic.StoreInt32(&failing, 1)
+
+	resp, body := do(t, c, upstream.URL, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "STALE", resp.Header.Get(httpcache.HeaderName))
+	assert.Equal(t, "content", body)
+	assert.Equal(t, 1, m.stale)
+}
+
+func TestClient_DoStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		_, _ = w.Write([]byte("response " + strconv.Itoa(int(n))))
+	}))
+	defer upstream.Close()
+
+	var c = newClient(upstream.Client(), httpcache.NewMemory(1<<20), &fakeMetrics{})
+
+	_, _ = do(t, c, upstream.URL, nil)
+
+	resp, body := do(t, c, upstream.URL, nil)
+	assert.Equal(t, "STALE", resp.Header.Get(httpcache.HeaderName))
+	assert.Equal(t, "response 1", body)
+
+	// the response is updated in background
+	assert.Eventually(t, func() bool {
+		_, body = do(t, c, upstream.URL, nil)
+
+		return body == "response 2"
+	}, time.Second*2, time.Millisecond*5)
+}
+
+func TestClient_DoOnlyIfCached(t *testing.T) {
+	var c = newClient(http.DefaultClient, httpcache.NewMemory(1<<20), &fakeMetrics{})
+
+	resp, _ := do(t, c, "http://127.0.0.1:1/", http.Header{"Cache-Control": {"only-if-cached"}})
+
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+}
+
+func TestClient_DoInvalidation(t *testing.T) {
+	var calls int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		w.Header().Set("Cache-Control", "max-age=60")
+	}))
+	defer upstream.Close()
+
+	var (
+		store = httpcache.NewMemory(1 << 20)
+		c     = newClient(upstream.Client(), store, &fakeMetrics{})
+	)
+
+	_, _ = do(t, c, upstream.URL, nil)
+	assert.Equal(t, 1, store.Len())
+
+	req, _ := http.NewRequest(http.MethodPost, upstream.URL, http.NoBody)
+	resp, err := c.Do(req)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestClient_DoSizeLimits(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write(make([]byte, size))
+	}))
+	defer upstream.Close()
+
+	var (
+		store = httpcache.NewMemory(3 << 10)
+		c     = newClient(upstream.Client(), store, &fakeMetrics{})
+	)
+
+	// too large entry is not stored
+	_, _ = do(t, c, upstream.URL+"?size=2048", nil)
+	assert.Equal(t, 0, store.Len())
+
+	for i := 0; i < 5; i++ {
+		_, _ = do(t, c, upstream.URL+"?size=1000&n="+strconv.Itoa(i), nil)
+	}
+
+	assert.LessOrEqual(t, store.Size(), int64(3<<10))
+	assert.Equal(t, 2, store.Len())
+
+	// the least recently used entries are evicted
+	resp, _ := do(t, c, upstream.URL+"?size=1000&n=4", nil)
+	assert.Equal(t, "HIT", resp.Header.Get(httpcache.HeaderName))
+
+	resp, _ = do(t, c, upstream.URL+"?size=1000&n=0", nil)
+	assert.Equal(t, "MISS", resp.Header.Get(httpcache.HeaderName))
+}
+
+type failingClient struct{}
+
+func (failingClient) Do(*http.Request) (*http.Response, error) { return nil, errors.New("boom") }
+
+func TestClient_DoError(t *testing.T) {
+	var c = newClient(failingClient{}, httpcache.NewMemory(1<<20), &fakeMetrics{})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+
+	resp, err := c.Do(req)
+
+	assert.Nil(t, resp)
+	assert.EqualError(t, err, "boom")
+}
@@ -0,0 +1,79 @@
+package httpcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net/http"
+	"time"
+)
+
+// record is the entry representation for the encoding (gob requires exported fields).
+type record struct {
+	Key          string
+	Vary         http.Header
+	Status       int
+	Header       http.Header
+	Body         []byte
+	RequestTime  time.Time
+	ResponseTime time.Time
+}
+
+// encodeEntries encodes the response variants.
+func encodeEntries(entries []*entry) ([]byte, error) {
+	var records = make([]record, 0, len(entries))
+
+	for _, e := range entries {
+		records = append(records, record{
+			Key:          e.key,
+			Vary:         e.vary,
+			Status:       e.status,
+			Header:       e.header,
+			Body:         e.body,
+			RequestTime:  e.requestTime,
+			ResponseTime: e.responseTime,
+		})
+	}
+
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(records); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeEntries decodes the response variants, encoded using encodeEntries.
+func decodeEntries(data []byte) ([]*entry, error) {
+	var records []record
+
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&records); err != nil {
+		return nil, err
+	}
+
+	var entries = make([]*entry, 0, len(records))
+
+	for _, r := range records {
+		e := &entry{
+			key:          r.Key,
+			vary:         r.Vary,
+			status:       r.Status,
+			header:       r.Header,
+			body:         r.Body,
+			requestTime:  r.RequestTime,
+			responseTime: r.ResponseTime,
+		}
+
+		if e.vary == nil { // gob does not distinguish empty and nil maps
+			e.vary = make(http.Header)
+		}
+
+		if e.header == nil {
+			e.header = make(http.Header)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,60 @@
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// directives are the "Cache-Control" header directives (names are lower-cased).
+type directives map[string]string
+
+// parseCacheControl parses all the "Cache-Control" header values. The "Pragma: no-cache" is treated as "no-cache"
+// directive, if the "Cache-Control" header is not present.
+func parseCacheControl(h http.Header) directives {
+	var d = make(directives)
+
+	for _, value := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				d[name] = strings.Trim(strings.TrimSpace(arg), `"`)
+			}
+		}
+	}
+
+	if len(d) == 0 {
+		for _, value := range h.Values("Pragma") {
+			if strings.EqualFold(strings.TrimSpace(value), "no-cache") {
+				d["no-cache"] = ""
+			}
+		}
+	}
+
+	return d
+}
+
+// has reports whether the directive is present.
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+
+	return ok
+}
+
+// duration returns the directive argument in seconds as a duration. False is returned, if the directive is not present
+// or its argument is invalid.
+func (d directives) duration(name string) (time.Duration, bool) {
+	arg, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+
+	seconds, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
@@ -0,0 +1,353 @@
+package httpcache
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Disk is the Storage, that keeps the values in the directory files with the LRU eviction by the total size. Files
+// are addressed by the key hash (SHA-256) and contain the key itself, so the index (keys, sizes and the usage order)
+// is restored by the directory scanning on start.
+type Disk struct {
+	dir     string
+	maxSize int64
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List               // the most recently used items are at the front (*diskItem)
+	index map[string]*list.Element // key => LRU element
+}
+
+type diskItem struct {
+	key  string
+	path string
+	size int64 // file size
+}
+
+const (
+	diskFormatVersion byte = 1
+	diskTempPrefix         = ".tmp-"
+	diskDirPerm            = 0o750
+	diskMaxKeyLength       = 1 << 16
+)
+
+// NewDisk creates a new Disk storage in the directory (it will be created, if needed) with the maximal total size
+// in bytes. Existing files are indexed.
+func NewDisk(dir string, maxSize int64) (*Disk, error) {
+	if err := os.MkdirAll(dir, diskDirPerm); err != nil {
+		return nil, err
+	}
+
+	s := &Disk{dir: dir, maxSize: maxSize, lru: list.New(), index: make(map[string]*list.Element)}
+
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("cache directory indexing failed: %w", err)
+	}
+
+	return s, nil
+}
+
+// Len returns the count of stored values.
+func (s *Disk) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lru.Len()
+}
+
+// Size returns the total size of stored files in bytes.
+func (s *Disk) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// Get implements Storage interface.
+func (s *Disk) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+
+	el, ok := s.index[key]
+	if !ok {
+		s.mu.Unlock()
+
+		return nil, ErrNotFound
+	}
+
+	s.lru.MoveToFront(el)
+	path := el.Value.(*diskItem).path //nolint:forcetypeassert
+	s.mu.Unlock()
+
+	storedKey, value, err := readDiskFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) { // removed concurrently
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	if storedKey != key {
+		return nil, ErrNotFound
+	}
+
+	var now = time.Now()
+
+	_ = os.Chtimes(path, now, now) // the usage order is restored using the modification time
+
+	return value, nil
+}
+
+// Set implements Storage interface. Values larger than the storage size are not stored.
+func (s *Disk) Set(ctx context.Context, key string, value []byte) error {
+	var (
+		path = s.path(key)
+		size = diskFileSize(key, value)
+	)
+
+	if size > s.maxSize || len(key) > diskMaxKeyLength {
+		return s.Delete(ctx, key)
+	}
+
+	if err := writeDiskFile(path, key, value); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.index[key]; ok {
+		s.size -= el.Value.(*diskItem).size //nolint:forcetypeassert
+		s.lru.Remove(el)
+	}
+
+	s.index[key] = s.lru.PushFront(&diskItem{key: key, path: path, size: size})
+	s.size += size
+
+	return s.evict()
+}
+
+// Delete implements Storage interface.
+func (s *Disk) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := s.index[key]; ok {
+			if err := s.remove(el); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Keys implements Storage interface.
+func (s *Disk) Keys(context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys = make([]string, 0, len(s.index))
+
+	for key := range s.index {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// path returns the file path for the key (files are distributed between 256 subdirectories).
+func (s *Disk) path(key string) string {
+	var (
+		hash = sha256.Sum256([]byte(key))
+		name = hex.EncodeToString(hash[:])
+	)
+
+	return filepath.Join(s.dir, name[:2], name)
+}
+
+// load indexes the existing files. Broken and temporary files are removed.
+func (s *Disk) load() error {
+	type found struct {
+		item    *diskItem
+		modTime time.Time
+	}
+
+	var files []found
+
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		if strings.HasPrefix(d.Name(), diskTempPrefix) { // interrupted writing
+			return os.Remove(path)
+		}
+
+		if len(d.Name()) != sha256.Size*2 { //nolint:gomnd // foreign file (hex encoded hash is expected)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		key, err := readDiskKey(path)
+		if err != nil || s.path(key) != path {
+			return os.Remove(path)
+		}
+
+		files = append(files, found{item: &diskItem{key: key, path: path, size: info.Size()}, modTime: info.ModTime()})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	for _, f := range files { // the most recently used files go to the front
+		s.index[f.item.key] = s.lru.PushFront(f.item)
+		s.size += f.item.size
+	}
+
+	return s.evict()
+}
+
+// evict removes the least recently used files, while the size limit is exceeded. The mutex must be locked.
+func (s *Disk) evict() error {
+	for s.size > s.maxSize && s.lru.Len() > 0 {
+		if err := s.remove(s.lru.Back()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remove removes the file and its LRU element. The mutex must be locked.
+func (s *Disk) remove(el *list.Element) error {
+	item := s.lru.Remove(el).(*diskItem) //nolint:forcetypeassert
+
+	s.size -= item.size
+	delete(s.index, item.key)
+
+	if err := os.Remove(item.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// diskFileSize returns the size of the file with the key and value.
+func diskFileSize(key string, value []byte) int64 {
+	var varint [binary.MaxVarintLen64]byte
+
+	return int64(1 + binary.PutUvarint(varint[:], uint64(len(key))) + len(key) + len(value))
+}
+
+// writeDiskFile atomically writes the file (using the temporary file renaming). File format: version byte, key
+// length (uvarint), key and value.
+func writeDiskFile(path, key string, value []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), diskDirPerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), diskTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = os.Remove(tmp.Name()) }() // no-op after the successful renaming
+
+	var header = make([]byte, 1, 1+binary.MaxVarintLen64)
+
+	header[0] = diskFormatVersion
+	header = binary.AppendUvarint(header, uint64(len(key)))
+
+	w := bufio.NewWriter(tmp)
+	_, _ = w.Write(header)
+	_, _ = w.WriteString(key)
+	_, _ = w.Write(value)
+
+	if err = w.Flush(); err != nil {
+		_ = tmp.Close()
+
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// readDiskFile reads the key and value from the file.
+func readDiskFile(path string) (string, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(data) == 0 || data[0] != diskFormatVersion {
+		return "", nil, errors.New("unsupported cache file format")
+	}
+
+	keyLen, n := binary.Uvarint(data[1:])
+	if n <= 0 || keyLen > diskMaxKeyLength || uint64(len(data)-1-n) < keyLen {
+		return "", nil, errors.New("broken cache file")
+	}
+
+	var keyEnd = 1 + n + int(keyLen)
+
+	return string(data[1+n : keyEnd]), data[keyEnd:], nil
+}
+
+// readDiskKey reads only the key from the file.
+func readDiskKey(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() { _ = f.Close() }()
+
+	r := bufio.NewReader(f)
+
+	if version, readErr := r.ReadByte(); readErr != nil || version != diskFormatVersion {
+		return "", errors.New("unsupported cache file format")
+	}
+
+	keyLen, err := binary.ReadUvarint(r)
+	if err != nil || keyLen > diskMaxKeyLength {
+		return "", errors.New("broken cache file")
+	}
+
+	var key = make([]byte, keyLen)
+
+	if _, err = io.ReadFull(r, key); err != nil {
+		return "", err
+	}
+
+	return string(key), nil
+}
@@ -0,0 +1,158 @@
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// entry is a stored response. Entries are immutable, so they can be shared between the goroutines.
+type entry struct {
+	key          string      // primary cache key
+	vary         http.Header // request headers, nominated by the response "Vary" header
+	status       int
+	header       http.Header
+	body         []byte
+	requestTime  time.Time // when the request (that produced the response) was sent
+	responseTime time.Time // when the response was received
+}
+
+const maxHeuristicFreshness = time.Hour * 24
+
+// heuristicallyCacheable are the status codes, that are cacheable by default (RFC 9110, section 15.1).
+var heuristicallyCacheable = map[int]struct{}{ //nolint:gochecknoglobals
+	http.StatusOK: {}, http.StatusNonAuthoritativeInfo: {}, http.StatusNoContent: {}, http.StatusMultipleChoices: {},
+	http.StatusMovedPermanently: {}, http.StatusPermanentRedirect: {}, http.StatusNotFound: {},
+	http.StatusMethodNotAllowed: {}, http.StatusGone: {}, http.StatusRequestURITooLong: {},
+	http.StatusNotImplemented: {},
+}
+
+// date returns the "Date" header value (or the response time, if the header is missing or invalid).
+func (e *entry) date() time.Time {
+	if t, err := http.ParseTime(e.header.Get("Date")); err == nil {
+		return t
+	}
+
+	return e.responseTime
+}
+
+// freshnessLifetime calculates the freshness lifetime (RFC 9111, section 4.2.1) for the shared cache.
+func (e *entry) freshnessLifetime() time.Duration {
+	cc := parseCacheControl(e.header)
+
+	if d, ok := cc.duration("s-maxage"); ok {
+		return d
+	}
+
+	if d, ok := cc.duration("max-age"); ok {
+		return d
+	}
+
+	if expires := e.header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil { // invalid date means "already expired"
+			return 0
+		}
+
+		return t.Sub(e.date())
+	}
+
+	if _, ok := heuristicallyCacheable[e.status]; ok { // 10% of the time since the last modification
+		if lastModified, err := http.ParseTime(e.header.Get("Last-Modified")); err == nil {
+			if d := e.date().Sub(lastModified) / 10; d > 0 { //nolint:gomnd
+				if d > maxHeuristicFreshness {
+					return maxHeuristicFreshness
+				}
+
+				return d
+			}
+		}
+	}
+
+	return 0
+}
+
+// age calculates the current age (RFC 9111, section 4.2.3).
+func (e *entry) age(now time.Time) time.Duration {
+	var apparentAge = e.responseTime.Sub(e.date())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+
+	var ageValue time.Duration
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(e.header.Get("Age")), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+
+	var correctedInitialAge = ageValue + e.responseTime.Sub(e.requestTime) // the response delay is added
+	if apparentAge > correctedInitialAge {
+		correctedInitialAge = apparentAge
+	}
+
+	return correctedInitialAge + now.Sub(e.responseTime)
+}
+
+// hasValidators reports whether the response can be revalidated.
+func (e *entry) hasValidators() bool {
+	return e.header.Get("ETag") != "" || e.header.Get("Last-Modified") != ""
+}
+
+// matches reports whether the request headers, nominated by the "Vary" header, match the stored ones.
+func (e *entry) matches(r *http.Request) bool {
+	for name := range e.vary {
+		if e.vary.Get(name) != headerValue(r.Header, name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// updated returns a copy of the entry with the headers, updated using the "304 Not Modified" response (RFC 9111,
+// section 4.3.4).
+func (e *entry) updated(notModified *http.Response, requestTime, responseTime time.Time) *entry {
+	var updated = *e
+
+	updated.header = e.header.Clone()
+	updated.requestTime, updated.responseTime = requestTime, responseTime
+
+	for name, values := range notModified.Header {
+		switch name {
+		case "Content-Length", "Content-Encoding", "Content-Type", "Transfer-Encoding":
+			continue // the stored body is not changed
+		}
+
+		updated.header[name] = values
+	}
+
+	return &updated
+}
+
+// headerValue returns all the header values, joined using comma.
+func headerValue(h http.Header, name string) string {
+	var values = h.Values(name)
+
+	trimmed := make([]string, len(values)) // values must not be modified in place
+
+	for i, v := range values {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+
+	return strings.Join(trimmed, ", ")
+}
+
+// sameVary reports whether the entries have the same nominated request headers values.
+func sameVary(a, b *entry) bool {
+	if len(a.vary) != len(b.vary) {
+		return false
+	}
+
+	for name := range a.vary {
+		if _, ok := b.vary[name]; !ok || a.vary.Get(name) != b.vary.Get(name) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,123 @@
+package httpcache
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"sync"
+)
+
+// Memory is the in-memory Storage with the LRU eviction by the total size.
+type Memory struct {
+	maxSize int64
+
+	mu     sync.Mutex
+	size   int64
+	lru    *list.List               // the most recently used items are at the front (*memoryItem)
+	values map[string]*list.Element // key => LRU element
+}
+
+type memoryItem struct {
+	key   string
+	value []byte
+}
+
+func (i *memoryItem) size() int64 { return int64(len(i.key) + len(i.value)) }
+
+// NewMemory creates a new Memory storage with the maximal total size in bytes.
+func NewMemory(maxSize int64) *Memory {
+	return &Memory{maxSize: maxSize, lru: list.New(), values: make(map[string]*list.Element)}
+}
+
+// Len returns the count of stored values.
+func (s *Memory) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lru.Len()
+}
+
+// Size returns the approximate size of stored values in bytes.
+func (s *Memory) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// Get implements Storage interface.
+func (s *Memory) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.values[key]; ok {
+		s.lru.MoveToFront(el)
+
+		return el.Value.(*memoryItem).value, nil //nolint:forcetypeassert
+	}
+
+	return nil, ErrNotFound
+}
+
+// Set implements Storage interface. Values larger than the storage size are not stored.
+func (s *Memory) Set(_ context.Context, key string, value []byte) error {
+	var item = &memoryItem{key: key, value: value}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.values[key]; ok {
+		s.remove(el)
+	}
+
+	if item.size() > s.maxSize {
+		return nil
+	}
+
+	s.values[key] = s.lru.PushFront(item)
+	s.size += item.size()
+
+	for s.size > s.maxSize {
+		s.remove(s.lru.Back())
+	}
+
+	return nil
+}
+
+// Delete implements Storage interface.
+func (s *Memory) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := s.values[key]; ok {
+			s.remove(el)
+		}
+	}
+
+	return nil
+}
+
+// Keys implements Storage interface.
+func (s *Memory) Keys(context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys = make([]string, 0, len(s.values))
+
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// remove removes the LRU element. The mutex must be locked.
+func (s *Memory) remove(el *list.Element) {
+	item := s.lru.Remove(el).(*memoryItem) //nolint:forcetypeassert
+
+	s.size -= item.size()
+	delete(s.values, item.key)
+}
@@ -0,0 +1,84 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// PurgeURL removes all the cached response variants for the URL. It returns the count of purged URLs (0 or 1).
+func (c *Client) PurgeURL(ctx context.Context, rawURL string) (int, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, err
+	}
+
+	var key = u.String() // the same form as the request URL
+
+	if _, err = c.storage.Get(ctx, key); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return 1, c.storage.Delete(ctx, key)
+}
+
+// PurgeHost removes the cached responses for all the URLs of the host. When the host has no port, URLs with any port
+// are purged. It returns the count of purged URLs.
+func (c *Client) PurgeHost(ctx context.Context, host string) (int, error) {
+	var withPort = strings.Contains(host, ":")
+
+	if _, _, err := net.SplitHostPort(host); err != nil { // IPv6 address without the port
+		withPort = false
+	}
+
+	return c.purge(ctx, func(key string) bool {
+		u, err := url.Parse(key)
+		if err != nil {
+			return false
+		}
+
+		if withPort {
+			return strings.EqualFold(u.Host, host)
+		}
+
+		return strings.EqualFold(u.Hostname(), strings.Trim(host, "[]"))
+	})
+}
+
+// PurgePrefix removes the cached responses for all the URLs with the prefix (like "https://example.com/static/"). It
+// returns the count of purged URLs.
+func (c *Client) PurgePrefix(ctx context.Context, prefix string) (int, error) {
+	return c.purge(ctx, func(key string) bool { return strings.HasPrefix(key, prefix) })
+}
+
+// purge removes the cached responses, which keys match the function.
+func (c *Client) purge(ctx context.Context, match func(key string) bool) (int, error) {
+	keys, err := c.storage.Keys(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var matched = make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		if match(key) {
+			matched = append(matched, key)
+		}
+	}
+
+	if len(matched) == 0 {
+		return 0, nil
+	}
+
+	if err = c.storage.Delete(ctx, matched...); err != nil {
+		return 0, err
+	}
+
+	return len(matched), nil
+}
@@ -0,0 +1,112 @@
+package httpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/httpcache"
+)
+
+func TestClient_Purge(t *testing.T) {
+	var ctx = context.Background()
+
+	for _, tt := range []struct {
+		name       string
+		givePurge  func(c *httpcache.Client) (int, error)
+		wantPurged int
+		wantKeys   []string
+	}{
+		{
+			name:       "by URL",
+			givePurge:  func(c *httpcache.Client) (int, error) { return c.PurgeURL(ctx, "http://example.com/a") },
+			wantPurged: 1,
+			wantKeys:   []string{"http://example.com/b/c", "http://example.com:8080/a", "https://foo.com/b/d"},
+		},
+		{
+			name:       "by unknown URL",
+			givePurge:  func(c *httpcache.Client) (int, error) { return c.PurgeURL(ctx, "http://example.com/z") },
+			wantPurged: 0,
+			wantKeys: []string{
+				"http://example.com/a", "http://example.com/b/c", "http://example.com:8080/a", "https://foo.com/b/d",
+			},
+		},
+		{
+			name:       "by host",
+			givePurge:  func(c *httpcache.Client) (int, error) { return c.PurgeHost(ctx, "EXAMPLE.com") },
+			wantPurged: 3,
+			wantKeys:   []string{"https://foo.com/b/d"},
+		},
+		{
+			name:       "by host with port",
+			givePurge:  func(c *httpcache.Client) (int, error) { return c.PurgeHost(ctx, "example.com:8080") },
+			wantPurged: 1,
+			wantKeys:   []string{"http://example.com/a", "http://example.com/b/c", "https://foo.com/b/d"},
+		},
+		{
+			name:       "by prefix",
+			givePurge:  func(c *httpcache.Client) (int, error) { return c.PurgePrefix(ctx, "http://example.com/b/") },
+			wantPurged: 1,
+			wantKeys:   []string{"http://example.com/a", "http://example.com:8080/a", "https://foo.com/b/d"},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				storage = httpcache.NewMemory(1 << 20)
+				c       = newClient(http.DefaultClient, storage, &fakeMetrics{})
+			)
+
+			for _, key := range []string{
+				"http://example.com/a", "http://example.com/b/c", "http://example.com:8080/a", "https://foo.com/b/d",
+			} {
+				assert.NoError(t, storage.Set(ctx, key, []byte("foo")))
+			}
+
+			purged, err := tt.givePurge(c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantPurged, purged)
+
+			keys, _ := storage.Keys(ctx)
+			assert.Equal(t, tt.wantKeys, keys)
+		})
+	}
+}
+
+func TestClient_SharedStorage(t *testing.T) {
+	var calls int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer upstream.Close()
+
+	var (
+		storage = newRedisStorage(t)
+		replica = newClient(upstream.Client(), storage, &fakeMetrics{})
+		another = newClient(upstream.Client(), storage, &fakeMetrics{})
+	)
+
+	resp, _ := do(t, replica, upstream.URL, nil)
+	assert.Equal(t, "MISS", resp.Header.Get(httpcache.HeaderName))
+
+	resp, body := do(t, another, upstream.URL, nil)
+	assert.Equal(t, "HIT", resp.Header.Get(httpcache.HeaderName))
+	assert.Equal(t, "content", body)
+
+	purged, err := another.PurgeHost(context.Background(), upstream.Listener.Addr().String())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	resp, _ = do(t, replica, upstream.URL, nil)
+	assert.Equal(t, "MISS", resp.Header.Get(httpcache.HeaderName))
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,64 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redis"
+)
+
+// Redis is the Storage, that keeps the values in Redis, so the cache survives restarts and is shared between the
+// proxy instances. Values expire after the TTL, and the total size is limited by the Redis server itself (using the
+// "maxmemory" setting with the "allkeys-lru" eviction policy).
+type Redis struct {
+	client *redis.Client
+	prefix string        // keys prefix (like "proxy:cache:")
+	ttl    time.Duration // zero means "without expiration"
+}
+
+// NewRedis creates a new Redis storage. The keys prefix must not contain glob-style pattern characters.
+func NewRedis(client *redis.Client, prefix string, ttl time.Duration) *Redis {
+	return &Redis{client: client, prefix: prefix, ttl: ttl}
+}
+
+// Get implements Storage interface.
+func (s *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.client.Get(ctx, s.prefix+key)
+	if errors.Is(err, redis.ErrNil) {
+		return nil, ErrNotFound
+	}
+
+	return value, err
+}
+
+// Set implements Storage interface.
+func (s *Redis) Set(ctx context.Context, key string, value []byte) error {
+	return s.client.Set(ctx, s.prefix+key, value, s.ttl)
+}
+
+// Delete implements Storage interface.
+func (s *Redis) Delete(ctx context.Context, keys ...string) error {
+	var prefixed = make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		prefixed = append(prefixed, s.prefix+key)
+	}
+
+	return s.client.Del(ctx, prefixed...)
+}
+
+// Keys implements Storage interface.
+func (s *Redis) Keys(ctx context.Context) ([]string, error) {
+	keys, err := s.client.Scan(ctx, s.prefix+"*")
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range keys {
+		keys[i] = strings.TrimPrefix(keys[i], s.prefix)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,36 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+)
+
+// Storage types.
+const (
+	StorageMemory = "memory" // in-memory storage (see Memory)
+	StorageDisk   = "disk"   // files storage (see Disk)
+	StorageRedis  = "redis"  // Redis storage (see Redis)
+)
+
+// StorageTypes returns the list of supported storage types.
+func StorageTypes() []string { return []string{StorageMemory, StorageDisk, StorageRedis} }
+
+// ErrNotFound is returned by the storages, when the key does not exist.
+var ErrNotFound = errors.New("httpcache: not found")
+
+// Storage stores the encoded responses. The key is the primary cache key (request URL), and the value contains all
+// the stored response variants (selected using the "Vary" header). Storages may evict the values on their own (e.g.
+// when the size limit is exceeded).
+type Storage interface {
+	// Get returns the stored value or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores the value. The value must not be modified after the call.
+	Set(ctx context.Context, key string, value []byte) error
+
+	// Delete removes the values. Missing keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+
+	// Keys returns all the stored keys.
+	Keys(ctx context.Context) ([]string, error)
+}
@@ -0,0 +1,142 @@
+package httpcache_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/httpcache"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redis"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redis/redistest"
+)
+
+func newRedisStorage(t *testing.T) httpcache.Storage {
+	t.Helper()
+
+	srv := redistest.NewServer()
+	t.Cleanup(srv.Close)
+
+	client := redis.New(redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return httpcache.NewRedis(client, "test:", time.Minute)
+}
+
+func TestStorages(t *testing.T) {
+	for name, factory := range map[string]func(t *testing.T) httpcache.Storage{
+		"memory": func(*testing.T) httpcache.Storage { return httpcache.NewMemory(1 << 20) },
+		"disk": func(t *testing.T) httpcache.Storage {
+			s, err := httpcache.NewDisk(t.TempDir(), 1<<20)
+			assert.NoError(t, err)
+
+			return s
+		},
+		"redis": newRedisStorage,
+	} {
+		factory := factory
+		t.Run(name, func(t *testing.T) {
+			var (
+				ctx     = context.Background()
+				storage = factory(t)
+			)
+
+			_, err := storage.Get(ctx, "http://example.com/")
+			assert.ErrorIs(t, err, httpcache.ErrNotFound)
+
+			assert.NoError(t, storage.Set(ctx, "http://example.com/", []byte("foo")))
+			assert.NoError(t, storage.Set(ctx, "http://example.com/?a=b", []byte("bar")))
+			assert.NoError(t, storage.Set(ctx, "http://example.com/", []byte("baz"))) // overwriting
+
+			value, err := storage.Get(ctx, "http://example.com/")
+			assert.NoError(t, err)
+			assert.Equal(t, "baz", string(value))
+
+			keys, err := storage.Keys(ctx)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []string{"http://example.com/", "http://example.com/?a=b"}, keys)
+
+			assert.NoError(t, storage.Delete(ctx, "http://example.com/", "http://example.com/unknown"))
+
+			_, err = storage.Get(ctx, "http://example.com/")
+			assert.ErrorIs(t, err, httpcache.ErrNotFound)
+
+			keys, err = storage.Keys(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"http://example.com/?a=b"}, keys)
+		})
+	}
+}
+
+func TestMemory_Eviction(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		storage = httpcache.NewMemory(100)
+	)
+
+	assert.NoError(t, storage.Set(ctx, "a", make([]byte, 39)))
+	assert.NoError(t, storage.Set(ctx, "b", make([]byte, 39)))
+
+	_, _ = storage.Get(ctx, "a") // "b" becomes the least recently used
+
+	assert.NoError(t, storage.Set(ctx, "c", make([]byte, 39)))
+	assert.NoError(t, storage.Set(ctx, "d", make([]byte, 200))) // too large
+
+	keys, _ := storage.Keys(ctx)
+	assert.Equal(t, []string{"a", "c"}, keys)
+	assert.Equal(t, int64(80), storage.Size())
+}
+
+func TestDisk_Persistence(t *testing.T) {
+	var (
+		ctx = context.Background()
+		dir = t.TempDir()
+	)
+
+	storage, err := httpcache.NewDisk(dir, 1<<10)
+	assert.NoError(t, err)
+
+	assert.NoError(t, storage.Set(ctx, "a", []byte("foo")))
+	<-time.After(time.Millisecond * 10) // the usage order is restored using the files modification time
+	assert.NoError(t, storage.Set(ctx, "b", []byte("bar")))
+	<-time.After(time.Millisecond * 10)
+	_, _ = storage.Get(ctx, "a")
+
+	// foreign and temporary files
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("foo"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".tmp-123"), []byte("foo"), 0o600))
+
+	size := storage.Size()
+
+	// the index is restored, and the least recently used file is evicted
+	storage, err = httpcache.NewDisk(dir, size-1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, storage.Len())
+
+	value, err := storage.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(value))
+
+	assert.FileExists(t, filepath.Join(dir, "README"))
+	assert.NoFileExists(t, filepath.Join(dir, ".tmp-123"))
+}
+
+func TestDisk_Eviction(t *testing.T) {
+	var ctx = context.Background()
+
+	storage, err := httpcache.NewDisk(t.TempDir(), 100)
+	assert.NoError(t, err)
+
+	assert.NoError(t, storage.Set(ctx, "a", make([]byte, 40)))
+	assert.NoError(t, storage.Set(ctx, "b", make([]byte, 40)))
+	assert.NoError(t, storage.Set(ctx, "c", make([]byte, 40)))
+	assert.NoError(t, storage.Set(ctx, "d", make([]byte, 200))) // too large
+
+	keys, _ := storage.Keys(ctx)
+	assert.Equal(t, []string{"b", "c"}, keys)
+	assert.LessOrEqual(t, storage.Size(), int64(100))
+}
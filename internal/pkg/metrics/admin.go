@@ -0,0 +1,43 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type Admin struct {
+	success prometheus.Counter
+	failed  prometheus.Counter
+}
+
+// NewAdmin creates new Admin (administrative API) metrics collector.
+func NewAdmin() Admin {
+	return Admin{
+		success: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "admin",
+			Name:      "auth_success",
+			Help:      "The count of successfully authenticated administrative API requests.",
+		}),
+		failed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "admin",
+			Name:      "auth_failed",
+			Help:      "The count of administrative API requests, rejected due to missing or invalid credentials.",
+		}),
+	}
+}
+
+// IncrementSuccessful increments successfully authenticated requests counter.
+func (w *Admin) IncrementSuccessful() { w.success.Inc() }
+
+// IncrementFailed increments rejected (not authenticated) requests counter.
+func (w *Admin) IncrementFailed() { w.failed.Inc() }
+
+// Register metrics with registerer.
+func (w *Admin) Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{w.success, w.failed} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
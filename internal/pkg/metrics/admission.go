@@ -0,0 +1,59 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type Admission struct {
+	inFlight prometheus.Gauge
+	queued   prometheus.Gauge
+	rejected prometheus.Counter
+}
+
+// NewAdmission creates new Admission (concurrency limiting) metrics collector.
+func NewAdmission() Admission {
+	return Admission{
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "proxy",
+			Subsystem: "admission",
+			Name:      "in_flight",
+			Help:      "The count of requests, that are processed right now.",
+		}),
+		queued: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "proxy",
+			Subsystem: "admission",
+			Name:      "queued",
+			Help:      "The count of requests, waiting in the admission queue.",
+		}),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "admission",
+			Name:      "rejected",
+			Help:      "The count of requests, rejected due to the full admission queue or the queue timeout.",
+		}),
+	}
+}
+
+// IncrementInFlight increments in-flight requests gauge.
+func (w *Admission) IncrementInFlight() { w.inFlight.Inc() }
+
+// DecrementInFlight decrements in-flight requests gauge.
+func (w *Admission) DecrementInFlight() { w.inFlight.Dec() }
+
+// IncrementQueued increments waiting in the queue requests gauge.
+func (w *Admission) IncrementQueued() { w.queued.Inc() }
+
+// DecrementQueued decrements waiting in the queue requests gauge.
+func (w *Admission) DecrementQueued() { w.queued.Dec() }
+
+// IncrementRejected increments rejected requests counter.
+func (w *Admission) IncrementRejected() { w.rejected.Inc() }
+
+// Register metrics with registerer.
+func (w *Admission) Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{w.inFlight, w.queued, w.rejected} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/metrics"
+)
+
+func TestAdmission_Register(t *testing.T) {
+	var (
+		registry = prometheus.NewRegistry()
+		am       = metrics.NewAdmission()
+	)
+
+	assert.NoError(t, am.Register(registry))
+
+	count, err := testutil.GatherAndCount(registry,
+		"proxy_admission_in_flight",
+		"proxy_admission_queued",
+		"proxy_admission_rejected",
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, count)
+}
+
+func TestAdmission_Counters(t *testing.T) {
+	am := metrics.NewAdmission()
+
+	am.IncrementInFlight()
+	am.IncrementInFlight()
+	am.DecrementInFlight()
+	am.IncrementQueued()
+	am.IncrementQueued()
+	am.IncrementQueued()
+	am.DecrementQueued()
+	am.IncrementRejected()
+
+	assert.Equal(t, float64(1), getMetric(t, &am, "proxy_admission_in_flight").Gauge.GetValue())
+	assert.Equal(t, float64(2), getMetric(t, &am, "proxy_admission_queued").Gauge.GetValue())
+	assert.Equal(t, float64(1), getMetric(t, &am, "proxy_admission_rejected").Counter.GetValue())
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type Auth struct {
+	success prometheus.Counter
+	failed  prometheus.Counter
+}
+
+// NewAuth creates new Auth (proxy clients authentication) metrics collector.
+func NewAuth() Auth {
+	return Auth{
+		success: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "auth",
+			Name:      "success",
+			Help:      "The count of successfully authenticated requests.",
+		}),
+		failed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "auth",
+			Name:      "failed",
+			Help:      "The count of requests, rejected due to missing or invalid credentials.",
+		}),
+	}
+}
+
+// IncrementSuccessful increments successfully authenticated requests counter.
+func (w *Auth) IncrementSuccessful() { w.success.Inc() }
+
+// IncrementFailed increments rejected (not authenticated) requests counter.
+func (w *Auth) IncrementFailed() { w.failed.Inc() }
+
+// Register metrics with registerer.
+func (w *Auth) Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{w.success, w.failed} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/metrics"
+)
+
+func TestAuth_Register(t *testing.T) {
+	var (
+		registry = prometheus.NewRegistry()
+		am       = metrics.NewAuth()
+	)
+
+	assert.NoError(t, am.Register(registry))
+
+	count, err := testutil.GatherAndCount(registry, "proxy_auth_success", "proxy_auth_failed")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, count)
+}
+
+func TestAuth_Counters(t *testing.T) {
+	am := metrics.NewAuth()
+
+	am.IncrementSuccessful()
+	am.IncrementFailed()
+	am.IncrementFailed()
+
+	assert.Equal(t, float64(1), getMetric(t, &am, "proxy_auth_success").Counter.GetValue())
+	assert.Equal(t, float64(2), getMetric(t, &am, "proxy_auth_failed").Counter.GetValue())
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type Cache struct {
+	hits   prometheus.Counter
+	misses prometheus.Counter
+	stale  prometheus.Counter
+}
+
+// NewCache creates new Cache (upstream responses caching) metrics collector.
+func NewCache() Cache {
+	return Cache{
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "cache",
+			Name:      "hits",
+			Help:      "The count of requests, served from the cache (including revalidated responses).",
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "cache",
+			Name:      "misses",
+			Help:      "The count of requests, served by the upstream.",
+		}),
+		stale: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "cache",
+			Name:      "stale",
+			Help:      "The count of requests, served using the stale cached responses.",
+		}),
+	}
+}
+
+// IncrementHits increments served from the cache requests counter.
+func (w *Cache) IncrementHits() { w.hits.Inc() }
+
+// IncrementMisses increments served by the upstream requests counter.
+func (w *Cache) IncrementMisses() { w.misses.Inc() }
+
+// IncrementStale increments served using the stale cached responses requests counter.
+func (w *Cache) IncrementStale() { w.stale.Inc() }
+
+// Register metrics with registerer.
+func (w *Cache) Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{w.hits, w.misses, w.stale} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
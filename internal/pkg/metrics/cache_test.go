@@ -0,0 +1,38 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/metrics"
+)
+
+func TestCache_Register(t *testing.T) {
+	var (
+		registry = prometheus.NewRegistry()
+		cm       = metrics.NewCache()
+	)
+
+	assert.NoError(t, cm.Register(registry))
+
+	count, err := testutil.GatherAndCount(registry, "proxy_cache_hits", "proxy_cache_misses", "proxy_cache_stale")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, count)
+}
+
+func TestCache_Counters(t *testing.T) {
+	cm := metrics.NewCache()
+
+	cm.IncrementHits()
+	cm.IncrementHits()
+	cm.IncrementMisses()
+	cm.IncrementStale()
+
+	assert.Equal(t, float64(2), getMetric(t, &cm, "proxy_cache_hits").Counter.GetValue())
+	assert.Equal(t, float64(1), getMetric(t, &cm, "proxy_cache_misses").Counter.GetValue())
+	assert.Equal(t, float64(1), getMetric(t, &cm, "proxy_cache_stale").Counter.GetValue())
+}
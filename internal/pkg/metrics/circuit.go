@@ -0,0 +1,46 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type Circuit struct {
+	state    *prometheus.GaugeVec
+	rejected prometheus.Counter
+}
+
+// NewCircuit creates new Circuit (upstream hosts circuit breakers) metrics collector.
+func NewCircuit() Circuit {
+	return Circuit{
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "proxy",
+			Subsystem: "circuit_breaker",
+			Name:      "state",
+			Help:      "The upstream host circuit breaker state (0 - closed, 1 - half-open, 2 - open).",
+		}, []string{"host"}),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "circuit_breaker",
+			Name:      "rejected",
+			Help:      "The count of requests, rejected by the open circuit breakers.",
+		}),
+	}
+}
+
+// SetState sets the host circuit breaker state gauge.
+func (w *Circuit) SetState(host string, state int) { w.state.WithLabelValues(host).Set(float64(state)) }
+
+// DeleteHost removes the host circuit breaker state gauge.
+func (w *Circuit) DeleteHost(host string) { w.state.DeleteLabelValues(host) }
+
+// IncrementRejected increments rejected requests counter.
+func (w *Circuit) IncrementRejected() { w.rejected.Inc() }
+
+// Register metrics with registerer.
+func (w *Circuit) Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{w.state, w.rejected} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
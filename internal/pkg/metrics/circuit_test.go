@@ -0,0 +1,53 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/metrics"
+)
+
+func TestCircuit_Register(t *testing.T) {
+	var (
+		registry = prometheus.NewRegistry()
+		cm       = metrics.NewCircuit()
+	)
+
+	assert.NoError(t, cm.Register(registry))
+
+	cm.SetState("example.com", 2)
+
+	count, err := testutil.GatherAndCount(registry,
+		"proxy_circuit_breaker_state", "proxy_circuit_breaker_rejected",
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, count)
+}
+
+func TestCircuit_Counters(t *testing.T) {
+	cm := metrics.NewCircuit()
+
+	cm.IncrementRejected()
+	cm.IncrementRejected()
+
+	assert.Equal(t, float64(2), getMetric(t, &cm, "proxy_circuit_breaker_rejected").Counter.GetValue())
+
+	cm.SetState("example.com", 1)
+
+	state := getMetric(t, &cm, "proxy_circuit_breaker_state")
+	assert.Equal(t, float64(1), state.Gauge.GetValue())
+	assert.Equal(t, "example.com", state.Label[0].GetValue())
+
+	cm.DeleteHost("example.com")
+
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, cm.Register(registry))
+
+	count, err := testutil.GatherAndCount(registry, "proxy_circuit_breaker_state")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
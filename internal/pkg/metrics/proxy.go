@@ -3,9 +3,17 @@ package metrics
 import "github.com/prometheus/client_golang/prometheus"
 
 type Proxy struct {
-	success prometheus.Counter
-	failed  prometheus.Counter
-	errors  prometheus.Counter
+	success      prometheus.Counter
+	failed       prometheus.Counter
+	clientClosed prometheus.Counter
+	blocked      prometheus.Counter
+	errors       prometheus.Counter
+	websockets   prometheus.Gauge
+
+	requestBodyTooLarge  prometheus.Counter
+	responseBodyTooLarge prometheus.Counter
+	urlTooLong           prometheus.Counter
+	headersTooLarge      prometheus.Counter
 }
 
 // NewProxy creates new Proxy metrics collector.
@@ -23,12 +31,54 @@ func NewProxy() Proxy {
 			Name:      "failed",
 			Help:      "The count of unsuccessful proxied requests.",
 		}),
+		clientClosed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "requests",
+			Name:      "client_closed",
+			Help:      "The count of proxied requests, canceled by the client (the client closed the connection).",
+		}),
+		blocked: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "requests",
+			Name:      "blocked",
+			Help:      "The count of proxied requests, blocked by the upstream access policy.",
+		}),
 		errors: prometheus.NewCounter(prometheus.CounterOpts{
 			Namespace: "proxy",
 			Subsystem: "internal",
 			Name:      "errors",
 			Help:      "The count of internal proxying errors (including bad requests).",
 		}),
+		websockets: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "proxy",
+			Subsystem: "websockets",
+			Name:      "open",
+			Help:      "The count of currently open proxied WebSocket connections.",
+		}),
+		requestBodyTooLarge: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "limits",
+			Name:      "request_body_exceeded",
+			Help:      "The count of proxied requests, rejected because of the request body size limit.",
+		}),
+		responseBodyTooLarge: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "limits",
+			Name:      "response_body_exceeded",
+			Help:      "The count of proxied requests, failed because of the response body size limit.",
+		}),
+		urlTooLong: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "limits",
+			Name:      "url_exceeded",
+			Help:      "The count of proxied requests, rejected because of the URL length limit.",
+		}),
+		headersTooLarge: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "limits",
+			Name:      "headers_exceeded",
+			Help:      "The count of proxied requests, rejected because of the request headers size limit.",
+		}),
 	}
 }
 
@@ -38,9 +88,33 @@ func (w *Proxy) IncrementSuccessful() { w.success.Inc() }
 // IncrementFailed increments unsuccessful proxied requests counter.
 func (w *Proxy) IncrementFailed() { w.failed.Inc() }
 
+// IncrementClientClosed increments canceled by the client proxied requests counter.
+func (w *Proxy) IncrementClientClosed() { w.clientClosed.Inc() }
+
+// IncrementBlocked increments blocked by the upstream access policy proxied requests counter.
+func (w *Proxy) IncrementBlocked() { w.blocked.Inc() }
+
 // IncrementErrors increments internal proxying errors counter.
 func (w *Proxy) IncrementErrors() { w.errors.Inc() }
 
+// IncrementOpenWebsockets increments open WebSocket connections gauge.
+func (w *Proxy) IncrementOpenWebsockets() { w.websockets.Inc() }
+
+// DecrementOpenWebsockets decrements open WebSocket connections gauge.
+func (w *Proxy) DecrementOpenWebsockets() { w.websockets.Dec() }
+
+// IncrementRequestBodyTooLarge increments rejected by the request body size limit requests counter.
+func (w *Proxy) IncrementRequestBodyTooLarge() { w.requestBodyTooLarge.Inc() }
+
+// IncrementResponseBodyTooLarge increments failed by the response body size limit requests counter.
+func (w *Proxy) IncrementResponseBodyTooLarge() { w.responseBodyTooLarge.Inc() }
+
+// IncrementURLTooLong increments rejected by the URL length limit requests counter.
+func (w *Proxy) IncrementURLTooLong() { w.urlTooLong.Inc() }
+
+// IncrementHeadersTooLarge increments rejected by the request headers size limit requests counter.
+func (w *Proxy) IncrementHeadersTooLarge() { w.headersTooLarge.Inc() }
+
 // Register metrics with registerer.
 func (w *Proxy) Register(reg prometheus.Registerer) error {
 	if err := reg.Register(w.success); err != nil {
@@ -51,9 +125,37 @@ func (w *Proxy) Register(reg prometheus.Registerer) error {
 		return err
 	}
 
+	if err := reg.Register(w.clientClosed); err != nil {
+		return err
+	}
+
+	if err := reg.Register(w.blocked); err != nil {
+		return err
+	}
+
 	if err := reg.Register(w.errors); err != nil {
 		return err
 	}
 
+	if err := reg.Register(w.websockets); err != nil {
+		return err
+	}
+
+	if err := reg.Register(w.requestBodyTooLarge); err != nil {
+		return err
+	}
+
+	if err := reg.Register(w.responseBodyTooLarge); err != nil {
+		return err
+	}
+
+	if err := reg.Register(w.urlTooLong); err != nil {
+		return err
+	}
+
+	if err := reg.Register(w.headersTooLarge); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -23,11 +23,18 @@ func TestProxy_Register(t *testing.T) {
 	count, err := testutil.GatherAndCount(registry,
 		"proxy_requests_success",
 		"proxy_requests_failed",
+		"proxy_requests_client_closed",
+		"proxy_requests_blocked",
 		"proxy_internal_errors",
+		"proxy_websockets_open",
+		"proxy_limits_request_body_exceeded",
+		"proxy_limits_response_body_exceeded",
+		"proxy_limits_url_exceeded",
+		"proxy_limits_headers_exceeded",
 	)
 	assert.NoError(t, err)
 
-	assert.Equal(t, 3, count)
+	assert.Equal(t, 10, count)
 }
 
 func TestProxy_IncrementSuccessful(t *testing.T) {
@@ -48,6 +55,24 @@ func TestProxy_IncrementFailed(t *testing.T) {
 	assert.Equal(t, float64(1), metric.Counter.GetValue())
 }
 
+func TestProxy_IncrementClientClosed(t *testing.T) {
+	p := metrics.NewProxy()
+
+	p.IncrementClientClosed()
+
+	metric := getMetric(t, &p, "proxy_requests_client_closed")
+	assert.Equal(t, float64(1), metric.Counter.GetValue())
+}
+
+func TestProxy_IncrementBlocked(t *testing.T) {
+	p := metrics.NewProxy()
+
+	p.IncrementBlocked()
+
+	metric := getMetric(t, &p, "proxy_requests_blocked")
+	assert.Equal(t, float64(1), metric.Counter.GetValue())
+}
+
 func TestProxy_IncrementErrors(t *testing.T) {
 	p := metrics.NewProxy()
 
@@ -57,6 +82,36 @@ func TestProxy_IncrementErrors(t *testing.T) {
 	assert.Equal(t, float64(1), metric.Counter.GetValue())
 }
 
+func TestProxy_OpenWebsockets(t *testing.T) {
+	p := metrics.NewProxy()
+
+	p.IncrementOpenWebsockets()
+	p.IncrementOpenWebsockets()
+	p.DecrementOpenWebsockets()
+
+	metric := getMetric(t, &p, "proxy_websockets_open")
+	assert.Equal(t, float64(1), metric.Gauge.GetValue())
+}
+
+func TestProxy_Limits(t *testing.T) {
+	p := metrics.NewProxy()
+
+	p.IncrementRequestBodyTooLarge()
+	p.IncrementResponseBodyTooLarge()
+	p.IncrementResponseBodyTooLarge()
+	p.IncrementURLTooLong()
+	p.IncrementHeadersTooLarge()
+
+	for name, want := range map[string]float64{
+		"proxy_limits_request_body_exceeded":  1,
+		"proxy_limits_response_body_exceeded": 2,
+		"proxy_limits_url_exceeded":           1,
+		"proxy_limits_headers_exceeded":       1,
+	} {
+		assert.Equal(t, want, getMetric(t, &p, name).Counter.GetValue(), name)
+	}
+}
+
 type registerer interface {
 	Register(prometheus.Registerer) error
 }
@@ -0,0 +1,43 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type RateLimit struct {
+	throttled     prometheus.Counter
+	throttledHost prometheus.Counter
+}
+
+// NewRateLimit creates new RateLimit (proxy clients requests rate limiting) metrics collector.
+func NewRateLimit() RateLimit {
+	return RateLimit{
+		throttled: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "ratelimit",
+			Name:      "throttled",
+			Help:      "The count of requests, rejected by the client rate limit.",
+		}),
+		throttledHost: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "ratelimit",
+			Name:      "throttled_host",
+			Help:      "The count of requests, rejected by the client rate limit for the upstream host.",
+		}),
+	}
+}
+
+// IncrementThrottled increments rejected by the client rate limit requests counter.
+func (w *RateLimit) IncrementThrottled() { w.throttled.Inc() }
+
+// IncrementThrottledHost increments rejected by the client rate limit for the upstream host requests counter.
+func (w *RateLimit) IncrementThrottledHost() { w.throttledHost.Inc() }
+
+// Register metrics with registerer.
+func (w *RateLimit) Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{w.throttled, w.throttledHost} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
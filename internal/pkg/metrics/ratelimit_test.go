@@ -0,0 +1,36 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/metrics"
+)
+
+func TestRateLimit_Register(t *testing.T) {
+	var (
+		registry = prometheus.NewRegistry()
+		rm       = metrics.NewRateLimit()
+	)
+
+	assert.NoError(t, rm.Register(registry))
+
+	count, err := testutil.GatherAndCount(registry, "proxy_ratelimit_throttled", "proxy_ratelimit_throttled_host")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, count)
+}
+
+func TestRateLimit_Counters(t *testing.T) {
+	rm := metrics.NewRateLimit()
+
+	rm.IncrementThrottled()
+	rm.IncrementThrottledHost()
+	rm.IncrementThrottledHost()
+
+	assert.Equal(t, float64(1), getMetric(t, &rm, "proxy_ratelimit_throttled").Counter.GetValue())
+	assert.Equal(t, float64(2), getMetric(t, &rm, "proxy_ratelimit_throttled_host").Counter.GetValue())
+}
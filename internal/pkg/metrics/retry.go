@@ -0,0 +1,43 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type Retry struct {
+	retries   prometheus.Counter
+	exhausted prometheus.Counter
+}
+
+// NewRetry creates new Retry (upstream requests retrying) metrics collector.
+func NewRetry() Retry {
+	return Retry{
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "upstream",
+			Name:      "retries",
+			Help:      "The count of upstream request retries.",
+		}),
+		exhausted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "upstream",
+			Name:      "retries_exhausted",
+			Help:      "The count of upstream requests, failed after all the retries.",
+		}),
+	}
+}
+
+// IncrementRetries increments upstream request retries counter.
+func (w *Retry) IncrementRetries() { w.retries.Inc() }
+
+// IncrementExhausted increments failed after all the retries requests counter.
+func (w *Retry) IncrementExhausted() { w.exhausted.Inc() }
+
+// Register metrics with registerer.
+func (w *Retry) Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{w.retries, w.exhausted} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
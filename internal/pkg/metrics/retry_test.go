@@ -0,0 +1,36 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/metrics"
+)
+
+func TestRetry_Register(t *testing.T) {
+	var (
+		registry = prometheus.NewRegistry()
+		rm       = metrics.NewRetry()
+	)
+
+	assert.NoError(t, rm.Register(registry))
+
+	count, err := testutil.GatherAndCount(registry, "proxy_upstream_retries", "proxy_upstream_retries_exhausted")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, count)
+}
+
+func TestRetry_Counters(t *testing.T) {
+	rm := metrics.NewRetry()
+
+	rm.IncrementRetries()
+	rm.IncrementRetries()
+	rm.IncrementExhausted()
+
+	assert.Equal(t, float64(2), getMetric(t, &rm, "proxy_upstream_retries").Counter.GetValue())
+	assert.Equal(t, float64(1), getMetric(t, &rm, "proxy_upstream_retries_exhausted").Counter.GetValue())
+}
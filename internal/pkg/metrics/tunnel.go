@@ -0,0 +1,97 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type Tunnel struct {
+	success  prometheus.Counter
+	failed   prometheus.Counter
+	open     prometheus.Gauge
+	sent     prometheus.Counter
+	received prometheus.Counter
+
+	intercepted prometheus.Counter
+	blocked     prometheus.Counter
+}
+
+// NewTunnel creates new Tunnel (CONNECT requests) metrics collector.
+func NewTunnel() Tunnel {
+	return Tunnel{
+		success: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "tunnels",
+			Name:      "success",
+			Help:      "The count of successfully established tunnels.",
+		}),
+		failed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "tunnels",
+			Name:      "failed",
+			Help:      "The count of tunnels, that were not established (forbidden, dialing errors, etc.).",
+		}),
+		open: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "proxy",
+			Subsystem: "tunnels",
+			Name:      "open",
+			Help:      "The count of currently open tunnels.",
+		}),
+		sent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "tunnels",
+			Name:      "sent_bytes",
+			Help:      "The count of bytes, sent from the clients to the upstreams through the tunnels.",
+		}),
+		received: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "tunnels",
+			Name:      "received_bytes",
+			Help:      "The count of bytes, received by the clients from the upstreams through the tunnels.",
+		}),
+		intercepted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "tunnels",
+			Name:      "intercepted",
+			Help:      "The count of tunnels with the intercepted (terminated by the proxy) TLS.",
+		}),
+		blocked: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "proxy",
+			Subsystem: "tunnels",
+			Name:      "blocked",
+			Help:      "The count of tunnels, blocked by the upstream access policy.",
+		}),
+	}
+}
+
+// IncrementSuccessful increments successfully established tunnels counter.
+func (w *Tunnel) IncrementSuccessful() { w.success.Inc() }
+
+// IncrementFailed increments not established tunnels counter.
+func (w *Tunnel) IncrementFailed() { w.failed.Inc() }
+
+// IncrementOpen increments open tunnels gauge.
+func (w *Tunnel) IncrementOpen() { w.open.Inc() }
+
+// DecrementOpen decrements open tunnels gauge.
+func (w *Tunnel) DecrementOpen() { w.open.Dec() }
+
+// AddSentBytes increases sent (client to upstream) bytes counter.
+func (w *Tunnel) AddSentBytes(n int) { w.sent.Add(float64(n)) }
+
+// AddReceivedBytes increases received (upstream to client) bytes counter.
+func (w *Tunnel) AddReceivedBytes(n int) { w.received.Add(float64(n)) }
+
+// IncrementIntercepted increments intercepted tunnels counter.
+func (w *Tunnel) IncrementIntercepted() { w.intercepted.Inc() }
+
+// IncrementBlocked increments blocked by the upstream access policy tunnels counter.
+func (w *Tunnel) IncrementBlocked() { w.blocked.Inc() }
+
+// Register metrics with registerer.
+func (w *Tunnel) Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{w.success, w.failed, w.open, w.sent, w.received, w.intercepted, w.blocked} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/metrics"
+)
+
+func TestTunnel_Register(t *testing.T) {
+	var (
+		registry = prometheus.NewRegistry()
+		tm       = metrics.NewTunnel()
+	)
+
+	assert.NoError(t, tm.Register(registry))
+
+	count, err := testutil.GatherAndCount(registry,
+		"proxy_tunnels_success",
+		"proxy_tunnels_failed",
+		"proxy_tunnels_open",
+		"proxy_tunnels_sent_bytes",
+		"proxy_tunnels_received_bytes",
+		"proxy_tunnels_intercepted",
+		"proxy_tunnels_blocked",
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 7, count)
+}
+
+func TestTunnel_Counters(t *testing.T) {
+	tm := metrics.NewTunnel()
+
+	tm.IncrementSuccessful()
+	tm.IncrementFailed()
+	tm.IncrementFailed()
+	tm.IncrementOpen()
+	tm.IncrementOpen()
+	tm.DecrementOpen()
+	tm.AddSentBytes(10)
+	tm.AddReceivedBytes(20)
+	tm.IncrementIntercepted()
+	tm.IncrementBlocked()
+
+	assert.Equal(t, float64(1), getMetric(t, &tm, "proxy_tunnels_success").Counter.GetValue())
+	assert.Equal(t, float64(2), getMetric(t, &tm, "proxy_tunnels_failed").Counter.GetValue())
+	assert.Equal(t, float64(1), getMetric(t, &tm, "proxy_tunnels_open").Gauge.GetValue())
+	assert.Equal(t, float64(10), getMetric(t, &tm, "proxy_tunnels_sent_bytes").Counter.GetValue())
+	assert.Equal(t, float64(20), getMetric(t, &tm, "proxy_tunnels_received_bytes").Counter.GetValue())
+	assert.Equal(t, float64(1), getMetric(t, &tm, "proxy_tunnels_intercepted").Counter.GetValue())
+	assert.Equal(t, float64(1), getMetric(t, &tm, "proxy_tunnels_blocked").Counter.GetValue())
+}
@@ -0,0 +1,114 @@
+// Package mitm contains TLS interception (man-in-the-middle) for the CONNECT tunnels: a local certificate authority,
+// on-the-fly leaf certificates issuing and decrypted requests serving.
+package mitm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"time"
+)
+
+// CA is a certificate authority, used for the leaf certificates signing.
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+const (
+	pemTypeCertificate = "CERTIFICATE"
+	pemTypePrivateKey  = "PRIVATE KEY"
+	serialNumberBits   = 128
+)
+
+// GenerateCA generates a new self-signed CA certificate and private key, encoded into PEM.
+func GenerateCA(commonName string, validFor time.Duration) (certPEM, keyPEM []byte, _ error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		now  = time.Now()
+		tmpl = &x509.Certificate{
+			SerialNumber:          serial,
+			Subject:               pkix.Name{CommonName: commonName, Organization: []string{commonName}},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(validFor),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLenZero:        true,
+		}
+	)
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypeCertificate, Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: pemTypePrivateKey, Bytes: keyDer}),
+		nil
+}
+
+// ParseCA parses PEM encoded CA certificate and private key.
+func ParseCA(certPEM, keyPEM []byte) (*CA, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if !cert.IsCA {
+		return nil, errors.New("mitm: the certificate is not a CA certificate")
+	}
+
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("mitm: unsupported private key type")
+	}
+
+	return &CA{Cert: cert, Key: signer}, nil
+}
+
+func randomSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
+}
+
+// LoadCA loads PEM encoded CA certificate and private key from the files.
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCA(certPEM, keyPEM)
+}
@@ -0,0 +1,72 @@
+package mitm_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/mitm"
+)
+
+func newTestCA(t *testing.T) *mitm.CA {
+	t.Helper()
+
+	certPEM, keyPEM, err := mitm.GenerateCA("Test CA", time.Hour*24)
+	assert.NoError(t, err)
+
+	ca, err := mitm.ParseCA(certPEM, keyPEM)
+	assert.NoError(t, err)
+
+	return ca
+}
+
+func TestGenerateCA(t *testing.T) {
+	ca := newTestCA(t)
+
+	assert.True(t, ca.Cert.IsCA)
+	assert.Equal(t, "Test CA", ca.Cert.Subject.CommonName)
+	assert.WithinDuration(t, time.Now().Add(time.Hour*24), ca.Cert.NotAfter, time.Minute)
+}
+
+func TestParseCAErrors(t *testing.T) {
+	_, err := mitm.ParseCA([]byte("foo"), []byte("bar"))
+	assert.Error(t, err)
+
+	// not a CA certificate must be rejected
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	keyDer, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	_, err = mitm.ParseCA(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}),
+	)
+	assert.ErrorContains(t, err, "not a CA certificate")
+}
+
+func TestLoadCA(t *testing.T) {
+	dir := t.TempDir()
+
+	certPEM, keyPEM, err := mitm.GenerateCA("Test CA", time.Hour*24)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), certPEM, 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca.key"), keyPEM, 0o600))
+
+	ca, err := mitm.LoadCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Test CA", ca.Cert.Subject.CommonName)
+
+	_, err = mitm.LoadCA(filepath.Join(dir, "foo.crt"), filepath.Join(dir, "ca.key"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,159 @@
+package mitm
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertCache issues leaf certificates (signed by the CA) on-the-fly and caches them.
+type CertCache struct {
+	ca       *CA
+	validFor time.Duration
+	maxSize  int
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	order *list.List // the most recently used items are at the front
+}
+
+type cacheItem struct {
+	host string
+	cert *tls.Certificate
+}
+
+const (
+	defaultLeafValidity  = time.Hour * 24 * 30
+	defaultCertCacheSize = 1024
+)
+
+// NewCertCache creates a new certificates cache. Zero maxSize means the default cache size.
+func NewCertCache(ca *CA, maxSize int) *CertCache {
+	if maxSize <= 0 {
+		maxSize = defaultCertCacheSize
+	}
+
+	return &CertCache{
+		ca:       ca,
+		validFor: defaultLeafValidity,
+		maxSize:  maxSize,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the certificate for the host (it will be issued, if it is not cached or expired).
+func (c *CertCache) Get(host string) (*tls.Certificate, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	c.mu.Lock()
+
+	if el, ok := c.items[host]; ok {
+		item := el.Value.(*cacheItem) //nolint:forcetypeassert
+
+		if time.Now().Before(item.cert.Leaf.NotAfter.Add(-time.Hour)) {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+
+			return item.cert, nil
+		}
+
+		c.order.Remove(el)
+		delete(c.items, host)
+	}
+
+	c.mu.Unlock()
+
+	cert, err := c.issue(host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[host]; ok { // issued concurrently
+		c.order.Remove(el)
+	}
+
+	c.items[host] = c.order.PushFront(&cacheItem{host: host, cert: cert})
+
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheItem).host) //nolint:forcetypeassert
+	}
+
+	return cert, nil
+}
+
+// Len returns the count of cached certificates.
+func (c *CertCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// issue creates a new leaf certificate for the host.
+func (c *CertCache) issue(host string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		now      = time.Now()
+		notAfter = now.Add(c.validFor)
+	)
+
+	if notAfter.After(c.ca.Cert.NotAfter) {
+		notAfter = c.ca.Cert.NotAfter
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: host},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.ca.Cert, key.Public(), c.ca.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, c.ca.Cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
@@ -0,0 +1,42 @@
+package mitm_test
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/mitm"
+)
+
+func TestCertCache_Get(t *testing.T) {
+	var (
+		ca    = newTestCA(t)
+		cache = mitm.NewCertCache(ca, 2)
+		roots = x509.NewCertPool()
+	)
+
+	roots.AddCert(ca.Cert)
+
+	cert, err := cache.Get("Example.com.")
+	assert.NoError(t, err)
+
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots})
+	assert.NoError(t, err, "leaf certificate must be signed by the CA")
+
+	again, err := cache.Get("example.com")
+	assert.NoError(t, err)
+	assert.Same(t, cert, again, "certificate must be cached")
+
+	ipCert, err := cache.Get("127.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ipCert.Leaf.IPAddresses[0].String())
+
+	_, err = cache.Get("foo.com") // the oldest (example.com) must be evicted
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cache.Len())
+
+	evicted, err := cache.Get("example.com")
+	assert.NoError(t, err)
+	assert.NotSame(t, cert, evicted)
+}
@@ -0,0 +1,153 @@
+package mitm
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/http/netconn"
+)
+
+// Interceptor terminates the TLS connections (using the certificates, issued on-the-fly) and passes the decrypted
+// requests into the handler (in the absolute-form, like `GET https://example.com/foo HTTP/1.1`).
+type Interceptor struct {
+	certs   *CertCache
+	hosts   hostmatch.Matcher
+	handler http.Handler
+	log     *zap.Logger
+}
+
+// NewInterceptor creates a new Interceptor. Only connections to the hosts, that match the hosts matcher, should be
+// intercepted.
+func NewInterceptor(certs *CertCache, hosts hostmatch.Matcher, handler http.Handler, log *zap.Logger) *Interceptor {
+	return &Interceptor{certs: certs, hosts: hosts, handler: handler, log: log}
+}
+
+// ShouldIntercept reports whether the connection to the target (host:port) should be intercepted.
+func (i *Interceptor) ShouldIntercept(target string) bool { return i.hosts.Match(target) }
+
+const (
+	readHeaderTimeout = time.Second * 10
+	handshakeTimeout  = time.Second * 10
+	idleTimeout       = time.Minute
+)
+
+// Serve terminates TLS on the client connection and serves the decrypted HTTP requests, sent to the target
+// (host:port, from the CONNECT request). The requests contexts are derived from the ctx, so the CONNECT request
+// values (like the client permissions) are passed to the handler. It blocks until the connection is closed or the
+// context is canceled.
+func (i *Interceptor) Serve(ctx context.Context, conn net.Conn, target string) error {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return i.certs.Get(hello.ServerName)
+			}
+
+			return i.certs.Get(host)
+		},
+		NextProtos: []string{"http/1.1"},
+		MinVersion: tls.VersionTLS12,
+	})
+
+	handshakeCtx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	if err = tlsConn.HandshakeContext(handshakeCtx); err != nil {
+		_ = tlsConn.Close()
+
+		return err
+	}
+
+	if port == "443" {
+		target = host // the default port must be omitted in the URL (and the "Host" header)
+	}
+
+	var (
+		l   = newConnListener(tlsConn)
+		srv = &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the destination is always taken from the CONNECT request (not from the "Host" header)
+				r.URL.Scheme, r.URL.Host = "https", target
+
+				i.handler.ServeHTTP(w, r)
+			}),
+			ErrorLog:          zap.NewStdLog(i.log),
+			ReadHeaderTimeout: readHeaderTimeout,
+			IdleTimeout:       idleTimeout,
+			BaseContext:       func(net.Listener) context.Context { return ctx },
+			ConnContext:       netconn.WithConn,
+		}
+	)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-l.closed:
+		}
+
+		_ = srv.Close()
+	}()
+
+	if err = srv.Serve(l); errors.Is(err, net.ErrClosed) || errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// connListener is a net.Listener, that accepts the only one connection. After the accepted connection is closed,
+// the listener is closed too.
+type connListener struct {
+	conn      net.Conn
+	accepted  sync.Once
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	return &connListener{conn: conn, closed: make(chan struct{})}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	var c net.Conn
+
+	l.accepted.Do(func() { c = &notifyConn{Conn: l.conn, onClose: l.close} })
+
+	if c != nil {
+		return c, nil
+	}
+
+	<-l.closed
+
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) close() { l.closeOnce.Do(func() { close(l.closed) }) }
+
+func (l *connListener) Close() error { l.close(); return nil }
+
+func (l *connListener) Addr() net.Addr { return l.conn.LocalAddr() }
+
+// notifyConn calls onClose function after the connection closing.
+type notifyConn struct {
+	net.Conn
+	onClose func()
+}
+
+func (c *notifyConn) Close() error {
+	defer c.onClose()
+
+	return c.Conn.Close()
+}
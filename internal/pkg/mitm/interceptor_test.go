@@ -0,0 +1,62 @@
+package mitm_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/mitm"
+)
+
+func TestInterceptor_ShouldIntercept(t *testing.T) {
+	i := mitm.NewInterceptor(nil, hostmatch.New("*.example.com"), http.NotFoundHandler(), zap.NewNop())
+
+	assert.True(t, i.ShouldIntercept("api.example.com:443"))
+	assert.False(t, i.ShouldIntercept("example.org:443"))
+}
+
+func TestInterceptor_Serve(t *testing.T) {
+	var (
+		ca    = newTestCA(t)
+		roots = x509.NewCertPool()
+	)
+
+	roots.AddCert(ca.Cert)
+
+	var handler http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.String()))
+	}
+
+	interceptor := mitm.NewInterceptor(mitm.NewCertCache(ca, 0), hostmatch.New("*"), handler, zap.NewNop())
+
+	clientConn, proxyConn := net.Pipe()
+
+	var served = make(chan error, 1)
+
+	go func() { served <- interceptor.Serve(context.Background(), proxyConn, "example.com:443") }()
+
+	tlsConn := tls.Client(clientConn, &tls.Config{ServerName: "example.com", RootCAs: roots, MinVersion: tls.VersionTLS12})
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/foo?bar=baz", http.NoBody)
+	assert.NoError(t, req.Write(tlsConn))
+
+	resp, err := http.ReadResponse(bufio.NewReader(tlsConn), req)
+	assert.NoError(t, err)
+
+	body := make([]byte, 64)
+	n, _ := resp.Body.Read(body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "GET https://example.com/foo?bar=baz", string(body[:n]))
+
+	assert.NoError(t, tlsConn.Close())
+	assert.NoError(t, <-served)
+}
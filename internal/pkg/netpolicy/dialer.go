@@ -0,0 +1,48 @@
+package netpolicy
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+// Dialer dials the destinations, allowed by the policy only. IP addresses are checked after the DNS resolution (right
+// before the connection establishing), so the DNS rebinding cannot bypass the policy.
+type Dialer struct {
+	dialer *net.Dialer
+	policy *Policy
+}
+
+// NewDialer wraps the dialer with the policy.
+func NewDialer(dialer *net.Dialer, policy *Policy) *Dialer {
+	return &Dialer{dialer: dialer, policy: policy}
+}
+
+// DialContext connects to the address on the named network using the provided context. *BlockedError is returned
+// (wrapped), when the destination is not allowed.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	hostAllowed, err := d.policy.checkHost(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if hostAllowed {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	var dialer = *d.dialer // copy, to avoid the original dialer modifying
+
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		if checkErr := d.policy.checkIP(address); checkErr != nil {
+			return checkErr
+		}
+
+		if d.dialer.Control != nil {
+			return d.dialer.Control(network, address, c)
+		}
+
+		return nil
+	}
+
+	return dialer.DialContext(ctx, network, address)
+}
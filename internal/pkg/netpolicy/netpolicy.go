@@ -0,0 +1,205 @@
+// Package netpolicy contains the upstream destinations access policy (SSRF protection), enforced at dial time.
+package netpolicy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+)
+
+// privateNetworks are loopback, private, link-local (including the cloud metadata services), shared, reserved and
+// multicast networks, that should not be reachable through the proxy.
+var privateNetworks = mustParseCIDRs( //nolint:gochecknoglobals
+	"0.0.0.0/8",      // "this" network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // shared address space (carrier-grade NAT)
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link-local (169.254.169.254 is the cloud metadata service)
+	"172.16.0.0/12",  // private
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // private
+	"198.18.0.0/15",  // benchmarking
+	"224.0.0.0/4",    // multicast
+	"240.0.0.0/4",    // reserved (including broadcast)
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"fc00::/7",       // unique local (fd00:ec2::254 is the AWS metadata service)
+	"fe80::/10",      // link-local
+	"ff00::/8",       // multicast
+)
+
+// Policy decides whether the upstream destination is allowed. Allow lists are the exceptions for the deny lists, so
+// they are checked first.
+type Policy struct {
+	allowNetworks, denyNetworks []*net.IPNet
+	allowHosts, denyHosts       hostmatch.Matcher
+	allowedPorts                map[uint16]struct{} // empty map means "any port is allowed"
+}
+
+// Option allows to configure the Policy.
+type Option func(*Policy)
+
+// WithDenyPrivateNetworks denies loopback, private, link-local (including the cloud metadata services), reserved and
+// multicast networks.
+func WithDenyPrivateNetworks() Option {
+	return func(p *Policy) { p.denyNetworks = append(p.denyNetworks, privateNetworks...) }
+}
+
+// WithAllowNetworks allows the networks, even if they are denied.
+func WithAllowNetworks(networks ...*net.IPNet) Option {
+	return func(p *Policy) { p.allowNetworks = append(p.allowNetworks, networks...) }
+}
+
+// WithDenyNetworks denies the networks.
+func WithDenyNetworks(networks ...*net.IPNet) Option {
+	return func(p *Policy) { p.denyNetworks = append(p.denyNetworks, networks...) }
+}
+
+// WithAllowHosts allows the hosts, that match the patterns (the hosts are allowed even if they are denied or resolved
+// into the denied networks).
+func WithAllowHosts(m hostmatch.Matcher) Option { return func(p *Policy) { p.allowHosts = m } }
+
+// WithDenyHosts denies the hosts, that match the patterns.
+func WithDenyHosts(m hostmatch.Matcher) Option { return func(p *Policy) { p.denyHosts = m } }
+
+// WithAllowedPorts limits the destination ports. Without this option any port is allowed.
+func WithAllowedPorts(ports ...uint16) Option {
+	return func(p *Policy) {
+		for _, port := range ports {
+			p.allowedPorts[port] = struct{}{}
+		}
+	}
+}
+
+// New creates a new Policy. Without options everything is allowed.
+func New(opts ...Option) *Policy {
+	p := &Policy{allowedPorts: make(map[uint16]struct{})}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// BlockedError is returned, when the destination is not allowed by the policy.
+type BlockedError struct {
+	Address string // the host:port or ip:port
+	Reason  string
+}
+
+func (e *BlockedError) Error() string {
+	return "destination " + e.Address + " is blocked (" + e.Reason + ")"
+}
+
+// Check checks the destination (host:port), when the connection is established by someone else (e.g. the parent
+// proxy), so only the IP addresses (not the host names) are checked against the networks. *BlockedError is returned,
+// when the destination is not allowed.
+func (p *Policy) Check(address string) error {
+	hostAllowed, err := p.checkHost(address)
+	if err != nil || hostAllowed {
+		return err
+	}
+
+	if host, _, _ := net.SplitHostPort(address); net.ParseIP(host) != nil {
+		return p.checkIP(address)
+	}
+
+	return nil
+}
+
+// checkHost checks the destination (host:port, before the DNS resolution). It returns true, if the host is explicitly
+// allowed (so the resolved IP addresses must not be checked).
+func (p *Policy) checkHost(address string) (bool, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return false, err
+	}
+
+	if len(p.allowedPorts) > 0 {
+		port, _ := strconv.ParseUint(portStr, 10, 16) //nolint:gomnd
+
+		if _, ok := p.allowedPorts[uint16(port)]; !ok {
+			return false, &BlockedError{Address: address, Reason: "port " + portStr + " is not allowed"}
+		}
+	}
+
+	if p.allowHosts.Match(host) {
+		return true, nil
+	}
+
+	if p.denyHosts.Match(host) {
+		return false, &BlockedError{Address: address, Reason: "host is denied"}
+	}
+
+	return false, nil
+}
+
+// checkIP checks the resolved destination IP address (ip:port).
+func (p *Policy) checkIP(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return &BlockedError{Address: address, Reason: "not an IP address"}
+	}
+
+	for _, n := range p.allowNetworks {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+
+	for _, n := range p.denyNetworks {
+		if n.Contains(ip) {
+			return &BlockedError{Address: address, Reason: "network " + n.String() + " is denied"}
+		}
+	}
+
+	return nil
+}
+
+// ParseCIDRs parses the list of networks in CIDR notation (single IP addresses are allowed too).
+func ParseCIDRs(list ...string) ([]*net.IPNet, error) {
+	var networks = make([]*net.IPNet, 0, len(list))
+
+	for _, s := range list {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		if !strings.Contains(s, "/") { // single IP address
+			if ip := net.ParseIP(s); ip != nil {
+				if ip.To4() != nil {
+					s += "/32"
+				} else {
+					s += "/128"
+				}
+			}
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("wrong network [%s]: %w", s, err)
+		}
+
+		networks = append(networks, n)
+	}
+
+	return networks, nil
+}
+
+func mustParseCIDRs(list ...string) []*net.IPNet {
+	networks, err := ParseCIDRs(list...)
+	if err != nil {
+		panic(err)
+	}
+
+	return networks
+}
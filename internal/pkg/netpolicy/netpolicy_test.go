@@ -0,0 +1,192 @@
+package netpolicy_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/netpolicy"
+)
+
+func TestDialer_DialContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	defer l.Close()
+
+	go func() {
+		for {
+			c, acceptErr := l.Accept()
+			if acceptErr != nil {
+				return
+			}
+
+			_ = c.Close()
+		}
+	}()
+
+	var (
+		port     = uint16(l.Addr().(*net.TCPAddr).Port) //nolint:forcetypeassert
+		portStr  = strconv.Itoa(int(port))
+		loopback = mustParseCIDRs(t, "127.0.0.0/8")
+	)
+
+	for _, tt := range []struct {
+		name        string
+		giveOptions []netpolicy.Option
+		giveAddress string
+		wantBlocked string
+	}{
+		{
+			name:        "everything is allowed by default",
+			giveAddress: "127.0.0.1:" + portStr,
+		},
+		{
+			name:        "private networks are denied",
+			giveOptions: []netpolicy.Option{netpolicy.WithDenyPrivateNetworks()},
+			giveAddress: "127.0.0.1:" + portStr,
+			wantBlocked: "network 127.0.0.0/8 is denied",
+		},
+		{
+			name:        "host is checked after the resolving",
+			giveOptions: []netpolicy.Option{netpolicy.WithDenyPrivateNetworks()},
+			giveAddress: "localhost:" + portStr,
+			wantBlocked: "is denied",
+		},
+		{
+			name:        "IPv4-mapped IPv6 address is denied",
+			giveOptions: []netpolicy.Option{netpolicy.WithDenyPrivateNetworks()},
+			giveAddress: "[::ffff:127.0.0.1]:" + portStr,
+			wantBlocked: "network 127.0.0.0/8 is denied",
+		},
+		{
+			name: "allowed network is an exception",
+			giveOptions: []netpolicy.Option{
+				netpolicy.WithDenyPrivateNetworks(),
+				netpolicy.WithAllowNetworks(mustParseCIDRs(t, "127.0.0.1")...),
+			},
+			giveAddress: "127.0.0.1:" + portStr,
+		},
+		{
+			name:        "denied network",
+			giveOptions: []netpolicy.Option{netpolicy.WithDenyNetworks(loopback...)},
+			giveAddress: "127.0.0.1:" + portStr,
+			wantBlocked: "network 127.0.0.0/8 is denied",
+		},
+		{
+			name:        "denied host",
+			giveOptions: []netpolicy.Option{netpolicy.WithDenyHosts(hostmatch.New("local*"))},
+			giveAddress: "localhost:" + portStr,
+			wantBlocked: "host is denied",
+		},
+		{
+			name: "allowed host is an exception",
+			giveOptions: []netpolicy.Option{
+				netpolicy.WithDenyPrivateNetworks(),
+				netpolicy.WithDenyHosts(hostmatch.New("*")),
+				netpolicy.WithAllowHosts(hostmatch.New("localhost")),
+			},
+			giveAddress: "localhost:" + portStr,
+		},
+		{
+			name:        "allowed port",
+			giveOptions: []netpolicy.Option{netpolicy.WithAllowedPorts(port)},
+			giveAddress: "127.0.0.1:" + portStr,
+		},
+		{
+			name:        "not allowed port",
+			giveOptions: []netpolicy.Option{netpolicy.WithAllowedPorts(80, 443)},
+			giveAddress: "127.0.0.1:" + portStr,
+			wantBlocked: "port " + portStr + " is not allowed",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			d := netpolicy.NewDialer(&net.Dialer{}, netpolicy.New(tt.giveOptions...))
+
+			conn, dialErr := d.DialContext(context.Background(), "tcp", tt.giveAddress)
+
+			if tt.wantBlocked == "" {
+				assert.NoError(t, dialErr)
+
+				if conn != nil {
+					_ = conn.Close()
+				}
+
+				return
+			}
+
+			var blocked *netpolicy.BlockedError
+
+			assert.True(t, errors.As(dialErr, &blocked))
+			assert.ErrorContains(t, dialErr, tt.wantBlocked)
+		})
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	policy := netpolicy.New(
+		netpolicy.WithDenyPrivateNetworks(),
+		netpolicy.WithAllowHosts(hostmatch.New("127.0.0.2")),
+		netpolicy.WithDenyHosts(hostmatch.New("*.internal")),
+		netpolicy.WithAllowedPorts(80, 443),
+	)
+
+	for address, wantBlocked := range map[string]string{
+		"example.com:443":  "",
+		"localhost:80":     "", // host names are not resolved
+		"127.0.0.2:80":     "", // explicitly allowed
+		"127.0.0.1:80":     "network 127.0.0.0/8 is denied",
+		"[::1]:443":        "network ::1/128 is denied",
+		"foo.internal:80":  "host is denied",
+		"example.com:8080": "port 8080 is not allowed",
+	} {
+		err := policy.Check(address)
+
+		if wantBlocked == "" {
+			assert.NoError(t, err, address)
+
+			continue
+		}
+
+		var blocked *netpolicy.BlockedError
+
+		assert.True(t, errors.As(err, &blocked), address)
+		assert.ErrorContains(t, err, wantBlocked, address)
+	}
+
+	assert.Error(t, policy.Check("foo"))
+}
+
+func TestParseCIDRs(t *testing.T) {
+	networks, err := netpolicy.ParseCIDRs("10.0.0.0/8", " 1.2.3.4 ", "", "::1", "fd00::/8")
+	assert.NoError(t, err)
+
+	var got = make([]string, 0, len(networks))
+
+	for _, n := range networks {
+		got = append(got, n.String())
+	}
+
+	assert.Equal(t, []string{"10.0.0.0/8", "1.2.3.4/32", "::1/128", "fd00::/8"}, got)
+
+	_, err = netpolicy.ParseCIDRs("10.0.0.0/33")
+	assert.ErrorContains(t, err, "wrong network")
+
+	_, err = netpolicy.ParseCIDRs("foo")
+	assert.ErrorContains(t, err, "wrong network")
+}
+
+func mustParseCIDRs(t *testing.T, list ...string) []*net.IPNet {
+	t.Helper()
+
+	networks, err := netpolicy.ParseCIDRs(list...)
+	assert.NoError(t, err)
+
+	return networks
+}
@@ -0,0 +1,37 @@
+package parentproxy
+
+import (
+	"net"
+	"net/http"
+)
+
+type httpClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Client records the route of the requests (see WithRouteHolder), even if the pooled connections are reused and no
+// dialing happens.
+type Client struct {
+	next   httpClient
+	router *Router
+}
+
+// NewClient creates a new Client.
+func NewClient(next httpClient, router *Router) *Client { return &Client{next: next, router: router} }
+
+// Do sends an HTTP request and returns an HTTP response.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	var address = req.URL.Host
+
+	if req.URL.Port() == "" {
+		if req.URL.Scheme == "https" {
+			address = net.JoinHostPort(req.URL.Hostname(), "443")
+		} else {
+			address = net.JoinHostPort(req.URL.Hostname(), "80")
+		}
+	}
+
+	setRoute(req.Context(), c.router.Route(address))
+
+	return c.next.Do(req)
+}
@@ -0,0 +1,41 @@
+package parentproxy
+
+import (
+	"context"
+	"sync"
+)
+
+type routeHolderKey struct{}
+
+// routeHolder allows to pass the used route to the outer handlers (like the requests logger).
+type routeHolder struct {
+	mu    sync.Mutex
+	route string
+}
+
+// WithRouteHolder returns a copy of the context, where the used route can be stored by the Router (or the Client)
+// and read later by the caller (using the RouteFromContext function).
+func WithRouteHolder(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routeHolderKey{}, &routeHolder{})
+}
+
+// setRoute stores the route into the context, created by the WithRouteHolder function. Otherwise, it does nothing.
+func setRoute(ctx context.Context, route Route) {
+	if h, ok := ctx.Value(routeHolderKey{}).(*routeHolder); ok {
+		h.mu.Lock()
+		h.route = route.String()
+		h.mu.Unlock()
+	}
+}
+
+// RouteFromContext returns the used route name (empty string, if no outbound connections were made).
+func RouteFromContext(ctx context.Context) string {
+	if h, ok := ctx.Value(routeHolderKey{}).(*routeHolder); ok {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		return h.route
+	}
+
+	return ""
+}
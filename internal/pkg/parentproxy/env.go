@@ -0,0 +1,142 @@
+package parentproxy
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Environment contains the routes, taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+type Environment struct {
+	httpProxy, httpsProxy *url.URL // nil, when the variable is not set
+	noProxy               []noProxyEntry
+	noProxyAll            bool
+}
+
+type noProxyEntry struct {
+	host    string     // lower-cased host name without the leading dot (matches the subdomains too)
+	network *net.IPNet // IP address or network (host is empty)
+	port    string     // empty means "any port"
+}
+
+// ParseEnvironment parses the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables (lower-cased names are
+// used as a fallback), using the getenv function (like os.Getenv). The proxy URL without scheme means "http://".
+func ParseEnvironment(getenv func(string) string) (*Environment, error) {
+	var (
+		env = new(Environment)
+		err error
+	)
+
+	if env.httpProxy, err = parseEnvURL(envValue(getenv, "HTTP_PROXY")); err != nil {
+		return nil, err
+	}
+
+	if env.httpsProxy, err = parseEnvURL(envValue(getenv, "HTTPS_PROXY")); err != nil {
+		return nil, err
+	}
+
+	for _, s := range strings.Split(envValue(getenv, "NO_PROXY"), ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s == "" {
+			continue
+		}
+
+		if s == "*" {
+			env.noProxyAll = true
+
+			continue
+		}
+
+		env.noProxy = append(env.noProxy, parseNoProxyEntry(s))
+	}
+
+	return env, nil
+}
+
+func envValue(getenv func(string) string, name string) string {
+	if v := getenv(name); v != "" {
+		return v
+	}
+
+	return getenv(strings.ToLower(name))
+}
+
+func parseEnvURL(s string) (*url.URL, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	if !strings.Contains(s, "://") {
+		s = schemeHTTP + "://" + s
+	}
+
+	return ParseURL(s)
+}
+
+func parseNoProxyEntry(s string) noProxyEntry {
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return noProxyEntry{network: n}
+	}
+
+	var entry noProxyEntry
+
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		s, entry.port = host, port
+	}
+
+	if ip := net.ParseIP(strings.Trim(s, "[]")); ip != nil {
+		var bits = 8 * net.IPv4len //nolint:gomnd
+
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len //nolint:gomnd
+		}
+
+		entry.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+
+		return entry
+	}
+
+	entry.host = strings.TrimPrefix(s, ".")
+
+	return entry
+}
+
+// route returns the route for the destination host and port. The HTTPS_PROXY is used for the 443 port, and the
+// HTTP_PROXY - for the others (the request scheme is unknown at the dial time).
+func (e *Environment) route(host, port string) (Route, bool) {
+	var proxy = e.httpProxy
+
+	if port == "443" {
+		proxy = e.httpsProxy
+	}
+
+	if proxy == nil {
+		return Route{}, false
+	}
+
+	if e.noProxyAll {
+		return Route{}, true
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip := net.ParseIP(host)
+
+	for _, entry := range e.noProxy {
+		if entry.port != "" && entry.port != port {
+			continue
+		}
+
+		if entry.network != nil {
+			if ip != nil && entry.network.Contains(ip) {
+				return Route{}, true
+			}
+
+			continue
+		}
+
+		if host == entry.host || strings.HasSuffix(host, "."+entry.host) {
+			return Route{}, true
+		}
+	}
+
+	return ProxyRoute(proxy), true
+}
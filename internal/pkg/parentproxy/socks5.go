@@ -0,0 +1,200 @@
+package parentproxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+const (
+	schemeSOCKS5  = "socks5"  // host names are resolved locally
+	schemeSOCKS5H = "socks5h" // host names are resolved by the proxy
+)
+
+// SOCKS5 protocol constants (RFC 1928 and RFC 1929).
+const (
+	socksVersion         byte = 0x05
+	socksAuthNone        byte = 0x00
+	socksAuthPassword    byte = 0x02
+	socksAuthNoAccepted  byte = 0xFF
+	socksPasswordVersion byte = 0x01
+	socksCmdConnect      byte = 0x01
+	socksAddrIPv4        byte = 0x01
+	socksAddrDomain      byte = 0x03
+	socksAddrIPv6        byte = 0x04
+)
+
+// socksReplies are the SOCKS5 reply field descriptions.
+var socksReplies = [...]string{ //nolint:gochecknoglobals
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// connectSOCKS5 establishes the tunnel to the address using the SOCKS5 CONNECT command. For the "socks5" scheme the
+// host name is resolved locally, and the resolved IP address is checked by the policy.
+func (r *Router) connectSOCKS5(ctx context.Context, conn net.Conn, proxy *url.URL, address string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16) //nolint:gomnd
+	if err != nil {
+		return nil, fmt.Errorf("wrong port [%s]", portStr)
+	}
+
+	if proxy.Scheme == schemeSOCKS5 && net.ParseIP(host) == nil {
+		addrs, lookupErr := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+
+		host = addrs[0].IP.String()
+
+		if err = r.policy.Check(net.JoinHostPort(host, portStr)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = socksAuthenticate(conn, proxy.User); err != nil {
+		return nil, err
+	}
+
+	req := []byte{socksVersion, socksCmdConnect, 0x00}
+
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 { //nolint:gomnd
+			return nil, errors.New("too long host name")
+		}
+
+		req = append(append(req, socksAddrDomain, byte(len(host))), host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, socksAddrIPv4), ip4...)
+	} else {
+		req = append(append(req, socksAddrIPv6), ip.To16()...)
+	}
+
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+
+	if _, err = conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	if err = socksReadReply(conn); err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// socksAuthenticate negotiates the authentication method (the username/password authentication is used, when the
+// credentials are set).
+func socksAuthenticate(conn net.Conn, user *url.Userinfo) error {
+	var methods = []byte{socksAuthNone}
+
+	if user != nil {
+		methods = []byte{socksAuthPassword}
+	}
+
+	if _, err := conn.Write(append([]byte{socksVersion, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	var resp = make([]byte, 2) //nolint:gomnd
+
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+
+	switch {
+	case resp[0] != socksVersion:
+		return fmt.Errorf("unexpected SOCKS version [%d]", resp[0])
+	case resp[1] == socksAuthNoAccepted:
+		return errors.New("no acceptable SOCKS authentication methods")
+	case resp[1] == socksAuthNone:
+		return nil
+	case resp[1] != socksAuthPassword || user == nil:
+		return fmt.Errorf("unexpected SOCKS authentication method [%d]", resp[1])
+	}
+
+	var (
+		username    = user.Username()
+		password, _ = user.Password()
+	)
+
+	if len(username) > 255 || len(password) > 255 { //nolint:gomnd
+		return errors.New("too long SOCKS credentials")
+	}
+
+	req := append([]byte{socksPasswordVersion, byte(len(username))}, username...)
+	req = append(append(req, byte(len(password))), password...)
+
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+
+	if resp[1] != 0x00 {
+		return errors.New("SOCKS authentication failed")
+	}
+
+	return nil
+}
+
+// socksReadReply reads the CONNECT command reply (the bound address is skipped).
+func socksReadReply(conn net.Conn) error {
+	var hdr = make([]byte, 4) //nolint:gomnd
+
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return err
+	}
+
+	if hdr[0] != socksVersion {
+		return fmt.Errorf("unexpected SOCKS version [%d]", hdr[0])
+	}
+
+	if rep := int(hdr[1]); rep != 0 {
+		if rep < len(socksReplies) && socksReplies[rep] != "" {
+			return fmt.Errorf("SOCKS CONNECT failed: %s", socksReplies[rep])
+		}
+
+		return fmt.Errorf("SOCKS CONNECT failed with the code [%d]", rep)
+	}
+
+	var addrLen int
+
+	switch hdr[3] {
+	case socksAddrIPv4:
+		addrLen = net.IPv4len
+	case socksAddrIPv6:
+		addrLen = net.IPv6len
+	case socksAddrDomain:
+		var l = make([]byte, 1)
+
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return err
+		}
+
+		addrLen = int(l[0])
+	default:
+		return fmt.Errorf("unexpected SOCKS address type [%d]", hdr[3])
+	}
+
+	_, err := io.ReadFull(conn, make([]byte, addrLen+2)) //nolint:gomnd // address + port
+
+	return err
+}
@@ -0,0 +1,216 @@
+// Package ratelimit contains the token bucket rate limiter with the separate bucket for each key (client).
+package ratelimit
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is the maximal requests count per period. The bucket capacity (burst) is equal to the requests count, and
+// the bucket is fully refilled during the period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses the limit in the "<requests>/<period>" format, where the period is a duration (like "30s") or a
+// unit ("s", "m" or "h"). For example: "10/s", "100/m", "5/30s".
+func ParseLimit(s string) (Limit, error) {
+	requestsStr, periodStr, found := strings.Cut(strings.TrimSpace(s), "/")
+	if !found {
+		return Limit{}, fmt.Errorf("wrong rate limit [%s] format (<requests>/<period> expected)", s)
+	}
+
+	requests, err := strconv.Atoi(requestsStr)
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("wrong rate limit [%s] requests count", s)
+	}
+
+	switch periodStr {
+	case "s", "m", "h":
+		periodStr = "1" + periodStr
+	}
+
+	period, err := time.ParseDuration(periodStr)
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("wrong rate limit [%s] period", s)
+	}
+
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+// ParseHostLimit parses the upstream host limit in the "<host pattern>=<limit>" format (e.g. "*.example.com=10/s").
+func ParseHostLimit(s string) (string, Limit, error) {
+	pattern, limitStr, found := strings.Cut(s, "=")
+	if pattern = strings.TrimSpace(pattern); !found || pattern == "" {
+		return "", Limit{}, fmt.Errorf("wrong host rate limit [%s] format (<host pattern>=<limit> expected)", s)
+	}
+
+	limit, err := ParseLimit(limitStr)
+	if err != nil {
+		return "", Limit{}, err
+	}
+
+	return pattern, limit, nil
+}
+
+// String returns the limit in the "<requests>/<period>" format.
+func (l Limit) String() string { return strconv.Itoa(l.Requests) + "/" + l.Period.String() }
+
+// Result is the rate limiting decision.
+type Result struct {
+	Allowed    bool
+	Limit      int           // the bucket capacity
+	Remaining  int           // tokens left in the bucket
+	Reset      time.Duration // time until the bucket is fully refilled
+	RetryAfter time.Duration // time until the next token (zero for the allowed requests)
+}
+
+// Limiter limits the requests rate for each key separately. Idle buckets (fully refilled) are evicted, so the memory
+// usage is bounded by the count of recently active keys (and by the maximal keys count, if it is set).
+type Limiter struct {
+	capacity float64
+	rate     float64 // tokens per second
+	period   time.Duration
+	maxKeys  int // zero means "no limit"
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element // values are *bucket
+	order   *list.List               // the least recently updated buckets are at the front
+	sweptAt time.Time
+	nowFunc func() time.Time
+}
+
+type bucket struct {
+	key       string
+	tokens    float64
+	updatedAt time.Time
+}
+
+// Option allows to configure the Limiter.
+type Option func(*Limiter)
+
+// WithClock sets the current time source (time.Now is used by default).
+func WithClock(now func() time.Time) Option { return func(l *Limiter) { l.nowFunc = now } }
+
+// WithMaxKeys limits the count of the active buckets. When the limit is reached, the least recently updated bucket
+// is evicted for the new key.
+func WithMaxKeys(n int) Option { return func(l *Limiter) { l.maxKeys = n } }
+
+// New creates a new Limiter.
+func New(limit Limit, opts ...Option) (*Limiter, error) {
+	if limit.Requests <= 0 || limit.Period <= 0 {
+		return nil, errors.New("rate limit requests count and period must be positive")
+	}
+
+	l := &Limiter{
+		capacity: float64(limit.Requests),
+		rate:     float64(limit.Requests) / limit.Period.Seconds(),
+		period:   limit.Period,
+		buckets:  make(map[string]*list.Element),
+		order:    list.New(),
+		nowFunc:  time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l, nil
+}
+
+// Allow takes a token from the key bucket, if possible.
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var now = l.nowFunc()
+
+	l.sweep(now)
+
+	var b *bucket
+
+	if el, exists := l.buckets[key]; exists {
+		b = el.Value.(*bucket)
+		b.tokens = math.Min(l.capacity, b.tokens+now.Sub(b.updatedAt).Seconds()*l.rate)
+
+		l.order.MoveToBack(el)
+	} else {
+		if l.maxKeys > 0 && len(l.buckets) >= l.maxKeys {
+			l.remove(l.order.Front())
+		}
+
+		b = &bucket{key: key, tokens: l.capacity}
+		l.buckets[key] = l.order.PushBack(b)
+	}
+
+	b.updatedAt = now
+
+	var result = Result{Limit: int(l.capacity)}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.duration(1 - b.tokens)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = l.duration(l.capacity - b.tokens)
+
+	return result
+}
+
+// Refund puts the token, taken by the allowed request, back into the key bucket (e.g. when the request is rejected by
+// another limiter later).
+func (l *Limiter) Refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, exists := l.buckets[key]; exists {
+		b := el.Value.(*bucket)
+		b.tokens = math.Min(l.capacity, b.tokens+1)
+	}
+}
+
+// Len returns the count of the active buckets.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.buckets)
+}
+
+// sweep evicts the buckets, that are fully refilled (such bucket is equal to a new one). Buckets are checked not more
+// often than once per period. The mutex must be locked.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < l.period {
+		return
+	}
+
+	l.sweptAt = now
+
+	for el := l.order.Front(); el != nil; el = l.order.Front() {
+		if now.Sub(el.Value.(*bucket).updatedAt) < l.period { // the rest buckets are updated later
+			return
+		}
+
+		l.remove(el)
+	}
+}
+
+// remove removes the bucket. The mutex must be locked.
+func (l *Limiter) remove(el *list.Element) {
+	delete(l.buckets, l.order.Remove(el).(*bucket).key)
+}
+
+// duration returns the time, required for the tokens refilling.
+func (l *Limiter) duration(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / l.rate * float64(time.Second)))
+}
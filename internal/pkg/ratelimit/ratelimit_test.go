@@ -0,0 +1,163 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/ratelimit"
+)
+
+func TestParseLimit(t *testing.T) {
+	for _, tt := range []struct {
+		give      string
+		wantLimit ratelimit.Limit
+		wantErr   bool
+	}{
+		{give: "10/s", wantLimit: ratelimit.Limit{Requests: 10, Period: time.Second}},
+		{give: " 100/m ", wantLimit: ratelimit.Limit{Requests: 100, Period: time.Minute}},
+		{give: "1000/h", wantLimit: ratelimit.Limit{Requests: 1000, Period: time.Hour}},
+		{give: "5/30s", wantLimit: ratelimit.Limit{Requests: 5, Period: time.Second * 30}},
+		{give: "10", wantErr: true},
+		{give: "0/s", wantErr: true},
+		{give: "foo/s", wantErr: true},
+		{give: "10/d", wantErr: true},
+		{give: "10/-1s", wantErr: true},
+	} {
+		tt := tt
+		t.Run(tt.give, func(t *testing.T) {
+			limit, err := ratelimit.ParseLimit(tt.give)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantLimit, limit)
+		})
+	}
+}
+
+func TestParseHostLimit(t *testing.T) {
+	pattern, limit, err := ratelimit.ParseHostLimit("*.example.com=10/s")
+	assert.NoError(t, err)
+	assert.Equal(t, "*.example.com", pattern)
+	assert.Equal(t, ratelimit.Limit{Requests: 10, Period: time.Second}, limit)
+
+	for _, give := range []string{"*.example.com", "=10/s", "example.com=foo"} {
+		_, _, err = ratelimit.ParseHostLimit(give)
+		assert.Error(t, err, give)
+	}
+}
+
+// fakeClock is the manually advanced time source.
+type fakeClock struct{ now time.Time }
+
+func newFakeClock() *fakeClock           { return &fakeClock{now: time.Unix(1_000_000, 0)} }
+func (c *fakeClock) Now() time.Time      { return c.now }
+func (c *fakeClock) Add(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestLimiter_Allow(t *testing.T) {
+	clock := newFakeClock()
+
+	l, err := ratelimit.New(ratelimit.Limit{Requests: 2, Period: time.Millisecond * 200}, ratelimit.WithClock(clock.Now))
+	assert.NoError(t, err)
+
+	first := l.Allow("foo")
+	assert.True(t, first.Allowed)
+	assert.Equal(t, 2, first.Limit)
+	assert.Equal(t, 1, first.Remaining)
+	assert.Zero(t, first.RetryAfter)
+
+	assert.True(t, l.Allow("foo").Allowed)
+
+	rejected := l.Allow("foo")
+	assert.False(t, rejected.Allowed)
+	assert.Equal(t, 0, rejected.Remaining)
+	assert.Equal(t, time.Millisecond*100, rejected.RetryAfter)
+	assert.Equal(t, time.Millisecond*200, rejected.Reset)
+
+	assert.True(t, l.Allow("bar").Allowed, "keys must have separate buckets")
+
+	clock.Add(rejected.RetryAfter - time.Millisecond)
+
+	assert.False(t, l.Allow("foo").Allowed, "bucket is not refilled yet")
+
+	clock.Add(time.Millisecond)
+
+	assert.True(t, l.Allow("foo").Allowed, "bucket must be refilled")
+}
+
+func TestLimiter_Refund(t *testing.T) {
+	l, err := ratelimit.New(ratelimit.Limit{Requests: 1, Period: time.Minute}, ratelimit.WithClock(newFakeClock().Now))
+	assert.NoError(t, err)
+
+	l.Refund("foo") // unknown key - nothing happens
+
+	assert.True(t, l.Allow("foo").Allowed)
+	assert.False(t, l.Allow("foo").Allowed)
+
+	l.Refund("foo")
+	l.Refund("foo") // the bucket capacity is not exceeded
+
+	assert.True(t, l.Allow("foo").Allowed)
+	assert.False(t, l.Allow("foo").Allowed)
+}
+
+func TestLimiter_Eviction(t *testing.T) {
+	clock := newFakeClock()
+
+	l, err := ratelimit.New(ratelimit.Limit{Requests: 1, Period: time.Millisecond * 50}, ratelimit.WithClock(clock.Now))
+	assert.NoError(t, err)
+
+	l.Allow("foo")
+	l.Allow("bar")
+
+	assert.Equal(t, 2, l.Len())
+
+	clock.Add(time.Millisecond * 50)
+
+	l.Allow("baz") // triggers the idle buckets eviction
+
+	assert.Equal(t, 1, l.Len())
+}
+
+func TestLimiter_MaxKeys(t *testing.T) {
+	clock := newFakeClock()
+
+	l, err := ratelimit.New(ratelimit.Limit{Requests: 1, Period: time.Minute},
+		ratelimit.WithClock(clock.Now),
+		ratelimit.WithMaxKeys(2),
+	)
+	assert.NoError(t, err)
+
+	assert.True(t, l.Allow("foo").Allowed)
+	clock.Add(time.Second)
+	assert.True(t, l.Allow("bar").Allowed)
+	clock.Add(time.Second)
+	assert.False(t, l.Allow("foo").Allowed) // "bar" is the least recently updated now
+	clock.Add(time.Second)
+
+	assert.True(t, l.Allow("baz").Allowed, "new keys must not be rejected, when the limit is reached")
+	assert.Equal(t, 2, l.Len())
+
+	assert.False(t, l.Allow("foo").Allowed, "the recently updated bucket must be kept")
+	assert.True(t, l.Allow("bar").Allowed, "the least recently updated bucket must be evicted")
+	assert.Equal(t, 2, l.Len())
+
+	clock.Add(time.Minute) // the idle buckets are evicted
+
+	assert.True(t, l.Allow("qux").Allowed)
+	assert.Equal(t, 1, l.Len())
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := ratelimit.New(ratelimit.Limit{Requests: 0, Period: time.Second})
+	assert.Error(t, err)
+
+	_, err = ratelimit.New(ratelimit.Limit{Requests: 1})
+	assert.Error(t, err)
+}
@@ -34,3 +34,24 @@ func FromHTTPRequest(r *http.Request) string {
 
 	return strings.Split(r.RemoteAddr, ":")[0]
 }
+
+// FromTrustedHTTPRequest extracts the client IP address from the HTTP request. The client IP headers are used only
+// for the requests from the trusted proxies (the remote address is within the trusted networks), so the clients cannot
+// spoof their addresses. Otherwise, the remote address is returned.
+func FromTrustedHTTPRequest(r *http.Request, trusted []*net.IPNet) string {
+	var remote = r.RemoteAddr
+
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	if ip := net.ParseIP(remote); ip != nil {
+		for _, n := range trusted {
+			if n.Contains(ip) {
+				return FromHTTPRequest(r)
+			}
+		}
+	}
+
+	return remote
+}
@@ -1,6 +1,7 @@
 package realip_test
 
 import (
+	"net"
 	"net/http"
 	"testing"
 
@@ -69,6 +70,31 @@ func TestFromHTTPRequest(t *testing.T) {
 	}
 }
 
+func TestFromTrustedHTTPRequest(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+
+	for _, tt := range []struct {
+		name           string
+		giveRemoteAddr string
+		wantIP         string
+	}{
+		{name: "untrusted remote addr", giveRemoteAddr: "4.3.2.1:567", wantIP: "4.3.2.1"},
+		{name: "untrusted IPv6 remote addr", giveRemoteAddr: "[2001:db8::1]:567", wantIP: "2001:db8::1"},
+		{name: "trusted proxy", giveRemoteAddr: "10.1.1.1:567", wantIP: "8.8.8.8"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "http://testing", nil)
+			req.RemoteAddr = tt.giveRemoteAddr
+			req.Header.Set("X-Forwarded-For", "8.8.8.8, 10.1.1.1")
+
+			if got := realip.FromTrustedHTTPRequest(req, []*net.IPNet{trusted}); got != tt.wantIP {
+				t.Errorf("want IP: %s, got: %s", tt.wantIP, got)
+			}
+		})
+	}
+}
+
 func BenchmarkFromHTTPRequest(b *testing.B) {
 	b.ReportAllocs()
 
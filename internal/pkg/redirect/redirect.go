@@ -0,0 +1,116 @@
+// Package redirect contains the upstream redirects policy: redirects are followed by the proxy, or passed through to
+// the clients (with the `Location` headers rewriting, so the clients keep going through the proxy).
+package redirect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+)
+
+// Mode is the redirects handling mode.
+type Mode string
+
+const (
+	ModeFollow Mode = "follow" // redirects are followed by the proxy
+	ModePass   Mode = "pass"   // 3xx responses are passed through to the client
+)
+
+// Header is the request header, that overrides the redirects mode for the request.
+const Header = "X-Proxy-Redirect"
+
+// Modes returns all supported modes.
+func Modes() []Mode { return []Mode{ModeFollow, ModePass} }
+
+// ParseMode parses the mode (case-insensitive).
+func ParseMode(s string) (Mode, error) {
+	for _, m := range Modes() {
+		if strings.EqualFold(strings.TrimSpace(s), string(m)) {
+			return m, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported redirects mode [%s]", s)
+}
+
+// Policy is the redirects handling policy.
+type Policy struct {
+	Mode         Mode
+	MaxRedirects int  // maximal number of the followed redirects (follow mode only)
+	SameHost     bool // only the same host redirects are followed, others are passed through (follow mode only)
+}
+
+type policyKey struct{}
+
+// WithPolicy returns a copy of the context with the redirects policy, that overrides the default one (see
+// CheckRedirect).
+func WithPolicy(ctx context.Context, p Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+// NotPermittedError is returned, when the redirect target is not permitted for the client (see auth.Permissions).
+type NotPermittedError struct {
+	Method, Host string
+}
+
+func (e *NotPermittedError) Error() string {
+	return "redirect to [" + e.Host + "] (" + e.Method + ") is not permitted for the client"
+}
+
+// CheckRedirect returns the http.Client CheckRedirect function, that handles the redirects using the request context
+// policy (see WithPolicy) or the fallback policy. The redirect targets are checked against the client permissions
+// (see auth.WithPermissions) of the request context too.
+func CheckRedirect(fallback Policy) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		p, ok := req.Context().Value(policyKey{}).(Policy)
+		if !ok {
+			p = fallback
+		}
+
+		switch {
+		case p.Mode == ModePass:
+			return http.ErrUseLastResponse
+
+		case p.SameHost && len(via) > 0 && !strings.EqualFold(req.URL.Host, via[0].URL.Host):
+			return http.ErrUseLastResponse
+
+		case !auth.PermissionsFromContext(req.Context()).Allows(req.Method, req.URL.Host):
+			return &NotPermittedError{Method: req.Method, Host: req.URL.Host}
+
+		case len(via) > p.MaxRedirects:
+			return fmt.Errorf("too many (%d) redirects", p.MaxRedirects)
+		}
+
+		return nil
+	}
+}
+
+// RewriteLocation rewrites the HTTP(S) location (the relative location is resolved using the base URL) into the
+// proxy route form: "{prefix}/{scheme}/{host}/{path}". Other locations are returned as is.
+func RewriteLocation(location string, base *url.URL, prefix string) string {
+	u, err := base.Parse(location)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return location
+	}
+
+	var path = u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	var rewritten = strings.TrimSuffix(prefix, "/") + "/" + u.Scheme + "/" + u.Host + path
+
+	if u.RawQuery != "" {
+		rewritten += "?" + u.RawQuery
+	}
+
+	if u.Fragment != "" {
+		rewritten += "#" + u.EscapedFragment()
+	}
+
+	return rewritten
+}
@@ -0,0 +1,148 @@
+package redirect_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/auth"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redirect"
+)
+
+func TestParseMode(t *testing.T) {
+	for give, want := range map[string]redirect.Mode{
+		"follow": redirect.ModeFollow,
+		" PASS ": redirect.ModePass,
+	} {
+		mode, err := redirect.ParseMode(give)
+		assert.NoError(t, err)
+		assert.Equal(t, want, mode)
+	}
+
+	_, err := redirect.ParseMode("foo")
+	assert.ErrorContains(t, err, "unsupported redirects mode [foo]")
+}
+
+func TestCheckRedirect(t *testing.T) {
+	var (
+		origin, _  = http.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+		same, _    = http.NewRequest(http.MethodGet, "https://EXAMPLE.com/foo", http.NoBody)
+		another, _ = http.NewRequest(http.MethodGet, "http://example.org/", http.NoBody)
+	)
+
+	for _, tt := range []struct {
+		name       string
+		givePolicy redirect.Policy
+		giveReq    *http.Request
+		giveVia    []*http.Request
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			name:       "followed",
+			givePolicy: redirect.Policy{Mode: redirect.ModeFollow, MaxRedirects: 2},
+			giveReq:    another,
+			giveVia:    []*http.Request{origin, same},
+		},
+		{
+			name:       "too many redirects",
+			givePolicy: redirect.Policy{Mode: redirect.ModeFollow, MaxRedirects: 2},
+			giveReq:    another,
+			giveVia:    []*http.Request{origin, same, same},
+			wantErrMsg: "too many (2) redirects",
+		},
+		{
+			name:       "passed through",
+			givePolicy: redirect.Policy{Mode: redirect.ModePass, MaxRedirects: 2},
+			giveReq:    same,
+			giveVia:    []*http.Request{origin},
+			wantErr:    http.ErrUseLastResponse,
+		},
+		{
+			name:       "same host is followed",
+			givePolicy: redirect.Policy{Mode: redirect.ModeFollow, MaxRedirects: 2, SameHost: true},
+			giveReq:    same,
+			giveVia:    []*http.Request{origin},
+		},
+		{
+			name:       "another host is passed through",
+			givePolicy: redirect.Policy{Mode: redirect.ModeFollow, MaxRedirects: 2, SameHost: true},
+			giveReq:    another,
+			giveVia:    []*http.Request{origin},
+			wantErr:    http.ErrUseLastResponse,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := redirect.CheckRedirect(tt.givePolicy)(tt.giveReq, tt.giveVia)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.EqualError(t, err, tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckRedirectContextPolicy(t *testing.T) {
+	var (
+		check     = redirect.CheckRedirect(redirect.Policy{Mode: redirect.ModeFollow, MaxRedirects: 3})
+		origin, _ = http.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+		ctx       = redirect.WithPolicy(context.Background(), redirect.Policy{Mode: redirect.ModePass})
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/foo", http.NoBody)
+
+	assert.NoError(t, check(req, []*http.Request{origin}))
+	assert.ErrorIs(t, check(req.WithContext(ctx), []*http.Request{origin}), http.ErrUseLastResponse)
+}
+
+func TestCheckRedirectPermissions(t *testing.T) {
+	var (
+		check     = redirect.CheckRedirect(redirect.Policy{Mode: redirect.ModeFollow, MaxRedirects: 3})
+		origin, _ = http.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+		ctx       = auth.WithPermissions(context.Background(),
+			auth.PermissionsFromScopes("proxy:host:example.com", "proxy:method:GET"),
+		)
+	)
+
+	allowed, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/foo", http.NoBody)
+	assert.NoError(t, check(allowed, []*http.Request{origin}))
+
+	for _, give := range []struct{ method, url string }{
+		{http.MethodGet, "http://example.org/"},  // forbidden host
+		{http.MethodPost, "http://example.com/"}, // forbidden method (307 and 308 redirects keep it)
+	} {
+		req, _ := http.NewRequestWithContext(ctx, give.method, give.url, http.NoBody)
+
+		var notPermitted *redirect.NotPermittedError
+
+		assert.ErrorAs(t, check(req, []*http.Request{origin}), &notPermitted)
+		assert.Equal(t, req.URL.Host, notPermitted.Host)
+		assert.Equal(t, give.method, notPermitted.Method)
+	}
+}
+
+func TestRewriteLocation(t *testing.T) {
+	base, _ := url.Parse("https://example.com/foo/bar?baz")
+
+	for give, want := range map[string]string{
+		"https://example.org/a/b?c=d#e": "/proxy/https/example.org/a/b?c=d#e",
+		"http://example.org:8080":       "/proxy/http/example.org:8080/",
+		"//example.org/a":               "/proxy/https/example.org/a",
+		"/a%20b":                        "/proxy/https/example.com/a%20b",
+		"baz?x=1":                       "/proxy/https/example.com/foo/baz?x=1",
+		"mailto:foo@example.com":        "mailto:foo@example.com",
+		"ftp://example.com/file":        "ftp://example.com/file",
+		"http://[::1":                   "http://[::1",
+	} {
+		assert.Equal(t, want, redirect.RewriteLocation(give, base, "/proxy/"), give)
+	}
+}
@@ -0,0 +1,481 @@
+// Package redis contains the minimal Redis (RESP2 protocol) client with the connections pool. The cache uses only a
+// few simple commands (GET, SET, DEL and SCAN), so the small client is used instead of the full-featured one (like
+// go-redis), which brings the RESP3, cluster and sentinel support, and the extra dependencies, that are not needed.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNil is returned, when the key does not exist (the nil reply is received).
+var ErrNil = errors.New("redis: nil")
+
+// Error is the error reply from the server.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// Options are the connection options.
+type Options struct {
+	Addr     string // host:port
+	Username string // ACL user name (empty means "default")
+	Password string // empty means "without authentication"
+	DB       int
+
+	PoolSize int           // maximal count of the idle connections
+	Timeout  time.Duration // dialing and commands timeout, when the context has no deadline
+}
+
+const (
+	defaultPort     = "6379"
+	defaultPoolSize = 10
+	defaultTimeout  = time.Second * 5
+)
+
+// ParseURL parses the connection URL, like "redis://[[user]:password@]host[:port][/db]".
+func ParseURL(rawURL string) (Options, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Options{}, err
+	}
+
+	if u.Scheme != "redis" {
+		return Options{}, fmt.Errorf("unsupported redis URL scheme [%s]", u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return Options{}, errors.New("redis host is required")
+	}
+
+	var opts = Options{Addr: u.Host}
+
+	if u.Port() == "" {
+		opts.Addr = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	if u.User != nil {
+		opts.Username = u.User.Username()
+		opts.Password, _ = u.User.Password()
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if opts.DB, err = strconv.Atoi(db); err != nil || opts.DB < 0 {
+			return Options{}, fmt.Errorf("wrong redis database number [%s]", db)
+		}
+	}
+
+	return opts, nil
+}
+
+// Client is the Redis client. It is safe for concurrent use.
+type Client struct {
+	opts   Options
+	dialer net.Dialer
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// New creates a new Client. Connections are established lazily.
+func New(opts Options) *Client {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = defaultPoolSize
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	return &Client{opts: opts, dialer: net.Dialer{Timeout: opts.Timeout}}
+}
+
+// Do sends the command and returns the reply: string (simple string), int64, []byte (bulk string) or
+// []interface{} (array). Arguments can be strings, byte slices or integers. Nil replies are returned as ErrNil.
+//
+// When the idle connection turns out to be broken (e.g. the server was restarted), the command is retried once using
+// a new connection, so the command must be idempotent.
+func (c *Client) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	cn, reused, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(ctx, cn, args)
+
+	if err != nil && reused && isConnError(err) && ctx.Err() == nil {
+		if cn, err = c.dial(ctx); err != nil {
+			return nil, err
+		}
+
+		reply, err = c.do(ctx, cn, args)
+	}
+
+	return reply, err
+}
+
+// do sends the command using the connection, and puts the connection back into the pool (or closes it, when its
+// state is unknown).
+func (c *Client) do(ctx context.Context, cn *conn, args []interface{}) (interface{}, error) {
+	reply, err := c.roundTrip(ctx, cn, args)
+
+	if isConnError(err) {
+		_ = cn.Close()
+	} else {
+		c.put(cn)
+	}
+
+	return reply, err
+}
+
+// isConnError reports whether the error is the connection (I/O or protocol) error, after which the connection state
+// is unknown.
+func isConnError(err error) bool {
+	var redisErr Error
+
+	return err != nil && !errors.Is(err, ErrNil) && !errors.As(err, &redisErr)
+}
+
+// Close closes the idle connections. The client cannot be used after closing.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
+	for _, cn := range c.idle {
+		_ = cn.Close()
+	}
+
+	c.idle = nil
+
+	return nil
+}
+
+// Ping checks the server availability.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+
+	return err
+}
+
+// Get returns the key value or ErrNil, if the key does not exist.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return nil, err
+	}
+
+	if b, ok := reply.([]byte); ok {
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("redis: unexpected GET reply type %T", reply)
+}
+
+// Set sets the key value with the TTL (zero means "without expiration").
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	var args = []interface{}{"SET", key, value}
+
+	if ttl > 0 {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+
+	_, err := c.Do(ctx, args...)
+
+	return err
+}
+
+// Del removes the keys.
+func (c *Client) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	var args = make([]interface{}, 0, len(keys)+1)
+
+	args = append(args, "DEL")
+
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	_, err := c.Do(ctx, args...)
+
+	return err
+}
+
+// Scan returns all the keys, that match the glob-style pattern (using the SCAN command, so the server is not
+// blocked).
+func (c *Client) Scan(ctx context.Context, pattern string) ([]string, error) {
+	var (
+		keys   []string
+		cursor = "0"
+	)
+
+	for {
+		reply, err := c.Do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", 1000) //nolint:gomnd
+		if err != nil {
+			return nil, err
+		}
+
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 2 { //nolint:gomnd
+			return nil, errors.New("redis: unexpected SCAN reply")
+		}
+
+		next, _ := items[0].([]byte)
+		batch, _ := items[1].([]interface{})
+
+		for _, item := range batch {
+			if key, isBytes := item.([]byte); isBytes {
+				keys = append(keys, string(key))
+			}
+		}
+
+		if cursor = string(next); cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
+
+// get returns the idle connection (reused is true in this case) or dials a new one.
+func (c *Client) get(ctx context.Context) (_ *conn, reused bool, _ error) {
+	c.mu.Lock()
+
+	if c.closed {
+		c.mu.Unlock()
+
+		return nil, false, errors.New("redis: client is closed")
+	}
+
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+
+		return cn, true, nil
+	}
+
+	c.mu.Unlock()
+
+	cn, err := c.dial(ctx)
+
+	return cn, false, err
+}
+
+// dial establishes a new connection.
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	netConn, err := c.dialer.DialContext(ctx, "tcp", c.opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{Conn: netConn, r: bufio.NewReader(netConn)}
+
+	if err = c.handshake(ctx, cn); err != nil {
+		_ = cn.Close()
+
+		return nil, err
+	}
+
+	return cn, nil
+}
+
+// handshake authenticates the connection and selects the database.
+func (c *Client) handshake(ctx context.Context, cn *conn) error {
+	if c.opts.Password != "" {
+		var args = []interface{}{"AUTH", c.opts.Password}
+
+		if c.opts.Username != "" {
+			args = []interface{}{"AUTH", c.opts.Username, c.opts.Password}
+		}
+
+		if _, err := c.roundTrip(ctx, cn, args); err != nil {
+			return err
+		}
+	}
+
+	if c.opts.DB != 0 {
+		if _, err := c.roundTrip(ctx, cn, []interface{}{"SELECT", c.opts.DB}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// put returns the connection into the pool (or closes it, when the pool is full).
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || len(c.idle) >= c.opts.PoolSize {
+		_ = cn.Close()
+
+		return
+	}
+
+	c.idle = append(c.idle, cn)
+}
+
+func (c *Client) roundTrip(ctx context.Context, cn *conn, args []interface{}) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(c.opts.Timeout)
+	}
+
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if err := writeCommand(cn, args); err != nil {
+		return nil, err
+	}
+
+	return ReadReply(cn.r)
+}
+
+// writeCommand writes the command as the array of bulk strings.
+func writeCommand(w io.Writer, args []interface{}) error {
+	var buf = make([]byte, 0, 64) //nolint:gomnd
+
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+
+	for _, arg := range args {
+		var b []byte
+
+		switch v := arg.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		case int:
+			b = strconv.AppendInt(nil, int64(v), 10)
+		case int64:
+			b = strconv.AppendInt(nil, v, 10)
+		default:
+			return fmt.Errorf("redis: unsupported argument type %T", arg)
+		}
+
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(b)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, b...)
+		buf = append(buf, '\r', '\n')
+	}
+
+	_, err := w.Write(buf)
+
+	return err
+}
+
+// ReadReply reads the single reply (RESP2 protocol).
+func ReadReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return nil, Error(line[1:])
+
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$':
+		return readBulk(r, line[1:])
+
+	case '*':
+		return readArray(r, line[1:])
+	}
+
+	return nil, fmt.Errorf("redis: unexpected reply type [%c]", line[0])
+}
+
+// readBulk reads the bulk string payload with the declared size.
+func readBulk(r *bufio.Reader, header string) (interface{}, error) {
+	size, err := strconv.Atoi(header)
+	if err != nil {
+		return nil, err
+	}
+
+	if size < 0 {
+		return nil, ErrNil
+	}
+
+	var b = make([]byte, size+2) //nolint:gomnd // including the trailing CRLF
+	if _, err = io.ReadFull(r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return b[:size], nil
+}
+
+// readArray reads the declared count of the array items (nil items are kept as nil values).
+func readArray(r *bufio.Reader, header string) (interface{}, error) {
+	count, err := strconv.Atoi(header)
+	if err != nil {
+		return nil, err
+	}
+
+	if count < 0 {
+		return nil, ErrNil
+	}
+
+	var items = make([]interface{}, 0, count)
+
+	for i := 0; i < count; i++ {
+		item, itemErr := ReadReply(r)
+		if itemErr != nil && !errors.Is(itemErr, ErrNil) {
+			return nil, unexpectedEOF(itemErr)
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF (the reply is truncated, when its header is read already).
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
@@ -0,0 +1,375 @@
+// Package redistest contains the in-memory Redis server stand-in for testing. Only a small subset of commands is
+// supported: PING, AUTH, SELECT, GET, SET (with the EX and PX options), DEL, EXISTS, SCAN (the MATCH patterns support
+// "*" and "?" wildcards only) and FLUSHALL.
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redis"
+)
+
+// Server is the Redis server stand-in, listening on the loopback interface.
+type Server struct {
+	l  net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	password string // empty means "without authentication"
+	data     map[string]item
+	conns    map[net.Conn]struct{}
+	closing  bool
+	truncate bool // the next reply is written partially, and the connection is closed
+}
+
+type item struct {
+	value     []byte
+	expiresAt time.Time // zero means "without expiration"
+}
+
+// NewServer starts and returns a new Server. The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("redistest: failed to listen on a port: %v", err))
+	}
+
+	s := &Server{l: l, data: make(map[string]item), conns: make(map[net.Conn]struct{})}
+
+	s.wg.Add(1)
+
+	go s.serve()
+
+	return s
+}
+
+// RequirePassword makes the server require the AUTH command with the password for the new connections.
+func (s *Server) RequirePassword(password string) {
+	s.mu.Lock()
+	s.password = password
+	s.mu.Unlock()
+}
+
+// DropConnections closes all the current client connections (like the server restart does). New connections are
+// accepted as usual.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		_ = c.Close()
+	}
+}
+
+// TruncateNextReply makes the server write only a part of the next reply and close the connection.
+func (s *Server) TruncateNextReply() {
+	s.mu.Lock()
+	s.truncate = true
+	s.mu.Unlock()
+}
+
+// Addr returns the server address (host:port).
+func (s *Server) Addr() string { return s.l.Addr().String() }
+
+// URL returns the server connection URL (like "redis://127.0.0.1:12345").
+func (s *Server) URL() string { return "redis://" + s.Addr() }
+
+// Keys returns the count of stored (not expired) keys.
+func (s *Server) Keys() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int
+
+	for key := range s.data {
+		if _, ok := s.lookup(key); ok {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Close shuts down the server and closes all the client connections.
+func (s *Server) Close() {
+	_ = s.l.Close()
+
+	s.mu.Lock()
+	s.closing = true
+
+	for c := range s.conns {
+		_ = c.Close()
+	}
+
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+
+		if s.closing {
+			s.mu.Unlock()
+			_ = c.Close()
+
+			return
+		}
+
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+
+		_ = c.Close()
+		s.wg.Done()
+	}()
+
+	s.mu.Lock()
+	var password = s.password
+	s.mu.Unlock()
+
+	var (
+		r             = bufio.NewReader(c)
+		authenticated = password == ""
+	)
+
+	for {
+		request, err := redis.ReadReply(r)
+		if err != nil {
+			return
+		}
+
+		args, ok := request.([]interface{})
+		if !ok || len(args) == 0 {
+			return
+		}
+
+		var cmd = make([]string, 0, len(args))
+
+		for _, arg := range args {
+			b, _ := arg.([]byte)
+			cmd = append(cmd, string(b))
+		}
+
+		var reply string
+
+		switch name := strings.ToUpper(cmd[0]); {
+		case name == "AUTH":
+			if authenticated = cmd[len(cmd)-1] == password; authenticated {
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+
+		default:
+			reply = s.exec(name, cmd[1:])
+		}
+
+		s.mu.Lock()
+		var truncate = s.truncate
+		s.truncate = false
+		s.mu.Unlock()
+
+		if truncate {
+			_, _ = c.Write([]byte(reply[:len(reply)/2]))
+
+			return
+		}
+
+		if _, err = c.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) exec(name string, args []string) string { //nolint:funlen
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch name {
+	case "PING":
+		return "+PONG\r\n"
+
+	case "SELECT", "FLUSHALL":
+		if name == "FLUSHALL" {
+			s.data = make(map[string]item)
+		}
+
+		return "+OK\r\n"
+
+	case "GET":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+
+		if value, ok := s.lookup(args[0]); ok {
+			return bulk(value)
+		}
+
+		return "$-1\r\n"
+
+	case "SET":
+		if len(args) != 2 && len(args) != 4 { //nolint:gomnd
+			return wrongArgs(name)
+		}
+
+		var it = item{value: []byte(args[1])}
+
+		if len(args) == 4 { //nolint:gomnd
+			ttl, err := parseTTL(args[2], args[3])
+			if err != nil {
+				return "-ERR " + err.Error() + "\r\n"
+			}
+
+			it.expiresAt = time.Now().Add(ttl)
+		}
+
+		s.data[args[0]] = it
+
+		return "+OK\r\n"
+
+	case "DEL", "EXISTS":
+		var count int
+
+		for _, key := range args {
+			if _, ok := s.lookup(key); ok {
+				count++
+
+				if name == "DEL" {
+					delete(s.data, key)
+				}
+			}
+		}
+
+		return ":" + strconv.Itoa(count) + "\r\n"
+
+	case "SCAN": // all the keys are returned at once
+		var (
+			pattern = "*"
+			keys    []string
+		)
+
+		for i := 1; i+1 < len(args); i += 2 {
+			if strings.EqualFold(args[i], "MATCH") {
+				pattern = args[i+1]
+			}
+		}
+
+		for key := range s.data {
+			if _, ok := s.lookup(key); ok {
+				if globMatch(pattern, key) {
+					keys = append(keys, key)
+				}
+			}
+		}
+
+		var b strings.Builder
+
+		b.WriteString("*2\r\n$1\r\n0\r\n*" + strconv.Itoa(len(keys)) + "\r\n")
+
+		for _, key := range keys {
+			b.WriteString(bulk([]byte(key)))
+		}
+
+		return b.String()
+	}
+
+	return "-ERR unknown command '" + name + "'\r\n"
+}
+
+// lookup returns the key value, removing the expired keys. The lock must be held.
+func (s *Server) lookup(key string) ([]byte, bool) {
+	it, ok := s.data[key]
+	if !ok {
+		return nil, false
+	}
+
+	if !it.expiresAt.IsZero() && !time.Now().Before(it.expiresAt) {
+		delete(s.data, key)
+
+		return nil, false
+	}
+
+	return it.value, true
+}
+
+func parseTTL(unit, value string) (time.Duration, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errors.New("invalid expire time in 'set' command")
+	}
+
+	switch strings.ToUpper(unit) {
+	case "EX":
+		return time.Duration(n) * time.Second, nil
+	case "PX":
+		return time.Duration(n) * time.Millisecond, nil
+	}
+
+	return 0, errors.New("syntax error")
+}
+
+// globMatch reports whether the string matches the glob-style pattern (unlike path.Match, "*" matches "/" too).
+func globMatch(pattern, s string) bool {
+	var b strings.Builder
+
+	b.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("$")
+
+	matched, _ := regexp.MatchString(b.String(), s)
+
+	return matched
+}
+
+func bulk(b []byte) string { return "$" + strconv.Itoa(len(b)) + "\r\n" + string(b) + "\r\n" }
+
+func wrongArgs(name string) string {
+	return "-ERR wrong number of arguments for '" + strings.ToLower(name) + "' command\r\n"
+}
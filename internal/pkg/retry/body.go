@@ -0,0 +1,62 @@
+package retry
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// bufferBody makes the request body replayable (sets the GetBody function). The body is read into the memory, when
+// its size does not exceed the limit; otherwise the request is left as is (the already read part is not lost), and
+// false is returned.
+func bufferBody(req *http.Request, limit int64) (bool, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return true, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return false, err
+	}
+
+	if int64(len(buf)) > limit {
+		req.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(buf), req.Body), Closer: req.Body}
+
+		return false, nil
+	}
+
+	_ = req.Body.Close()
+
+	req.ContentLength = int64(len(buf))
+	req.GetBody = func() (io.ReadCloser, error) {
+		if len(buf) == 0 {
+			return http.NoBody, nil
+		}
+
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+	req.Body, _ = req.GetBody()
+
+	return true, nil
+}
+
+// rewind returns the request copy with the fresh body for the next attempt.
+func rewind(req *http.Request) (*http.Request, error) {
+	next := req.Clone(req.Context())
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		next.Body = body
+	}
+
+	return next, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,272 @@
+// Package retry contains the HTTP client, that retries the transient upstream failures with the exponential
+// backoff.
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/netpolicy"
+)
+
+type httpClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+type metrics interface {
+	IncrementRetries()
+	IncrementExhausted()
+}
+
+// Client is an HTTP client, that retries the idempotent requests (and the non-idempotent ones with the
+// "Idempotency-Key" header) on the connection errors, timeouts and the retryable response status codes.
+type Client struct {
+	next httpClient
+	m    metrics
+
+	maxRetries  int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	budget      time.Duration // zero means "limited by the request context only"
+	statusCodes map[int]struct{}
+	maxBodySize int64
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+const (
+	// IdempotencyKeyHeader marks the non-idempotent request as safe to retry.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	defaultMaxRetries  = 2
+	defaultBackoff     = time.Millisecond * 100
+	defaultMaxBackoff  = time.Second * 2
+	defaultMaxBodySize = 64 << 10 // 64 KiB
+)
+
+// DefaultStatusCodes are the response status codes, that are retried by default.
+func DefaultStatusCodes() []int {
+	return []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+}
+
+// Option allows to configure the Client.
+type Option func(*Client)
+
+// WithMaxRetries sets the maximal count of retries (the first attempt is not counted).
+func WithMaxRetries(n int) Option { return func(c *Client) { c.maxRetries = n } }
+
+// WithBackoff sets the delay before the first retry and the maximal delay. The delay is doubled for each next retry,
+// and the random jitter (up to the half of the delay) is subtracted from it.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(c *Client) { c.backoff, c.maxBackoff = initial, max }
+}
+
+// WithBudget sets the overall time limit for all the attempts (including the delays between them). A retry is not
+// made, when it cannot be started before the budget is exhausted. Zero value means "no limit".
+func WithBudget(d time.Duration) Option { return func(c *Client) { c.budget = d } }
+
+// WithStatusCodes sets the response status codes, that are retried.
+func WithStatusCodes(codes ...int) Option {
+	return func(c *Client) {
+		c.statusCodes = make(map[int]struct{}, len(codes))
+
+		for _, code := range codes {
+			c.statusCodes[code] = struct{}{}
+		}
+	}
+}
+
+// WithMaxBodySize sets the maximal size of the request body, that is buffered to be replayed. Requests with the
+// larger bodies are sent without retrying.
+func WithMaxBodySize(size int64) Option { return func(c *Client) { c.maxBodySize = size } }
+
+// NewClient creates a new retrying Client.
+func NewClient(next httpClient, m metrics, opts ...Option) *Client {
+	c := &Client{
+		next:        next,
+		m:           m,
+		maxRetries:  defaultMaxRetries,
+		backoff:     defaultBackoff,
+		maxBackoff:  defaultMaxBackoff,
+		maxBodySize: defaultMaxBodySize,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec // jitter is not a secret
+	}
+
+	WithStatusCodes(DefaultStatusCodes()...)(c)
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Do sends the request, retrying it on the transient failures. The last attempt result is returned, when all the
+// retries are exhausted.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if c.maxRetries <= 0 || !isRetryable(req) {
+		return c.next.Do(req)
+	}
+
+	replayable, err := bufferBody(req, c.maxBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	if !replayable {
+		return c.next.Do(req)
+	}
+
+	var (
+		ctx      = req.Context()
+		deadline = c.deadline(ctx)
+	)
+
+	for attempt := 0; ; attempt++ {
+		resp, doErr := c.next.Do(req)
+
+		if !c.shouldRetry(ctx, resp, doErr) {
+			return resp, doErr
+		}
+
+		if attempt >= c.maxRetries {
+			c.m.IncrementExhausted()
+
+			return resp, doErr
+		}
+
+		var delay = c.delay(attempt, resp)
+
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return resp, doErr // there is no time for one more attempt
+		}
+
+		if resp != nil { // the response is discarded, so the connection can be reused
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, c.maxBodySize))
+			_ = resp.Body.Close()
+		}
+
+		if !sleep(ctx, delay) {
+			return nil, ctx.Err()
+		}
+
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+
+		c.m.IncrementRetries()
+	}
+}
+
+// deadline returns the time, after which the retries are not made (zero, if there is no limit).
+func (c *Client) deadline(ctx context.Context) time.Time {
+	var deadline, ok = ctx.Deadline()
+
+	if c.budget > 0 {
+		if budgetDeadline := time.Now().Add(c.budget); !ok || budgetDeadline.Before(deadline) {
+			return budgetDeadline
+		}
+	}
+
+	return deadline
+}
+
+// shouldRetry checks whether the attempt result is a transient failure.
+func (c *Client) shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil { // the client has gone, or the request timeout is exceeded
+		return false
+	}
+
+	if err != nil {
+		return isTransientError(err)
+	}
+
+	_, retryable := c.statusCodes[resp.StatusCode]
+
+	return retryable
+}
+
+// delay returns the jittered exponential backoff delay before the next attempt. The upstream "Retry-After" header
+// value is used, when it is greater.
+func (c *Client) delay(attempt int, resp *http.Response) time.Duration {
+	var d = c.backoff
+
+	for i := 0; i < attempt && d < c.maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+
+	if half := int64(d / 2); half > 0 { //nolint:gomnd
+		c.randMu.Lock()
+		d -= time.Duration(c.rand.Int63n(half))
+		c.randMu.Unlock()
+	}
+
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			if retryAfter := time.Duration(seconds) * time.Second; retryAfter > d {
+				return retryAfter
+			}
+		}
+	}
+
+	return d
+}
+
+// isRetryable checks whether the request can be safely sent more than once.
+func isRetryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// isTransientError checks whether the error is a connection error or timeout. The requests, blocked by the upstream
+// policy, TLS errors and redirect policy errors are not retried.
+func isTransientError(err error) bool {
+	var blocked *netpolicy.BlockedError
+	if errors.As(err, &blocked) {
+		return false
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) { // url.Error implements net.Error itself, so it must be unwrapped
+		err = urlErr.Err
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// sleep waits for the duration. It returns false, if the context is canceled earlier.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
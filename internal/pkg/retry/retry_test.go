@@ -0,0 +1,324 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/netpolicy"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/retry"
+)
+
+type fakeMetrics struct {
+	mu                 sync.Mutex
+	retries, exhausted int
+}
+
+func (m *fakeMetrics) IncrementRetries()   { m.mu.Lock(); m.retries++; m.mu.Unlock() }
+func (m *fakeMetrics) IncrementExhausted() { m.mu.Lock(); m.exhausted++; m.mu.Unlock() }
+
+// fakeUpstream responds using the results list (the last result is repeated) and records the received bodies.
+type fakeUpstream struct {
+	results []interface{} // status code (int) or error
+	bodies  []string
+}
+
+func (u *fakeUpstream) Do(req *http.Request) (*http.Response, error) {
+	var body string
+
+	if req.Body != nil {
+		b, _ := io.ReadAll(req.Body)
+		body = string(b)
+	}
+
+	u.bodies = append(u.bodies, body)
+
+	var result = u.results[len(u.results)-1]
+	if len(u.bodies) <= len(u.results) {
+		result = u.results[len(u.bodies)-1]
+	}
+
+	if err, isErr := result.(error); isErr {
+		return nil, err
+	}
+
+	return &http.Response{
+		StatusCode: result.(int),
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("upstream")),
+	}, nil
+}
+
+func connectionRefused() error {
+	return &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}
+}
+
+func TestClient_Do(t *testing.T) {
+	blocked := &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{
+		Op: "dial", Err: &netpolicy.BlockedError{Address: "127.0.0.1:80", Reason: "network is denied"},
+	}}
+
+	for name, tt := range map[string]struct {
+		giveMethod    string
+		giveBody      string
+		giveHeaders   map[string]string
+		giveResults   []interface{}
+		giveOptions   []retry.Option
+		wantStatus    int
+		wantError     bool
+		wantBodies    []string
+		wantRetries   int
+		wantExhausted int
+	}{
+		"success": {
+			giveMethod:  http.MethodGet,
+			giveResults: []interface{}{http.StatusOK},
+			wantStatus:  http.StatusOK,
+			wantBodies:  []string{""},
+		},
+		"retried status codes": {
+			giveMethod:  http.MethodGet,
+			giveResults: []interface{}{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK},
+			wantStatus:  http.StatusOK,
+			wantBodies:  []string{"", "", ""},
+			wantRetries: 2,
+		},
+		"not retried status code": {
+			giveMethod:  http.MethodGet,
+			giveResults: []interface{}{http.StatusInternalServerError, http.StatusOK},
+			wantStatus:  http.StatusInternalServerError,
+			wantBodies:  []string{""},
+		},
+		"custom status codes": {
+			giveMethod:  http.MethodGet,
+			giveResults: []interface{}{http.StatusInternalServerError, http.StatusOK},
+			giveOptions: []retry.Option{retry.WithStatusCodes(http.StatusInternalServerError)},
+			wantStatus:  http.StatusOK,
+			wantBodies:  []string{"", ""},
+			wantRetries: 1,
+		},
+		"retries exhausted": {
+			giveMethod:    http.MethodGet,
+			giveResults:   []interface{}{http.StatusServiceUnavailable},
+			wantStatus:    http.StatusServiceUnavailable,
+			wantBodies:    []string{"", "", ""},
+			wantRetries:   2,
+			wantExhausted: 1,
+		},
+		"connection error": {
+			giveMethod:  http.MethodHead,
+			giveResults: []interface{}{connectionRefused(), http.StatusOK},
+			wantStatus:  http.StatusOK,
+			wantBodies:  []string{"", ""},
+			wantRetries: 1,
+		},
+		"connection error exhausted": {
+			giveMethod:    http.MethodGet,
+			giveResults:   []interface{}{connectionRefused()},
+			giveOptions:   []retry.Option{retry.WithMaxRetries(1)},
+			wantError:     true,
+			wantBodies:    []string{"", ""},
+			wantRetries:   1,
+			wantExhausted: 1,
+		},
+		"blocked upstream": {
+			giveMethod:  http.MethodGet,
+			giveResults: []interface{}{blocked, http.StatusOK},
+			wantError:   true,
+			wantBodies:  []string{""},
+		},
+		"not transient error": {
+			giveMethod:  http.MethodGet,
+			giveResults: []interface{}{&url.Error{Op: "Get", URL: "/", Err: errors.New("too many redirects")}},
+			wantError:   true,
+			wantBodies:  []string{""},
+		},
+		"idempotent method with body": {
+			giveMethod:  http.MethodPut,
+			giveBody:    "foo",
+			giveResults: []interface{}{http.StatusBadGateway, http.StatusOK},
+			wantStatus:  http.StatusOK,
+			wantBodies:  []string{"foo", "foo"},
+			wantRetries: 1,
+		},
+		"non-idempotent method": {
+			giveMethod:  http.MethodPost,
+			giveBody:    "foo",
+			giveResults: []interface{}{http.StatusBadGateway, http.StatusOK},
+			wantStatus:  http.StatusBadGateway,
+			wantBodies:  []string{"foo"},
+		},
+		"non-idempotent method with idempotency key": {
+			giveMethod:  http.MethodPost,
+			giveBody:    "foo",
+			giveHeaders: map[string]string{"Idempotency-Key": "bar"},
+			giveResults: []interface{}{http.StatusBadGateway, http.StatusOK},
+			wantStatus:  http.StatusOK,
+			wantBodies:  []string{"foo", "foo"},
+			wantRetries: 1,
+		},
+		"body over the limit": {
+			giveMethod:  http.MethodPut,
+			giveBody:    "foobar",
+			giveResults: []interface{}{http.StatusBadGateway, http.StatusOK},
+			giveOptions: []retry.Option{retry.WithMaxBodySize(5)},
+			wantStatus:  http.StatusBadGateway,
+			wantBodies:  []string{"foobar"},
+		},
+		"body at the limit": {
+			giveMethod:  http.MethodPut,
+			giveBody:    "foobar",
+			giveResults: []interface{}{http.StatusBadGateway, http.StatusOK},
+			giveOptions: []retry.Option{retry.WithMaxBodySize(6)},
+			wantStatus:  http.StatusOK,
+			wantBodies:  []string{"foobar", "foobar"},
+			wantRetries: 1,
+		},
+		"disabled": {
+			giveMethod:  http.MethodGet,
+			giveResults: []interface{}{http.StatusBadGateway, http.StatusOK},
+			giveOptions: []retry.Option{retry.WithMaxRetries(0)},
+			wantStatus:  http.StatusBadGateway,
+			wantBodies:  []string{""},
+		},
+		"budget exhausted": {
+			giveMethod:  http.MethodGet,
+			giveResults: []interface{}{http.StatusBadGateway, http.StatusOK},
+			giveOptions: []retry.Option{
+				retry.WithBackoff(time.Second, time.Second), retry.WithBudget(time.Millisecond * 100),
+			},
+			wantStatus: http.StatusBadGateway,
+			wantBodies: []string{""},
+		},
+	} {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			var (
+				upstream = &fakeUpstream{results: tt.giveResults}
+				m        = &fakeMetrics{}
+				client   = retry.NewClient(upstream, m, append(
+					[]retry.Option{retry.WithBackoff(time.Millisecond, time.Millisecond*5)}, tt.giveOptions...,
+				)...)
+			)
+
+			var body io.Reader = http.NoBody
+			if tt.giveBody != "" {
+				body = io.NopCloser(strings.NewReader(tt.giveBody)) // unknown length, like the proxied requests
+			}
+
+			req, _ := http.NewRequest(tt.giveMethod, "http://example.com/", body)
+
+			for k, v := range tt.giveHeaders {
+				req.Header.Set(k, v)
+			}
+
+			resp, err := client.Do(req)
+
+			if tt.wantError {
+				assert.Error(t, err)
+				assert.Nil(t, resp)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+				b, _ := io.ReadAll(resp.Body)
+				assert.Equal(t, "upstream", string(b))
+			}
+
+			assert.Equal(t, tt.wantBodies, upstream.bodies)
+			assert.Equal(t, tt.wantRetries, m.retries)
+			assert.Equal(t, tt.wantExhausted, m.exhausted)
+		})
+	}
+}
+
+func TestClient_DoCanceled(t *testing.T) {
+	var (
+		upstream = &fakeUpstream{results: []interface{}{http.StatusBadGateway}}
+		m        = &fakeMetrics{}
+		client   = retry.NewClient(upstream, m, retry.WithBackoff(time.Second, time.Second))
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/", http.NoBody)
+
+	time.AfterFunc(time.Millisecond*10, cancel)
+
+	resp, err := client.Do(req)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, resp)
+	assert.Len(t, upstream.bodies, 1)
+	assert.Equal(t, 0, m.retries)
+}
+
+func TestClient_DoWithServer(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+
+	// the listener is closed, so the connections are refused
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	addr := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+
+	// the upstream starts listening after the first attempt
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		l, listenErr := net.Listen("tcp", addr)
+		if listenErr != nil {
+			return
+		}
+
+		go func() {
+			_ = http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { //nolint:gosec
+				mu.Lock()
+				calls++
+				mu.Unlock()
+
+				_, _ = w.Write([]byte("ok"))
+			}))
+		}()
+
+		t.Cleanup(func() { _ = l.Close() })
+	}()
+
+	m := &fakeMetrics{}
+	client := retry.NewClient(&http.Client{}, m,
+		retry.WithMaxRetries(10), retry.WithBackoff(time.Millisecond*10, time.Millisecond*20),
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/", http.NoBody)
+
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+
+	defer func() { _ = resp.Body.Close() }()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	mu.Lock()
+	assert.Equal(t, 1, calls)
+	mu.Unlock()
+
+	assert.Positive(t, m.retries)
+	assert.Equal(t, 0, m.exhausted)
+}
@@ -0,0 +1,93 @@
+package rewrite
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// urlAttributes are the HTML attributes with the single URL values.
+var urlAttributes = map[string]struct{}{ //nolint:gochecknoglobals
+	"href": {}, "src": {}, "action": {}, "formaction": {}, "poster": {},
+}
+
+// writeHTML rewrites the HTML document using the streaming tokenizer: the tokens without the URLs are written as is
+// (byte-to-byte), and the tags with the URLs are re-serialized.
+func (rw *Rewriter) writeHTML(w io.Writer, r io.Reader, base *url.URL) error {
+	var (
+		z       = html.NewTokenizer(r)
+		inStyle bool
+	)
+
+	for {
+		tt := z.Next()
+
+		var out = append([]byte(nil), z.Raw()...) // the raw buffer is modified (lower-cased) by the z.Token() call
+
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF { //nolint:errorlint // io.EOF is never wrapped by the tokenizer
+				return err
+			}
+
+			return nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+
+			if token.Data == "base" { // the following relative URLs are resolved using the base URL
+				for _, attr := range token.Attr {
+					if attr.Key == "href" {
+						if u, err := base.Parse(strings.TrimSpace(attr.Val)); err == nil {
+							base = u
+						}
+					}
+				}
+			}
+
+			if rw.rewriteAttributes(token.Attr, base) {
+				out = []byte(token.String())
+			}
+
+			inStyle = tt == html.StartTagToken && token.Data == "style"
+
+		case html.TextToken:
+			if inStyle { // the style element content is the raw text (not escaped)
+				out = []byte(rw.CSS(string(out), base))
+			}
+
+		case html.EndTagToken:
+			inStyle = false
+
+		case html.CommentToken, html.DoctypeToken:
+		}
+
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+}
+
+// rewriteAttributes rewrites the URLs in the tag attributes. It returns true, if any attribute was changed.
+func (rw *Rewriter) rewriteAttributes(attrs []html.Attribute, base *url.URL) (changed bool) {
+	for i, attr := range attrs {
+		var value = attr.Val
+
+		switch _, isURL := urlAttributes[attr.Key]; {
+		case isURL:
+			value = rw.URL(attr.Val, base)
+		case attr.Key == "srcset":
+			value = rw.SrcSet(attr.Val, base)
+		case attr.Key == "style":
+			value = rw.CSS(attr.Val, base)
+		}
+
+		if value != attr.Val {
+			attrs[i].Val, changed = value, true
+		}
+	}
+
+	return changed
+}
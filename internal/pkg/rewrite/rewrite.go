@@ -0,0 +1,198 @@
+// Package rewrite contains the web-browsing mode: URLs in the HTML and CSS responses (and the cookies attributes) are
+// rewritten into the proxy route form, so the pages work through the proxy.
+package rewrite
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/redirect"
+)
+
+// Rewriter rewrites the URLs into the proxy route form: "{prefix}/{scheme}/{host}/{path}".
+type Rewriter struct {
+	prefix string
+}
+
+// New creates a new Rewriter. The prefix is the proxy route prefix (like "/proxy").
+func New(prefix string) *Rewriter { return &Rewriter{prefix: strings.TrimSuffix(prefix, "/")} }
+
+// supportedEncodings are the content encodings, that can be decoded before the rewriting.
+var supportedEncodings = map[string]struct{}{ //nolint:gochecknoglobals
+	"": {}, "identity": {}, "gzip": {}, "deflate": {},
+}
+
+// Supports reports whether the response with the content type and encoding can be rewritten.
+func Supports(contentType, contentEncoding string) bool {
+	if _, ok := supportedEncodings[strings.ToLower(strings.TrimSpace(contentEncoding))]; !ok {
+		return false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/css":
+		return true
+	}
+
+	return false
+}
+
+// AcceptEncoding removes the encodings, that cannot be decoded before the rewriting (like "br"), from the
+// `Accept-Encoding` request header value.
+func AcceptEncoding(value string) string {
+	var accepted = make([]string, 0)
+
+	for _, part := range strings.Split(value, ",") {
+		coding, _, _ := strings.Cut(part, ";")
+
+		if _, ok := supportedEncodings[strings.ToLower(strings.TrimSpace(coding))]; ok {
+			accepted = append(accepted, strings.TrimSpace(part))
+		}
+	}
+
+	return strings.Join(accepted, ", ")
+}
+
+// Reader returns the rewritten (and decoded, when compressed) response body. The base URL is the response URL, and
+// the relative URLs are resolved using it. Supported content types and encodings are checked by the Supports
+// function.
+func (rw *Rewriter) Reader(body io.Reader, contentType, contentEncoding string, base *url.URL) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		decoded, err := decode(body, contentEncoding)
+		if err != nil {
+			_ = pw.CloseWithError(err)
+
+			return
+		}
+
+		if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "text/css" {
+			err = rw.writeCSS(pw, decoded, base)
+		} else {
+			err = rw.writeHTML(pw, decoded, base)
+		}
+
+		_ = pw.CloseWithError(err) // nil error means io.EOF for the reader
+	}()
+
+	return pr
+}
+
+func decode(body io.Reader, contentEncoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return zlib.NewReader(body)
+	}
+
+	return body, nil
+}
+
+// URL rewrites the URL into the proxy route form (the relative URL is resolved using the base URL). Empty URLs,
+// fragments and non-HTTP(S) URLs (like "data:" or "javascript:") are returned as is.
+func (rw *Rewriter) URL(s string, base *url.URL) string {
+	if trimmed := strings.TrimSpace(s); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return s
+	}
+
+	return redirect.RewriteLocation(strings.TrimSpace(s), base, rw.prefix)
+}
+
+// SrcSet rewrites the URLs in the "srcset" attribute value (like "a.png 1x, b.png 2x").
+func (rw *Rewriter) SrcSet(s string, base *url.URL) string {
+	var candidates = strings.Split(s, ",")
+
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+
+		fields[0] = rw.URL(fields[0], base)
+		candidates[i] = strings.Join(fields, " ")
+	}
+
+	return strings.Join(candidates, ", ")
+}
+
+var (
+	cssURL    = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^'")\s]*))\s*\)`) //nolint:gochecknoglobals
+	cssImport = regexp.MustCompile(`@import\s+(?:"([^"]*)"|'([^']*)')`)                //nolint:gochecknoglobals
+)
+
+// CSS rewrites the URLs in the stylesheet (`url(...)` and `@import "..."`).
+func (rw *Rewriter) CSS(s string, base *url.URL) string {
+	var replace = func(re *regexp.Regexp, format func(string) string) func(string) string {
+		return func(match string) string {
+			for _, value := range re.FindStringSubmatch(match)[1:] {
+				if rewritten := rw.URL(value, base); value != "" && rewritten != value {
+					return format(rewritten)
+				}
+			}
+
+			return match
+		}
+	}
+
+	s = cssURL.ReplaceAllStringFunc(s, replace(cssURL, func(u string) string { return `url("` + u + `")` }))
+
+	return cssImport.ReplaceAllStringFunc(s, replace(cssImport, func(u string) string { return `@import "` + u + `"` }))
+}
+
+// maxCSSSize is the maximal size of the rewritten stylesheet (the whole stylesheet is buffered, since the URLs can be
+// split between the chunks). Larger stylesheets are passed through as is.
+const maxCSSSize = 1 << 20 // 1 MiB
+
+func (rw *Rewriter) writeCSS(w io.Writer, r io.Reader, base *url.URL) error {
+	css, err := io.ReadAll(io.LimitReader(r, maxCSSSize+1))
+	if err != nil {
+		return err
+	}
+
+	if len(css) > maxCSSSize {
+		if _, err = w.Write(css); err != nil {
+			return err
+		}
+
+		_, err = io.Copy(w, r)
+
+		return err
+	}
+
+	_, err = io.WriteString(w, rw.CSS(string(css), base))
+
+	return err
+}
+
+// SetCookie rewrites the `Set-Cookie` header value attributes: the cookie domain is removed (the cookie belongs to
+// the proxy host), and the path is prefixed with the target route (like "/proxy/https/example.com").
+func (rw *Rewriter) SetCookie(value string, target *url.URL) string {
+	var (
+		parts     = strings.Split(value, ";")
+		rewritten = parts[:1:1]
+	)
+
+	for _, part := range parts[1:] {
+		name, path, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+		switch strings.ToLower(name) {
+		case "domain":
+			continue
+
+		case "path":
+			part = " Path=" + rw.prefix + "/" + target.Scheme + "/" + target.Host + "/" + strings.TrimPrefix(path, "/")
+		}
+
+		rewritten = append(rewritten, part)
+	}
+
+	return strings.Join(rewritten, ";")
+}
@@ -0,0 +1,165 @@
+package rewrite_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/rewrite"
+)
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(s)
+	assert.NoError(t, err)
+
+	return u
+}
+
+func TestRewriter_ReaderHTML(t *testing.T) {
+	const (
+		give = `<!DOCTYPE html>
+<html><head>
+<link rel="stylesheet" href="/css/main.css">
+<style>body { background: url('/img/bg.png') }</style>
+<script src="//cdn.example.org/app.js"></script>
+<script>var a = "<a href='/not-rewritten'>";</script>
+</head><body>
+<!-- <a href="/comment"> -->
+<a href="https://example.org/page?a=1&amp;b=2">link</a>
+<a href="#top">top</a>
+<a href="javascript:void(0)">js</a>
+<img src="logo.png" srcset="logo-1x.png 1x, https://example.org/logo-2x.png 2x" alt="&quot;logo&quot;">
+<form action="/login" method="post"><button formaction="/other">go</button></form>
+<div style="background-image: url(data:image/png;base64,AAAA)"></div>
+</body></html>`
+
+		want = `<!DOCTYPE html>
+<html><head>
+<link rel="stylesheet" href="/proxy/https/example.com/css/main.css">
+<style>body { background: url("/proxy/https/example.com/img/bg.png") }</style>
+<script src="/proxy/https/cdn.example.org/app.js"></script>
+<script>var a = "<a href='/not-rewritten'>";</script>
+</head><body>
+<!-- <a href="/comment"> -->
+<a href="/proxy/https/example.org/page?a=1&amp;b=2">link</a>
+<a href="#top">top</a>
+<a href="javascript:void(0)">js</a>
+<img src="/proxy/https/example.com/docs/logo.png" srcset="/proxy/https/example.com/docs/logo-1x.png 1x, ` +
+			`/proxy/https/example.org/logo-2x.png 2x" alt="&#34;logo&#34;">
+<form action="/proxy/https/example.com/login" method="post"><button formaction="/proxy/https/example.com/other">` +
+			`go</button></form>
+<div style="background-image: url(data:image/png;base64,AAAA)"></div>
+</body></html>`
+	)
+
+	rw := rewrite.New("/proxy/")
+
+	body, err := io.ReadAll(rw.Reader(strings.NewReader(give), "text/html; charset=utf-8", "",
+		mustParseURL(t, "https://example.com/docs/index.html"),
+	))
+
+	assert.NoError(t, err)
+	assert.Equal(t, want, string(body))
+}
+
+func TestRewriter_ReaderHTMLBase(t *testing.T) {
+	const give = `<base href="https://cdn.example.org/assets/"><img src="a.png"><img src="/b.png">`
+
+	body, err := io.ReadAll(rewrite.New("/proxy").Reader(strings.NewReader(give), "text/html", "",
+		mustParseURL(t, "https://example.com/"),
+	))
+
+	assert.NoError(t, err)
+	assert.Equal(t, `<base href="/proxy/https/cdn.example.org/assets/">`+
+		`<img src="/proxy/https/cdn.example.org/assets/a.png">`+
+		`<img src="/proxy/https/cdn.example.org/b.png">`, string(body))
+}
+
+func TestRewriter_ReaderHTMLCaseSensitiveTags(t *testing.T) {
+	const give = `<svg viewBox="0 0 10 10"><linearGradient gradientUnits="userSpaceOnUse"/></svg>` +
+		`<DIV Class="a">b</DIV>`
+
+	body, err := io.ReadAll(rewrite.New("/proxy").Reader(strings.NewReader(give), "text/html", "",
+		mustParseURL(t, "https://example.com/"),
+	))
+
+	assert.NoError(t, err)
+	assert.Equal(t, give, string(body), "the tags without the URLs must be written as is")
+}
+
+func TestRewriter_ReaderCompressedCSS(t *testing.T) {
+	var compressed bytes.Buffer
+
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte(`@import "theme.css"; .a { background: url( "../img/a.png" ) } .b { src: url(x.woff) }`))
+	assert.NoError(t, gz.Close())
+
+	body, err := io.ReadAll(rewrite.New("/proxy").Reader(&compressed, "text/css", "gzip",
+		mustParseURL(t, "http://example.com/css/main.css"),
+	))
+
+	assert.NoError(t, err)
+	assert.Equal(t, `@import "/proxy/http/example.com/css/theme.css"; `+
+		`.a { background: url("/proxy/http/example.com/img/a.png") } `+
+		`.b { src: url("/proxy/http/example.com/css/x.woff") }`, string(body))
+
+	_, err = io.ReadAll(rewrite.New("/proxy").Reader(strings.NewReader("foo"), "text/css", "gzip",
+		mustParseURL(t, "http://example.com/"),
+	))
+	assert.Error(t, err, "wrong gzip body")
+}
+
+func TestRewriter_ReaderLargeCSS(t *testing.T) {
+	var give = `.a { background: url("/img/a.png") }` + strings.Repeat(" ", 1<<20) // over the rewriting limit
+
+	body, err := io.ReadAll(rewrite.New("/proxy").Reader(strings.NewReader(give), "text/css", "",
+		mustParseURL(t, "http://example.com/"),
+	))
+
+	assert.NoError(t, err)
+	assert.True(t, string(body) == give, "large stylesheets must be passed through as is")
+}
+
+func TestSupports(t *testing.T) {
+	for _, tt := range []struct {
+		giveContentType, giveEncoding string
+		want                          bool
+	}{
+		{"text/html; charset=utf-8", "", true},
+		{"application/xhtml+xml", "gzip", true},
+		{"text/css", "deflate", true},
+		{"text/css", "br", false},
+		{"application/json", "", false},
+		{"", "", false},
+	} {
+		assert.Equal(t, tt.want, rewrite.Supports(tt.giveContentType, tt.giveEncoding), tt)
+	}
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	assert.Equal(t, "gzip, deflate", rewrite.AcceptEncoding("gzip, deflate, br"))
+	assert.Equal(t, "gzip;q=0.5", rewrite.AcceptEncoding("br;q=1.0, gzip;q=0.5, zstd"))
+	assert.Equal(t, "", rewrite.AcceptEncoding("br"))
+}
+
+func TestRewriter_SetCookie(t *testing.T) {
+	var (
+		rw     = rewrite.New("/proxy")
+		target = mustParseURL(t, "https://example.com/account/login")
+	)
+
+	for give, want := range map[string]string{
+		"sid=1; Path=/; Domain=.example.com; HttpOnly; Secure": "sid=1; Path=/proxy/https/example.com/; HttpOnly; Secure",
+		"a=b; path=/account; SameSite=Lax":                     "a=b; Path=/proxy/https/example.com/account; SameSite=Lax",
+		"a=b; Max-Age=10":                                      "a=b; Max-Age=10",
+	} {
+		assert.Equal(t, want, rw.SetCookie(give, target), give)
+	}
+}
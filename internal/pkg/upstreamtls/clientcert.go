@@ -0,0 +1,95 @@
+package upstreamtls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/filereload"
+)
+
+// ClientCertificate is the client certificate (mTLS) with the private key, loaded from the PEM encoded files. The
+// files are re-read, when they change.
+type ClientCertificate struct {
+	certFile, keyFile string
+	log               *zap.Logger
+	reloader          *filereload.Reloader
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+const clientCertCheckInterval = time.Second * 2 // limits the files changes checking frequency
+
+// NewClientCertificate creates ClientCertificate and loads the files.
+func NewClientCertificate(certFile, keyFile string, log *zap.Logger) (*ClientCertificate, error) {
+	c := &ClientCertificate{certFile: certFile, keyFile: keyFile, log: log}
+
+	reloader, err := filereload.New(clientCertCheckInterval, c.load, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c.reloader = reloader
+
+	return c, nil
+}
+
+// ParseClientCertificate parses the client certificate setting in the "host-pattern=cert.pem:key.pem" format.
+func ParseClientCertificate(s string) (pattern, certFile, keyFile string, _ error) {
+	pattern, files, ok := strings.Cut(strings.TrimSpace(s), "=")
+	if ok {
+		certFile, keyFile, ok = strings.Cut(files, ":")
+	}
+
+	if !ok || pattern == "" || certFile == "" || keyFile == "" {
+		return "", "", "", fmt.Errorf("wrong client certificate [%s] (host-pattern=cert.pem:key.pem expected)", s)
+	}
+
+	return pattern, certFile, keyFile, nil
+}
+
+// Certificate returns the actual certificate (the files are re-read, when they were changed).
+func (c *ClientCertificate) Certificate() *tls.Certificate {
+	c.reloadIfChanged()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert
+}
+
+// reloadIfChanged re-reads the files, if they were changed (since the last reading).
+func (c *ClientCertificate) reloadIfChanged() {
+	reloaded, err := c.reloader.ReloadIfChanged()
+	if err != nil {
+		c.log.Error("Cannot reload the client certificate (previous version is used)",
+			zap.String("cert", c.certFile),
+			zap.Error(err),
+		)
+
+		return
+	}
+
+	if reloaded {
+		c.log.Info("Client certificate reloaded", zap.String("cert", c.certFile))
+	}
+}
+
+// load reads and parses the files.
+func (c *ClientCertificate) load() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load the client certificate [%s]: %w", c.certFile, err)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+
+	return nil
+}
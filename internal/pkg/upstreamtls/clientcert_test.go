@@ -0,0 +1,117 @@
+package upstreamtls_test
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/mitm"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/upstreamtls"
+)
+
+// writeClientCertificate writes the self-signed certificate with the common name and its private key.
+func writeClientCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+
+	certPEM, keyPEM, err := mitm.GenerateCA(commonName, time.Hour)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+}
+
+func TestDialer_DialTLSContextClientCertificate(t *testing.T) {
+	// upstream responds with the client certificate common name
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+
+	defer srv.Close()
+
+	var (
+		dir      = t.TempDir()
+		certFile = filepath.Join(dir, "client.crt")
+		keyFile  = filepath.Join(dir, "client.key")
+	)
+
+	writeClientCertificate(t, certFile, keyFile, "foo")
+
+	cert, err := upstreamtls.NewClientCertificate(certFile, keyFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	get := func(opts ...upstreamtls.Option) (int, string) {
+		resp, getErr := newClient(append(opts, upstreamtls.WithInsecure())...).Get(srv.URL)
+		assert.NoError(t, getErr)
+
+		defer func() { _ = resp.Body.Close() }()
+
+		body, _ := io.ReadAll(resp.Body)
+
+		return resp.StatusCode, string(body)
+	}
+
+	code, _ := get()
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = get(upstreamtls.WithClientCertificate(hostmatch.New("example.com"), cert))
+	assert.Equal(t, http.StatusUnauthorized, code, "other hosts certificate is not presented")
+
+	code, body := get(upstreamtls.WithClientCertificate(hostmatch.New("127.*"), cert))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "foo", body)
+
+	writeClientCertificate(t, certFile, keyFile, "bar")
+
+	assert.Eventually(t, func() bool {
+		_, body = get(upstreamtls.WithClientCertificate(hostmatch.New("127.*"), cert))
+
+		return body == "bar"
+	}, time.Second*5, time.Millisecond*100)
+}
+
+func TestNewClientCertificateErrors(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		certFile = filepath.Join(dir, "client.crt")
+		keyFile  = filepath.Join(dir, "client.key")
+	)
+
+	_, err := upstreamtls.NewClientCertificate(certFile, keyFile, zap.NewNop())
+	assert.Error(t, err)
+
+	writeClientCertificate(t, certFile, keyFile, "foo")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("foo"), 0o600))
+
+	_, err = upstreamtls.NewClientCertificate(certFile, keyFile, zap.NewNop())
+	assert.ErrorContains(t, err, "cannot load the client certificate")
+}
+
+func TestParseClientCertificate(t *testing.T) {
+	pattern, certFile, keyFile, err := upstreamtls.ParseClientCertificate(" *.example.com=/tmp/a.crt:/tmp/a.key ")
+	assert.NoError(t, err)
+	assert.Equal(t, "*.example.com", pattern)
+	assert.Equal(t, "/tmp/a.crt", certFile)
+	assert.Equal(t, "/tmp/a.key", keyFile)
+
+	for _, give := range []string{"", "example.com", "example.com=a.crt", "=a:b", "example.com=:b", "example.com=a:"} {
+		_, _, _, err = upstreamtls.ParseClientCertificate(give)
+		assert.Error(t, err, give)
+	}
+}
@@ -0,0 +1,56 @@
+package upstreamtls
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Pin is the SHA-256 hash of the certificate public key (SubjectPublicKeyInfo).
+type Pin [sha256.Size]byte
+
+const pinPrefix = "sha256/"
+
+// PinOf returns the certificate public key pin.
+func PinOf(cert *x509.Certificate) Pin { return sha256.Sum256(cert.RawSubjectPublicKeyInfo) }
+
+// String returns the pin in the "sha256/<base64>" format (the same as used by HPKP and curl --pinnedpubkey).
+func (p Pin) String() string { return pinPrefix + base64.StdEncoding.EncodeToString(p[:]) }
+
+// ParsePin parses the host pin in the "host=sha256/<base64>" format.
+func ParsePin(s string) (string, Pin, error) {
+	var pin Pin
+
+	host, value, ok := strings.Cut(strings.TrimSpace(s), "=")
+	if !ok || host == "" {
+		return "", pin, fmt.Errorf("wrong pin [%s] (host=sha256/<base64> expected)", s)
+	}
+
+	if !strings.HasPrefix(value, pinPrefix) {
+		return "", pin, fmt.Errorf("wrong pin [%s] (only sha256 pins are supported)", s)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, pinPrefix))
+	if err != nil || len(decoded) != len(pin) {
+		return "", pin, fmt.Errorf("wrong pin [%s] (base64-encoded SHA-256 hash expected)", s)
+	}
+
+	copy(pin[:], decoded)
+
+	return strings.ToLower(host), pin, nil
+}
+
+// matchPins reports whether the certificate public key matches any of the pins.
+func matchPins(pins []Pin, cert *x509.Certificate) bool {
+	var actual = PinOf(cert)
+
+	for _, pin := range pins {
+		if pin == actual {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,283 @@
+// Package upstreamtls contains the upstream TLS connections configuration: certificates verification with the
+// additional CA bundles, per-host verification exceptions, public keys (SPKI) pinning and protocol settings.
+package upstreamtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+)
+
+// CertificateError is returned, when the upstream certificate is not trusted or does not match the pinned keys.
+type CertificateError struct {
+	Host string
+	Err  error
+}
+
+func (e *CertificateError) Error() string {
+	return "upstream [" + e.Host + "] certificate verification failed: " + e.Err.Error()
+}
+
+func (e *CertificateError) Unwrap() error { return e.Err }
+
+// Option allows to configure the upstream TLS settings.
+type Option func(*Dialer)
+
+type contextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Dialer establishes the TLS connections to the upstreams. Certificates are verified by the dialer itself (not by
+// the crypto/tls package), since the per-host exceptions and pins require the dialed host name (it is not available
+// in the connection state for the IP addresses).
+type Dialer struct {
+	next contextDialer
+	cfg  *tls.Config
+
+	insecure      bool              // skip the verification for all the hosts
+	insecureHosts hostmatch.Matcher // hosts without the verification
+	roots         *x509.CertPool    // nil means "system roots"
+	pins          map[string][]Pin  // pinned public keys by the host
+	clientCerts   []clientCert      // client certificates (mTLS), the first matched is used
+}
+
+type clientCert struct {
+	hosts hostmatch.Matcher
+	cert  *ClientCertificate
+}
+
+// WithInsecure disables the certificates verification for all the hosts (the pinned keys are still checked).
+func WithInsecure() Option { return func(d *Dialer) { d.insecure = true } }
+
+// WithInsecureHosts disables the certificates verification for the matched hosts (the pinned keys are still
+// checked).
+func WithInsecureHosts(m hostmatch.Matcher) Option { return func(d *Dialer) { d.insecureHosts = m } }
+
+// WithRootCAs sets the trusted root certificates (see LoadRootCAs).
+func WithRootCAs(pool *x509.CertPool) Option { return func(d *Dialer) { d.roots = pool } }
+
+// WithPins pins the host public keys: at least one certificate of the host chain must match any of the pins.
+func WithPins(host string, pins ...Pin) Option {
+	return func(d *Dialer) {
+		host = strings.ToLower(host)
+		d.pins[host] = append(d.pins[host], pins...)
+	}
+}
+
+// WithClientCertificate sets the client certificate (mTLS) for the matched hosts. When several certificates match
+// the host, the first one is used.
+func WithClientCertificate(hosts hostmatch.Matcher, cert *ClientCertificate) Option {
+	return func(d *Dialer) { d.clientCerts = append(d.clientCerts, clientCert{hosts: hosts, cert: cert}) }
+}
+
+// WithMinVersion sets the minimal TLS version (see ParseVersion).
+func WithMinVersion(version uint16) Option { return func(d *Dialer) { d.cfg.MinVersion = version } }
+
+// WithCipherSuites sets the enabled TLS 1.0-1.2 cipher suites (see ParseCipherSuites).
+func WithCipherSuites(ids ...uint16) Option { return func(d *Dialer) { d.cfg.CipherSuites = ids } }
+
+// NewDialer creates a new Dialer, which establishes the connections using the next dialer. Certificates are
+// verified by default (using the system roots).
+func NewDialer(next contextDialer, opts ...Option) *Dialer {
+	d := &Dialer{
+		next: next,
+		cfg:  &tls.Config{MinVersion: tls.VersionTLS12},
+		pins: make(map[string][]Pin),
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// DialTLSContext connects to the address and performs the TLS handshake (compatible with the
+// http.Transport.DialTLSContext).
+func (d *Dialer) DialTLSContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := d.next.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, d.config(host))
+
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// config returns the TLS configuration for the host connection.
+func (d *Dialer) config(host string) *tls.Config {
+	cfg := d.cfg.Clone()
+
+	cfg.ServerName = host
+	// the built-in verification is replaced with the custom one, which supports the per-host exceptions and pins
+	cfg.InsecureSkipVerify = true //nolint:gosec // the verification is done by the VerifyConnection callback
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error { return d.verify(host, cs) }
+
+	for _, cc := range d.clientCerts {
+		if cc.hosts.Match(host) {
+			cert := cc.cert // the certificate is requested by the server only, so it is (re)loaded lazily
+			cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return cert.Certificate(), nil
+			}
+
+			break
+		}
+	}
+
+	return cfg
+}
+
+// verify verifies the server certificate chain and the pinned public keys.
+func (d *Dialer) verify(host string, cs tls.ConnectionState) error {
+	host = strings.ToLower(host)
+
+	if len(cs.PeerCertificates) == 0 {
+		return &CertificateError{Host: host, Err: errors.New("no certificates")}
+	}
+
+	var chains [][]*x509.Certificate
+
+	if !d.insecure && !d.insecureHosts.Match(host) {
+		opts := x509.VerifyOptions{Roots: d.roots, DNSName: host, Intermediates: x509.NewCertPool()}
+
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+
+		var err error
+
+		if chains, err = cs.PeerCertificates[0].Verify(opts); err != nil {
+			return &CertificateError{Host: host, Err: err}
+		}
+	}
+
+	if pins, pinned := d.pins[host]; pinned {
+		if len(chains) == 0 { // the chain is not verified, so the presented certificates are checked
+			chains = [][]*x509.Certificate{cs.PeerCertificates}
+		}
+
+		for _, chain := range chains {
+			for _, cert := range chain {
+				if matchPins(pins, cert) {
+					return nil
+				}
+			}
+		}
+
+		return &CertificateError{Host: host, Err: errors.New("public key does not match the pinned keys")}
+	}
+
+	return nil
+}
+
+// LoadRootCAs loads the system root certificates and the additional PEM-encoded CA certificates from the files or
+// directories (all the files of the directory are loaded, subdirectories are ignored).
+func LoadRootCAs(paths ...string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	for _, path := range paths {
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			return nil, statErr
+		}
+
+		var files = []string{path}
+
+		if info.IsDir() {
+			entries, readErr := os.ReadDir(path)
+			if readErr != nil {
+				return nil, readErr
+			}
+
+			files = files[:0]
+
+			for _, entry := range entries {
+				if entry.Type().IsRegular() {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+
+		for _, file := range files {
+			data, readErr := os.ReadFile(file)
+			if readErr != nil {
+				return nil, readErr
+			}
+
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no PEM-encoded certificates found in [%s]", file)
+			}
+		}
+	}
+
+	return pool, nil
+}
+
+// ParseVersion parses the TLS version, like "1.2".
+func ParseVersion(s string) (uint16, error) {
+	switch strings.TrimSpace(s) {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+
+	return 0, fmt.Errorf("unsupported TLS version [%s] (1.0, 1.1, 1.2 or 1.3 expected)", s)
+}
+
+// ParseCipherSuites parses the cipher suite names, like "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256". TLS 1.3 cipher
+// suites are not configurable.
+func ParseCipherSuites(names ...string) ([]uint16, error) {
+	var (
+		known = make(map[string]uint16)
+		ids   = make([]uint16, 0, len(names))
+	)
+
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range suites {
+			known[suite.Name] = suite.ID
+		}
+	}
+
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		id, ok := known[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite [%s]", name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
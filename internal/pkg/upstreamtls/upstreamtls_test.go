@@ -0,0 +1,189 @@
+package upstreamtls_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/hostmatch"
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/upstreamtls"
+)
+
+func newClient(opts ...upstreamtls.Option) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialTLSContext: upstreamtls.NewDialer(&net.Dialer{}, opts...).DialTLSContext,
+	}}
+}
+
+func TestDialer_DialTLSContext(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	var (
+		roots    = x509.NewCertPool()
+		validPin = upstreamtls.PinOf(srv.Certificate())
+		wrongPin = upstreamtls.Pin{1, 2, 3}
+	)
+
+	roots.AddCert(srv.Certificate())
+
+	for name, tt := range map[string]struct {
+		giveOptions []upstreamtls.Option
+		wantError   bool
+	}{
+		"system roots":  {wantError: true},
+		"custom roots":  {giveOptions: []upstreamtls.Option{upstreamtls.WithRootCAs(roots)}},
+		"insecure":      {giveOptions: []upstreamtls.Option{upstreamtls.WithInsecure()}},
+		"insecure host": {giveOptions: []upstreamtls.Option{upstreamtls.WithInsecureHosts(hostmatch.New("127.*"))}},
+		"other insecure": {
+			giveOptions: []upstreamtls.Option{upstreamtls.WithInsecureHosts(hostmatch.New("foo"))},
+			wantError:   true,
+		},
+		"valid pin": {giveOptions: []upstreamtls.Option{
+			upstreamtls.WithRootCAs(roots),
+			upstreamtls.WithPins("127.0.0.1", wrongPin, validPin),
+		}},
+		"wrong pin": {giveOptions: []upstreamtls.Option{
+			upstreamtls.WithRootCAs(roots),
+			upstreamtls.WithPins("127.0.0.1", wrongPin),
+		}, wantError: true},
+		"wrong pin when insecure": {giveOptions: []upstreamtls.Option{
+			upstreamtls.WithInsecure(),
+			upstreamtls.WithPins("127.0.0.1", wrongPin),
+		}, wantError: true},
+		"other host pin": {giveOptions: []upstreamtls.Option{
+			upstreamtls.WithRootCAs(roots),
+			upstreamtls.WithPins("example.com", wrongPin),
+		}},
+	} {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			client := newClient(tt.giveOptions...)
+
+			resp, err := client.Get(srv.URL)
+
+			if tt.wantError {
+				var certErr *upstreamtls.CertificateError
+
+				assert.True(t, errors.As(err, &certErr))
+				assert.Equal(t, "127.0.0.1", certErr.Host)
+				assert.Contains(t, err.Error(), "certificate verification failed")
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+			assert.NoError(t, resp.Body.Close())
+		})
+	}
+}
+
+func TestDialer_DialTLSContextMinVersion(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+
+	defer srv.Close()
+
+	resp, err := newClient(upstreamtls.WithInsecure()).Get(srv.URL)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	_, err = newClient(upstreamtls.WithInsecure(), upstreamtls.WithMinVersion(tls.VersionTLS13)).Get(srv.URL)
+	assert.ErrorContains(t, err, "protocol version")
+}
+
+func TestLoadRootCAs(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer srv.Close()
+
+	var (
+		dir     = t.TempDir()
+		caFile  = filepath.Join(dir, "ca.pem")
+		badFile = filepath.Join(t.TempDir(), "bad.pem")
+	)
+
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.Certificate().Raw,
+	}), 0o600))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0o700))
+	assert.NoError(t, os.WriteFile(badFile, []byte("foo"), 0o600))
+
+	for _, path := range []string{caFile, dir} {
+		pool, err := upstreamtls.LoadRootCAs(path)
+		assert.NoError(t, err, path)
+
+		_, err = srv.Certificate().Verify(x509.VerifyOptions{Roots: pool, DNSName: "example.com"})
+		assert.NoError(t, err, path)
+	}
+
+	_, err := upstreamtls.LoadRootCAs(badFile)
+	assert.ErrorContains(t, err, "no PEM-encoded certificates found")
+
+	_, err = upstreamtls.LoadRootCAs(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
+
+func TestParsePin(t *testing.T) {
+	const valid = "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	host, pin, err := upstreamtls.ParsePin(" Example.com=" + valid + " ")
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", host)
+	assert.Equal(t, valid, pin.String())
+
+	for _, give := range []string{
+		"",
+		"example.com",
+		"=" + valid,
+		"example.com=sha1/AAAA",
+		"example.com=sha256/foo",
+		"example.com=sha256/AAAA",
+	} {
+		_, _, err = upstreamtls.ParsePin(give)
+		assert.Error(t, err, give)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for give, want := range map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	} {
+		got, err := upstreamtls.ParseVersion(give)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := upstreamtls.ParseVersion("1.4")
+	assert.Error(t, err)
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := upstreamtls.ParseCipherSuites(
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		" tls_rsa_with_aes_128_cbc_sha ",
+		"",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_AES_128_CBC_SHA}, ids)
+
+	_, err = upstreamtls.ParseCipherSuites("foo")
+	assert.Error(t, err)
+}
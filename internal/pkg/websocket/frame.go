@@ -0,0 +1,172 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Opcodes, defined in RFC 6455 (section 5.2).
+const (
+	OpContinuation byte = 0x0
+	OpText         byte = 0x1
+	OpBinary       byte = 0x2
+	OpClose        byte = 0x8
+	OpPing         byte = 0x9
+	OpPong         byte = 0xA
+)
+
+// Close status codes, defined in RFC 6455 (section 7.4) and the IANA registry.
+const (
+	CloseNormal         uint16 = 1000
+	CloseGoingAway      uint16 = 1001
+	CloseNoStatus       uint16 = 1005 // must not be sent on the wire
+	CloseAbnormal       uint16 = 1006 // must not be sent on the wire
+	CloseInternalError  uint16 = 1011
+	CloseBadGateway     uint16 = 1014
+	maxControlFrameSize        = 125
+)
+
+const (
+	finBit      byte = 0x80
+	opcodeMask  byte = 0x0F
+	maskBit     byte = 0x80
+	lenMask     byte = 0x7F
+	len16Marker byte = 126
+	len64Marker byte = 127
+)
+
+// frameHeader is a parsed WebSocket frame header.
+type frameHeader struct {
+	raw     []byte // raw header bytes (forwarded as-is)
+	opcode  byte
+	masked  bool
+	maskKey [4]byte
+	length  uint64
+}
+
+// isControl reports whether the frame is a control frame (close, ping or pong).
+func (h *frameHeader) isControl() bool { return h.opcode&0x8 != 0 }
+
+var errControlFrameTooLarge = errors.New("websocket: control frame payload is too large")
+
+// readFrameHeader reads the frame header from the reader.
+func readFrameHeader(r io.Reader) (*frameHeader, error) {
+	var h = frameHeader{raw: make([]byte, 2, 14)} //nolint:gomnd // 14 is the maximal header size
+
+	if _, err := io.ReadFull(r, h.raw); err != nil {
+		return nil, err
+	}
+
+	h.opcode = h.raw[0] & opcodeMask
+	h.masked = h.raw[1]&maskBit != 0
+
+	switch l := h.raw[1] & lenMask; l {
+	case len16Marker:
+		if err := h.readMore(r, 2); err != nil { //nolint:gomnd
+			return nil, err
+		}
+
+		h.length = uint64(binary.BigEndian.Uint16(h.raw[2:]))
+
+	case len64Marker:
+		if err := h.readMore(r, 8); err != nil { //nolint:gomnd
+			return nil, err
+		}
+
+		h.length = binary.BigEndian.Uint64(h.raw[2:])
+
+	default:
+		h.length = uint64(l)
+	}
+
+	if h.masked {
+		if err := h.readMore(r, len(h.maskKey)); err != nil {
+			return nil, err
+		}
+
+		copy(h.maskKey[:], h.raw[len(h.raw)-len(h.maskKey):])
+	}
+
+	if h.isControl() && h.length > maxControlFrameSize {
+		return nil, errControlFrameTooLarge
+	}
+
+	return &h, nil
+}
+
+func (h *frameHeader) readMore(r io.Reader, n int) error {
+	var offset = len(h.raw)
+
+	h.raw = append(h.raw, make([]byte, n)...)
+
+	_, err := io.ReadFull(r, h.raw[offset:])
+
+	return err
+}
+
+// unmask returns the unmasked copy of the payload.
+func (h *frameHeader) unmask(payload []byte) []byte {
+	if !h.masked {
+		return payload
+	}
+
+	out := make([]byte, len(payload))
+
+	for i := range payload {
+		out[i] = payload[i] ^ h.maskKey[i%4]
+	}
+
+	return out
+}
+
+// buildControlFrame builds the control frame. Frames, sent by the client (to the server), must be masked.
+func buildControlFrame(opcode byte, payload []byte, mask bool) ([]byte, error) {
+	if len(payload) > maxControlFrameSize {
+		return nil, errControlFrameTooLarge
+	}
+
+	var frame = []byte{finBit | opcode, byte(len(payload))}
+
+	if !mask {
+		return append(frame, payload...), nil
+	}
+
+	var key [4]byte
+
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+
+	frame[1] |= maskBit
+	frame = append(frame, key[:]...)
+
+	for i := range payload {
+		frame = append(frame, payload[i]^key[i%4])
+	}
+
+	return frame, nil
+}
+
+// closePayload builds the close frame payload.
+func closePayload(code uint16, reason string) []byte {
+	var payload = make([]byte, 2, 2+len(reason)) //nolint:gomnd
+
+	binary.BigEndian.PutUint16(payload, code)
+
+	if len(reason) > maxControlFrameSize-2 {
+		reason = reason[:maxControlFrameSize-2]
+	}
+
+	return append(payload, reason...)
+}
+
+// parseClosePayload extracts the status code from the (unmasked) close frame payload.
+func parseClosePayload(payload []byte) uint16 {
+	if len(payload) < 2 { //nolint:gomnd
+		return CloseNoStatus
+	}
+
+	return binary.BigEndian.Uint16(payload)
+}
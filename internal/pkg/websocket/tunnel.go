@@ -0,0 +1,245 @@
+package websocket
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// peer is one side of the tunnel.
+type peer struct {
+	r io.Reader
+	w io.Writer
+	c io.Closer
+
+	mask bool       // frames, written by the proxy, must be masked (the proxy acts as a client)
+	wMu  sync.Mutex // guards writing, since the frames must not be interleaved
+
+	lastSeen      atomic.Int64 // the last frame receiving time (unix nanoseconds)
+	closeReceived atomic.Bool  // the close frame was received from the peer
+	closeSent     atomic.Bool  // the close frame was sent to the peer
+}
+
+func (p *peer) touch() { p.lastSeen.Store(time.Now().UnixNano()) }
+
+func (p *peer) idleFor() time.Duration { return time.Since(time.Unix(0, p.lastSeen.Load())) }
+
+// writeControl writes the control frame. If wait is false and the peer is busy with another frame writing, the
+// frame will be skipped.
+func (p *peer) writeControl(opcode byte, payload []byte, wait bool) error {
+	frame, err := buildControlFrame(opcode, payload, p.mask)
+	if err != nil {
+		return err
+	}
+
+	if wait {
+		p.wMu.Lock()
+	} else if !p.wMu.TryLock() {
+		return nil
+	}
+
+	defer p.wMu.Unlock()
+
+	if opcode == OpClose {
+		if p.closeSent.Load() {
+			return nil
+		}
+
+		p.closeSent.Store(true)
+	}
+
+	_, err = p.w.Write(frame)
+
+	return err
+}
+
+// Tunnel relays WebSocket frames between the client and the upstream connections.
+type Tunnel struct {
+	client, upstream *peer
+
+	pingInterval time.Duration
+	idleTimeout  time.Duration
+
+	closeOnce sync.Once
+	code      atomic.Uint32
+}
+
+// TunnelOption allows to configure the Tunnel.
+type TunnelOption func(*Tunnel)
+
+// WithPingInterval sets the interval for the keepalive pings sending (to both sides). Zero value disables pinging.
+func WithPingInterval(d time.Duration) TunnelOption { return func(t *Tunnel) { t.pingInterval = d } }
+
+// WithIdleTimeout sets the maximal duration without any frames from one of the sides, after which the tunnel will
+// be closed. Zero value means "no timeout". The idle timeout is checked with the ping interval only.
+func WithIdleTimeout(d time.Duration) TunnelOption { return func(t *Tunnel) { t.idleTimeout = d } }
+
+// NewTunnel creates a new tunnel. The clientReader is used for the client frames reading (it may contain already
+// buffered data after the connection hijacking), the client is used for writing and closing. The upstream is the
+// upgraded upstream connection.
+func NewTunnel(
+	clientReader io.Reader,
+	client io.WriteCloser,
+	upstream io.ReadWriteCloser,
+	opts ...TunnelOption,
+) *Tunnel {
+	t := &Tunnel{
+		client:   &peer{r: clientReader, w: client, c: client},
+		upstream: &peer{r: upstream, w: upstream, c: upstream, mask: true},
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	t.client.touch()
+	t.upstream.touch()
+
+	return t
+}
+
+const defaultCloseCheckInterval = time.Second
+
+// Run relays the frames until one of the sides closes the connection or the context is canceled. It returns the
+// close status code (the first one, received from any side).
+func (t *Tunnel) Run(ctx context.Context) uint16 {
+	var done = make(chan struct{}, 2) //nolint:gomnd
+
+	go func() { t.relay(t.client, t.upstream, CloseGoingAway); done <- struct{}{} }()
+	go func() { t.relay(t.upstream, t.client, CloseBadGateway); done <- struct{}{} }()
+
+	var tick = t.pingInterval
+	if tick <= 0 {
+		tick = defaultCloseCheckInterval
+	}
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	var ctxDone = ctx.Done()
+
+loop:
+	for {
+		select {
+		case <-ctxDone:
+			t.shutdown(CloseGoingAway, "proxy is shutting down")
+
+			ctxDone = nil
+
+		case <-done:
+			break loop
+
+		case <-ticker.C:
+			if t.idleTimeout > 0 && (t.client.idleFor() > t.idleTimeout || t.upstream.idleFor() > t.idleTimeout) {
+				t.shutdown(CloseGoingAway, "idle timeout")
+
+				continue
+			}
+
+			if t.pingInterval > 0 {
+				_ = t.client.writeControl(OpPing, nil, false)
+				_ = t.upstream.writeControl(OpPing, nil, false)
+			}
+		}
+	}
+
+	t.closeConnections()
+
+	<-done // wait for the second relay
+
+	if code := t.code.Load(); code != 0 {
+		return uint16(code)
+	}
+
+	return CloseNoStatus
+}
+
+// relay copies the frames from the src into the dst. When the src disconnects without the closing handshake, the
+// close frame with the abnormalCode will be sent to the dst.
+func (t *Tunnel) relay(src, dst *peer, abnormalCode uint16) {
+	for {
+		h, err := readFrameHeader(src.r)
+		if err != nil {
+			if !src.closeReceived.Load() {
+				t.setCode(CloseAbnormal)
+
+				_ = dst.writeControl(OpClose, closePayload(abnormalCode, "peer disconnected"), false)
+			}
+
+			return
+		}
+
+		src.touch()
+
+		if h.opcode == OpClose {
+			payload := make([]byte, h.length)
+
+			if _, err = io.ReadFull(src.r, payload); err != nil {
+				return
+			}
+
+			t.setCode(parseClosePayload(h.unmask(payload)))
+			src.closeReceived.Store(true)
+
+			if err = t.forward(dst, h, payload, nil); err != nil || dst.closeReceived.Load() {
+				return // the closing handshake is completed (or the dst is gone)
+			}
+
+			continue
+		}
+
+		if err = t.forward(dst, h, nil, src.r); err != nil {
+			return
+		}
+	}
+}
+
+// forward writes the frame (header and payload) into the dst. The payload is taken from the payload slice (when
+// it is not nil) or read from the src reader.
+func (t *Tunnel) forward(dst *peer, h *frameHeader, payload []byte, src io.Reader) error {
+	dst.wMu.Lock()
+	defer dst.wMu.Unlock()
+
+	if h.opcode == OpClose {
+		if dst.closeSent.Load() {
+			return nil
+		}
+
+		dst.closeSent.Store(true)
+	}
+
+	if _, err := dst.w.Write(h.raw); err != nil {
+		return err
+	}
+
+	if payload != nil {
+		_, err := dst.w.Write(payload)
+
+		return err
+	}
+
+	_, err := io.CopyN(dst.w, src, int64(h.length))
+
+	return err
+}
+
+// shutdown sends the close frames to both sides and closes the connections.
+func (t *Tunnel) shutdown(code uint16, reason string) {
+	t.setCode(code)
+
+	_ = t.client.writeControl(OpClose, closePayload(code, reason), false)
+	_ = t.upstream.writeControl(OpClose, closePayload(code, reason), false)
+
+	t.closeConnections()
+}
+
+func (t *Tunnel) closeConnections() {
+	t.closeOnce.Do(func() {
+		_ = t.client.c.Close()
+		_ = t.upstream.c.Close()
+	})
+}
+
+func (t *Tunnel) setCode(code uint16) { t.code.CompareAndSwap(0, uint32(code)) }
@@ -0,0 +1,203 @@
+package websocket_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/websocket"
+)
+
+// writeFrame writes the frame asynchronously, since the pipe writing blocks until the whole frame is read on the
+// other side (and the tunnel reads the frame header and payload separately).
+func writeFrame(t *testing.T, w io.Writer, opcode byte, payload []byte, mask bool) {
+	t.Helper()
+
+	frame := []byte{0x80 | opcode, byte(len(payload))}
+
+	if mask {
+		key := []byte{1, 2, 3, 4}
+		frame[1] |= 0x80
+		frame = append(frame, key...)
+
+		for i := range payload {
+			frame = append(frame, payload[i]^key[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	go func() {
+		_, err := w.Write(frame)
+		assert.NoError(t, err)
+	}()
+}
+
+type frame struct {
+	opcode  byte
+	masked  bool
+	payload []byte
+}
+
+func readFrame(t *testing.T, r io.Reader) frame {
+	t.Helper()
+
+	var hdr = make([]byte, 2)
+
+	_, err := io.ReadFull(r, hdr)
+	assert.NoError(t, err)
+
+	var (
+		f   = frame{opcode: hdr[0] & 0x0F, masked: hdr[1]&0x80 != 0}
+		key = make([]byte, 4)
+	)
+
+	if f.masked {
+		_, err = io.ReadFull(r, key)
+		assert.NoError(t, err)
+	}
+
+	f.payload = make([]byte, hdr[1]&0x7F)
+
+	_, err = io.ReadFull(r, f.payload)
+	assert.NoError(t, err)
+
+	if f.masked {
+		for i := range f.payload {
+			f.payload[i] ^= key[i%4]
+		}
+	}
+
+	return f
+}
+
+func closePayload(code uint16) []byte {
+	p := make([]byte, 2)
+	binary.BigEndian.PutUint16(p, code)
+
+	return p
+}
+
+func startTunnel(t *testing.T, opts ...websocket.TunnelOption) (browser, server net.Conn, result <-chan uint16) {
+	t.Helper()
+
+	var (
+		proxyClient, proxyUpstream net.Conn
+		resultCh                   = make(chan uint16, 1)
+	)
+
+	browser, proxyClient = net.Pipe()
+	proxyUpstream, server = net.Pipe()
+
+	tunnel := websocket.NewTunnel(proxyClient, proxyClient, proxyUpstream, opts...)
+
+	go func() { resultCh <- tunnel.Run(context.Background()) }()
+
+	return browser, server, resultCh
+}
+
+func TestTunnel_RelayFrames(t *testing.T) {
+	browser, server, result := startTunnel(t)
+
+	writeFrame(t, browser, websocket.OpText, []byte("hello"), true)
+
+	f := readFrame(t, server)
+	assert.Equal(t, websocket.OpText, f.opcode)
+	assert.True(t, f.masked)
+	assert.Equal(t, "hello", string(f.payload))
+
+	writeFrame(t, server, websocket.OpBinary, []byte("world"), false)
+
+	f = readFrame(t, browser)
+	assert.Equal(t, websocket.OpBinary, f.opcode)
+	assert.False(t, f.masked)
+	assert.Equal(t, "world", string(f.payload))
+
+	// closing handshake, initiated by the upstream
+	writeFrame(t, server, websocket.OpClose, closePayload(4001), false)
+
+	f = readFrame(t, browser)
+	assert.Equal(t, websocket.OpClose, f.opcode)
+	assert.Equal(t, closePayload(4001), f.payload)
+
+	writeFrame(t, browser, websocket.OpClose, closePayload(4001), true)
+
+	f = readFrame(t, server)
+	assert.Equal(t, websocket.OpClose, f.opcode)
+
+	assert.Equal(t, uint16(4001), <-result)
+}
+
+func TestTunnel_UpstreamAbnormalDisconnect(t *testing.T) {
+	browser, server, result := startTunnel(t)
+
+	assert.NoError(t, server.Close())
+
+	f := readFrame(t, browser)
+	assert.Equal(t, websocket.OpClose, f.opcode)
+	assert.Equal(t, closePayload(websocket.CloseBadGateway), f.payload[:2])
+
+	assert.Equal(t, websocket.CloseAbnormal, <-result)
+}
+
+func TestTunnel_KeepalivePings(t *testing.T) {
+	browser, server, result := startTunnel(t, websocket.WithPingInterval(time.Millisecond*5))
+
+	var serverPing = make(chan frame, 1)
+
+	go func() { serverPing <- readFrame(t, server) }()
+
+	f := readFrame(t, browser)
+	assert.Equal(t, websocket.OpPing, f.opcode)
+	assert.False(t, f.masked)
+
+	f = <-serverPing
+	assert.Equal(t, websocket.OpPing, f.opcode)
+	assert.True(t, f.masked) // frames from the client side must be masked
+
+	assert.NoError(t, browser.Close())
+	assert.NoError(t, server.Close())
+
+	<-result
+}
+
+func TestIsUpgradeRequest(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		giveHeader http.Header
+		want       bool
+	}{
+		{
+			name:       "websocket upgrade",
+			giveHeader: http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}},
+			want:       true,
+		},
+		{
+			name:       "multiple connection tokens",
+			giveHeader: http.Header{"Connection": {"keep-alive, Upgrade"}, "Upgrade": {"WebSocket"}},
+			want:       true,
+		},
+		{
+			name:       "another protocol",
+			giveHeader: http.Header{"Connection": {"Upgrade"}, "Upgrade": {"h2c"}},
+		},
+		{
+			name:       "without connection header",
+			giveHeader: http.Header{"Upgrade": {"websocket"}},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "http://testing", http.NoBody)
+			req.Header = tt.giveHeader
+
+			assert.Equal(t, tt.want, websocket.IsUpgradeRequest(req))
+		})
+	}
+}
@@ -0,0 +1,27 @@
+// Package websocket contains WebSocket (RFC 6455) connections tunneling with frames relaying, keepalive pinging and
+// close codes propagation.
+package websocket
+
+import (
+	"net/http"
+	"strings"
+)
+
+// IsUpgradeRequest reports whether the request is a WebSocket handshake (upgrade) request.
+func IsUpgradeRequest(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+// headerContainsToken reports whether the header with the given name contains the token (case-insensitive).
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,135 @@
+package zstd
+
+import "encoding/binary"
+
+// sequence is the literals length, match length and offset triple.
+type sequence struct {
+	literals uint32
+	match    uint32
+	offset   uint32
+}
+
+// compress appends the compressed block (literals and sequences sections) of the pending data into the dst.
+func (w *Writer) compress(dst []byte) []byte {
+	var (
+		src       = w.history
+		end       = len(src)
+		start     = w.pending
+		literals  = make([]byte, 0, end-start)
+		sequences = make([]sequence, 0)
+	)
+
+	for i := start; i+minMatch <= end; {
+		var (
+			value     = binary.LittleEndian.Uint32(src[i:])
+			h         = value * 2654435761 >> (32 - hashLog) //nolint:gomnd
+			candidate = int(w.table[h]) - 1
+		)
+
+		w.table[h] = int32(i + 1)
+
+		if candidate < 0 || i-candidate >= windowSize || binary.LittleEndian.Uint32(src[candidate:]) != value {
+			i++
+
+			continue
+		}
+
+		var length = minMatch
+
+		for i+length < end && src[candidate+length] == src[i+length] {
+			length++
+		}
+
+		for i > start && candidate > 0 && src[i-1] == src[candidate-1] { // extend the match backward
+			i, candidate, length = i-1, candidate-1, length+1
+		}
+
+		sequences = append(sequences, sequence{
+			literals: uint32(i - start),
+			match:    uint32(length),
+			offset:   uint32(i - candidate),
+		})
+		literals = append(literals, src[start:i]...)
+
+		i += length
+		start = i
+	}
+
+	literals = append(literals, src[start:end]...) // the last literals are not a part of any sequence
+
+	dst = appendLiterals(dst, literals)
+
+	return appendSequences(dst, sequences)
+}
+
+// appendLiterals appends the raw literals section.
+func appendLiterals(dst, literals []byte) []byte {
+	switch size := len(literals); {
+	case size < 1<<5:
+		dst = append(dst, byte(size<<3))
+	case size < 1<<12:
+		dst = append(dst, byte(size<<4|1<<2), byte(size>>4))
+	default:
+		dst = append(dst, byte(size<<4|3<<2), byte(size>>4), byte(size>>12))
+	}
+
+	return append(dst, literals...)
+}
+
+// appendSequences appends the sequences section, coded using the predefined distributions.
+func appendSequences(dst []byte, sequences []sequence) []byte {
+	switch n := len(sequences); {
+	case n == 0:
+		return append(dst, 0)
+	case n < 0x80:
+		dst = append(dst, byte(n))
+	case n < 0x7f00:
+		dst = append(dst, byte(n>>8+0x80), byte(n))
+	default:
+		dst = append(dst, 0xff, byte(n-0x7f00), byte((n-0x7f00)>>8))
+	}
+
+	dst = append(dst, 0) // symbols compression modes: all the predefined
+
+	type codes struct{ literals, match, offset uint8 }
+
+	var all = make([]codes, len(sequences))
+
+	for i, s := range sequences {
+		all[i] = codes{
+			literals: code(literalsLengthBaselines[:], s.literals),
+			match:    code(matchLengthBaselines[:], s.match),
+			offset:   uint8(highBit(s.offset + 3)), // offsets are not repeated, so all of them are shifted by 3
+		}
+	}
+
+	var (
+		w                                      = bitWriter{out: dst}
+		literalsState, matchState, offsetState fseState
+		addExtraBits                           = func(s sequence, c codes) {
+			w.add(uint64(s.literals-literalsLengthBaselines[c.literals]), literalsLengthBits[c.literals])
+			w.add(uint64(s.match-matchLengthBaselines[c.match]), matchLengthBits[c.match])
+			w.add(uint64(s.offset+3-1<<c.offset), c.offset)
+		}
+		last = len(sequences) - 1
+	)
+
+	// the sequences are written in the reverse order, since the bitstream is read backward
+	matchState.init(matchLengthTable, all[last].match)
+	offsetState.init(offsetTable, all[last].offset)
+	literalsState.init(literalsLengthTable, all[last].literals)
+	addExtraBits(sequences[last], all[last])
+
+	for i := last - 1; i >= 0; i-- {
+		offsetState.encode(&w, all[i].offset)
+		matchState.encode(&w, all[i].match)
+		literalsState.encode(&w, all[i].literals)
+		addExtraBits(sequences[i], all[i])
+	}
+
+	matchState.flush(&w)
+	offsetState.flush(&w)
+	literalsState.flush(&w)
+
+	return w.close()
+}
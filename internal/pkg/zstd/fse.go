@@ -0,0 +1,206 @@
+package zstd
+
+// Predefined FSE distributions (RFC 8878, section 3.1.1.3.2.2), the encoder uses them only, so the tables are not
+// written into the blocks.
+var (
+	literalsLengthDistribution = [...]int16{ //nolint:gochecknoglobals
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}
+	matchLengthDistribution = [...]int16{ //nolint:gochecknoglobals
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1, -1, -1,
+	}
+	offsetDistribution = [...]int16{ //nolint:gochecknoglobals
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}
+)
+
+// Accuracy logs of the predefined distributions.
+const (
+	literalsLengthLog = 6
+	matchLengthLog    = 6
+	offsetLog         = 5
+)
+
+// Literals length and match length codes baselines and extra bits (RFC 8878, section 3.1.1.3.2.1.1).
+var (
+	literalsLengthBaselines = [...]uint32{ //nolint:gochecknoglobals
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512,
+		1024, 2048, 4096, 8192, 16384, 32768, 65536,
+	}
+	literalsLengthBits = [...]uint8{ //nolint:gochecknoglobals
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16,
+	}
+	matchLengthBaselines = [...]uint32{ //nolint:gochecknoglobals
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32,
+		33, 34, 35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051, 4099, 8195, 16387, 32771, 65539,
+	}
+	matchLengthBits = [...]uint8{ //nolint:gochecknoglobals
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2,
+		3, 3, 4, 4, 5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
+	}
+)
+
+// Encoding tables for the predefined distributions (they are read-only, so they are shared by all the writers).
+var (
+	literalsLengthTable = newFSETable(literalsLengthDistribution[:], literalsLengthLog) //nolint:gochecknoglobals
+	matchLengthTable    = newFSETable(matchLengthDistribution[:], matchLengthLog)       //nolint:gochecknoglobals
+	offsetTable         = newFSETable(offsetDistribution[:], offsetLog)                 //nolint:gochecknoglobals
+)
+
+// code returns the code for the value using the code baselines.
+func code(baselines []uint32, value uint32) uint8 {
+	var c = len(baselines) - 1
+
+	for baselines[c] > value {
+		c--
+	}
+
+	return uint8(c)
+}
+
+// symbolTransform is the FSE symbol encoding transform.
+type symbolTransform struct {
+	deltaNbBits    uint32
+	deltaFindState int32
+}
+
+// fseTable is the FSE (tANS) encoding table.
+type fseTable struct {
+	log     uint8
+	states  []uint16
+	symbols []symbolTransform
+}
+
+// newFSETable builds the encoding table for the normalized distribution (-1 means "less than 1" probability). The
+// symbols are spread the same way as the decoders do it.
+func newFSETable(distribution []int16, log uint8) *fseTable {
+	var (
+		size          = 1 << log
+		highThreshold = size - 1
+		symbols       = make([]uint8, size)
+		cumulative    = make([]int, len(distribution)+1)
+		t             = &fseTable{log: log, states: make([]uint16, size), symbols: make([]symbolTransform, len(distribution))}
+	)
+
+	for s, p := range distribution {
+		if p == -1 { // "less than 1" probability symbols are placed at the end of the table
+			cumulative[s+1] = cumulative[s] + 1
+			symbols[highThreshold] = uint8(s)
+			highThreshold--
+		} else {
+			cumulative[s+1] = cumulative[s] + int(p)
+		}
+	}
+
+	var step, position = (size >> 1) + (size >> 3) + 3, 0 //nolint:gomnd
+
+	for s, p := range distribution {
+		for i := 0; i < int(p); i++ {
+			symbols[position] = uint8(s)
+
+			for position = (position + step) & (size - 1); position > highThreshold; {
+				position = (position + step) & (size - 1)
+			}
+		}
+	}
+
+	for u := 0; u < size; u++ {
+		s := symbols[u]
+		t.states[cumulative[s]] = uint16(size + u)
+		cumulative[s]++
+	}
+
+	var total int32
+
+	for s, p := range distribution {
+		switch {
+		case p == 0:
+			continue
+
+		case p == -1 || p == 1:
+			t.symbols[s] = symbolTransform{deltaNbBits: uint32(log)<<16 - uint32(size), deltaFindState: total - 1}
+			total++
+
+		default:
+			maxBitsOut := uint32(log) - highBit(uint32(p-1))
+			t.symbols[s] = symbolTransform{deltaNbBits: maxBitsOut<<16 - uint32(p)<<maxBitsOut, deltaFindState: total - int32(p)}
+			total += int32(p)
+		}
+	}
+
+	return t
+}
+
+// highBit returns the index of the highest set bit (zero for zero).
+func highBit(v uint32) uint32 {
+	var n uint32
+
+	for v >>= 1; v > 0; v >>= 1 {
+		n++
+	}
+
+	return n
+}
+
+// fseState is the FSE encoder state.
+type fseState struct {
+	value uint32
+	table *fseTable
+}
+
+// init initializes the state with the first (the last in the sequences order) symbol.
+func (s *fseState) init(t *fseTable, symbol uint8) {
+	var (
+		tt        = t.symbols[symbol]
+		nbBitsOut = (tt.deltaNbBits + 1<<15) >> 16 //nolint:gomnd
+		value     = nbBitsOut<<16 - tt.deltaNbBits
+	)
+
+	s.table = t
+	s.value = uint32(t.states[int32(value>>nbBitsOut)+tt.deltaFindState])
+}
+
+// encode writes the state bits and moves the state to the symbol.
+func (s *fseState) encode(w *bitWriter, symbol uint8) {
+	var (
+		tt        = s.table.symbols[symbol]
+		nbBitsOut = (s.value + tt.deltaNbBits) >> 16 //nolint:gomnd
+	)
+
+	w.add(uint64(s.value), uint8(nbBitsOut))
+	s.value = uint32(s.table.states[int32(s.value>>nbBitsOut)+tt.deltaFindState])
+}
+
+// flush writes the final state.
+func (s *fseState) flush(w *bitWriter) { w.add(uint64(s.value), s.table.log) }
+
+// bitWriter writes the little-endian bitstream, that is read backward by the decoders.
+type bitWriter struct {
+	out   []byte
+	bits  uint64
+	count uint8
+}
+
+func (w *bitWriter) add(value uint64, n uint8) {
+	w.bits |= (value & (1<<n - 1)) << w.count
+	w.count += n
+
+	for ; w.count >= 8; w.count -= 8 { //nolint:gomnd
+		w.out = append(w.out, byte(w.bits))
+		w.bits >>= 8
+	}
+}
+
+// close writes the end mark (the highest set bit of the last byte) and the remaining bits.
+func (w *bitWriter) close() []byte {
+	w.add(1, 1)
+
+	if w.count > 0 {
+		w.out = append(w.out, byte(w.bits))
+	}
+
+	return w.out
+}
@@ -0,0 +1,184 @@
+// Package zstd contains the Zstandard (RFC 8878) stream encoder. It is intended for the on-the-fly HTTP responses
+// compression: the matches are found by a single hash table lookup (greedy parsing), the literals are not entropy
+// coded, and the sequences are coded using the predefined FSE distributions. So the compression ratio is lower, than
+// the reference implementation provides, but the encoder is fast, and its output is decoded by any decoder.
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	magicNumber  = 0xFD2FB528
+	windowLog    = 17
+	windowSize   = 1 << windowLog
+	maxBlockSize = 1 << 17 // 128 KiB (the format limit)
+	minMatch     = 4
+	hashLog      = 14
+)
+
+// frameHeader is the frame header: magic number, frame header descriptor (content checksum flag only, the content
+// size is unknown) and the window descriptor.
+var frameHeader = []byte{ //nolint:gochecknoglobals
+	magicNumber & 0xff, magicNumber >> 8 & 0xff, magicNumber >> 16 & 0xff, magicNumber >> 24,
+	1 << 2, (windowLog - 10) << 3,
+}
+
+// Writer is the Zstandard stream encoder. It writes a single frame with the content checksum.
+type Writer struct {
+	w       io.Writer
+	history []byte // window data (for the matches) and pending (not encoded yet) data
+	pending int    // pending data offset in the history
+	table   [1 << hashLog]int32
+	digest  *xxhash.Digest
+	block   []byte
+	started bool
+	closed  bool
+	err     error
+}
+
+// ErrClosed is returned, when the closed writer is used.
+var ErrClosed = errors.New("zstd: writer is closed")
+
+// NewWriter creates a new Writer. Written data is buffered, use Flush to encode it immediately, and Close to finish
+// the frame.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, digest: xxhash.New(), history: make([]byte, 0, windowSize+maxBlockSize)}
+}
+
+// Write buffers the data, and encodes it by the blocks of the maximal size.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	var written int
+
+	for len(p) > 0 {
+		n := maxBlockSize - (len(w.history) - w.pending)
+		if n > len(p) {
+			n = len(p)
+		}
+
+		w.history = append(w.history, p[:n]...)
+		p, written = p[n:], written+n
+
+		if len(w.history)-w.pending == maxBlockSize {
+			if err := w.encodeBlock(false); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// Flush encodes the pending data, so it can be decoded by the receiver.
+func (w *Writer) Flush() error {
+	if w.closed {
+		return ErrClosed
+	}
+
+	if len(w.history) == w.pending {
+		return w.err
+	}
+
+	return w.encodeBlock(false)
+}
+
+// Close encodes the pending data and finishes the frame. The underlying writer is not closed.
+func (w *Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+
+	if err := w.encodeBlock(true); err != nil {
+		return err
+	}
+
+	w.closed = true
+
+	var checksum [4]byte
+
+	binary.LittleEndian.PutUint32(checksum[:], uint32(w.digest.Sum64()))
+
+	return w.write(checksum[:])
+}
+
+// Reset discards the writer state and makes it write a new frame into the w.
+func (w *Writer) Reset(dst io.Writer) {
+	w.w, w.history, w.pending, w.started, w.closed, w.err = dst, w.history[:0], 0, false, false, nil
+	w.table = [1 << hashLog]int32{}
+	w.digest.Reset()
+}
+
+func (w *Writer) write(p []byte) error {
+	if w.err == nil {
+		_, w.err = w.w.Write(p)
+	}
+
+	return w.err
+}
+
+// encodeBlock encodes the pending data as a single block (compressed or raw, when the compression is useless).
+func (w *Writer) encodeBlock(last bool) error {
+	if !w.started {
+		w.started = true
+
+		if err := w.write(frameHeader); err != nil {
+			return err
+		}
+	}
+
+	var data = w.history[w.pending:]
+
+	_, _ = w.digest.Write(data)
+
+	var blockType uint32 = 2 // compressed
+
+	w.block = w.compress(w.block[:0])
+
+	if len(w.block) >= len(data) {
+		blockType, w.block = 0, append(w.block[:0], data...) // raw
+	}
+
+	var header = uint32(len(w.block))<<3 | blockType<<1
+
+	if last {
+		header |= 1
+	}
+
+	if err := w.write([]byte{byte(header), byte(header >> 8), byte(header >> 16)}); err != nil { //nolint:gomnd
+		return err
+	}
+
+	if err := w.write(w.block); err != nil {
+		return err
+	}
+
+	w.pending = len(w.history)
+
+	if keep := windowSize; w.pending > keep && len(w.history)+maxBlockSize > cap(w.history) {
+		w.slide(w.pending - keep)
+	}
+
+	return nil
+}
+
+// slide drops the data, that is out of the window, from the history.
+func (w *Writer) slide(n int) {
+	w.history = w.history[:copy(w.history, w.history[n:])]
+	w.pending -= n
+
+	for i, pos := range w.table {
+		if pos -= int32(n); pos < 0 {
+			pos = 0 // the position is lost (zero means "empty")
+		}
+
+		w.table[i] = pos
+	}
+}
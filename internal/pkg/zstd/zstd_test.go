@@ -0,0 +1,516 @@
+package zstd_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tarampampam/http-proxy-daemon/internal/pkg/zstd"
+)
+
+func encode(t *testing.T, data []byte, chunkSize int, flush bool) []byte {
+	t.Helper()
+
+	var (
+		buf bytes.Buffer
+		w   = zstd.NewWriter(&buf)
+	)
+
+	for len(data) > 0 {
+		n := chunkSize
+		if n > len(data) {
+			n = len(data)
+		}
+
+		written, err := w.Write(data[:n])
+		assert.NoError(t, err)
+		assert.Equal(t, n, written)
+
+		if flush {
+			assert.NoError(t, w.Flush())
+		}
+
+		data = data[n:]
+	}
+
+	assert.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestWriter(t *testing.T) {
+	var (
+		rnd  = make([]byte, 200000)
+		json = []byte(strings.Repeat(`{"id":1,"name":"foo","tags":["bar","baz"],"active":true},`, 10000))
+	)
+
+	rand.New(rand.NewSource(1)).Read(rnd) //nolint:gosec
+
+	for _, tt := range []struct {
+		name          string
+		giveData      []byte
+		giveChunkSize int
+		giveFlush     bool
+		wantSmaller   bool
+	}{
+		{name: "empty", giveData: []byte{}, giveChunkSize: 1},
+		{name: "short", giveData: []byte("foo"), giveChunkSize: 1},
+		{name: "json", giveData: json, giveChunkSize: 32 * 1024, wantSmaller: true},
+		{name: "json with flushes", giveData: json, giveChunkSize: 1000, giveFlush: true, wantSmaller: true},
+		{name: "random", giveData: rnd, giveChunkSize: 64 * 1024},
+		{name: "zeros", giveData: make([]byte, 1<<20), giveChunkSize: 100000, wantSmaller: true},
+		{name: "mixed", giveData: append(rnd[:50000:50000], json...), giveChunkSize: 4096, giveFlush: true},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encode(t, tt.giveData, tt.giveChunkSize, tt.giveFlush)
+
+			assert.Equal(t, []byte{0x28, 0xb5, 0x2f, 0xfd}, encoded[:4]) // magic number
+
+			if tt.wantSmaller {
+				assert.Less(t, len(encoded), len(tt.giveData)/4)
+			}
+
+			assert.True(t, bytes.Equal(tt.giveData, decode(t, encoded)))
+
+			if decoded, ok := referenceDecode(t, encoded); ok {
+				assert.True(t, bytes.Equal(tt.giveData, decoded))
+			}
+		})
+	}
+}
+
+func FuzzWriter(f *testing.F) {
+	f.Add([]byte("foo"), uint16(1), false)
+	f.Add([]byte(strings.Repeat(`{"foo":"bar"},`, 100)), uint16(100), true)
+	f.Add(make([]byte, 10000), uint16(4096), false)
+
+	f.Fuzz(func(t *testing.T, data []byte, chunkSize uint16, flush bool) {
+		encoded := encode(t, data, int(chunkSize)+1, flush)
+
+		assert.True(t, bytes.Equal(data, decode(t, encoded)))
+
+		if decoded, ok := referenceDecode(t, encoded); ok {
+			assert.True(t, bytes.Equal(data, decoded))
+		}
+	})
+}
+
+// referenceDecode decodes the frame using the reference implementation (the zstd binary). False is returned, when the
+// binary is not available (it is required on CI, so the check is never skipped there).
+func referenceDecode(t *testing.T, frame []byte) ([]byte, bool) {
+	t.Helper()
+
+	if _, err := exec.LookPath("zstd"); err != nil {
+		if os.Getenv("CI") != "" {
+			t.Fatal("zstd binary is required on CI for the reference implementation check")
+		}
+
+		return nil, false
+	}
+
+	cmd := exec.Command("zstd", "--decompress", "--stdout") //nolint:gosec
+	cmd.Stdin = bytes.NewReader(frame)
+
+	decoded, err := cmd.Output()
+	assert.NoError(t, err)
+
+	return decoded, true
+}
+
+func TestWriter_Flush(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		w   = zstd.NewWriter(&buf)
+	)
+
+	_, _ = w.Write([]byte("foo"))
+	assert.Zero(t, buf.Len()) // buffered
+
+	assert.NoError(t, w.Flush())
+	assert.NotZero(t, buf.Len())
+
+	var size = buf.Len()
+
+	assert.NoError(t, w.Flush()) // nothing to flush
+	assert.Equal(t, size, buf.Len())
+}
+
+func TestWriter_Close(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		w   = zstd.NewWriter(&buf)
+	)
+
+	assert.NoError(t, w.Close())
+	assert.NoError(t, w.Close())
+
+	_, err := w.Write([]byte("foo"))
+	assert.ErrorIs(t, err, zstd.ErrClosed)
+	assert.ErrorIs(t, w.Flush(), zstd.ErrClosed)
+
+	var encoded = append([]byte{}, buf.Bytes()...)
+
+	buf.Reset()
+	w.Reset(&buf)
+
+	assert.NoError(t, w.Close())
+	assert.Equal(t, encoded, buf.Bytes()) // the same empty frame
+}
+
+// decode is the test-only decoder of the frames, written by the Writer (the single frame with the raw or compressed
+// blocks, raw or RLE literals and the predefined FSE distributions of the sequences), implemented by RFC 8878. So the
+// encoded data is checked even without the reference implementation.
+func decode(t *testing.T, frame []byte) []byte {
+	t.Helper()
+
+	out, err := decodeFrame(frame)
+	assert.NoError(t, err)
+
+	return out
+}
+
+func decodeFrame(frame []byte) ([]byte, error) {
+	if len(frame) < 6 || binary.LittleEndian.Uint32(frame) != 0xFD2FB528 {
+		return nil, errors.New("wrong magic number")
+	}
+
+	var descriptor = frame[4]
+
+	if descriptor&0b11 != 0 || descriptor>>6 != 0 || descriptor&(1<<5) != 0 {
+		return nil, errors.New("dictionary, content size and single segment are not supported")
+	}
+
+	var (
+		checksum = descriptor&(1<<2) != 0
+		data     = frame[6:] // magic number, frame header descriptor and window descriptor
+		out      []byte
+		repeats  = [3]int{1, 4, 8}
+	)
+
+	for last := false; !last; {
+		if len(data) < 3 {
+			return nil, errors.New("truncated block header")
+		}
+
+		var header = int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+
+		last, data = header&1 == 1, data[3:]
+
+		var size = header >> 3
+
+		if size > len(data) {
+			return nil, errors.New("truncated block")
+		}
+
+		switch blockType := header >> 1 & 0b11; blockType {
+		case 0: // raw
+			out = append(out, data[:size]...)
+
+		case 2: // compressed
+			var err error
+
+			if out, err = decodeBlock(out, data[:size], &repeats); err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, fmt.Errorf("unsupported block type %d", blockType)
+		}
+
+		data = data[size:]
+	}
+
+	if checksum {
+		if len(data) < 4 || binary.LittleEndian.Uint32(data) != uint32(xxhash.Sum64(out)) {
+			return nil, errors.New("wrong content checksum")
+		}
+
+		data = data[4:]
+	}
+
+	if len(data) != 0 {
+		return nil, errors.New("unexpected data after the frame")
+	}
+
+	return out, nil
+}
+
+func decodeBlock(out, block []byte, repeats *[3]int) ([]byte, error) {
+	literals, block, err := decodeLiterals(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(block) == 0 {
+		return nil, errors.New("missing sequences section")
+	}
+
+	var count int
+
+	switch b0 := int(block[0]); {
+	case b0 < 128:
+		count, block = b0, block[1:]
+	case b0 < 255 && len(block) >= 2:
+		count, block = (b0-128)<<8+int(block[1]), block[2:]
+	case len(block) >= 3:
+		count, block = int(block[1])+int(block[2])<<8+0x7F00, block[3:]
+	default:
+		return nil, errors.New("truncated sequences section header")
+	}
+
+	if count == 0 {
+		return append(out, literals...), nil
+	}
+
+	if len(block) < 2 || block[0] != 0 {
+		return nil, errors.New("only the predefined distributions are supported")
+	}
+
+	var (
+		stream                    = newBackwardReader(block[1:])
+		llTable, ofTable, mlTable = testDecodingTables()
+		llState, ofState, mlState = stream.read(6), stream.read(5), stream.read(6)
+		literalsPos               int
+	)
+
+	for i := 0; i < count; i++ {
+		var (
+			ofCode = ofTable[ofState].symbol
+			mlCode = mlTable[mlState].symbol
+			llCode = llTable[llState].symbol
+
+			offsetValue = 1<<ofCode + stream.read(ofCode)
+			matchLength = int(testMatchLengthBaselines[mlCode]) + stream.read(testMatchLengthBits[mlCode])
+			litLength   = int(testLiteralsLengthBaselines[llCode]) + stream.read(testLiteralsLengthBits[llCode])
+			offset      int
+		)
+
+		if offsetValue > 3 {
+			offset = offsetValue - 3
+			repeats[0], repeats[1], repeats[2] = offset, repeats[0], repeats[1]
+		} else {
+			if litLength == 0 {
+				offsetValue++
+			}
+
+			switch offsetValue {
+			case 1:
+				offset = repeats[0]
+			case 2:
+				offset = repeats[1]
+				repeats[0], repeats[1] = repeats[1], repeats[0]
+			case 3:
+				offset = repeats[2]
+				repeats[0], repeats[1], repeats[2] = repeats[2], repeats[0], repeats[1]
+			default:
+				offset = repeats[0] - 1
+				repeats[0], repeats[1], repeats[2] = offset, repeats[0], repeats[1]
+			}
+		}
+
+		if literalsPos+litLength > len(literals) {
+			return nil, errors.New("literals length is out of the literals section")
+		}
+
+		out = append(out, literals[literalsPos:literalsPos+litLength]...)
+		literalsPos += litLength
+
+		if offset <= 0 || offset > len(out) {
+			return nil, fmt.Errorf("wrong offset %d", offset)
+		}
+
+		for j := 0; j < matchLength; j++ { // the match can overlap the copied data
+			out = append(out, out[len(out)-offset])
+		}
+
+		if i < count-1 { // the states are not updated after the last sequence
+			llState = llTable[llState].baseline + stream.read(llTable[llState].bits)
+			mlState = mlTable[mlState].baseline + stream.read(mlTable[mlState].bits)
+			ofState = ofTable[ofState].baseline + stream.read(ofTable[ofState].bits)
+		}
+	}
+
+	if stream.err != nil || stream.pos != 0 {
+		return nil, errors.New("corrupted sequences bitstream")
+	}
+
+	return append(out, literals[literalsPos:]...), nil
+}
+
+func decodeLiterals(block []byte) (literals, rest []byte, _ error) {
+	if len(block) == 0 {
+		return nil, nil, errors.New("missing literals section")
+	}
+
+	var (
+		literalsType = block[0] & 0b11
+		size, header int
+	)
+
+	switch block[0] >> 2 & 0b11 {
+	case 0, 2:
+		size, header = int(block[0]>>3), 1
+	case 1:
+		if len(block) < 2 {
+			return nil, nil, errors.New("truncated literals section header")
+		}
+
+		size, header = int(block[0]>>4)+int(block[1])<<4, 2
+	default:
+		if len(block) < 3 {
+			return nil, nil, errors.New("truncated literals section header")
+		}
+
+		size, header = int(block[0]>>4)+int(block[1])<<4+int(block[2])<<12, 3
+	}
+
+	block = block[header:]
+
+	switch literalsType {
+	case 0: // raw
+		if size > len(block) {
+			return nil, nil, errors.New("truncated literals")
+		}
+
+		return block[:size], block[size:], nil
+
+	case 1: // RLE
+		if len(block) == 0 {
+			return nil, nil, errors.New("truncated literals")
+		}
+
+		return bytes.Repeat(block[:1], size), block[1:], nil
+
+	default:
+		return nil, nil, errors.New("compressed literals are not supported")
+	}
+}
+
+// backwardReader reads the bitstream from the end (the highest set bit of the last byte is the end mark).
+type backwardReader struct {
+	data []byte
+	pos  int // count of the unread bits
+	err  error
+}
+
+func newBackwardReader(data []byte) *backwardReader {
+	var r = &backwardReader{data: data}
+
+	if last := data[len(data)-1]; last == 0 {
+		r.err = errors.New("missing end mark")
+	} else {
+		r.pos = (len(data)-1)*8 + bits.Len8(last) - 1
+	}
+
+	return r
+}
+
+func (r *backwardReader) read(n int) int {
+	if r.pos < n {
+		r.err, r.pos = errors.New("bitstream overflow"), 0
+
+		return 0
+	}
+
+	var value int
+
+	for i := 0; i < n; i++ {
+		r.pos--
+		value = value<<1 | int(r.data[r.pos/8]>>(r.pos%8)&1)
+	}
+
+	return value
+}
+
+// decodingEntry is the FSE decoding table entry.
+type decodingEntry struct {
+	symbol, bits, baseline int
+}
+
+// buildDecodingTable builds the FSE decoding table for the normalized distribution (RFC 8878, section 4.1.1).
+func buildDecodingTable(distribution []int, log int) []decodingEntry {
+	var (
+		size          = 1 << log
+		table         = make([]decodingEntry, size)
+		highThreshold = size - 1
+		next          = make([]int, len(distribution))
+	)
+
+	for s, p := range distribution {
+		if p == -1 {
+			table[highThreshold].symbol = s
+			highThreshold--
+			next[s] = 1
+		} else {
+			next[s] = p
+		}
+	}
+
+	var step, position = size>>1 + size>>3 + 3, 0
+
+	for s, p := range distribution {
+		for i := 0; i < p; i++ {
+			table[position].symbol = s
+
+			for position = (position + step) & (size - 1); position > highThreshold; {
+				position = (position + step) & (size - 1)
+			}
+		}
+	}
+
+	for u := range table {
+		state := next[table[u].symbol]
+		next[table[u].symbol]++
+
+		table[u].bits = log - (bits.Len(uint(state)) - 1)
+		table[u].baseline = state<<table[u].bits - size
+	}
+
+	return table
+}
+
+// testDecodingTables returns the decoding tables of the predefined distributions (RFC 8878, section 3.1.1.3.2.2).
+func testDecodingTables() (literalsLength, offset, matchLength []decodingEntry) {
+	return buildDecodingTable([]int{
+			4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+			-1, -1, -1, -1,
+		}, 6),
+		buildDecodingTable([]int{
+			1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+		}, 5),
+		buildDecodingTable([]int{
+			1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+			1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1, -1, -1,
+		}, 6)
+}
+
+// Literals length and match length codes baselines and extra bits (RFC 8878, section 3.1.1.3.2.1.1).
+var (
+	testLiteralsLengthBaselines = [...]int{ //nolint:gochecknoglobals
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512,
+		1024, 2048, 4096, 8192, 16384, 32768, 65536,
+	}
+	testLiteralsLengthBits = [...]int{ //nolint:gochecknoglobals
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16,
+	}
+	testMatchLengthBaselines = [...]int{ //nolint:gochecknoglobals
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32,
+		33, 34, 35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051, 4099, 8195, 16387, 32771, 65539,
+	}
+	testMatchLengthBits = [...]int{ //nolint:gochecknoglobals
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2,
+		3, 3, 4, 4, 5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
+	}
+)